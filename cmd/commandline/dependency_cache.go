@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+
+	"github.com/langgenius/dify-plugin-daemon/cmd/commandline/dependency_cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dependencyCacheStatsCommand = &cobra.Command{
+		Use:   "stats [cache_path]",
+		Short: "Show cache size",
+		Long:  "Show the size of the dependency cache and how much of it no plugin references",
+		Args:  cobra.ExactArgs(1),
+		Run: func(c *cobra.Command, args []string) {
+			if _, err := os.Stat(args[0]); err != nil {
+				log.Error("dependency cache not found: %v", err)
+				os.Exit(1)
+			}
+			if err := dependency_cache.Stats(args[0]); err != nil {
+				os.Exit(1)
+			}
+		},
+	}
+
+	dependencyCachePruneCommand = &cobra.Command{
+		Use:   "prune [cache_path]",
+		Short: "Prune cache",
+		Long:  "Remove the entries of the dependency cache no plugin references",
+		Args:  cobra.ExactArgs(1),
+		Run: func(c *cobra.Command, args []string) {
+			if _, err := os.Stat(args[0]); err != nil {
+				log.Error("dependency cache not found: %v", err)
+				os.Exit(1)
+			}
+			if err := dependency_cache.Prune(args[0]); err != nil {
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	dependencyCacheCommand.AddCommand(dependencyCacheStatsCommand)
+	dependencyCacheCommand.AddCommand(dependencyCachePruneCommand)
+}
@@ -0,0 +1,45 @@
+package dependency_cache
+
+import (
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/dependency_cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+)
+
+// Stats prints the size of a dependency cache, it must be run on the node owning the cache
+func Stats(cachePath string) error {
+	cache, err := dependency_cache.NewCache(cachePath)
+	if err != nil {
+		log.Error("failed to open dependency cache: %v", err)
+		return err
+	}
+
+	stats, err := cache.Stats()
+	if err != nil {
+		log.Error("failed to get dependency cache stats: %v", err)
+		return err
+	}
+
+	log.Info(
+		"dependency cache %s: %d bytes, %d entries, %d entries (%d bytes) not referenced by any plugin",
+		stats.Path, stats.Size, stats.Entries, stats.UnreferencedEntries, stats.UnreferencedSize,
+	)
+	return nil
+}
+
+// Prune removes the entries of a dependency cache no plugin references
+func Prune(cachePath string) error {
+	cache, err := dependency_cache.NewCache(cachePath)
+	if err != nil {
+		log.Error("failed to open dependency cache: %v", err)
+		return err
+	}
+
+	result, err := cache.Prune()
+	if err != nil {
+		log.Error("failed to prune dependency cache: %v", err)
+		return err
+	}
+
+	log.Info("dependency cache pruned, %d entries removed, %d bytes reclaimed", result.RemovedEntries, result.ReclaimedSize)
+	return nil
+}
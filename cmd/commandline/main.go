@@ -35,6 +35,12 @@ var (
 		Long:  "Signature related commands",
 	}
 
+	dependencyCacheCommand = &cobra.Command{
+		Use:   "dependency-cache",
+		Short: "Dependency cache",
+		Long:  "Manage the dependency cache shared by local plugins of a daemon node",
+	}
+
 	versionCommand = &cobra.Command{
 		Use:   "version",
 		Short: "Version",
@@ -52,6 +58,7 @@ func init() {
 	rootCommand.AddCommand(pluginCommand)
 	rootCommand.AddCommand(bundleCommand)
 	rootCommand.AddCommand(signatureCommand)
+	rootCommand.AddCommand(dependencyCacheCommand)
 	rootCommand.AddCommand(versionCommand)
 }
 
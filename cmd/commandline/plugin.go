@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 
 	"github.com/langgenius/dify-plugin-daemon/cmd/commandline/plugin"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/packager"
 	"github.com/spf13/cobra"
 )
 
@@ -30,6 +31,9 @@ var (
 	language                 string
 	minDifyVersion           string
 	quick                    bool
+	withWheelhouse           bool
+	wheelhousePython         string
+	wheelhouseIndexUrl       string
 
 	pluginInitCommand = &cobra.Command{
 		Use:   "init",
@@ -95,7 +99,31 @@ If no parameters are provided, an interactive mode will be started.`,
 				outputPath = base + ".difypkg"
 			}
 
-			plugin.PackagePlugin(inputPath, outputPath)
+			var wheelhouse *packager.WheelhouseOptions
+			if withWheelhouse {
+				wheelhouse = &packager.WheelhouseOptions{
+					PythonInterpreter: wheelhousePython,
+					IndexUrl:          wheelhouseIndexUrl,
+				}
+			}
+
+			plugin.PackagePlugin(inputPath, outputPath, wheelhouse)
+		},
+	}
+
+	pluginWheelsCommand = &cobra.Command{
+		Use:   "wheels",
+		Short: "Wheels",
+		Long:  "Manage python wheels vendored in packages for offline installation",
+	}
+
+	pluginWheelsAddCommand = &cobra.Command{
+		Use:   "add [difypkg_path] [wheel_or_directory...]",
+		Short: "Add wheels",
+		Long:  "Add wheels to an existing package, the package needs to be signed again afterwards",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			plugin.AddWheels(args[0], args[1:])
 		},
 	}
 
@@ -230,6 +258,8 @@ func init() {
 	pluginModuleAppendCommand.AddCommand(pluginModuleAppendToolsCommand)
 	pluginModuleAppendCommand.AddCommand(pluginModuleAppendEndpointsCommand)
 	pluginReadmeCommand.AddCommand(pluginReadmeListCommand)
+	pluginCommand.AddCommand(pluginWheelsCommand)
+	pluginWheelsCommand.AddCommand(pluginWheelsAddCommand)
 
 	pluginInitCommand.Flags().StringVar(&author, "author", "", "Author name (1-64 characters, lowercase letters, numbers, dashes and underscores only)")
 	pluginInitCommand.Flags().StringVar(&name, "name", "", "Plugin name (1-128 characters, lowercase letters, numbers, dashes and underscores only)")
@@ -259,9 +289,14 @@ func init() {
   - extension: Extension plugin
   - agent-strategy: Agent strategy plugin`)
 	pluginInitCommand.Flags().StringVar(&language, "language", "", `Programming language. Available options:
-  - python: Python language`)
+  - python: Python language
+  - nodejs: Node.js language, only tool plugins are supported
+  - go: Go language, only tool plugins are supported`)
 	pluginInitCommand.Flags().StringVar(&minDifyVersion, "min-dify-version", "", "Minimum Dify version required")
 	pluginInitCommand.Flags().BoolVar(&quick, "quick", false, "Skip interactive mode and create plugin directly")
 
 	pluginPackageCommand.Flags().StringP("output_path", "o", "", "output path")
+	pluginPackageCommand.Flags().BoolVar(&withWheelhouse, "wheelhouse", false, "Vendor wheels of requirements.txt for the declared arches, enables offline installation")
+	pluginPackageCommand.Flags().StringVar(&wheelhousePython, "wheelhouse-python", "python3", "Python interpreter used to download wheels")
+	pluginPackageCommand.Flags().StringVar(&wheelhouseIndexUrl, "wheelhouse-index-url", "", "Package index used to download wheels")
 }
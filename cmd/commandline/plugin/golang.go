@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	_ "embed"
+	"fmt"
+	"path/filepath"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+//go:embed templates/go/main.go.tmpl
+var GO_ENTRYPOINT_TEMPLATE []byte
+
+//go:embed templates/go/tool.go.tmpl
+var GO_TOOL_TEMPLATE []byte
+
+//go:embed templates/go/go.mod.tmpl
+var GO_MOD_TEMPLATE []byte
+
+//go:embed templates/go/tool.yaml
+var GO_TOOL_MANIFEST_TEMPLATE []byte
+
+//go:embed templates/go/tool_provider.yaml
+var GO_TOOL_PROVIDER_MANIFEST_TEMPLATE []byte
+
+//go:embed templates/go/GUIDE.md
+var GO_GUIDE []byte
+
+//go:embed templates/go/.difyignore
+var GO_DIFYIGNORE []byte
+
+//go:embed templates/go/.gitignore
+var GO_GITIGNORE []byte
+
+func createGoEnvironment(
+	root string, manifest *plugin_entities.PluginDeclaration, category string,
+) error {
+	if category != "tool" {
+		return fmt.Errorf("the go template only supports tool plugins, got %s", category)
+	}
+
+	files := []struct {
+		path     string
+		template []byte
+	}{
+		{"GUIDE.md", GO_GUIDE},
+		{"main.go", GO_ENTRYPOINT_TEMPLATE},
+		{"tool.go", GO_TOOL_TEMPLATE},
+		{"go.mod", GO_MOD_TEMPLATE},
+		{filepath.Join("tools", fmt.Sprintf("%s.yaml", manifest.Name)), GO_TOOL_MANIFEST_TEMPLATE},
+		{filepath.Join("provider", fmt.Sprintf("%s.yaml", manifest.Name)), GO_TOOL_PROVIDER_MANIFEST_TEMPLATE},
+	}
+
+	for _, file := range files {
+		content, err := renderTemplate(file.template, manifest, []string{""})
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(root, file.path), content); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFile(filepath.Join(root, ".difyignore"), string(GO_DIFYIGNORE)); err != nil {
+		return err
+	}
+
+	if err := writeFile(filepath.Join(root, ".gitignore"), string(GO_GITIGNORE)); err != nil {
+		return err
+	}
+
+	return nil
+}
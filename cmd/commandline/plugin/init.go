@@ -129,6 +129,8 @@ func InitPluginWithFlags(
 	if languageStr != "" {
 		validLanguages := []string{
 			string(constants.Python),
+			string(constants.NodeJS),
+			string(constants.Go),
 			// Add more languages here if supported
 		}
 		valid := false
@@ -461,6 +463,15 @@ func (m model) createPlugin() {
 		manifest.Meta.Runner.Entrypoint = "main"
 		manifest.Meta.Runner.Language = constants.Python
 		manifest.Meta.Runner.Version = "3.12"
+	case constants.NodeJS:
+		manifest.Meta.Runner.Entrypoint = "main"
+		manifest.Meta.Runner.Language = constants.NodeJS
+		manifest.Meta.Runner.Version = "20"
+	case constants.Go:
+		// name of the binary, it's cross-compiled into bin/ while packaging
+		manifest.Meta.Runner.Entrypoint = "main"
+		manifest.Meta.Runner.Language = constants.Go
+		manifest.Meta.Runner.Version = "1.22"
 	default:
 		log.Error("unsupported language: %s", m.subMenus[SUB_MENU_KEY_LANGUAGE].(language).Language())
 		return
@@ -578,15 +589,39 @@ func (m model) createPlugin() {
 		return
 	}
 
-	err = createPythonEnvironment(
-		pluginDir,
-		manifest.Meta.Runner.Entrypoint,
-		manifest,
-		m.subMenus[SUB_MENU_KEY_CATEGORY].(category).Category(),
-	)
-	if err != nil {
-		log.Error("failed to create python environment: %s", err)
-		return
+	switch manifest.Meta.Runner.Language {
+	case constants.NodeJS:
+		err = createNodeJSEnvironment(
+			pluginDir,
+			manifest.Meta.Runner.Entrypoint,
+			manifest,
+			m.subMenus[SUB_MENU_KEY_CATEGORY].(category).Category(),
+		)
+		if err != nil {
+			log.Error("failed to create nodejs environment: %s", err)
+			return
+		}
+	case constants.Go:
+		err = createGoEnvironment(
+			pluginDir,
+			manifest,
+			m.subMenus[SUB_MENU_KEY_CATEGORY].(category).Category(),
+		)
+		if err != nil {
+			log.Error("failed to create go environment: %s", err)
+			return
+		}
+	default:
+		err = createPythonEnvironment(
+			pluginDir,
+			manifest.Meta.Runner.Entrypoint,
+			manifest,
+			m.subMenus[SUB_MENU_KEY_CATEGORY].(category).Category(),
+		)
+		if err != nil {
+			log.Error("failed to create python environment: %s", err)
+			return
+		}
 	}
 
 	success = true
@@ -353,3 +353,96 @@ func TestInitPluginWithFlagsValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestInitNodeJSPlugin(t *testing.T) {
+	tempDir := t.TempDir()
+
+	oldDir, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(oldDir)
+	assert.NoError(t, os.Chdir(tempDir))
+
+	InitPluginWithFlags(
+		"test-author",
+		"test-nodejs-tool",
+		"",
+		"Test nodejs tool",
+		false, true, false, false, false, false, false, false, false, false, false, false,
+		0,
+		"tool",
+		"nodejs",
+		"",
+		true,
+	)
+
+	for _, file := range []string{
+		"test-nodejs-tool/manifest.yaml",
+		"test-nodejs-tool/main.js",
+		"test-nodejs-tool/package.json",
+		"test-nodejs-tool/package-lock.json",
+		"test-nodejs-tool/tools/test-nodejs-tool.js",
+		"test-nodejs-tool/tools/test-nodejs-tool.yaml",
+		"test-nodejs-tool/provider/test-nodejs-tool.js",
+		"test-nodejs-tool/provider/test-nodejs-tool.yaml",
+		"test-nodejs-tool/.difyignore",
+	} {
+		_, err := os.Stat(file)
+		assert.NoError(t, err, "Expected file %s to exist", file)
+	}
+
+	decoder, err := decoder.NewFSPluginDecoder("test-nodejs-tool")
+	assert.NoError(t, err)
+	defer decoder.Close()
+
+	manifest, err := decoder.Manifest()
+	assert.NoError(t, err)
+	assert.Equal(t, "nodejs", string(manifest.Meta.Runner.Language))
+	assert.Equal(t, "main", manifest.Meta.Runner.Entrypoint)
+
+	// the tool is registered by its name in the entrypoint
+	main, err := os.ReadFile("test-nodejs-tool/main.js")
+	assert.NoError(t, err)
+	assert.Contains(t, string(main), `require("./tools/test-nodejs-tool")`)
+}
+
+func TestInitGoPlugin(t *testing.T) {
+	tempDir := t.TempDir()
+
+	oldDir, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(oldDir)
+	assert.NoError(t, os.Chdir(tempDir))
+
+	InitPluginWithFlags(
+		"test-author",
+		"test-go-tool",
+		"",
+		"Test go tool",
+		false, true, false, false, false, false, false, false, false, false, false, false,
+		0,
+		"tool",
+		"go",
+		"",
+		true,
+	)
+
+	for _, file := range []string{
+		"test-go-tool/manifest.yaml",
+		"test-go-tool/main.go",
+		"test-go-tool/tool.go",
+		"test-go-tool/go.mod",
+		"test-go-tool/tools/test-go-tool.yaml",
+		"test-go-tool/provider/test-go-tool.yaml",
+	} {
+		_, err := os.Stat(file)
+		assert.NoError(t, err, "Expected file %s to exist", file)
+	}
+
+	decoder, err := decoder.NewFSPluginDecoder("test-go-tool")
+	assert.NoError(t, err)
+	defer decoder.Close()
+
+	manifest, err := decoder.Manifest()
+	assert.NoError(t, err)
+	assert.Equal(t, "go", string(manifest.Meta.Runner.Language))
+}
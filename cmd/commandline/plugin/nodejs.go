@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	_ "embed"
+	"fmt"
+	"path/filepath"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+//go:embed templates/nodejs/main.js
+var NODEJS_ENTRYPOINT_TEMPLATE []byte
+
+//go:embed templates/nodejs/package.json
+var NODEJS_PACKAGE_JSON_TEMPLATE []byte
+
+//go:embed templates/nodejs/package-lock.json
+var NODEJS_PACKAGE_LOCK_TEMPLATE []byte
+
+//go:embed templates/nodejs/tool.js
+var NODEJS_TOOL_JS_TEMPLATE []byte
+
+//go:embed templates/nodejs/tool.yaml
+var NODEJS_TOOL_TEMPLATE []byte
+
+//go:embed templates/nodejs/tool_provider.js
+var NODEJS_TOOL_PROVIDER_JS_TEMPLATE []byte
+
+//go:embed templates/nodejs/tool_provider.yaml
+var NODEJS_TOOL_PROVIDER_TEMPLATE []byte
+
+//go:embed templates/nodejs/GUIDE.md
+var NODEJS_GUIDE []byte
+
+//go:embed templates/nodejs/.difyignore
+var NODEJS_DIFYIGNORE []byte
+
+//go:embed templates/nodejs/.gitignore
+var NODEJS_GITIGNORE []byte
+
+func createNodeJSEnvironment(
+	root string, entrypoint string, manifest *plugin_entities.PluginDeclaration, category string,
+) error {
+	if category != "tool" {
+		return fmt.Errorf("the nodejs template only supports tool plugins, got %s", category)
+	}
+
+	files := []struct {
+		path     string
+		template []byte
+	}{
+		{"GUIDE.md", NODEJS_GUIDE},
+		{fmt.Sprintf("%s.js", entrypoint), NODEJS_ENTRYPOINT_TEMPLATE},
+		{"package.json", NODEJS_PACKAGE_JSON_TEMPLATE},
+		{"package-lock.json", NODEJS_PACKAGE_LOCK_TEMPLATE},
+		{filepath.Join("tools", fmt.Sprintf("%s.js", manifest.Name)), NODEJS_TOOL_JS_TEMPLATE},
+		{filepath.Join("tools", fmt.Sprintf("%s.yaml", manifest.Name)), NODEJS_TOOL_TEMPLATE},
+		{filepath.Join("provider", fmt.Sprintf("%s.js", manifest.Name)), NODEJS_TOOL_PROVIDER_JS_TEMPLATE},
+		{filepath.Join("provider", fmt.Sprintf("%s.yaml", manifest.Name)), NODEJS_TOOL_PROVIDER_TEMPLATE},
+	}
+
+	for _, file := range files {
+		content, err := renderTemplate(file.template, manifest, []string{""})
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(root, file.path), content); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFile(filepath.Join(root, ".difyignore"), string(NODEJS_DIFYIGNORE)); err != nil {
+		return err
+	}
+
+	if err := writeFile(filepath.Join(root, ".gitignore"), string(NODEJS_GITIGNORE)); err != nil {
+		return err
+	}
+
+	return nil
+}
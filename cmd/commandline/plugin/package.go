@@ -2,8 +2,10 @@ package plugin
 
 import (
 	"os"
+	"path/filepath"
 
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
 	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/decoder"
 	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/packager"
 )
@@ -12,7 +14,10 @@ var (
 	MaxPluginPackageSize = int64(50 * 1024 * 1024) // 50 MB
 )
 
-func PackagePlugin(inputPath string, outputPath string) {
+// PackagePlugin packages the plugin, wheels of requirements.txt are vendored into
+// the package if wheelhouse is not nil, go plugins with a go.mod are cross-compiled
+// for the declared arches before packaging
+func PackagePlugin(inputPath string, outputPath string, wheelhouse *packager.WheelhouseOptions) {
 	decoder, err := decoder.NewFSPluginDecoder(inputPath)
 	if err != nil {
 		log.Error("failed to create plugin decoder , plugin path: %s, error: %v", inputPath, err)
@@ -20,6 +25,24 @@ func PackagePlugin(inputPath string, outputPath string) {
 		return
 	}
 
+	manifest, err := decoder.Manifest()
+	if err != nil {
+		log.Error("failed to read manifest: %v", err)
+		os.Exit(1)
+		return
+	}
+
+	if manifest.Meta.Runner.Language == constants.Go {
+		if _, err := os.Stat(filepath.Join(inputPath, "go.mod")); err == nil {
+			log.Info("building binaries for %v", manifest.Meta.Arch)
+			if err := packager.BuildGoBinaries(inputPath, &manifest, packager.GoBuildOptions{}); err != nil {
+				log.Error("failed to build binaries: %v", err)
+				os.Exit(1)
+				return
+			}
+		}
+	}
+
 	packager := packager.NewPackager(decoder)
 	zipFile, err := packager.Pack(MaxPluginPackageSize)
 
@@ -29,6 +52,15 @@ func PackagePlugin(inputPath string, outputPath string) {
 		return
 	}
 
+	if wheelhouse != nil {
+		zipFile, err = vendorWheels(packager, zipFile, *wheelhouse)
+		if err != nil {
+			log.Error("failed to vendor wheels: %v", err)
+			os.Exit(1)
+			return
+		}
+	}
+
 	err = os.WriteFile(outputPath, zipFile, 0644)
 	if err != nil {
 		log.Error("failed to write package file %v", err)
@@ -0,0 +1,85 @@
+// Minimal runner of the Dify plugin stdio protocol, every line of stdin is a
+// request of the plugin daemon, every line written to stdout is an event.
+const readline = require("readline");
+
+const tools = {};
+const providers = {};
+
+// register the tools and the provider of the plugin here
+tools["{{ .PluginName }}"] = require("./tools/{{ .PluginName }}");
+providers["{{ .PluginName }}"] = require("./provider/{{ .PluginName }}");
+
+function send(event) {
+  process.stdout.write(JSON.stringify(event) + "\n");
+}
+
+function sessionMessage(sessionId, type, data) {
+  send({ session_id: sessionId, event: "session", data: { type, data } });
+}
+
+function log(message, level = "INFO") {
+  send({ event: "log", data: { level, message, timestamp: Date.now() / 1000 } });
+}
+
+async function handle(request) {
+  const data = request.data || {};
+  switch (data.action) {
+    case "invoke_tool": {
+      const tool = tools[data.tool];
+      if (!tool) {
+        throw new Error(`tool ${data.tool} not found`);
+      }
+      for await (const chunk of tool.invoke(data.tool_parameters || {}, data.credentials || {})) {
+        sessionMessage(request.session_id, "stream", chunk);
+      }
+      return;
+    }
+    case "validate_tool_credentials": {
+      const provider = providers[data.provider];
+      if (!provider) {
+        throw new Error(`provider ${data.provider} not found`);
+      }
+      await provider.validateCredentials(data.credentials || {});
+      sessionMessage(request.session_id, "stream", { result: true });
+      return;
+    }
+    default:
+      throw new Error(`unsupported action: ${data.action}`);
+  }
+}
+
+const input = readline.createInterface({ input: process.stdin, terminal: false });
+
+input.on("line", (line) => {
+  if (!line.trim()) {
+    return;
+  }
+
+  let request;
+  try {
+    request = JSON.parse(line);
+  } catch (e) {
+    log(`invalid request: ${e.message}`, "ERROR");
+    return;
+  }
+
+  if (request.event !== "request") {
+    return;
+  }
+
+  handle(request)
+    .then(() => sessionMessage(request.session_id, "end", {}))
+    .catch((e) =>
+      sessionMessage(request.session_id, "error", {
+        error_type: e.name || "Error",
+        message: e.message,
+        args: {},
+      })
+    );
+});
+
+input.on("close", () => process.exit(0));
+
+// the plugin daemon restarts plugins which stop sending heartbeats
+send({ event: "heartbeat", data: {} });
+setInterval(() => send({ event: "heartbeat", data: {} }), 10000);
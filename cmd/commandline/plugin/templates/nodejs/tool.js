@@ -0,0 +1,7 @@
+// invoke yields tool response chunks, see GUIDE.md for all the chunk types
+async function* invoke(parameters, credentials) {
+  yield { type: "text", message: { text: `Hello, ${parameters.query}!` } };
+  yield { type: "json", message: { json_object: { query: parameters.query } } };
+}
+
+module.exports = { invoke };
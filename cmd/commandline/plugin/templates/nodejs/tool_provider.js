@@ -0,0 +1,4 @@
+// validateCredentials throws if the credentials of the provider are invalid
+async function validateCredentials(credentials) {}
+
+module.exports = { validateCredentials };
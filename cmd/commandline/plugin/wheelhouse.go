@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/packager"
+)
+
+func vendorWheels(p *packager.Packager, zipFile []byte, options packager.WheelhouseOptions) ([]byte, error) {
+	wheelhouse, err := os.MkdirTemp("", "dify-wheelhouse-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(wheelhouse)
+
+	log.Info("downloading wheels of requirements.txt, it may take a while")
+	if err := p.BuildWheelhouse(wheelhouse, options); err != nil {
+		return nil, err
+	}
+
+	wheels, err := packager.ReadWheelhouse(wheelhouse)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("vendoring %d wheels into the package", len(wheels))
+	return packager.AddWheels(zipFile, wheels, MaxPluginPackageSize)
+}
+
+// AddWheels adds wheel files, or all wheels of directories, to an existing package
+// the package is rewritten in place, signatures are dropped and it needs to be signed again
+func AddWheels(difypkgPath string, paths []string) {
+	plugin, err := os.ReadFile(difypkgPath)
+	if err != nil {
+		log.Error("failed to read plugin file: %v", err)
+		os.Exit(1)
+		return
+	}
+
+	wheels := map[string][]byte{}
+	for _, p := range paths {
+		stat, err := os.Stat(p)
+		if err != nil {
+			log.Error("failed to get file info, path: %s, error: %v", p, err)
+			os.Exit(1)
+			return
+		}
+
+		if stat.IsDir() {
+			dirWheels, err := packager.ReadWheelhouse(p)
+			if err != nil {
+				log.Error("failed to read wheels, path: %s, error: %v", p, err)
+				os.Exit(1)
+				return
+			}
+			for filename, content := range dirWheels {
+				wheels[filename] = content
+			}
+			continue
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			log.Error("failed to read wheel, path: %s, error: %v", p, err)
+			os.Exit(1)
+			return
+		}
+		wheels[filepath.Base(p)] = content
+	}
+
+	if len(wheels) == 0 {
+		log.Error("no wheels found")
+		os.Exit(1)
+		return
+	}
+
+	result, err := packager.AddWheels(plugin, wheels, MaxPluginPackageSize)
+	if err != nil {
+		log.Error("failed to add wheels: %v", err)
+		os.Exit(1)
+		return
+	}
+
+	if err := os.WriteFile(difypkgPath, result, 0644); err != nil {
+		log.Error("failed to write package file %v", err)
+		os.Exit(1)
+		return
+	}
+
+	log.Info(
+		"%d wheels added to %s, the package is unsigned now, sign it again with `dify signature sign` if needed",
+		len(wheels), difypkgPath,
+	)
+}
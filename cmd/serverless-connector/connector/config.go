@@ -0,0 +1,79 @@
+package connector
+
+import (
+	"fmt"
+)
+
+type RunnerMode string
+
+const (
+	// plugins run as python processes in their own virtual environments
+	RUNNER_MODE_PROCESS RunnerMode = "process"
+	// plugins are built into images and run as docker containers
+	RUNNER_MODE_CONTAINER RunnerMode = "container"
+)
+
+type Config struct {
+	Host   string `envconfig:"SERVERLESS_CONNECTOR_HOST"`
+	Port   uint16 `envconfig:"SERVERLESS_CONNECTOR_PORT"`
+	APIKey string `envconfig:"SERVERLESS_CONNECTOR_API_KEY"`
+
+	// the base url instances are reached at by the daemon, invokes are proxied to the plugins
+	PublicURL string `envconfig:"SERVERLESS_CONNECTOR_PUBLIC_URL"`
+
+	WorkingPath string     `envconfig:"SERVERLESS_CONNECTOR_WORKING_PATH"`
+	Mode        RunnerMode `envconfig:"SERVERLESS_CONNECTOR_MODE"`
+
+	PythonInterpreterPath string `envconfig:"PYTHON_INTERPRETER_PATH"`
+	DockerPath            string `envconfig:"SERVERLESS_CONNECTOR_DOCKER_PATH"`
+
+	// images built in container mode, the registry of base images is replaced by the mirror if set
+	ImageRegistryMirror string `envconfig:"SERVERLESS_IMAGE_REGISTRY_MIRROR"`
+	// file of dockerfile instructions appended to the images
+	ImageExtraBuildStepsPath string `envconfig:"SERVERLESS_IMAGE_EXTRA_BUILD_STEPS_PATH"`
+
+	BuildTimeout  int `envconfig:"SERVERLESS_CONNECTOR_BUILD_TIMEOUT"`  // in seconds
+	LaunchTimeout int `envconfig:"SERVERLESS_CONNECTOR_LAUNCH_TIMEOUT"` // in seconds
+}
+
+func (c *Config) SetDefault() {
+	if c.Host == "" {
+		c.Host = "0.0.0.0"
+	}
+	if c.Port == 0 {
+		c.Port = 5004
+	}
+	if c.PublicURL == "" {
+		c.PublicURL = fmt.Sprintf("http://127.0.0.1:%d", c.Port)
+	}
+	if c.WorkingPath == "" {
+		c.WorkingPath = "./storage/serverless-connector"
+	}
+	if c.Mode == "" {
+		c.Mode = RUNNER_MODE_PROCESS
+	}
+	if c.PythonInterpreterPath == "" {
+		c.PythonInterpreterPath = "python3"
+	}
+	if c.DockerPath == "" {
+		c.DockerPath = "docker"
+	}
+	if c.BuildTimeout == 0 {
+		c.BuildTimeout = 600
+	}
+	if c.LaunchTimeout == 0 {
+		c.LaunchTimeout = 60
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.APIKey == "" {
+		return fmt.Errorf("serverless connector api key is empty")
+	}
+
+	if c.Mode != RUNNER_MODE_PROCESS && c.Mode != RUNNER_MODE_CONTAINER {
+		return fmt.Errorf("invalid serverless connector mode: %s", c.Mode)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package connector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+const (
+	// the port plugins listen on inside containers
+	CONTAINER_PORT = 8080
+)
+
+var ErrInstanceNotBuilt = errors.New("instance is not built")
+
+// Instance is a launched plugin package, it's started on demand once built,
+// e.g. after the connector restarted or the plugin crashed
+type Instance struct {
+	ID          string                            `json:"id"`
+	Name        string                            `json:"name"`
+	Filename    string                            `json:"filename"`
+	Checksum    string                            `json:"checksum"`
+	SourcePath  string                            `json:"source_path"`
+	Declaration plugin_entities.PluginDeclaration `json:"declaration"`
+	Built       bool                              `json:"built"`
+
+	Port    int `json:"-"`
+	process Process
+	// closed once the running process exited
+	exited chan bool
+
+	lock sync.Mutex
+	// the persisted fields are changed holding both locks, they're read holding this one only
+	stateLock sync.Mutex
+}
+
+// snapshot copies the persisted fields, it doesn't wait for a launch of the instance
+func (i *Instance) snapshot() *Instance {
+	i.stateLock.Lock()
+	defer i.stateLock.Unlock()
+	return &Instance{
+		ID:          i.ID,
+		Name:        i.Name,
+		Filename:    i.Filename,
+		Checksum:    i.Checksum,
+		SourcePath:  i.SourcePath,
+		Declaration: i.Declaration,
+		Built:       i.Built,
+	}
+}
+
+// setBuilt marks the instance as built, the lock must be held
+func (i *Instance) setBuilt(built bool) {
+	i.stateLock.Lock()
+	i.Built = built
+	i.stateLock.Unlock()
+}
+
+// instanceID is stable for a package filename
+func instanceID(filename string) string {
+	hash := sha256.Sum256([]byte(filename))
+	return hex.EncodeToString(hash[:])[:16]
+}
+
+func (i *Instance) buildLogPath() string {
+	return filepath.Join(filepath.Dir(i.SourcePath), "build.log")
+}
+
+func (i *Instance) runLogPath() string {
+	return filepath.Join(filepath.Dir(i.SourcePath), "run.log")
+}
+
+func (i *Instance) running() bool {
+	return i.process != nil
+}
+
+// stop stops the running process and waits for it, the lock must be held
+func (i *Instance) stop() {
+	if i.process == nil {
+		return
+	}
+
+	if err := i.process.Stop(); err != nil {
+		log.Warn("failed to stop plugin %s: %s", i.Filename, err.Error())
+	}
+	<-i.exited
+	i.process = nil
+}
+
+// start starts the plugin and waits until it accepts connections, the lock must be held
+func (i *Instance) start(runner Runner, timeout time.Duration) error {
+	if !i.Built {
+		return ErrInstanceNotBuilt
+	}
+
+	// the port is bound until the runner hands it over, nobody else can take it meanwhile
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	i.Port = listener.Addr().(*net.TCPAddr).Port
+
+	process, err := runner.Start(i, listener)
+	if err != nil {
+		return err
+	}
+
+	exited := make(chan bool)
+	go func() {
+		err := process.Wait()
+		close(exited)
+
+		i.lock.Lock()
+		if i.process == process {
+			i.process = nil
+			log.Warn("plugin %s exited: %v", i.Filename, err)
+		}
+		i.lock.Unlock()
+	}()
+
+	if err := waitForPort(i.Port, exited, timeout); err != nil {
+		process.Stop()
+		return err
+	}
+
+	i.process = process
+	i.exited = exited
+	return nil
+}
+
+// ensureRunning starts the plugin unless it's running
+func (i *Instance) ensureRunning(runner Runner, timeout time.Duration) (int, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if !i.running() {
+		if err := i.start(runner, timeout); err != nil {
+			return 0, err
+		}
+	}
+
+	return i.Port, nil
+}
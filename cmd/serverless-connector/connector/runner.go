@@ -0,0 +1,284 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/serverless_runtime/dockerfile"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/decoder"
+)
+
+// Runner builds unpacked plugins and runs them, a running plugin serves the
+// invoke contract of serverless plugins on the port of its instance
+type Runner interface {
+	Build(ctx context.Context, instance *Instance) error
+	// Start runs the plugin on the listener bound to the port of the instance, the runner owns the
+	// listener, runners which can't hand it over close it and update the port of the instance
+	Start(instance *Instance, listener net.Listener) (Process, error)
+	// Remove releases what was built for the instance, its files are removed by the server
+	Remove(instance *Instance) error
+}
+
+// Process is a running plugin
+type Process interface {
+	// Wait blocks until the plugin exits
+	Wait() error
+	Stop() error
+}
+
+func NewRunner(config *Config) Runner {
+	if config.Mode == RUNNER_MODE_CONTAINER {
+		return &containerRunner{
+			dockerPath:               config.DockerPath,
+			imageRegistryMirror:      config.ImageRegistryMirror,
+			imageExtraBuildStepsPath: config.ImageExtraBuildStepsPath,
+		}
+	}
+	return &processRunner{pythonInterpreterPath: config.PythonInterpreterPath}
+}
+
+const (
+	// the listener handed to plugin processes, the first of cmd.ExtraFiles
+	LISTENER_FD = 3
+	// tells the plugin sdk to serve the inherited listener instead of binding the port
+	LISTENER_FD_ENV = "SERVERLESS_LISTEN_FD"
+
+	// time allowed for docker to publish the port of a started container
+	CONTAINER_PUBLISH_TIMEOUT = 10 * time.Second
+)
+
+// pluginEnv configures the plugin sdk to serve http on the port
+func pluginEnv(host string, port int) []string {
+	return []string{
+		"INSTALL_METHOD=serverless",
+		"SERVERLESS_HOST=" + host,
+		fmt.Sprintf("SERVERLESS_PORT=%d", port),
+	}
+}
+
+// runCommand runs a build command, its output is appended to the build log of the instance
+func runCommand(ctx context.Context, instance *Instance, name string, args ...string) error {
+	logFile, err := os.OpenFile(instance.buildLogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = instance.SourcePath
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s failed: %s, see %s", name, strings.Join(args, " "), err, instance.buildLogPath())
+	}
+	return nil
+}
+
+type cmdProcess struct {
+	cmd     *exec.Cmd
+	logFile *os.File
+	stop    func() error
+}
+
+// Wait waits for the plugin, the log file is closed once it exited
+func (p *cmdProcess) Wait() error {
+	err := p.cmd.Wait()
+	p.logFile.Close()
+	return err
+}
+
+func (p *cmdProcess) Stop() error {
+	return p.stop()
+}
+
+// startCommand starts the plugin with its output appended to the run log, the process must be waited
+func startCommand(instance *Instance, cmd *exec.Cmd) (*cmdProcess, error) {
+	logFile, err := os.OpenFile(instance.runLogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return nil, err
+	}
+
+	return &cmdProcess{cmd: cmd, logFile: logFile, stop: cmd.Process.Kill}, nil
+}
+
+// processRunner runs plugins as python processes in their own virtual environments
+type processRunner struct {
+	pythonInterpreterPath string
+}
+
+func (r *processRunner) venvPython(instance *Instance) string {
+	return filepath.Join(instance.SourcePath, ".venv", "bin", "python")
+}
+
+func (r *processRunner) Build(ctx context.Context, instance *Instance) error {
+	if err := runCommand(ctx, instance, r.pythonInterpreterPath, "-m", "venv", ".venv"); err != nil {
+		return err
+	}
+
+	return runCommand(ctx, instance, r.venvPython(instance), "-m", "pip", "install", "-r", "requirements.txt")
+}
+
+func (r *processRunner) Remove(instance *Instance) error {
+	// the virtual environment is inside the source of the instance
+	return nil
+}
+
+func (r *processRunner) Start(instance *Instance, listener net.Listener) (Process, error) {
+	// the plugin inherits the bound socket, the port is never released in between
+	file, err := listener.(*net.TCPListener).File()
+	listener.Close()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cmd := exec.Command(r.venvPython(instance), "-m", instance.Declaration.Meta.Runner.Entrypoint)
+	cmd.Dir = instance.SourcePath
+	cmd.Env = append(os.Environ(), pluginEnv("127.0.0.1", instance.Port)...)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", LISTENER_FD_ENV, LISTENER_FD))
+	cmd.ExtraFiles = []*os.File{file}
+
+	return startCommand(instance, cmd)
+}
+
+// containerRunner builds plugins into images with the serverless dockerfile and runs them as containers
+type containerRunner struct {
+	dockerPath string
+
+	imageRegistryMirror      string
+	imageExtraBuildStepsPath string
+}
+
+func (r *containerRunner) image(instance *Instance) string {
+	return "dify-serverless-plugin:" + instance.ID
+}
+
+func (r *containerRunner) container(instance *Instance) string {
+	return "dify-serverless-plugin-" + instance.ID
+}
+
+func (r *containerRunner) Build(ctx context.Context, instance *Instance) error {
+	extraBuildSteps, err := dockerfile.ReadExtraBuildSteps(r.imageExtraBuildStepsPath)
+	if err != nil {
+		return err
+	}
+
+	pluginDecoder, err := decoder.NewFSPluginDecoder(instance.SourcePath)
+	if err != nil {
+		return err
+	}
+
+	content, err := dockerfile.GenerateDockerfile(&instance.Declaration, dockerfile.Options{
+		RegistryMirror:  r.imageRegistryMirror,
+		ExtraBuildSteps: extraBuildSteps,
+		PackageFeatures: dockerfile.DetectPackageFeatures(pluginDecoder),
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(instance.SourcePath, "Dockerfile"), []byte(content), 0644); err != nil {
+		return err
+	}
+
+	return runCommand(ctx, instance, r.dockerPath, "build", "-t", r.image(instance), ".")
+}
+
+func (r *containerRunner) Remove(instance *Instance) error {
+	return exec.Command(r.dockerPath, "rmi", "-f", r.image(instance)).Run()
+}
+
+func (r *containerRunner) Start(instance *Instance, listener net.Listener) (Process, error) {
+	// docker can't adopt the listener, it picks a free port itself while publishing the container
+	listener.Close()
+
+	// remove the container left behind by a previous run
+	exec.Command(r.dockerPath, "rm", "-f", r.container(instance)).Run()
+
+	args := []string{
+		"run", "--rm", "--name", r.container(instance),
+		"-p", fmt.Sprintf("127.0.0.1::%d", CONTAINER_PORT),
+	}
+	for _, env := range pluginEnv("0.0.0.0", CONTAINER_PORT) {
+		args = append(args, "-e", env)
+	}
+	args = append(args, r.image(instance))
+
+	process, err := startCommand(instance, exec.Command(r.dockerPath, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	process.stop = func() error {
+		return exec.Command(r.dockerPath, "rm", "-f", r.container(instance)).Run()
+	}
+
+	port, err := r.publishedPort(instance)
+	if err != nil {
+		process.Stop()
+		process.Wait()
+		return nil, err
+	}
+	instance.Port = port
+
+	return process, nil
+}
+
+// publishedPort waits until docker published the port of the container
+func (r *containerRunner) publishedPort(instance *Instance) (int, error) {
+	deadline := time.Now().Add(CONTAINER_PUBLISH_TIMEOUT)
+	for {
+		output, err := exec.Command(r.dockerPath, "port", r.container(instance), fmt.Sprintf("%d/tcp", CONTAINER_PORT)).Output()
+		if err == nil {
+			return parsePublishedPort(string(output))
+		}
+
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("timeout waiting for docker to publish port %d of %s", CONTAINER_PORT, r.container(instance))
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// parsePublishedPort reads the port of the output of docker port, e.g. 127.0.0.1:49153
+func parsePublishedPort(output string) (int, error) {
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(output), "\n", 2)[0])
+	_, port, err := net.SplitHostPort(line)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected output of docker port: %q", output)
+	}
+	return strconv.Atoi(port)
+}
+
+// waitForPort waits until the plugin accepts connections or exits
+func waitForPort(port int, exited <-chan bool, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		select {
+		case <-exited:
+			return fmt.Errorf("plugin exited before listening on port %d", port)
+		case <-deadline:
+			return fmt.Errorf("timeout waiting for plugin to listen on port %d", port)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartCommandClosesLogAfterWait(t *testing.T) {
+	instance := &Instance{SourcePath: filepath.Join(t.TempDir(), "source")}
+
+	process, err := startCommand(instance, exec.Command("sh", "-c", "echo started"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the process is only waited here
+	assert.NoError(t, process.Wait())
+	_, err = process.logFile.WriteString("after exit")
+	assert.ErrorIs(t, err, os.ErrClosed)
+
+	content, err := os.ReadFile(instance.runLogPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "started\n", string(content))
+}
+
+func TestParsePublishedPort(t *testing.T) {
+	port, err := parsePublishedPort("127.0.0.1:49153\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 49153, port)
+
+	// only the first binding is used
+	port, err = parsePublishedPort("127.0.0.1:49153\n[::1]:49154\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 49153, port)
+
+	_, err = parsePublishedPort("")
+	assert.Error(t, err)
+}
+
+func TestProcessRunnerHandsOverListener(t *testing.T) {
+	instance := &Instance{SourcePath: filepath.Join(t.TempDir(), "source")}
+	python := (&processRunner{}).venvPython(instance)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(python), 0755))
+	assert.NoError(t, os.WriteFile(python, []byte("#!/bin/sh\ntest -S /dev/fd/$SERVERLESS_LISTEN_FD && echo inherited\n"), 0755))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	instance.Port = listener.Addr().(*net.TCPAddr).Port
+
+	process, err := (&processRunner{}).Start(instance, listener)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, process.Wait())
+
+	content, err := os.ReadFile(instance.runLogPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "inherited\n", string(content))
+}
@@ -0,0 +1,460 @@
+package connector
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/decoder"
+)
+
+type LaunchStage string
+
+const (
+	LAUNCH_STAGE_HEALTHZ LaunchStage = "healthz"
+	LAUNCH_STAGE_START   LaunchStage = "start"
+	LAUNCH_STAGE_BUILD   LaunchStage = "build"
+	LAUNCH_STAGE_RUN     LaunchStage = "run"
+	LAUNCH_STAGE_END     LaunchStage = "end"
+)
+
+type LaunchState string
+
+const (
+	LAUNCH_STATE_SUCCESS LaunchState = "success"
+	LAUNCH_STATE_RUNNING LaunchState = "running"
+	LAUNCH_STATE_FAILED  LaunchState = "failed"
+)
+
+type LaunchChunk struct {
+	Stage   LaunchStage `json:"Stage"`
+	Obj     string      `json:"Obj"`
+	State   LaunchState `json:"State"`
+	Message string      `json:"Message"`
+}
+
+type RunnerInstance struct {
+	ID           string `json:"ID"`
+	Name         string `json:"Name"`
+	Endpoint     string `json:"Endpoint"`
+	ResourceName string `json:"ResourceName"`
+	Status       struct {
+		State string `json:"State"`
+	} `json:"Status"`
+}
+
+type RunnerInstances struct {
+	Error string           `json:"error"`
+	Items []RunnerInstance `json:"Items"`
+}
+
+// Server implements the serverless runtime interface, instances are persisted in the
+// working path and started again on their first invoke after a restart
+type Server struct {
+	config *Config
+	runner Runner
+
+	// filename of the package => instance
+	instances map[string]*Instance
+	lock      sync.RWMutex
+}
+
+func NewServer(config *Config) (*Server, error) {
+	return NewServerWithRunner(config, NewRunner(config))
+}
+
+func NewServerWithRunner(config *Config, runner Runner) (*Server, error) {
+	s := &Server{
+		config:    config,
+		runner:    runner,
+		instances: map[string]*Instance{},
+	}
+
+	if err := os.MkdirAll(s.instancesPath(), 0755); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadInstances(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Server) instancesPath() string {
+	return filepath.Join(s.config.WorkingPath, "instances")
+}
+
+func (s *Server) statePath() string {
+	return filepath.Join(s.config.WorkingPath, "instances.json")
+}
+
+func (s *Server) loadInstances() error {
+	data, err := os.ReadFile(s.statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	instances := []*Instance{}
+	if err := json.Unmarshal(data, &instances); err != nil {
+		return fmt.Errorf("failed to load instances: %s", err)
+	}
+	for _, instance := range instances {
+		s.instances[instance.Filename] = instance
+	}
+	return nil
+}
+
+// saveInstances persists the built instances, the lock of the server must be held
+func (s *Server) saveInstances() error {
+	instances := []*Instance{}
+	for _, instance := range s.instances {
+		// instances being launched are not waited for
+		if snapshot := instance.snapshot(); snapshot.Built {
+			instances = append(instances, snapshot)
+		}
+	}
+
+	data, err := json.Marshal(instances)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.statePath())
+}
+
+func (s *Server) endpoint(instance *Instance) string {
+	return strings.TrimRight(s.config.PublicURL, "/") + "/v1/instances/" + instance.ID
+}
+
+func (s *Server) Handler() http.Handler {
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+
+	authorized := engine.Group("/", s.checkAPIKey)
+	authorized.GET("/ping", s.ping)
+	authorized.POST("/ping", s.ping)
+	authorized.GET("/v1/runner/instances", s.listInstances)
+	authorized.DELETE("/v1/runner/instances", s.deleteInstance)
+	authorized.POST("/v1/launch", s.launch)
+
+	// instances are invoked like function urls, without the api key
+	engine.Any("/v1/instances/:id/*path", s.invoke)
+
+	return engine
+}
+
+func (s *Server) Run() error {
+	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
+	log.Info("serverless connector listening on %s, running plugins as %s", addr, s.config.Mode)
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// Stop stops all running plugins
+func (s *Server) Stop() {
+	s.lock.RLock()
+	instances := make([]*Instance, 0, len(s.instances))
+	for _, instance := range s.instances {
+		instances = append(instances, instance)
+	}
+	s.lock.RUnlock()
+
+	for _, instance := range instances {
+		instance.lock.Lock()
+		instance.stop()
+		instance.lock.Unlock()
+	}
+}
+
+func (s *Server) checkAPIKey(c *gin.Context) {
+	// compared in constant time to not leak the key through the response time
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte(s.config.APIKey)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) ping(c *gin.Context) {
+	c.JSON(http.StatusOK, "pong")
+}
+
+func (s *Server) listInstances(c *gin.Context) {
+	filename := c.Query("filename")
+	if filename == "" {
+		c.JSON(http.StatusBadRequest, RunnerInstances{Error: "filename is required"})
+		return
+	}
+
+	response := RunnerInstances{Items: []RunnerInstance{}}
+
+	s.lock.RLock()
+	instance, ok := s.instances[filename]
+	s.lock.RUnlock()
+	if ok {
+		// the instance may be launched meanwhile
+		instance = instance.snapshot()
+	}
+	if ok && instance.Built {
+		item := RunnerInstance{
+			ID:           instance.ID,
+			Name:         instance.Name,
+			Endpoint:     s.endpoint(instance),
+			ResourceName: fmt.Sprintf("%s:%s", s.config.Mode, instance.ID),
+		}
+		item.Status.State = "ready"
+		response.Items = append(response.Items, item)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// deleteInstance stops the plugin and removes everything built for it, the deleted instance is
+// returned, none if it doesn't exist
+func (s *Server) deleteInstance(c *gin.Context) {
+	filename := c.Query("filename")
+	if filename == "" {
+		c.JSON(http.StatusBadRequest, RunnerInstances{Error: "filename is required"})
+		return
+	}
+
+	response := RunnerInstances{Items: []RunnerInstance{}}
+
+	s.lock.Lock()
+	instance, ok := s.instances[filename]
+	delete(s.instances, filename)
+	s.lock.Unlock()
+	if !ok {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	instance.lock.Lock()
+	instance.stop()
+	instance.setBuilt(false)
+	snapshot := instance.snapshot()
+	instance.lock.Unlock()
+
+	if err := s.runner.Remove(instance); err != nil {
+		log.Warn("failed to remove the build of %s: %s", filename, err.Error())
+	}
+	if err := os.RemoveAll(filepath.Join(s.instancesPath(), instance.ID)); err != nil {
+		log.Warn("failed to remove the files of %s: %s", filename, err.Error())
+	}
+
+	s.lock.Lock()
+	err := s.saveInstances()
+	s.lock.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, RunnerInstances{Error: err.Error()})
+		return
+	}
+
+	item := RunnerInstance{
+		ID:           snapshot.ID,
+		Name:         snapshot.Name,
+		Endpoint:     s.endpoint(snapshot),
+		ResourceName: fmt.Sprintf("%s:%s", s.config.Mode, snapshot.ID),
+	}
+	item.Status.State = "deleted"
+	response.Items = append(response.Items, item)
+	c.JSON(http.StatusOK, response)
+}
+
+// launch unpacks, builds and starts a plugin, the stages are reported as server-sent events
+func (s *Server) launch(c *gin.Context) {
+	fileHeader, err := c.FormFile("context")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fileHeader.Filename
+	if !strings.HasSuffix(filename, ".difypkg") || filepath.Base(filename) != filename {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filename: " + filename})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+	pkg, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.WriteHeader(http.StatusOK)
+
+	report := func(stage LaunchStage, state LaunchState, message string) {
+		data, _ := json.Marshal(LaunchChunk{Stage: stage, Obj: filename, State: state, Message: message})
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+	}
+
+	if err := s.launchInstance(c.Request.Context(), filename, pkg, report); err != nil {
+		log.Error("failed to launch %s: %s", filename, err.Error())
+		return
+	}
+
+	report(LAUNCH_STAGE_END, LAUNCH_STATE_SUCCESS, "Plugin launched")
+}
+
+func (s *Server) launchInstance(
+	ctx context.Context,
+	filename string,
+	pkg []byte,
+	report func(stage LaunchStage, state LaunchState, message string),
+) (err error) {
+	stage := LAUNCH_STAGE_HEALTHZ
+	defer func() {
+		if err != nil {
+			report(stage, LAUNCH_STATE_FAILED, err.Error())
+		}
+	}()
+
+	report(stage, LAUNCH_STATE_RUNNING, "Checking runtime")
+	s.lock.Lock()
+	instance, ok := s.instances[filename]
+	if !ok {
+		instance = &Instance{ID: instanceID(filename), Filename: filename}
+		s.instances[filename] = instance
+	}
+	s.lock.Unlock()
+
+	// launches of the same package are serialized, the running plugin is replaced
+	instance.lock.Lock()
+	defer instance.lock.Unlock()
+	report(stage, LAUNCH_STATE_SUCCESS, "Runtime is ready")
+
+	stage = LAUNCH_STAGE_START
+	report(stage, LAUNCH_STATE_RUNNING, "Unpacking plugin")
+	if err := s.unpack(instance, pkg); err != nil {
+		return err
+	}
+	report(stage, LAUNCH_STATE_SUCCESS, "Plugin unpacked")
+
+	stage = LAUNCH_STAGE_BUILD
+	report(stage, LAUNCH_STATE_RUNNING, "Building plugin")
+	buildCtx, cancel := context.WithTimeout(ctx, time.Duration(s.config.BuildTimeout)*time.Second)
+	defer cancel()
+	if err := s.runner.Build(buildCtx, instance); err != nil {
+		return err
+	}
+	instance.setBuilt(true)
+	report(stage, LAUNCH_STATE_SUCCESS, "Plugin built")
+
+	stage = LAUNCH_STAGE_RUN
+	report(stage, LAUNCH_STATE_RUNNING, "Starting plugin")
+	if err := instance.start(s.runner, time.Duration(s.config.LaunchTimeout)*time.Second); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	err = s.saveInstances()
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	report(stage, LAUNCH_STATE_SUCCESS, fmt.Sprintf(
+		"endpoint=%s,name=%s,id=%s", s.endpoint(instance), instance.Name, instance.ID,
+	))
+	return nil
+}
+
+// unpack replaces the source of the instance with the package, the lock of the instance must be held
+func (s *Server) unpack(instance *Instance, pkg []byte) error {
+	zipDecoder, err := decoder.NewZipPluginDecoder(pkg)
+	if err != nil {
+		return err
+	}
+	declaration, err := zipDecoder.Manifest()
+	if err != nil {
+		return err
+	}
+	checksum, err := zipDecoder.Checksum()
+	if err != nil {
+		return err
+	}
+
+	// the running plugin is replaced by the new build
+	instance.stop()
+	instance.setBuilt(false)
+
+	sourcePath := filepath.Join(s.instancesPath(), instance.ID, "source")
+	if err := os.RemoveAll(sourcePath); err != nil {
+		return err
+	}
+	if err := zipDecoder.ExtractTo(sourcePath); err != nil {
+		return err
+	}
+
+	instance.stateLock.Lock()
+	instance.Name = fmt.Sprintf("%s-%s", declaration.Name, instance.ID)
+	instance.Checksum = checksum
+	instance.Declaration = declaration
+	instance.SourcePath = sourcePath
+	instance.stateLock.Unlock()
+	return nil
+}
+
+// invoke proxies requests to the plugin of the instance, which is started if it isn't running
+func (s *Server) invoke(c *gin.Context) {
+	var instance *Instance
+	s.lock.RLock()
+	for _, i := range s.instances {
+		if i.ID == c.Param("id") {
+			instance = i
+		}
+	}
+	s.lock.RUnlock()
+
+	if instance == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "instance not found"})
+		return
+	}
+
+	port, err := instance.ensureRunning(s.runner, time.Duration(s.config.LaunchTimeout)*time.Second)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	target := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", port)}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.URL.Path = c.Param("path")
+			r.Out.URL.RawPath = ""
+		},
+		// responses are event streams
+		FlushInterval: -1,
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
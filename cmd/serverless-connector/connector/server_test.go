@@ -0,0 +1,263 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	serverless "github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/serverless_connector"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/decoder"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRunner serves the invoke contract in process instead of running the plugin
+type fakeRunner struct {
+	builds   int32
+	starts   int32
+	removes  int32
+	buildErr error
+}
+
+type fakeProcess struct {
+	server *http.Server
+	done   chan bool
+}
+
+func (p *fakeProcess) Wait() error {
+	<-p.done
+	return nil
+}
+
+func (p *fakeProcess) Stop() error {
+	return p.server.Close()
+}
+
+func (r *fakeRunner) Build(ctx context.Context, instance *Instance) error {
+	atomic.AddInt32(&r.builds, 1)
+	return r.buildErr
+}
+
+func (r *fakeRunner) Remove(instance *Instance) error {
+	atomic.AddInt32(&r.removes, 1)
+	return nil
+}
+
+func (r *fakeRunner) Start(instance *Instance, listener net.Listener) (Process, error) {
+	atomic.AddInt32(&r.starts, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/invoke", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s:%s", r.URL.Query().Get("action"), body)
+	})
+
+	process := &fakeProcess{server: &http.Server{Handler: mux}, done: make(chan bool)}
+	go func() {
+		process.server.Serve(listener)
+		close(process.done)
+	}()
+	return process, nil
+}
+
+func newTestServer(t *testing.T, runner Runner) (*Server, *httptest.Server) {
+	routine.InitPool(1024)
+
+	config := &Config{APIKey: "test-key", WorkingPath: t.TempDir()}
+	config.SetDefault()
+
+	server, err := NewServerWithRunner(config, runner)
+	assert.NoError(t, err)
+
+	httpServer := httptest.NewServer(server.Handler())
+	config.PublicURL = httpServer.URL
+	t.Cleanup(func() {
+		server.Stop()
+		httpServer.Close()
+	})
+
+	// the daemon talks to the connector with its own client
+	key := config.APIKey
+	serverless.Init(&app.Config{
+		DifyPluginServerlessConnectorURL:    &httpServer.URL,
+		DifyPluginServerlessConnectorAPIKey: &key,
+	})
+
+	return server, httpServer
+}
+
+func testPackage(t *testing.T) ([]byte, *decoder.ZipPluginDecoder) {
+	pkg, err := os.ReadFile("../../../internal/core/plugin_manager/testdata/openai.difypkg")
+	assert.NoError(t, err)
+	zipDecoder, err := decoder.NewZipPluginDecoder(pkg)
+	assert.NoError(t, err)
+	return pkg, zipDecoder
+}
+
+func readLaunchEvents(t *testing.T, pkg []byte, zipDecoder *decoder.ZipPluginDecoder) []serverless.LaunchFunctionResponse {
+	manifest, _ := zipDecoder.Manifest()
+	checksum, _ := zipDecoder.Checksum()
+
+	response, err := serverless.SetupFunction(manifest, checksum, bytes.NewReader(pkg), 10)
+	assert.NoError(t, err)
+
+	events := []serverless.LaunchFunctionResponse{}
+	response.Async(func(r serverless.LaunchFunctionResponse) {
+		events = append(events, r)
+	})
+	return events
+}
+
+func TestLaunchAndInvoke(t *testing.T) {
+	runner := &fakeRunner{}
+	server, _ := newTestServer(t, runner)
+	pkg, zipDecoder := testPackage(t)
+	manifest, _ := zipDecoder.Manifest()
+	checksum, _ := zipDecoder.Checksum()
+
+	_, err := serverless.FetchFunction(manifest, checksum)
+	assert.ErrorIs(t, err, serverless.ErrFunctionNotFound)
+
+	events := readLaunchEvents(t, pkg, zipDecoder)
+	functionURL := ""
+	for _, event := range events {
+		assert.NotEqual(t, serverless.Error, event.Event, event.Message)
+		if event.Event == serverless.FunctionUrl {
+			functionURL = event.Message
+		}
+	}
+	if assert.NotEmpty(t, events) {
+		assert.Equal(t, serverless.Done, events[len(events)-1].Event)
+	}
+
+	function, err := serverless.FetchFunction(manifest, checksum)
+	if assert.NoError(t, err) {
+		assert.Equal(t, functionURL, function.FunctionURL)
+	}
+
+	invoke := func() string {
+		response, err := http.Post(functionURL+"/invoke?action=invoke_tool", "application/json", bytes.NewReader([]byte("{}")))
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return string(body)
+	}
+	assert.Equal(t, "invoke_tool:{}", invoke())
+
+	// crashed plugins are started again on demand
+	instance := server.instances[fmt.Sprintf(
+		"%s@%s@%s@%s.difypkg", manifest.Author, manifest.Name, manifest.Version, checksum,
+	)]
+	instance.lock.Lock()
+	instance.stop()
+	instance.lock.Unlock()
+	assert.Equal(t, "invoke_tool:{}", invoke())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runner.starts))
+
+	// instances survive restarts of the connector
+	restarted, err := NewServerWithRunner(server.config, runner)
+	assert.NoError(t, err)
+	assert.Len(t, restarted.instances, 1)
+}
+
+func TestDeleteFunction(t *testing.T) {
+	runner := &fakeRunner{}
+	server, _ := newTestServer(t, runner)
+	pkg, zipDecoder := testPackage(t)
+	manifest, _ := zipDecoder.Manifest()
+	checksum, _ := zipDecoder.Checksum()
+	identity, _ := zipDecoder.UniqueIdentity()
+
+	assert.ErrorIs(t, serverless.DeleteFunction(identity), serverless.ErrFunctionNotFound)
+
+	readLaunchEvents(t, pkg, zipDecoder)
+	function, err := serverless.FetchFunction(manifest, checksum)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, serverless.DeleteFunction(identity))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runner.removes))
+
+	_, err = serverless.FetchFunction(manifest, checksum)
+	assert.ErrorIs(t, err, serverless.ErrFunctionNotFound)
+
+	// the function url is gone, and so are the files of the instance
+	response, err := http.Post(function.FunctionURL+"/invoke?action=invoke_tool", "application/json", bytes.NewReader([]byte("{}")))
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+		response.Body.Close()
+	}
+	entries, err := os.ReadDir(server.instancesPath())
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// deletions survive restarts of the connector
+	restarted, err := NewServerWithRunner(server.config, runner)
+	assert.NoError(t, err)
+	assert.Empty(t, restarted.instances)
+}
+
+func TestLaunchBuildFailed(t *testing.T) {
+	runner := &fakeRunner{buildErr: errors.New("pip install failed")}
+	_, httpServer := newTestServer(t, runner)
+	pkg, zipDecoder := testPackage(t)
+	manifest, _ := zipDecoder.Manifest()
+	checksum, _ := zipDecoder.Checksum()
+
+	events := readLaunchEvents(t, pkg, zipDecoder)
+	if assert.NotEmpty(t, events) {
+		last := events[len(events)-1]
+		assert.Equal(t, serverless.Error, last.Event)
+		assert.Equal(t, "pip install failed", last.Message)
+	}
+
+	_, err := serverless.FetchFunction(manifest, checksum)
+	assert.ErrorIs(t, err, serverless.ErrFunctionNotFound)
+
+	// the api key is required
+	response, err := http.Get(httpServer.URL + "/ping")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		response.Body.Close()
+	}
+}
+
+func TestListWhileLaunching(t *testing.T) {
+	runner := &fakeRunner{}
+	newTestServer(t, runner)
+	pkg, zipDecoder := testPackage(t)
+	manifest, _ := zipDecoder.Manifest()
+	checksum, _ := zipDecoder.Checksum()
+
+	// the instance is listed and persisted while it's unpacked again, run with -race
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			readLaunchEvents(t, pkg, zipDecoder)
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			_, err := serverless.FetchFunction(manifest, checksum)
+			assert.NoError(t, err)
+			return
+		default:
+			serverless.FetchFunction(manifest, checksum)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/joho/godotenv"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/langgenius/dify-plugin-daemon/cmd/serverless-connector/connector"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+)
+
+// a reference implementation of the serverless runtime interface (docs/runtime/sri.md),
+// plugins run as local processes or docker containers on this host
+func main() {
+	var config connector.Config
+
+	// load env
+	godotenv.Load()
+
+	if err := envconfig.Process("", &config); err != nil {
+		log.Panic("Error processing environment variables: %s", err.Error())
+	}
+
+	config.SetDefault()
+
+	if err := config.Validate(); err != nil {
+		log.Panic("Invalid configuration: %s", err.Error())
+	}
+
+	routine.InitPool(1024)
+
+	server, err := connector.NewServer(&config)
+	if err != nil {
+		log.Panic("Failed to init serverless connector: %s", err.Error())
+	}
+
+	if err := server.Run(); err != nil {
+		log.Panic("Serverless connector stopped: %s", err.Error())
+	}
+}
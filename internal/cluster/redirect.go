@@ -18,8 +18,9 @@ func constructRedirectUrl(ip address, request *http.Request) string {
 func redirectRequestToIp(ip address, request *http.Request) (int, http.Header, io.ReadCloser, error) {
 	url := constructRedirectUrl(ip, request)
 
-	// create a new request
-	redirectedRequest, err := http.NewRequest(
+	// create a new request, it's canceled once the original request is gone, e.g. a closed sse stream
+	redirectedRequest, err := http.NewRequestWithContext(
+		request.Context(),
 		request.Method,
 		url,
 		request.Body,
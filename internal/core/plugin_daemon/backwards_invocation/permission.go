@@ -0,0 +1,151 @@
+package backwards_invocation
+
+import (
+	"fmt"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/dify_invocation"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+type PermissionSource string
+
+const (
+	PERMISSION_SOURCE_MANIFEST     PermissionSource = "manifest"
+	PERMISSION_SOURCE_INSTALLATION PermissionSource = "installation"
+)
+
+// PermissionDeniedError tells the plugin which rule blocked a backwards invocation,
+// it's sent as the data of the error event
+type PermissionDeniedError struct {
+	ErrorType  string                     `json:"error_type"`
+	InvokeType dify_invocation.InvokeType `json:"invoke_type"`
+	Source     PermissionSource           `json:"source"`
+	// path of the rule in the permission, e.g. model.llm or tool.providers
+	Rule string `json:"rule"`
+	// the provider, model, app or file which is not allowed
+	Resource string `json:"resource,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (e *PermissionDeniedError) Error() string {
+	return e.Message
+}
+
+func newAccessDeniedError(
+	invokeType dify_invocation.InvokeType,
+	source PermissionSource,
+	rule string,
+	access string,
+) *PermissionDeniedError {
+	message := fmt.Sprintf("permission denied, you need to enable %s access in plugin manifest", access)
+	if source == PERMISSION_SOURCE_INSTALLATION {
+		message = fmt.Sprintf("permission denied, %s access is not granted to the plugin installation", access)
+	}
+
+	return &PermissionDeniedError{
+		ErrorType:  exception.PluginPermissionDeniedError,
+		InvokeType: invokeType,
+		Source:     source,
+		Rule:       rule,
+		Message:    message,
+	}
+}
+
+func newResourceDeniedError(
+	invokeType dify_invocation.InvokeType,
+	source PermissionSource,
+	rule string,
+	resource string,
+) *PermissionDeniedError {
+	return &PermissionDeniedError{
+		ErrorType:  exception.PluginPermissionDeniedError,
+		InvokeType: invokeType,
+		Source:     source,
+		Rule:       rule,
+		Resource:   resource,
+		Message: fmt.Sprintf(
+			"permission denied, %s is not allowed by %s of the plugin %s", resource, rule, source,
+		),
+	}
+}
+
+type permissionScope struct {
+	source     PermissionSource
+	permission *plugin_entities.PluginPermissionRequirement
+}
+
+func stringField(request map[string]any, key string) string {
+	value, _ := request[key].(string)
+	return value
+}
+
+func checkModelPermission(
+	invokeType dify_invocation.InvokeType,
+	source PermissionSource,
+	model *plugin_entities.PluginPermissionModelRequirement,
+	provider string,
+	name string,
+) error {
+	if !model.AllowProvider(provider) {
+		return newResourceDeniedError(invokeType, source, "model.providers", provider)
+	}
+
+	if !model.AllowModel(provider, name) {
+		return newResourceDeniedError(invokeType, source, "model.providers.models", fmt.Sprintf("%s/%s", provider, name))
+	}
+
+	return nil
+}
+
+// checkResourcePermission checks the allowlists of the permission against the resource the request targets
+func checkResourcePermission(
+	invokeType dify_invocation.InvokeType,
+	source PermissionSource,
+	permission *plugin_entities.PluginPermissionRequirement,
+	request map[string]any,
+) error {
+	if permission == nil {
+		return nil
+	}
+
+	switch invokeType {
+	case dify_invocation.INVOKE_TYPE_LLM,
+		dify_invocation.INVOKE_TYPE_LLM_STRUCTURED_OUTPUT,
+		dify_invocation.INVOKE_TYPE_TEXT_EMBEDDING,
+		dify_invocation.INVOKE_TYPE_RERANK,
+		dify_invocation.INVOKE_TYPE_TTS,
+		dify_invocation.INVOKE_TYPE_SPEECH2TEXT,
+		dify_invocation.INVOKE_TYPE_MODERATION:
+		return checkModelPermission(
+			invokeType, source, permission.Model,
+			stringField(request, "provider"), stringField(request, "model"),
+		)
+	case dify_invocation.INVOKE_TYPE_NODE_PARAMETER_EXTRACTOR,
+		dify_invocation.INVOKE_TYPE_NODE_QUESTION_CLASSIFIER:
+		// nodes invoke the model configured in the request
+		model, _ := request["model"].(map[string]any)
+		return checkModelPermission(
+			invokeType, source, permission.Model,
+			stringField(model, "provider"), stringField(model, "name"),
+		)
+	case dify_invocation.INVOKE_TYPE_TOOL:
+		provider := stringField(request, "provider")
+		if !permission.Tool.AllowProvider(provider) {
+			return newResourceDeniedError(invokeType, source, "tool.providers", provider)
+		}
+	case dify_invocation.INVOKE_TYPE_APP, dify_invocation.INVOKE_TYPE_FETCH_APP:
+		appID := stringField(request, "app_id")
+		if !permission.App.AllowApp(appID) {
+			return newResourceDeniedError(invokeType, source, "app.app_ids", appID)
+		}
+	case dify_invocation.INVOKE_TYPE_UPLOAD_FILE:
+		mimeType := stringField(request, "mimetype")
+		// only the declared mimetype is checked, the file itself is uploaded to dify without passing the daemon
+		if !permission.File.AllowMimeType(mimeType) {
+			return newResourceDeniedError(invokeType, source, "file.mime_types", mimeType)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package backwards_invocation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/dify_invocation"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func getAllowlistDeclaration() *plugin_entities.PluginDeclaration {
+	return &plugin_entities.PluginDeclaration{
+		PluginDeclarationWithoutAdvancedFields: plugin_entities.PluginDeclarationWithoutAdvancedFields{
+			Resource: plugin_entities.PluginResourceRequirement{
+				Permission: &plugin_entities.PluginPermissionRequirement{
+					Tool: &plugin_entities.PluginPermissionToolRequirement{
+						Enabled:   true,
+						Providers: []string{"langgenius/google/google"},
+					},
+					Model: &plugin_entities.PluginPermissionModelRequirement{
+						Enabled: true,
+						LLM:     true,
+						Providers: []plugin_entities.PluginPermissionModelProvider{
+							{Provider: "langgenius/openai/openai", Models: []string{"gpt-4o"}},
+							{Provider: "langgenius/anthropic/anthropic"},
+						},
+					},
+					Node: &plugin_entities.PluginPermissionNodeRequirement{
+						Enabled: true,
+					},
+					App: &plugin_entities.PluginPermissionAppRequirement{
+						Enabled: true,
+						AppIDs:  []string{"app-1"},
+					},
+					File: &plugin_entities.PluginPermissionFileRequirement{
+						MimeTypes: []string{"image/*", "application/pdf"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func checkAllowlist(
+	declaration *plugin_entities.PluginDeclaration,
+	permission *plugin_entities.PluginPermissionRequirement,
+	typ dify_invocation.InvokeType,
+	request map[string]any,
+) *PermissionDeniedError {
+	session := getTestSession()
+	session.Permission = permission
+
+	err := checkPermission(declaration, NewBackwardsInvocation(typ, "", session, nil, request))
+	if err == nil {
+		return nil
+	}
+
+	var denied *PermissionDeniedError
+	if !errors.As(err, &denied) {
+		return &PermissionDeniedError{Message: err.Error()}
+	}
+	return denied
+}
+
+func TestBackwardsInvocationModelAllowlist(t *testing.T) {
+	declaration := getAllowlistDeclaration()
+
+	assert.Nil(t, checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_LLM, map[string]any{
+		"provider": "langgenius/openai/openai", "model": "gpt-4o",
+	}))
+	assert.Nil(t, checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_LLM, map[string]any{
+		"provider": "langgenius/anthropic/anthropic", "model": "claude-sonnet",
+	}))
+
+	denied := checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_LLM, map[string]any{
+		"provider": "langgenius/openai/openai", "model": "gpt-3.5-turbo",
+	})
+	assert.Equal(t, "model.providers.models", denied.Rule)
+	assert.Equal(t, "langgenius/openai/openai/gpt-3.5-turbo", denied.Resource)
+	assert.Equal(t, PERMISSION_SOURCE_MANIFEST, denied.Source)
+
+	denied = checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_NODE_PARAMETER_EXTRACTOR, map[string]any{
+		"model": map[string]any{"provider": "deepseek", "name": "deepseek-chat"},
+	})
+	assert.Equal(t, "model.providers", denied.Rule)
+	assert.Equal(t, "deepseek", denied.Resource)
+
+	// providers of the same name from other organizations are different providers
+	denied = checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_LLM, map[string]any{
+		"provider": "anyone/openai/openai", "model": "gpt-4o",
+	})
+	assert.Equal(t, "model.providers", denied.Rule)
+	assert.Equal(t, "anyone/openai/openai", denied.Resource)
+
+	// the boolean switches are still checked first
+	denied = checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_TEXT_EMBEDDING, map[string]any{
+		"provider": "langgenius/openai/openai", "model": "gpt-4o",
+	})
+	assert.Equal(t, "model.text_embedding", denied.Rule)
+	assert.Equal(t, "permission denied, you need to enable text-embedding access in plugin manifest", denied.Message)
+}
+
+func TestBackwardsInvocationToolAndAppAllowlist(t *testing.T) {
+	declaration := getAllowlistDeclaration()
+
+	assert.Nil(t, checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_TOOL, map[string]any{
+		"provider": "langgenius/google/google", "tool": "search",
+	}))
+	denied := checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_TOOL, map[string]any{
+		"provider": "bing", "tool": "search",
+	})
+	assert.Equal(t, "tool.providers", denied.Rule)
+	denied = checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_TOOL, map[string]any{
+		"provider": "anyone/google/google", "tool": "search",
+	})
+	assert.Equal(t, "tool.providers", denied.Rule)
+
+	assert.Nil(t, checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_APP, map[string]any{"app_id": "app-1"}))
+	denied = checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_FETCH_APP, map[string]any{"app_id": "app-2"})
+	assert.Equal(t, "app.app_ids", denied.Rule)
+	assert.Equal(t, "app-2", denied.Resource)
+}
+
+func TestBackwardsInvocationUploadFilePermission(t *testing.T) {
+	declaration := getAllowlistDeclaration()
+
+	assert.Nil(t, checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_UPLOAD_FILE, map[string]any{
+		"filename": "a.png", "mimetype": "image/png",
+	}))
+	assert.Nil(t, checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_UPLOAD_FILE, map[string]any{
+		"filename": "a.pdf", "mimetype": "application/pdf",
+	}))
+
+	denied := checkAllowlist(declaration, nil, dify_invocation.INVOKE_TYPE_UPLOAD_FILE, map[string]any{
+		"filename": "a.exe", "mimetype": "application/octet-stream",
+	})
+	assert.Equal(t, "file.mime_types", denied.Rule)
+
+	// plugins without a file section upload without restrictions
+	assert.Nil(t, checkAllowlist(&plugin_entities.PluginDeclaration{}, nil, dify_invocation.INVOKE_TYPE_UPLOAD_FILE, map[string]any{
+		"filename": "a.exe", "mimetype": "application/octet-stream",
+	}))
+
+	// the installation may limit the types further
+	denied = checkAllowlist(declaration, &plugin_entities.PluginPermissionRequirement{
+		File: &plugin_entities.PluginPermissionFileRequirement{MimeTypes: []string{"application/pdf"}},
+	}, dify_invocation.INVOKE_TYPE_UPLOAD_FILE, map[string]any{
+		"filename": "a.png", "mimetype": "image/png",
+	})
+	assert.Equal(t, PERMISSION_SOURCE_INSTALLATION, denied.Source)
+	assert.Equal(t, "file.mime_types", denied.Rule)
+}
+
+func TestBackwardsInvocationInstallationNarrowsPermission(t *testing.T) {
+	declaration := getAllowlistDeclaration()
+	installation := &plugin_entities.PluginPermissionRequirement{
+		Model: &plugin_entities.PluginPermissionModelRequirement{
+			Enabled: true,
+			LLM:     true,
+			Providers: []plugin_entities.PluginPermissionModelProvider{
+				{Provider: "langgenius/openai/openai"},
+			},
+		},
+	}
+
+	assert.Nil(t, checkAllowlist(declaration, installation, dify_invocation.INVOKE_TYPE_LLM, map[string]any{
+		"provider": "langgenius/openai/openai", "model": "gpt-4o",
+	}))
+
+	// allowed by the manifest but not by the installation
+	denied := checkAllowlist(declaration, installation, dify_invocation.INVOKE_TYPE_LLM, map[string]any{
+		"provider": "langgenius/anthropic/anthropic", "model": "claude-sonnet",
+	})
+	assert.Equal(t, PERMISSION_SOURCE_INSTALLATION, denied.Source)
+	assert.Equal(t, "model.providers", denied.Rule)
+
+	denied = checkAllowlist(declaration, installation, dify_invocation.INVOKE_TYPE_TOOL, map[string]any{
+		"provider": "langgenius/google/google",
+	})
+	assert.Equal(t, PERMISSION_SOURCE_INSTALLATION, denied.Source)
+	assert.Equal(t, "tool.enabled", denied.Rule)
+
+	// the installation can't widen the manifest
+	denied = checkAllowlist(declaration, installation, dify_invocation.INVOKE_TYPE_LLM, map[string]any{
+		"provider": "langgenius/openai/openai", "model": "gpt-3.5-turbo",
+	})
+	assert.Equal(t, PERMISSION_SOURCE_MANIFEST, denied.Source)
+}
+
+func TestBackwardsInvocationDeniedErrorEvent(t *testing.T) {
+	writer := &recordingWriter{}
+	handle := NewBackwardsInvocation(dify_invocation.INVOKE_TYPE_APP, "request", getTestSession(), writer, nil)
+	handle.WriteError(newResourceDeniedError(dify_invocation.INVOKE_TYPE_APP, PERMISSION_SOURCE_MANIFEST, "app.app_ids", "app-2"))
+
+	event := writer.events[0].(*BackwardsInvocationResponseEvent)
+	assert.Equal(t, REQUEST_EVENT_ERROR, event.Event)
+	denied, ok := event.Data.(*PermissionDeniedError)
+	assert.True(t, ok)
+	assert.Equal(t, "PluginPermissionDeniedError", denied.ErrorType)
+	assert.Equal(t, "app.app_ids", denied.Rule)
+}
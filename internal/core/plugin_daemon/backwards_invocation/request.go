@@ -1,6 +1,7 @@
 package backwards_invocation
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/langgenius/dify-plugin-daemon/internal/core/dify_invocation"
@@ -57,10 +58,15 @@ func (bi *BackwardsInvocation) GetID() string {
 }
 
 func (bi *BackwardsInvocation) WriteError(err error) {
-	bi.writer.Write(
-		session_manager.PLUGIN_IN_STREAM_EVENT_RESPONSE,
-		NewErrorEvent(bi.id, err.Error()),
-	)
+	event := NewErrorEvent(bi.id, err.Error())
+
+	// denials carry the rule which blocked the invocation
+	var permissionDenied *PermissionDeniedError
+	if errors.As(err, &permissionDenied) {
+		event.Data = permissionDenied
+	}
+
+	bi.writer.Write(session_manager.PLUGIN_IN_STREAM_EVENT_RESPONSE, event)
 }
 
 func (bi *BackwardsInvocation) WriteResponse(message string, data any) {
@@ -12,6 +12,7 @@ import (
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
 )
 
@@ -49,6 +50,13 @@ func InvokeDify(
 		return nil
 	}
 
+	// the caller of the session has gone away, no need to invoke dify anymore
+	if session.Cancelled() {
+		requestHandle.WriteError(fmt.Errorf("session %s has been cancelled", session.ID))
+		requestHandle.EndResponse()
+		return nil
+	}
+
 	// check permission
 	if err := checkPermission(declaration, requestHandle); err != nil {
 		requestHandle.WriteError(err)
@@ -71,111 +79,149 @@ func InvokeDify(
 var (
 	permissionMapping = map[dify_invocation.InvokeType]map[string]any{
 		dify_invocation.INVOKE_TYPE_TOOL: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeTool()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeTool()
 			},
-			"error": "permission denied, you need to enable tool access in plugin manifest",
+			"access": "tool",
+			"rule":   "tool.enabled",
 		},
 		dify_invocation.INVOKE_TYPE_LLM: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeLLM()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeLLM()
 			},
-			"error": "permission denied, you need to enable llm access in plugin manifest",
+			"access": "llm",
+			"rule":   "model.llm",
 		},
 		dify_invocation.INVOKE_TYPE_TEXT_EMBEDDING: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeTextEmbedding()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeTextEmbedding()
 			},
-			"error": "permission denied, you need to enable text-embedding access in plugin manifest",
+			"access": "text-embedding",
+			"rule":   "model.text_embedding",
 		},
 		dify_invocation.INVOKE_TYPE_RERANK: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeRerank()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeRerank()
 			},
-			"error": "permission denied, you need to enable rerank access in plugin manifest",
+			"access": "rerank",
+			"rule":   "model.rerank",
 		},
 		dify_invocation.INVOKE_TYPE_TTS: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeTTS()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeTTS()
 			},
-			"error": "permission denied, you need to enable tts access in plugin manifest",
+			"access": "tts",
+			"rule":   "model.tts",
 		},
 		dify_invocation.INVOKE_TYPE_SPEECH2TEXT: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeSpeech2Text()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeSpeech2Text()
 			},
-			"error": "permission denied, you need to enable speech2text access in plugin manifest",
+			"access": "speech2text",
+			"rule":   "model.speech2text",
 		},
 		dify_invocation.INVOKE_TYPE_MODERATION: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeModeration()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeModeration()
 			},
-			"error": "permission denied, you need to enable moderation access in plugin manifest",
+			"access": "moderation",
+			"rule":   "model.moderation",
 		},
 		dify_invocation.INVOKE_TYPE_NODE_PARAMETER_EXTRACTOR: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeNode()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeNode()
 			},
-			"error": "permission denied, you need to enable node access in plugin manifest",
+			"access": "node",
+			"rule":   "node.enabled",
 		},
 		dify_invocation.INVOKE_TYPE_NODE_QUESTION_CLASSIFIER: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeNode()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeNode()
 			},
-			"error": "permission denied, you need to enable node access in plugin manifest",
+			"access": "node",
+			"rule":   "node.enabled",
 		},
 		dify_invocation.INVOKE_TYPE_APP: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeApp()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeApp()
 			},
-			"error": "permission denied, you need to enable app access in plugin manifest",
+			"access": "app",
+			"rule":   "app.enabled",
 		},
 		dify_invocation.INVOKE_TYPE_STORAGE: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeStorage()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeStorage()
 			},
-			"error": "permission denied, you need to enable storage access in plugin manifest",
+			"access": "storage",
+			"rule":   "storage.enabled",
 		},
 		dify_invocation.INVOKE_TYPE_SYSTEM_SUMMARY: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeLLM()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeLLM()
 			},
-			"error": "permission denied, you need to enable llm access in plugin manifest",
+			"access": "llm",
+			"rule":   "model.llm",
 		},
 		dify_invocation.INVOKE_TYPE_UPLOAD_FILE: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
 				return true
 			},
-			"error": "permission denied, you need to enable storage access in plugin manifest",
+			"access": "file",
+			"rule":   "file",
 		},
 		dify_invocation.INVOKE_TYPE_FETCH_APP: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeApp()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeApp()
 			},
-			"error": "permission denied, you need to enable app access in plugin manifest",
+			"access": "app",
+			"rule":   "app.enabled",
 		},
 		dify_invocation.INVOKE_TYPE_LLM_STRUCTURED_OUTPUT: {
-			"func": func(declaration *plugin_entities.PluginDeclaration) bool {
-				return declaration.Resource.Permission.AllowInvokeLLM()
+			"func": func(permission *plugin_entities.PluginPermissionRequirement) bool {
+				return permission.AllowInvokeLLM()
 			},
-			"error": "permission denied, you need to enable llm access in plugin manifest",
+			"access": "llm",
+			"rule":   "model.llm",
 		},
 	}
 )
 
-func checkPermission(runtime *plugin_entities.PluginDeclaration, requestHandle *BackwardsInvocation) error {
+func checkPermission(declaration *plugin_entities.PluginDeclaration, requestHandle *BackwardsInvocation) error {
 	permission, ok := permissionMapping[requestHandle.Type()]
 	if !ok {
 		return fmt.Errorf("unsupported invoke type: %s", requestHandle.Type())
 	}
 
-	permissionFunc, ok := permission["func"].(func(runtime *plugin_entities.PluginDeclaration) bool)
+	permissionFunc, ok := permission["func"].(func(permission *plugin_entities.PluginPermissionRequirement) bool)
 	if !ok {
 		return fmt.Errorf("permission function not found: %s", requestHandle.Type())
 	}
 
-	if !permissionFunc(runtime) {
-		return fmt.Errorf(permission["error"].(string))
+	access, _ := permission["access"].(string)
+	rule, _ := permission["rule"].(string)
+
+	scopes := []permissionScope{
+		{source: PERMISSION_SOURCE_MANIFEST, permission: declaration.Resource.Permission},
+	}
+
+	// the installation narrows the declared permission, it never widens it
+	if requestHandle.session != nil && requestHandle.session.Permission != nil {
+		scopes = append(scopes, permissionScope{
+			source:     PERMISSION_SOURCE_INSTALLATION,
+			permission: requestHandle.session.Permission,
+		})
+	}
+
+	for _, scope := range scopes {
+		if !permissionFunc(scope.permission) {
+			return newAccessDeniedError(requestHandle.Type(), scope.source, rule, access)
+		}
+
+		if err := checkResourcePermission(
+			requestHandle.Type(), scope.source, scope.permission, requestHandle.RequestData(),
+		); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -304,6 +350,16 @@ func dispatchDifyInvocationTask(handle *BackwardsInvocation) {
 	handle.WriteError(fmt.Errorf("unsupported invoke type: %s", handle.Type()))
 }
 
+// abortOnCancel closes the streaming response once the session is cancelled
+// which stops reading from dify and releases the underlying connection,
+// the returned function releases the handler once the response is consumed
+func abortOnCancel[T any](handle *BackwardsInvocation, response *stream.Stream[T]) func() {
+	if handle.session == nil {
+		return func() {}
+	}
+	return handle.session.OnCancel(response.Close)
+}
+
 func executeDifyInvocationToolTask(
 	handle *BackwardsInvocation,
 	request *dify_invocation.InvokeToolRequest,
@@ -314,6 +370,8 @@ func executeDifyInvocationToolTask(
 		return
 	}
 
+	defer abortOnCancel(handle, response)()
+
 	for response.Next() {
 		value, err := response.Read()
 		if err != nil {
@@ -335,6 +393,8 @@ func executeDifyInvocationLLMTask(
 		return
 	}
 
+	defer abortOnCancel(handle, response)()
+
 	for response.Next() {
 		value, err := response.Read()
 		if err != nil {
@@ -356,6 +416,8 @@ func executeDifyInvocationLLMStructuredOutputTask(
 		return
 	}
 
+	defer abortOnCancel(handle, response)()
+
 	for response.Next() {
 		value, err := response.Read()
 		if err != nil {
@@ -402,6 +464,8 @@ func executeDifyInvocationTTSTask(
 		return
 	}
 
+	defer abortOnCancel(handle, response)()
+
 	for response.Next() {
 		value, err := response.Read()
 		if err != nil {
@@ -449,6 +513,8 @@ func executeDifyInvocationAppTask(
 		return
 	}
 
+	defer abortOnCancel(handle, response)()
+
 	userId, err := handle.UserID()
 	if err != nil {
 		handle.WriteError(fmt.Errorf("get user id failed: %s", err.Error()))
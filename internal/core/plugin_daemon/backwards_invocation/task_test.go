@@ -2,12 +2,16 @@ package backwards_invocation
 
 import (
 	"testing"
+	"time"
 
 	"github.com/langgenius/dify-plugin-daemon/internal/core/dify_invocation"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/dify_invocation/tester"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_daemon/access_types"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/session_manager"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/tool_entities"
+	"github.com/stretchr/testify/assert"
 )
 
 func getTestSession() *session_manager.Session {
@@ -168,3 +172,67 @@ func TestBackwardsInvocationAllDeniedPermission(t *testing.T) {
 		t.Errorf("checkPermission failed: expected error, got nil")
 	}
 }
+
+// streams tool responses until the stream is closed
+type endlessToolInvocation struct {
+	dify_invocation.BackwardsInvocation
+
+	response *stream.Stream[tool_entities.ToolResponseChunk]
+}
+
+func (e *endlessToolInvocation) InvokeTool(
+	_ *dify_invocation.InvokeToolRequest,
+) (*stream.Stream[tool_entities.ToolResponseChunk], error) {
+	return e.response, nil
+}
+
+type recordingWriter struct {
+	events []any
+}
+
+func (w *recordingWriter) Write(_ session_manager.PLUGIN_IN_STREAM_EVENT, data any) error {
+	w.events = append(w.events, data)
+	return nil
+}
+
+func (w *recordingWriter) Done() {}
+
+func TestBackwardsInvocationAbortOnCancel(t *testing.T) {
+	invocation := &endlessToolInvocation{response: stream.NewStream[tool_entities.ToolResponseChunk](8)}
+	session := getTestSession()
+	defer session.Close(session_manager.CloseSessionPayload{IgnoreCache: true})
+	session.BindBackwardsInvocation(invocation)
+
+	writer := &recordingWriter{}
+	handle := NewBackwardsInvocation(dify_invocation.INVOKE_TYPE_TOOL, "request", session, writer, nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		executeDifyInvocationToolTask(handle, &dify_invocation.InvokeToolRequest{})
+	}()
+
+	invocation.response.Write(tool_entities.ToolResponseChunk{Type: tool_entities.ToolResponseChunkTypeText})
+	session.Cancel(session_manager.SESSION_CANCEL_REASON_CLIENT_DISCONNECTED)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the response is still read after the session was cancelled")
+	}
+	assert.True(t, invocation.response.IsClosed())
+}
+
+func TestBackwardsInvocationReleasesCancelHandler(t *testing.T) {
+	response := stream.NewStream[tool_entities.ToolResponseChunk](8)
+	session := getTestSession()
+	defer session.Close(session_manager.CloseSessionPayload{IgnoreCache: true})
+
+	handle := NewBackwardsInvocation(dify_invocation.INVOKE_TYPE_TOOL, "request", session, &recordingWriter{}, nil)
+	release := abortOnCancel(handle, response)
+	release()
+
+	// the finished invocation is not touched by a later cancellation
+	session.Cancel(session_manager.SESSION_CANCEL_REASON_TIMEOUT)
+	assert.False(t, response.IsClosed())
+}
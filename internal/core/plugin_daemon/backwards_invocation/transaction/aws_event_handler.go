@@ -17,14 +17,43 @@ import (
 
 type AWSTransactionHandler struct {
 	maxTimeout time.Duration
+
+	// secret verifying the callback tokens
+	callbackTokenSecret []byte
+	// reject requests without a callback token
+	callbackTokenEnforced bool
 }
 
-func NewAWSTransactionHandler(maxTimeout time.Duration) *AWSTransactionHandler {
+func NewAWSTransactionHandler(
+	maxTimeout time.Duration,
+	callbackTokenSecret []byte,
+	callbackTokenEnforced bool,
+) *AWSTransactionHandler {
 	return &AWSTransactionHandler{
-		maxTimeout: maxTimeout,
+		maxTimeout:            maxTimeout,
+		callbackTokenSecret:   callbackTokenSecret,
+		callbackTokenEnforced: callbackTokenEnforced,
 	}
 }
 
+// verifyCallbackToken returns the claims of the token, nil if no token is required
+func (h *AWSTransactionHandler) verifyCallbackToken(
+	session_id string,
+	token string,
+) (*session_manager.CallbackTokenClaims, error) {
+	if token == "" && !h.callbackTokenEnforced {
+		// released sdks don't send the token yet, it's only enforced once they do
+		log.Warn("backwards invocation of session %s has no callback token, accepted as tokens are not enforced", session_id)
+		return nil, nil
+	}
+
+	if token == "" {
+		return nil, session_manager.ErrInvalidCallbackToken
+	}
+
+	return session_manager.VerifyCallbackToken(h.callbackTokenSecret, token, session_id)
+}
+
 type awsTransactionWriteCloser struct {
 	done   chan bool
 	closed int32
@@ -51,7 +80,16 @@ func (w *awsTransactionWriteCloser) Close() error {
 func (h *AWSTransactionHandler) Handle(
 	ctx *gin.Context,
 	session_id string,
+	callback_token string,
 ) {
+	claims, err := h.verifyCallbackToken(session_id, callback_token)
+	if err != nil {
+		log.Warn("rejected backwards invocation of session %s: %s", session_id, err.Error())
+		ctx.Writer.WriteHeader(http.StatusUnauthorized)
+		ctx.Writer.Write([]byte(err.Error()))
+		return
+	}
+
 	writer := &awsTransactionWriteCloser{
 		writer: ctx.Writer.Write,
 		flush:  ctx.Writer.Flush,
@@ -94,6 +132,17 @@ func (h *AWSTransactionHandler) Handle(
 				return
 			}
 
+			// the token only authorizes the session, plugin and tenant it was issued for
+			if claims != nil && (claims.SessionID != session.ID ||
+				claims.TenantID != session.TenantID ||
+				claims.PluginUniqueIdentifier != session.PluginUniqueIdentifier) {
+				log.Warn("callback token of session %s used for session %s", claims.SessionID, session.ID)
+				ctx.Writer.WriteHeader(http.StatusForbidden)
+				ctx.Writer.Write([]byte("callback token does not match the session"))
+				writer.Close()
+				return
+			}
+
 			// bind the backwards invocation
 			plugin_manager := plugin_manager.Manager()
 			session.BindBackwardsInvocation(plugin_manager.BackwardsInvocation())
@@ -113,10 +162,11 @@ func (h *AWSTransactionHandler) Handle(
 			}
 		},
 		func() {},
+		func(protocol plugin_entities.PluginProtocolEvent) {},
 		func(err string) {
 			log.Warn("invoke dify failed, received errors: %s", err)
 		},
-		func(message string) {}, //log
+		func(session_id string, logEvent plugin_entities.PluginLogEvent) {}, //log
 	)
 
 	select {
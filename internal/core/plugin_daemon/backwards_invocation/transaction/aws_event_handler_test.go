@@ -0,0 +1,126 @@
+package transaction
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/session_manager"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryCache struct {
+	cache.Client
+
+	lock sync.Mutex
+	kv   map[string]string
+}
+
+func (m *memoryCache) Set(key string, value any, _ time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if v, ok := value.(string); ok {
+		m.kv[key] = v
+	}
+	return nil
+}
+
+func (m *memoryCache) GetString(key string) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	v, ok := m.kv[key]
+	if !ok {
+		return "", cache.ErrNotFound
+	}
+	return v, nil
+}
+
+func (m *memoryCache) Delete(key string) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.kv, key)
+	return 1, nil
+}
+
+func newTestSession(t *testing.T, tenantID string) *session_manager.Session {
+	session := session_manager.NewSession(session_manager.NewSessionPayload{
+		TenantID:    tenantID,
+		IgnoreCache: true,
+	})
+	t.Cleanup(func() { session.Close(session_manager.CloseSessionPayload{IgnoreCache: true}) })
+	return session
+}
+
+func handleTransaction(
+	handler *AWSTransactionHandler,
+	sessionID string,
+	token string,
+	eventSessionID string,
+) *httptest.ResponseRecorder {
+	body := parser.MarshalJsonBytes(plugin_entities.PluginUniversalEvent{
+		SessionId: eventSessionID,
+		Event:     plugin_entities.PLUGIN_EVENT_SESSION,
+		Data: parser.MarshalJsonBytes(plugin_entities.SessionMessage{
+			Type: plugin_entities.SESSION_MESSAGE_TYPE_INVOKE,
+			Data: []byte("{}"),
+		}),
+	})
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/backwards-invocation/transaction", bytes.NewReader(body))
+	handler.Handle(ctx, sessionID, token)
+	return recorder
+}
+
+func TestAWSTransactionHandlerCallbackToken(t *testing.T) {
+	cache.SetClient(&memoryCache{kv: map[string]string{}})
+	defer cache.SetClient(nil)
+
+	secret := []byte("secret")
+	handler := NewAWSTransactionHandler(time.Second, secret, true)
+
+	session := newTestSession(t, "tenant")
+	another := newTestSession(t, "another_tenant")
+
+	token, err := session.IssueCallbackToken(secret, time.Minute)
+	assert.NoError(t, err)
+
+	t.Run("missing", func(t *testing.T) {
+		recorder := handleTransaction(handler, session.ID, "", session.ID)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("forged", func(t *testing.T) {
+		forged := session_manager.SignCallbackToken([]byte("another"), session_manager.CallbackTokenClaims{
+			SessionID: session.ID,
+			TenantID:  session.TenantID,
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		})
+		recorder := handleTransaction(handler, session.ID, forged, session.ID)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("used for another session", func(t *testing.T) {
+		recorder := handleTransaction(handler, another.ID, token, another.ID)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+		// the header matches the token but the event targets another session
+		recorder = handleTransaction(handler, session.ID, token, another.ID)
+		assert.Contains(t, recorder.Body.String(), "callback token does not match the session")
+	})
+
+	t.Run("replayed after close", func(t *testing.T) {
+		session.Close(session_manager.CloseSessionPayload{IgnoreCache: true})
+		recorder := handleTransaction(handler, session.ID, token, session.ID)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), session_manager.ErrCallbackTokenRevoked.Error())
+	})
+}
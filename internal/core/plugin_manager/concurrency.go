@@ -0,0 +1,32 @@
+package plugin_manager
+
+import (
+	"errors"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/concurrency_limiter"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+// AcquireSessionSlot waits for a free slot of the concurrency limits before a session is created
+// the returned release function must be called once the session is closed
+func (p *PluginManager) AcquireSessionSlot(
+	tenantID string,
+	identity plugin_entities.PluginUniqueIdentifier,
+) (func(), error) {
+	slot, err := p.concurrencyLimiter.Acquire(tenantID, identity.PluginID())
+	if err != nil {
+		var limitErr *concurrency_limiter.LimitExceededError
+		if errors.As(err, &limitErr) {
+			return nil, exception.TooManyRequestsError(limitErr.Error(), map[string]any{
+				"scope":     limitErr.Scope,
+				"limit":     limitErr.Limit,
+				"tenant_id": limitErr.TenantID,
+				"plugin_id": limitErr.PluginID,
+			})
+		}
+		return nil, err
+	}
+
+	return slot.Release, nil
+}
@@ -0,0 +1,425 @@
+package concurrency_limiter
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+)
+
+const (
+	// lease of a slot, it's renewed while the session is alive
+	SLOT_LEASE_TTL = 30 * time.Second
+	// waiters are woken up by released slots, the poll only covers leases expired on crashed nodes
+	DISPATCH_POLL_INTERVAL = 2 * time.Second
+)
+
+type Scope string
+
+const (
+	SCOPE_PLUGIN        Scope = "plugin"
+	SCOPE_TENANT        Scope = "tenant"
+	SCOPE_TENANT_PLUGIN Scope = "tenant_plugin"
+)
+
+// Limits of concurrent sessions, 0 means unlimited
+type Limits struct {
+	PerPlugin       int
+	PerTenant       int
+	PerTenantPlugin int
+}
+
+type bucket struct {
+	scope Scope
+	key   string
+	limit int
+}
+
+// LimitExceededError is returned when no slot became available within the wait timeout
+type LimitExceededError struct {
+	Scope    Scope
+	Limit    int
+	TenantID string
+	PluginID string
+	Waited   time.Duration
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf(
+		"too many concurrent sessions, %s limit %d reached, waited %s",
+		e.Scope, e.Limit, e.Waited,
+	)
+}
+
+type waiter struct {
+	tenantID string
+	pluginID string
+	buckets  []bucket
+	slotID   string
+	ready    chan bool
+	granted  bool
+	// the waiter gave up, a slot acquired for it meanwhile has to be released
+	abandoned bool
+	// error of the store if the limiter fails closed
+	err error
+	// the bucket which blocked the waiter last time
+	blockedBy *bucket
+}
+
+// Limiter limits concurrent sessions per plugin, per tenant and per (tenant, plugin)
+// slots are shared by the whole cluster through the cache, waiters on this node are
+// served round-robin across tenants so that a noisy tenant can not starve others
+type Limiter struct {
+	limits      Limits
+	waitTimeout time.Duration
+	store       slotStore
+	// whether sessions are let through when the store is unavailable
+	failOpen bool
+
+	watchOnce sync.Once
+
+	lock sync.Mutex
+	// a single dispatcher accesses the store at a time, requests meanwhile make it run another pass
+	dispatching bool
+	redispatch  bool
+	// waiting queues of each tenant
+	queues map[string][]*waiter
+	// tenants which have waiters, in the order they are served
+	tenants []string
+	// index of the tenant to be served first in the next round
+	next int
+}
+
+func NewLimiter(limits Limits, waitTimeout time.Duration, failOpen bool) *Limiter {
+	return newLimiter(limits, waitTimeout, failOpen, &cacheSlotStore{})
+}
+
+func newLimiter(limits Limits, waitTimeout time.Duration, failOpen bool, store slotStore) *Limiter {
+	return &Limiter{
+		limits:      limits,
+		waitTimeout: waitTimeout,
+		store:       store,
+		failOpen:    failOpen,
+		queues:      map[string][]*waiter{},
+	}
+}
+
+// watchReleases serves waiters as soon as slots are released by other nodes
+func (l *Limiter) watchReleases() {
+	released := l.store.released()
+	if released == nil {
+		return
+	}
+
+	routine.Submit(map[string]string{
+		"module":   "concurrency_limiter",
+		"function": "watchReleases",
+	}, func() {
+		for range released {
+			l.dispatch()
+		}
+	})
+}
+
+func (l *Limiter) buckets(tenantID string, pluginID string) []bucket {
+	buckets := []bucket{}
+	if l.limits.PerTenantPlugin > 0 {
+		buckets = append(buckets, bucket{
+			scope: SCOPE_TENANT_PLUGIN,
+			key:   fmt.Sprintf("tenant_plugin:%s:%s", tenantID, pluginID),
+			limit: l.limits.PerTenantPlugin,
+		})
+	}
+	if l.limits.PerTenant > 0 {
+		buckets = append(buckets, bucket{
+			scope: SCOPE_TENANT,
+			key:   fmt.Sprintf("tenant:%s", tenantID),
+			limit: l.limits.PerTenant,
+		})
+	}
+	if l.limits.PerPlugin > 0 {
+		buckets = append(buckets, bucket{
+			scope: SCOPE_PLUGIN,
+			key:   fmt.Sprintf("plugin:%s", pluginID),
+			limit: l.limits.PerPlugin,
+		})
+	}
+	return buckets
+}
+
+// Acquire occupies a slot for a new session, it blocks until a slot is available
+// returns a *LimitExceededError if the wait timeout is reached
+func (l *Limiter) Acquire(tenantID string, pluginID string) (*Slot, error) {
+	buckets := l.buckets(tenantID, pluginID)
+	if len(buckets) == 0 {
+		return &Slot{}, nil
+	}
+
+	w := &waiter{
+		tenantID: tenantID,
+		pluginID: pluginID,
+		buckets:  buckets,
+		slotID:   uuid.New().String(),
+		ready:    make(chan bool),
+	}
+
+	l.watchOnce.Do(l.watchReleases)
+
+	startedAt := time.Now()
+
+	l.lock.Lock()
+	l.enqueue(w)
+	l.lock.Unlock()
+
+	timer := time.NewTimer(l.waitTimeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(DISPATCH_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	// a slow cache must not delay the timeout
+	l.dispatchAsync()
+
+	for {
+		select {
+		case <-w.ready:
+			if w.err != nil {
+				return nil, w.err
+			}
+			return l.newSlot(w), nil
+		case <-ticker.C:
+			l.dispatchAsync()
+		case <-timer.C:
+			l.lock.Lock()
+			if w.granted {
+				// granted right before the timeout
+				l.lock.Unlock()
+				if w.err != nil {
+					return nil, w.err
+				}
+				return l.newSlot(w), nil
+			}
+			l.remove(w)
+			w.abandoned = true
+			blockedBy := w.blockedBy
+			l.lock.Unlock()
+
+			err := &LimitExceededError{
+				TenantID: tenantID,
+				PluginID: pluginID,
+				Waited:   time.Since(startedAt),
+			}
+			if blockedBy != nil {
+				err.Scope = blockedBy.scope
+				err.Limit = blockedBy.limit
+			}
+			return nil, err
+		}
+	}
+}
+
+func (l *Limiter) enqueue(w *waiter) {
+	if _, ok := l.queues[w.tenantID]; !ok {
+		l.tenants = append(l.tenants, w.tenantID)
+	}
+	l.queues[w.tenantID] = append(l.queues[w.tenantID], w)
+}
+
+func (l *Limiter) remove(w *waiter) {
+	queue := l.queues[w.tenantID]
+	for i, v := range queue {
+		if v == w {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+
+	if len(queue) > 0 {
+		l.queues[w.tenantID] = queue
+		return
+	}
+
+	delete(l.queues, w.tenantID)
+	for i, tenant := range l.tenants {
+		if tenant == w.tenantID {
+			l.tenants = append(l.tenants[:i], l.tenants[i+1:]...)
+			if l.next > i {
+				l.next--
+			}
+			break
+		}
+	}
+	if l.next >= len(l.tenants) {
+		l.next = 0
+	}
+}
+
+func (l *Limiter) tenantIndex(tenantID string) int {
+	for i, tenant := range l.tenants {
+		if tenant == tenantID {
+			return i
+		}
+	}
+	return -1
+}
+
+// dispatch grants slots to waiters, one waiter of each tenant per round
+// it stops once a whole round makes no progress, the store is never accessed with the lock held
+func (l *Limiter) dispatch() {
+	l.lock.Lock()
+	if l.dispatching {
+		l.redispatch = true
+		l.lock.Unlock()
+		return
+	}
+	l.dispatching = true
+	l.lock.Unlock()
+
+	for {
+		for l.dispatchRound() {
+		}
+
+		l.lock.Lock()
+		if !l.redispatch {
+			l.dispatching = false
+			l.lock.Unlock()
+			return
+		}
+		l.redispatch = false
+		l.lock.Unlock()
+	}
+}
+
+func (l *Limiter) dispatchAsync() {
+	routine.Submit(map[string]string{
+		"module":   "concurrency_limiter",
+		"function": "dispatch",
+	}, l.dispatch)
+}
+
+// dispatchRound tries the head of each tenant once, returns whether any waiter was served
+func (l *Limiter) dispatchRound() bool {
+	l.lock.Lock()
+	// snapshot the round as granted tenants may leave the rotation
+	// only the head of each tenant is considered to keep the order within a tenant
+	round := make([]*waiter, 0, len(l.tenants))
+	for i := range l.tenants {
+		if queue := l.queues[l.tenants[(l.next+i)%len(l.tenants)]]; len(queue) > 0 {
+			round = append(round, queue[0])
+		}
+	}
+	l.lock.Unlock()
+
+	progressed := false
+	for _, w := range round {
+		blockedBy, err := l.store.tryAcquire(w.buckets, w.slotID, SLOT_LEASE_TTL)
+		if err != nil {
+			if l.failOpen {
+				log.Error("failed to acquire concurrency slot, the session is let through without limiting: %s", err.Error())
+				blockedBy = nil
+			} else {
+				log.Error("failed to acquire concurrency slot, the session is rejected: %s", err.Error())
+				err = fmt.Errorf("concurrency limiter is unavailable: %w", err)
+			}
+		}
+
+		l.lock.Lock()
+		if w.abandoned {
+			l.lock.Unlock()
+			if blockedBy == nil && err == nil {
+				if err := l.store.release(w.buckets, w.slotID); err != nil {
+					log.Warn("failed to release concurrency slot %s: %s", w.slotID, err.Error())
+				}
+			}
+			continue
+		}
+
+		if blockedBy != nil {
+			w.blockedBy = blockedBy
+			l.lock.Unlock()
+			continue
+		}
+
+		if !l.failOpen {
+			w.err = err
+		}
+		w.granted = true
+		close(w.ready)
+		progressed = true
+
+		// the next round starts from the tenant after the served one
+		index := l.tenantIndex(w.tenantID)
+		l.remove(w)
+		if len(l.tenants) == 0 {
+			l.next = 0
+		} else if l.tenantIndex(w.tenantID) == index {
+			l.next = (index + 1) % len(l.tenants)
+		} else {
+			// the tenant left the rotation, the following one took its place
+			l.next = index % len(l.tenants)
+		}
+		l.lock.Unlock()
+	}
+
+	return progressed
+}
+
+func (l *Limiter) newSlot(w *waiter) *Slot {
+	slot := &Slot{
+		limiter: l,
+		buckets: w.buckets,
+		slotID:  w.slotID,
+		done:    make(chan bool),
+	}
+
+	routine.Submit(map[string]string{
+		"module":   "concurrency_limiter",
+		"function": "renew",
+	}, slot.keepAlive)
+
+	return slot
+}
+
+// Slot is an occupied slot of a session, it must be released once the session is closed
+type Slot struct {
+	limiter *Limiter
+	buckets []bucket
+	slotID  string
+
+	done     chan bool
+	doneOnce sync.Once
+}
+
+func (s *Slot) keepAlive() {
+	ticker := time.NewTicker(SLOT_LEASE_TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.limiter.store.renew(s.buckets, s.slotID, SLOT_LEASE_TTL); err != nil {
+				log.Warn("failed to renew concurrency slot %s: %s", s.slotID, err.Error())
+			}
+		}
+	}
+}
+
+// Release frees the slot and serves the waiters, it's safe to be called multiple times
+func (s *Slot) Release() {
+	if s.limiter == nil {
+		return
+	}
+
+	s.doneOnce.Do(func() {
+		close(s.done)
+		if err := s.limiter.store.release(s.buckets, s.slotID); err != nil {
+			log.Warn("failed to release concurrency slot %s: %s", s.slotID, err.Error())
+		}
+
+		s.limiter.dispatchAsync()
+	})
+}
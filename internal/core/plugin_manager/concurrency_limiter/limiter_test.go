@@ -0,0 +1,199 @@
+package concurrency_limiter
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/stretchr/testify/assert"
+)
+
+type memorySlotStore struct {
+	lock  sync.Mutex
+	slots map[string]map[string]bool
+}
+
+func newMemorySlotStore() *memorySlotStore {
+	return &memorySlotStore{slots: map[string]map[string]bool{}}
+}
+
+func (s *memorySlotStore) tryAcquire(buckets []bucket, slotID string, ttl time.Duration) (*bucket, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i := range buckets {
+		if len(s.slots[buckets[i].key]) >= buckets[i].limit {
+			return &buckets[i], nil
+		}
+	}
+	for _, b := range buckets {
+		if s.slots[b.key] == nil {
+			s.slots[b.key] = map[string]bool{}
+		}
+		s.slots[b.key][slotID] = true
+	}
+	return nil, nil
+}
+
+func (s *memorySlotStore) renew(buckets []bucket, slotID string, ttl time.Duration) error {
+	return nil
+}
+
+func (s *memorySlotStore) release(buckets []bucket, slotID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, b := range buckets {
+		delete(s.slots[b.key], slotID)
+	}
+	return nil
+}
+
+func (s *memorySlotStore) released() <-chan struct{} {
+	return nil
+}
+
+func TestAcquireWithoutLimits(t *testing.T) {
+	limiter := newLimiter(Limits{}, time.Second, true, newMemorySlotStore())
+	slot, err := limiter.Acquire("tenant", "langgenius/openai")
+	assert.NoError(t, err)
+	slot.Release()
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	routine.InitPool(1024)
+
+	limiter := newLimiter(Limits{PerTenantPlugin: 1}, 300*time.Millisecond, true, newMemorySlotStore())
+	slot, err := limiter.Acquire("tenant", "langgenius/openai")
+	assert.NoError(t, err)
+	defer slot.Release()
+
+	_, err = limiter.Acquire("tenant", "langgenius/openai")
+	var limitErr *LimitExceededError
+	if assert.True(t, errors.As(err, &limitErr)) {
+		assert.Equal(t, SCOPE_TENANT_PLUGIN, limitErr.Scope)
+		assert.Equal(t, 1, limitErr.Limit)
+	}
+
+	// other tenants are not affected by the per (tenant, plugin) limit
+	other, err := limiter.Acquire("another-tenant", "langgenius/openai")
+	assert.NoError(t, err)
+	other.Release()
+}
+
+func TestFairQueueingAcrossTenants(t *testing.T) {
+	routine.InitPool(1024)
+
+	limiter := newLimiter(Limits{PerPlugin: 1}, 5*time.Second, true, newMemorySlotStore())
+	first, err := limiter.Acquire("noisy", "langgenius/openai")
+	assert.NoError(t, err)
+
+	order := make(chan string, 4)
+	acquire := func(tenant string) {
+		slot, err := limiter.Acquire(tenant, "langgenius/openai")
+		if !assert.NoError(t, err) {
+			return
+		}
+		order <- tenant
+		slot.Release()
+	}
+
+	// the noisy tenant queues several sessions before the quiet one
+	for i := 0; i < 3; i++ {
+		go acquire("noisy")
+	}
+	assert.Eventually(t, func() bool {
+		limiter.lock.Lock()
+		defer limiter.lock.Unlock()
+		return len(limiter.queues["noisy"]) == 3
+	}, time.Second, 10*time.Millisecond)
+	go acquire("quiet")
+	assert.Eventually(t, func() bool {
+		limiter.lock.Lock()
+		defer limiter.lock.Unlock()
+		return len(limiter.queues["quiet"]) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	first.Release()
+
+	served := []string{}
+	for i := 0; i < 4; i++ {
+		select {
+		case tenant := <-order:
+			served = append(served, tenant)
+		case <-time.After(3 * time.Second):
+			t.Fatal("waiters were not served")
+		}
+	}
+
+	// the quiet tenant is served within the first round instead of after all noisy sessions
+	assert.Contains(t, served[:2], "quiet")
+}
+
+type failingSlotStore struct {
+	memorySlotStore
+}
+
+func (s *failingSlotStore) tryAcquire(buckets []bucket, slotID string, ttl time.Duration) (*bucket, error) {
+	return nil, errors.New("cache is down")
+}
+
+func TestAcquireWithBrokenStore(t *testing.T) {
+	routine.InitPool(1024)
+
+	// failing open lets the session through without limiting
+	limiter := newLimiter(Limits{PerPlugin: 1}, time.Second, true, &failingSlotStore{})
+	slot, err := limiter.Acquire("tenant", "langgenius/openai")
+	assert.NoError(t, err)
+	slot.Release()
+
+	// failing closed rejects it right away instead of waiting for the timeout
+	limiter = newLimiter(Limits{PerPlugin: 1}, 5*time.Second, false, &failingSlotStore{})
+	startedAt := time.Now()
+	_, err = limiter.Acquire("tenant", "langgenius/openai")
+	assert.ErrorContains(t, err, "cache is down")
+	var limitErr *LimitExceededError
+	assert.False(t, errors.As(err, &limitErr))
+	assert.Less(t, time.Since(startedAt), time.Second)
+}
+
+// blocks acquiring until it's unblocked, like a slow cache
+type blockingSlotStore struct {
+	*memorySlotStore
+	unblock chan struct{}
+}
+
+func (s *blockingSlotStore) tryAcquire(buckets []bucket, slotID string, ttl time.Duration) (*bucket, error) {
+	<-s.unblock
+	return s.memorySlotStore.tryAcquire(buckets, slotID, ttl)
+}
+
+func TestSlowStoreDoesNotBlockLimiter(t *testing.T) {
+	routine.InitPool(1024)
+
+	store := &blockingSlotStore{memorySlotStore: newMemorySlotStore(), unblock: make(chan struct{})}
+	limiter := newLimiter(Limits{PerPlugin: 1}, 100*time.Millisecond, true, store)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := limiter.Acquire("tenant", "langgenius/openai")
+		result <- err
+	}()
+
+	// the waiter times out while the store is still busy
+	select {
+	case err := <-result:
+		var limitErr *LimitExceededError
+		assert.True(t, errors.As(err, &limitErr))
+	case <-time.After(3 * time.Second):
+		t.Fatal("the waiter was blocked by the store")
+	}
+
+	// the slot acquired for the abandoned waiter is given back
+	close(store.unblock)
+	assert.Eventually(t, func() bool {
+		store.lock.Lock()
+		defer store.lock.Unlock()
+		return len(store.slots["plugin:langgenius/openai"]) == 0 && len(store.slots) == 1
+	}, time.Second, 10*time.Millisecond)
+}
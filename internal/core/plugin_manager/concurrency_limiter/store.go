@@ -0,0 +1,191 @@
+package concurrency_limiter
+
+import (
+	"errors"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+)
+
+const (
+	CONCURRENCY_LIMITER_LOCK_KEY         = "concurrency_limiter:lock"
+	CONCURRENCY_LIMITER_PREFIX           = "concurrency_limiter:slots:"
+	CONCURRENCY_LIMITER_RELEASED_CHANNEL = "concurrency_limiter:released"
+)
+
+// slotStore keeps the occupied slots of all buckets, it's shared by all nodes of the cluster
+type slotStore interface {
+	// tryAcquire occupies a slot in every bucket if none of them is full
+	// returns the first full bucket if the slot could not be acquired
+	tryAcquire(buckets []bucket, slotID string, ttl time.Duration) (*bucket, error)
+	// renew extends the lease of the slot
+	renew(buckets []bucket, slotID string, ttl time.Duration) error
+	// release frees the slot in every bucket
+	release(buckets []bucket, slotID string) error
+	// released notifies about slots released by any node, nil if not supported
+	released() <-chan struct{}
+}
+
+// a bucket is a sorted set of slot ids scored by their lease deadline,
+// expired leases are dropped and the buckets are checked and occupied in a single step
+const acquireScript = `
+local now = tonumber(ARGV[1])
+for i, key in ipairs(KEYS) do
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now)
+	if not redis.call('ZSCORE', key, ARGV[3]) and redis.call('ZCARD', key) >= tonumber(ARGV[4 + i]) then
+		return i
+	end
+end
+for _, key in ipairs(KEYS) do
+	redis.call('ZADD', key, ARGV[2], ARGV[3])
+	redis.call('PEXPIRE', key, ARGV[4])
+end
+return 0
+`
+
+const renewScript = `
+for _, key in ipairs(KEYS) do
+	redis.call('ZADD', key, ARGV[1], ARGV[2])
+	redis.call('PEXPIRE', key, ARGV[3])
+end
+return 0
+`
+
+const releaseScript = `
+for _, key in ipairs(KEYS) do
+	redis.call('ZREM', key, ARGV[1])
+end
+return 0
+`
+
+type slotReleasedEvent struct {
+	SlotID string `json:"slot_id"`
+}
+
+// cacheSlotStore stores slots in the cache, leases of crashed nodes expire by themselves
+// so no slot leaks forever, caches without scripting fall back to maps guarded by a global lock
+type cacheSlotStore struct{}
+
+func bucketKeys(buckets []bucket) []string {
+	keys := make([]string, 0, len(buckets))
+	for _, b := range buckets {
+		keys = append(keys, CONCURRENCY_LIMITER_PREFIX+b.key)
+	}
+	return keys
+}
+
+func (s *cacheSlotStore) tryAcquire(buckets []bucket, slotID string, ttl time.Duration) (*bucket, error) {
+	now := time.Now()
+	args := []any{now.UnixMilli(), now.Add(ttl).UnixMilli(), slotID, (2 * ttl).Milliseconds()}
+	for _, b := range buckets {
+		args = append(args, b.limit)
+	}
+
+	result, err := cache.Eval(acquireScript, bucketKeys(buckets), args...)
+	if errors.Is(err, cache.ErrNotSupported) {
+		return s.lockedTryAcquire(buckets, slotID, ttl)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if index, _ := result.(int64); index > 0 && int(index) <= len(buckets) {
+		return &buckets[index-1], nil
+	}
+	return nil, nil
+}
+
+func (s *cacheSlotStore) renew(buckets []bucket, slotID string, ttl time.Duration) error {
+	_, err := cache.Eval(
+		renewScript, bucketKeys(buckets),
+		time.Now().Add(ttl).UnixMilli(), slotID, (2 * ttl).Milliseconds(),
+	)
+	if errors.Is(err, cache.ErrNotSupported) {
+		return s.lockedRenew(buckets, slotID, ttl)
+	}
+	return err
+}
+
+func (s *cacheSlotStore) release(buckets []bucket, slotID string) error {
+	_, err := cache.Eval(releaseScript, bucketKeys(buckets), slotID)
+	if errors.Is(err, cache.ErrNotSupported) {
+		err = s.lockedRelease(buckets, slotID)
+	}
+	if err != nil {
+		return err
+	}
+
+	// waiters on other nodes may take the slot now
+	return cache.Publish(CONCURRENCY_LIMITER_RELEASED_CHANNEL, slotReleasedEvent{SlotID: slotID})
+}
+
+func (s *cacheSlotStore) released() <-chan struct{} {
+	events, _ := cache.Subscribe[slotReleasedEvent](CONCURRENCY_LIMITER_RELEASED_CHANNEL)
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		for range events {
+			ch <- struct{}{}
+		}
+	}()
+
+	return ch
+}
+
+// lockedTryAcquire is used by caches without scripting, a bucket is a map from slot id to its lease deadline
+func (s *cacheSlotStore) lockedTryAcquire(buckets []bucket, slotID string, ttl time.Duration) (*bucket, error) {
+	if err := cache.Lock(CONCURRENCY_LIMITER_LOCK_KEY, 5*time.Second, 5*time.Second); err != nil {
+		return nil, err
+	}
+	defer cache.Unlock(CONCURRENCY_LIMITER_LOCK_KEY)
+
+	now := time.Now()
+	for i := range buckets {
+		slots, err := cache.GetMap[int64](CONCURRENCY_LIMITER_PREFIX + buckets[i].key)
+		if err != nil && !errors.Is(err, cache.ErrNotFound) {
+			return nil, err
+		}
+
+		occupied := 0
+		for id, deadline := range slots {
+			if time.UnixMilli(deadline).Before(now) {
+				// the lease was not renewed, the holder is gone
+				cache.DelMapField(CONCURRENCY_LIMITER_PREFIX+buckets[i].key, id)
+				continue
+			}
+			occupied++
+		}
+
+		if occupied >= buckets[i].limit {
+			return &buckets[i], nil
+		}
+	}
+
+	return nil, s.lockedRenew(buckets, slotID, ttl)
+}
+
+func (s *cacheSlotStore) lockedRenew(buckets []bucket, slotID string, ttl time.Duration) error {
+	deadline := time.Now().Add(ttl).UnixMilli()
+	for _, b := range buckets {
+		key := CONCURRENCY_LIMITER_PREFIX + b.key
+		if err := cache.SetMapOneField(key, slotID, deadline); err != nil {
+			return err
+		}
+		// drop the whole bucket if nobody uses it anymore
+		if _, err := cache.Expire(key, 2*ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *cacheSlotStore) lockedRelease(buckets []bucket, slotID string) error {
+	var errs []error
+	for _, b := range buckets {
+		if err := cache.DelMapField(CONCURRENCY_LIMITER_PREFIX+b.key, slotID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,55 @@
+package debugging_runtime
+
+import (
+	"net"
+
+	"github.com/panjf2000/gnet/v2"
+)
+
+// pluginConn is the transport of a remote plugin, a tcp connection served by gnet or a websocket
+type pluginConn interface {
+	// AsyncWrite queues the data to be written without blocking the caller
+	AsyncWrite(data []byte) error
+	// CloseWithMessage sends the message to the plugin and closes the connection
+	CloseWithMessage(message []byte)
+	Close() error
+	// RemoteAddress returns the address of the plugin
+	RemoteAddress() string
+}
+
+type gnetConn struct {
+	conn gnet.Conn
+
+	// resolves the address of the plugin if connections are proxied, e.g. when tls is enabled
+	clientAddr func(net.Addr) (net.Addr, bool)
+}
+
+func (c *gnetConn) AsyncWrite(data []byte) error {
+	return c.conn.AsyncWrite(data, func(c gnet.Conn, err error) error {
+		return nil
+	})
+}
+
+func (c *gnetConn) CloseWithMessage(message []byte) {
+	// connections are only allowed to be closed in their event loop
+	c.conn.AsyncWrite(message, func(c gnet.Conn, err error) error {
+		return c.Close()
+	})
+}
+
+func (c *gnetConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *gnetConn) RemoteAddress() string {
+	addr := c.conn.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	if c.clientAddr != nil {
+		if client, ok := c.clientAddr(addr); ok {
+			return client.String()
+		}
+	}
+	return addr.String()
+}
@@ -14,13 +14,15 @@ import (
  * Therefore, we need to a key-value pair to connect a random string to a tenant.
  *
  * $random_key => $tenant_id, $user_id
- * $tenant_id => $random_key
+ * $tenant_id[:$user_id] => $random_key
  *
  * It's a double mapping for each key, therefore a transaction is needed.
+ * Keys issued to a user are only valid for the user, keys without a user are shared by the tenant.
  * */
 
 type ConnectionInfo struct {
 	TenantId string `json:"tenant_id" validate:"required"`
+	UserId   string `json:"user_id,omitempty"`
 }
 
 type Key struct {
@@ -31,25 +33,41 @@ const (
 	CONNECTION_KEY_MANAGER_KEY2ID_PREFIX = "{remote:key:manager}:key2id"
 	CONNECTION_KEY_MANAGER_ID2KEY_PREFIX = "{remote:key:manager}:id2key"
 	CONNECTION_KEY_LOCK                  = "connection_lock"
-	CONNECTION_KEY_EXPIRE_TIME           = time.Minute * 120 // 2 hours
+	CONNECTION_KEY_EXPIRE_TIME           = time.Minute * 120 // 2 hours, used if no expire time is given
+	// revoked keys are published to disconnect their connections on all nodes
+	CONNECTION_KEY_REVOKED_CHANNEL = "remote:key:revoked"
 )
 
+func id2keyCacheKey(info ConnectionInfo) string {
+	keys := []string{CONNECTION_KEY_MANAGER_ID2KEY_PREFIX, info.TenantId}
+	if info.UserId != "" {
+		keys = append(keys, info.UserId)
+	}
+	return strings.Join(keys, ":")
+}
+
+func key2idCacheKey(key string) string {
+	return strings.Join([]string{CONNECTION_KEY_MANAGER_KEY2ID_PREFIX, key}, ":")
+}
+
 // returns a random string, create it if not exists
-func GetConnectionKey(info ConnectionInfo) (string, error) {
+func GetConnectionKey(info ConnectionInfo, expire time.Duration) (string, error) {
 	var key *Key
 	var err error
 
-	key, err = cache.Get[Key](
-		strings.Join([]string{CONNECTION_KEY_MANAGER_ID2KEY_PREFIX, info.TenantId}, ":"),
-	)
+	if expire <= 0 {
+		expire = CONNECTION_KEY_EXPIRE_TIME
+	}
+
+	key, err = cache.Get[Key](id2keyCacheKey(info))
 
 	if err == cache.ErrNotFound {
 		err := cache.Transaction(func(context cache.Context) error {
 			k := uuid.New().String()
 			_, err = cache.SetNX(
-				strings.Join([]string{CONNECTION_KEY_MANAGER_ID2KEY_PREFIX, info.TenantId}, ":"),
+				id2keyCacheKey(info),
 				Key{Key: k},
-				CONNECTION_KEY_EXPIRE_TIME,
+				expire,
 				context,
 			)
 			if err != nil {
@@ -57,9 +75,9 @@ func GetConnectionKey(info ConnectionInfo) (string, error) {
 			}
 
 			_, err = cache.SetNX(
-				strings.Join([]string{CONNECTION_KEY_MANAGER_KEY2ID_PREFIX, k}, ":"),
+				key2idCacheKey(k),
 				info,
-				CONNECTION_KEY_EXPIRE_TIME,
+				expire,
 				context,
 			)
 			if err != nil {
@@ -78,13 +96,13 @@ func GetConnectionKey(info ConnectionInfo) (string, error) {
 		return "", err
 	} else {
 		// update expire time
-		_, err = cache.Expire(strings.Join([]string{CONNECTION_KEY_MANAGER_ID2KEY_PREFIX, info.TenantId}, ":"), CONNECTION_KEY_EXPIRE_TIME)
+		_, err = cache.Expire(id2keyCacheKey(info), expire)
 		if err != nil {
 			log.Error("failed to update connection key expire time: %s", err.Error())
 		}
 
 		// update expire time for key
-		_, err = cache.Expire(strings.Join([]string{CONNECTION_KEY_MANAGER_KEY2ID_PREFIX, key.Key}, ":"), CONNECTION_KEY_EXPIRE_TIME)
+		_, err = cache.Expire(key2idCacheKey(key.Key), expire)
 		if err != nil {
 			log.Error("failed to update connection key expire time: %s", err.Error())
 		}
@@ -93,30 +111,90 @@ func GetConnectionKey(info ConnectionInfo) (string, error) {
 	return key.Key, nil
 }
 
-// get connection info by key
-func GetConnectionInfo(key string) (*ConnectionInfo, error) {
-	info, err := cache.Get[ConnectionInfo](
-		strings.Join([]string{CONNECTION_KEY_MANAGER_KEY2ID_PREFIX, key}, ":"),
-	)
+// RotateConnectionKey replaces the key with a new one, connections using the old key are closed
+func RotateConnectionKey(info ConnectionInfo, expire time.Duration) (string, error) {
+	if expire <= 0 {
+		expire = CONNECTION_KEY_EXPIRE_TIME
+	}
 
-	if err != nil {
-		return nil, err
+	oldKey, err := cache.Get[Key](id2keyCacheKey(info))
+	if err != nil && err != cache.ErrNotFound {
+		return "", err
 	}
 
-	return info, nil
+	k := uuid.New().String()
+	if err := cache.Transaction(func(context cache.Context) error {
+		if err := cache.Store(id2keyCacheKey(info), Key{Key: k}, expire, context); err != nil {
+			return err
+		}
+
+		if err := cache.Store(key2idCacheKey(k), info, expire, context); err != nil {
+			return err
+		}
+
+		if oldKey != nil {
+			if _, err := cache.Del(key2idCacheKey(oldKey.Key), context); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	if oldKey != nil {
+		publishRevokedConnectionKey(oldKey.Key)
+	}
+
+	return k, nil
 }
 
-// clear connection key
-func ClearConnectionKey(tenant_id string) error {
-	key, err := cache.Get[Key](
-		strings.Join([]string{CONNECTION_KEY_MANAGER_ID2KEY_PREFIX, tenant_id}, ":"),
-	)
+// RevokeConnectionKey deletes the key, connections using it are closed, revoking a missing key is a no-op
+func RevokeConnectionKey(info ConnectionInfo) error {
+	key, err := cache.Get[Key](id2keyCacheKey(info))
+	if err == cache.ErrNotFound {
+		return nil
+	}
 
 	if err != nil {
 		return err
 	}
 
-	cache.Del(strings.Join([]string{CONNECTION_KEY_MANAGER_KEY2ID_PREFIX, key.Key}, ":"))
-	cache.Del(strings.Join([]string{CONNECTION_KEY_MANAGER_ID2KEY_PREFIX, tenant_id}, ":"))
+	if err := cache.Transaction(func(context cache.Context) error {
+		if _, err := cache.Del(key2idCacheKey(key.Key), context); err != nil {
+			return err
+		}
+		if _, err := cache.Del(id2keyCacheKey(info), context); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	publishRevokedConnectionKey(key.Key)
 	return nil
 }
+
+func publishRevokedConnectionKey(key string) {
+	if err := cache.Publish(CONNECTION_KEY_REVOKED_CHANNEL, Key{Key: key}); err != nil {
+		log.Error("failed to publish the revoked connection key: %s", err.Error())
+	}
+}
+
+// get connection info by key
+func GetConnectionInfo(key string) (*ConnectionInfo, error) {
+	info, err := cache.Get[ConnectionInfo](key2idCacheKey(key))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// clear connection key of a tenant
+func ClearConnectionKey(tenant_id string) error {
+	return RevokeConnectionKey(ConnectionInfo{TenantId: tenant_id})
+}
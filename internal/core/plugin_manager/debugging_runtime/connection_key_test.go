@@ -2,13 +2,15 @@ package debugging_runtime
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache/redis"
 )
 
 func TestConnectionKey(t *testing.T) {
-	err := cache.InitRedisClient("0.0.0.0:6379", "", "difyai123456", false, 0)
+	err := redis.InitRedisClient("0.0.0.0:6379", "", "difyai123456", false, 0)
 	if err != nil {
 		t.Errorf("init redis client failed: %v", err)
 		return
@@ -18,7 +20,7 @@ func TestConnectionKey(t *testing.T) {
 	// test connection key
 	key, err := GetConnectionKey(ConnectionInfo{
 		TenantId: "abc",
-	})
+	}, 0)
 
 	if err != nil {
 		t.Errorf("get connection key failed: %v", err)
@@ -36,7 +38,7 @@ func TestConnectionKey(t *testing.T) {
 	// test connection key with the same tenant id
 	key2, err := GetConnectionKey(ConnectionInfo{
 		TenantId: "abc",
-	})
+	}, 0)
 
 	if err != nil {
 		t.Errorf("get connection key failed: %v", err)
@@ -58,4 +60,46 @@ func TestConnectionKey(t *testing.T) {
 		t.Errorf("connection info is not the same: %v", connectionInfo)
 		return
 	}
+
+	// keys of users are independent from the key of the tenant
+	userKey, err := GetConnectionKey(ConnectionInfo{TenantId: "abc", UserId: "user"}, time.Minute)
+	if err != nil {
+		t.Errorf("get connection key failed: %v", err)
+		return
+	}
+	defer RevokeConnectionKey(ConnectionInfo{TenantId: "abc", UserId: "user"})
+
+	if userKey == key {
+		t.Errorf("user key is the same as the tenant key: %s", userKey)
+		return
+	}
+
+	// rotating invalidates the old key
+	rotatedKey, err := RotateConnectionKey(ConnectionInfo{TenantId: "abc", UserId: "user"}, time.Minute)
+	if err != nil {
+		t.Errorf("rotate connection key failed: %v", err)
+		return
+	}
+
+	if _, err := GetConnectionInfo(userKey); err != cache.ErrNotFound {
+		t.Errorf("rotated key is still valid: %v", err)
+		return
+	}
+
+	connectionInfo, err = GetConnectionInfo(rotatedKey)
+	if err != nil || connectionInfo.UserId != "user" {
+		t.Errorf("get connection info of rotated key failed: %v, %v", err, connectionInfo)
+		return
+	}
+
+	// revoking invalidates the key
+	if err := RevokeConnectionKey(ConnectionInfo{TenantId: "abc", UserId: "user"}); err != nil {
+		t.Errorf("revoke connection key failed: %v", err)
+		return
+	}
+
+	if _, err := GetConnectionInfo(rotatedKey); err != cache.ErrNotFound {
+		t.Errorf("revoked key is still valid: %v", err)
+		return
+	}
 }
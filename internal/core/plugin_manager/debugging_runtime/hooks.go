@@ -3,16 +3,20 @@ package debugging_runtime
 import (
 	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/basic_runtime"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/media_transport"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
 	"github.com/panjf2000/gnet/v2"
@@ -51,22 +55,53 @@ type DifyServer struct {
 
 	maxConn     int32
 	currentConn int32
+
+	// max connections of a tenant across the cluster, 0 means unlimited
+	maxSingleTenantConn int
+
+	// resolves the address of a plugin if connections are proxied, e.g. when tls is enabled
+	clientAddr func(net.Addr) (net.Addr, bool)
+
+	// called once the engine is listening, e.g. to start proxies forwarding to it
+	onBoot func(gnet.Engine) error
+
+	// ids of websocket connections, negative to never collide with the fds of tcp connections
+	lastWebSocketID int64
 }
 
 func (s *DifyServer) OnBoot(c gnet.Engine) (action gnet.Action) {
 	s.engine = c
+	if s.onBoot != nil {
+		if err := s.onBoot(c); err != nil {
+			log.Error("failed to boot the plugin server: %s", err.Error())
+			return gnet.Shutdown
+		}
+	}
 	return gnet.None
 }
 
 func (s *DifyServer) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
 	// new plugin connected
 	c.SetContext(&codec{})
+	s.onConnected(c.Fd(), &gnetConn{conn: c, clientAddr: s.clientAddr})
+
+	// verified
+	verified := true
+	if verified {
+		return nil, gnet.None
+	}
+
+	return nil, gnet.Close
+}
+
+// onConnected creates the runtime of a new connection, id identifies the connection on this server
+func (s *DifyServer) onConnected(id int, conn pluginConn) *RemotePluginRuntime {
 	runtime := &RemotePluginRuntime{
 		MediaTransport: basic_runtime.NewMediaTransport(
 			s.mediaManager,
 		),
 
-		conn:                      c,
+		conn:                      conn,
 		response:                  stream.NewStream[[]byte](512),
 		messageCallbacks:          make(map[string][]func([]byte)),
 		messageCallbacksLock:      &sync.RWMutex{},
@@ -84,40 +119,59 @@ func (s *DifyServer) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
 
 	// store plugin runtime
 	s.pluginsLock.Lock()
-	s.plugins[c.Fd()] = runtime
+	s.plugins[id] = runtime
 	s.pluginsLock.Unlock()
 
 	// start a timer to check if handshake is completed in 10 seconds
 	time.AfterFunc(time.Second*10, func() {
 		if !runtime.handshake {
 			// close connection
-			c.Close()
+			conn.Close()
 		}
 	})
 
-	// verified
-	verified := true
-	if verified {
-		return nil, gnet.None
-	}
-
-	return nil, gnet.Close
+	return runtime
 }
 
 func (s *DifyServer) OnClose(c gnet.Conn, err error) (action gnet.Action) {
+	s.onDisconnected(c.Fd())
+	return gnet.None
+}
+
+func (s *DifyServer) onDisconnected(id int) {
 	// plugin disconnected
 	s.pluginsLock.Lock()
-	plugin := s.plugins[c.Fd()]
-	delete(s.plugins, c.Fd())
+	plugin := s.plugins[id]
+	delete(s.plugins, id)
 	s.pluginsLock.Unlock()
 
 	if plugin == nil {
-		return gnet.None
+		return
 	}
 
 	// close plugin
 	plugin.onDisconnected()
 
+	// the launch may still take the connection slots, the runtime is cleaned up once it's done
+	if plugin.launched != nil {
+		select {
+		case <-plugin.launched:
+		default:
+			routine.Submit(map[string]string{
+				"module":   "debugging_runtime",
+				"function": "cleanupRuntime",
+			}, func() {
+				<-plugin.launched
+				s.cleanupRuntime(plugin)
+			})
+			return
+		}
+	}
+
+	s.cleanupRuntime(plugin)
+}
+
+func (s *DifyServer) cleanupRuntime(plugin *RemotePluginRuntime) {
 	// uninstall plugin
 	if plugin.assetsTransferred {
 		if _mode != _PLUGIN_RUNTIME_MODE_CI {
@@ -126,12 +180,12 @@ func (s *DifyServer) OnClose(c gnet.Conn, err error) (action gnet.Action) {
 					log.Error("unregister plugin failed, error: %v", err)
 				}
 			}
-
-			// decrease current connection
-			atomic.AddInt32(&s.currentConn, -1)
 		}
 	}
 
+	// release the connection slots
+	s.releaseConnection(plugin)
+
 	// send stopped event
 	plugin.waitChanLock.Lock()
 	for _, c := range plugin.waitStoppedChan {
@@ -146,8 +200,112 @@ func (s *DifyServer) OnClose(c gnet.Conn, err error) (action gnet.Action) {
 	plugin.waitLaunchedChanOnce.Do(func() {
 		close(plugin.waitLaunchedChan)
 	})
+}
 
-	return gnet.None
+// acquireConnection takes a slot of the server and a slot of the tenant for the runtime,
+// both are released once the runtime disconnects
+func (s *DifyServer) acquireConnection(runtime *RemotePluginRuntime) error {
+	for {
+		current := atomic.LoadInt32(&s.currentConn)
+		if current >= s.maxConn {
+			return ErrServerBusy
+		}
+		if atomic.CompareAndSwapInt32(&s.currentConn, current, current+1) {
+			break
+		}
+	}
+
+	if _mode != _PLUGIN_RUNTIME_MODE_CI {
+		identity, err := runtime.Identity()
+		if err != nil {
+			atomic.AddInt32(&s.currentConn, -1)
+			return err
+		}
+
+		session := &DebuggingSession{
+			ID:                     uuid.New().String(),
+			TenantID:               runtime.tenantId,
+			UserID:                 runtime.userId,
+			PluginUniqueIdentifier: identity.String(),
+			RemoteAddress:          runtime.conn.RemoteAddress(),
+			ConnectedAt:            time.Now(),
+		}
+		if err := acquireDebuggingSession(session, s.maxSingleTenantConn); err != nil {
+			atomic.AddInt32(&s.currentConn, -1)
+			if !errors.Is(err, ErrTenantConnectionsExceeded) {
+				log.Error("failed to acquire debugging session: %s", err.Error())
+			}
+			return err
+		}
+		runtime.session = session
+	}
+
+	runtime.connectionAcquired = true
+	return nil
+}
+
+func (s *DifyServer) releaseConnection(runtime *RemotePluginRuntime) {
+	if !runtime.connectionAcquired {
+		return
+	}
+	runtime.connectionAcquired = false
+
+	atomic.AddInt32(&s.currentConn, -1)
+	if runtime.session != nil {
+		releaseDebuggingSession(runtime.session)
+	}
+}
+
+// debuggingSessions returns the runtimes of this node holding a debugging session
+func (s *DifyServer) debuggingSessions() []*RemotePluginRuntime {
+	s.pluginsLock.RLock()
+	defer s.pluginsLock.RUnlock()
+
+	runtimes := []*RemotePluginRuntime{}
+	for _, runtime := range s.plugins {
+		if runtime.session != nil {
+			runtimes = append(runtimes, runtime)
+		}
+	}
+	return runtimes
+}
+
+func (s *DifyServer) refreshDebuggingSessions() {
+	for _, runtime := range s.debuggingSessions() {
+		refreshDebuggingSession(*runtime.session)
+	}
+}
+
+// closeDebuggingSession closes the connection of a session if it's on this node
+func (s *DifyServer) closeDebuggingSession(tenantID string, sessionID string) {
+	for _, runtime := range s.debuggingSessions() {
+		if runtime.session.TenantID == tenantID && runtime.session.ID == sessionID {
+			runtime.closeWithMessage([]byte("disconnected by the workspace\n"))
+		}
+	}
+}
+
+// closeConnectionsByKey closes the connections established with a revoked key
+func (s *DifyServer) closeConnectionsByKey(key string) {
+	s.pluginsLock.RLock()
+	runtimes := []*RemotePluginRuntime{}
+	for _, runtime := range s.plugins {
+		if runtime.connectionKey == key {
+			runtimes = append(runtimes, runtime)
+		}
+	}
+	s.pluginsLock.RUnlock()
+
+	for _, runtime := range runtimes {
+		runtime.closeWithMessage([]byte("connection key revoked\n"))
+	}
+}
+
+// closeWithMessage sends the message to the plugin and closes the connection, only the first call takes effect
+func (r *RemotePluginRuntime) closeWithMessage(message []byte) {
+	if atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		r.conn.CloseWithMessage(message)
+	}
 }
 
 func (s *DifyServer) OnShutdown(c gnet.Engine) {
@@ -188,15 +346,37 @@ func (s *DifyServer) onMessage(runtime *RemotePluginRuntime, message []byte) {
 		return
 	}
 
-	closeConn := func(message []byte) {
-		if atomic.CompareAndSwapInt32(&runtime.closed, 0, 1) {
-			runtime.conn.Write(message)
-			runtime.conn.Close()
+	if runtime.initialized.Load() {
+		// continue handle messages if handshake completed
+		runtime.response.WriteBlocking(message)
+		return
+	}
+
+	if runtime.launched != nil {
+		// the registration is done, messages are handled once the runtime is launched
+		if !runtime.deferMessage(message) {
+			runtime.response.WriteBlocking(message)
 		}
+		return
+	}
+
+	closeConn := runtime.closeWithMessage
+
+	registerPayload, err := parser.UnmarshalJsonBytes[plugin_entities.RemotePluginRegisterPayload](message)
+	if err != nil {
+		// close connection if handshake failed
+		closeConn([]byte("handshake failed, invalid handshake message\n"))
+		runtime.handshakeFailed = true
+		return
 	}
 
-	if !runtime.initialized {
-		registerPayload, err := parser.UnmarshalJsonBytes[plugin_entities.RemotePluginRegisterPayload](message)
+	if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_HAND_SHAKE {
+		if runtime.handshake {
+			// handshake already completed
+			return
+		}
+
+		key, err := parser.UnmarshalJsonBytes[plugin_entities.RemotePluginRegisterHandshake](registerPayload.Data)
 		if err != nil {
 			// close connection if handshake failed
 			closeConn([]byte("handshake failed, invalid handshake message\n"))
@@ -204,228 +384,272 @@ func (s *DifyServer) onMessage(runtime *RemotePluginRuntime, message []byte) {
 			return
 		}
 
-		if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_HAND_SHAKE {
-			if runtime.handshake {
-				// handshake already completed
-				return
-			}
-
-			key, err := parser.UnmarshalJsonBytes[plugin_entities.RemotePluginRegisterHandshake](registerPayload.Data)
-			if err != nil {
-				// close connection if handshake failed
-				closeConn([]byte("handshake failed, invalid handshake message\n"))
-				runtime.handshakeFailed = true
-				return
-			}
-
-			info, err := GetConnectionInfo(key.Key)
-			if err == cache.ErrNotFound {
-				// close connection if handshake failed
-				closeConn([]byte("handshake failed, invalid key\n"))
-				runtime.handshakeFailed = true
-				return
-			} else if err != nil {
-				// close connection if handshake failed
-				log.Error("failed to get connection info: %v", err)
-				closeConn([]byte("internal error\n"))
-				return
-			}
+		info, err := GetConnectionInfo(key.Key)
+		if err == cache.ErrNotFound {
+			// close connection if handshake failed
+			closeConn([]byte("handshake failed, invalid key\n"))
+			runtime.handshakeFailed = true
+			return
+		} else if err != nil {
+			// close connection if handshake failed
+			log.Error("failed to get connection info: %v", err)
+			closeConn([]byte("internal error\n"))
+			return
+		}
 
-			runtime.tenantId = info.TenantId
+		runtime.tenantId = info.TenantId
+		runtime.userId = info.UserId
+		runtime.connectionKey = key.Key
 
-			// handshake completed
-			runtime.handshake = true
-		} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_ASSET_CHUNK {
-			if runtime.assetsTransferred {
-				return
-			}
+		// handshake completed
+		runtime.handshake = true
+	} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_ASSET_CHUNK {
+		if runtime.assetsTransferred {
+			return
+		}
 
-			assetChunk, err := parser.UnmarshalJsonBytes[plugin_entities.RemotePluginRegisterAssetChunk](registerPayload.Data)
-			if err != nil {
-				log.Error("assets register failed, error: %v", err)
-				closeConn([]byte("assets register failed, invalid assets chunk\n"))
-				return
-			}
+		assetChunk, err := parser.UnmarshalJsonBytes[plugin_entities.RemotePluginRegisterAssetChunk](registerPayload.Data)
+		if err != nil {
+			log.Error("assets register failed, error: %v", err)
+			closeConn([]byte("assets register failed, invalid assets chunk\n"))
+			return
+		}
 
-			buffer, ok := runtime.assets[assetChunk.Filename]
-			if !ok {
-				runtime.assets[assetChunk.Filename] = &bytes.Buffer{}
-				buffer = runtime.assets[assetChunk.Filename]
-			}
+		buffer, ok := runtime.assets[assetChunk.Filename]
+		if !ok {
+			runtime.assets[assetChunk.Filename] = &bytes.Buffer{}
+			buffer = runtime.assets[assetChunk.Filename]
+		}
 
-			// allows at most 50MB assets
-			if runtime.assetsBytes+int64(len(assetChunk.Data)) > 50*1024*1024 {
-				closeConn([]byte("assets too large, at most 50MB\n"))
-				return
-			}
+		// allows at most 50MB assets
+		if runtime.assetsBytes+int64(len(assetChunk.Data)) > 50*1024*1024 {
+			closeConn([]byte("assets too large, at most 50MB\n"))
+			return
+		}
 
-			// decode as base64
-			data, err := base64.StdEncoding.DecodeString(assetChunk.Data)
-			if err != nil {
-				log.Error("assets decode failed, error: %v", err)
-				closeConn([]byte("assets decode failed, invalid assets data\n"))
-				return
-			}
+		// decode as base64
+		data, err := base64.StdEncoding.DecodeString(assetChunk.Data)
+		if err != nil {
+			log.Error("assets decode failed, error: %v", err)
+			closeConn([]byte("assets decode failed, invalid assets data\n"))
+			return
+		}
 
-			buffer.Write(data)
-
-			// update assets bytes
-			runtime.assetsBytes += int64(len(data))
-		} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_END {
-			if !runtime.modelsRegistrationTransferred &&
-				!runtime.endpointsRegistrationTransferred &&
-				!runtime.toolsRegistrationTransferred &&
-				!runtime.agentStrategyRegistrationTransferred {
-				closeConn([]byte("no registration transferred, cannot initialize\n"))
-				return
-			}
+		buffer.Write(data)
 
-			files := make(map[string][]byte)
-			for filename, buffer := range runtime.assets {
-				files[filename] = buffer.Bytes()
-			}
+		// update assets bytes
+		runtime.assetsBytes += int64(len(data))
+	} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_END {
+		if !runtime.modelsRegistrationTransferred &&
+			!runtime.endpointsRegistrationTransferred &&
+			!runtime.toolsRegistrationTransferred &&
+			!runtime.agentStrategyRegistrationTransferred {
+			closeConn([]byte("no registration transferred, cannot initialize\n"))
+			return
+		}
 
-			// remap assets
-			if err := runtime.RemapAssets(&runtime.Config, files); err != nil {
-				log.Error("assets remap failed, error: %v", err)
-				closeConn([]byte(fmt.Sprintf("assets remap failed, invalid assets data, cannot remap: %v\n", err)))
-				return
-			}
+		files := make(map[string][]byte)
+		for filename, buffer := range runtime.assets {
+			files[filename] = buffer.Bytes()
+		}
 
-			atomic.AddInt32(&s.currentConn, 1)
-			if atomic.LoadInt32(&s.currentConn) > int32(s.maxConn) {
-				closeConn([]byte("server is busy now, please try again later\n"))
-				return
-			}
+		// remap assets
+		if err := runtime.RemapAssets(&runtime.Config, files); err != nil {
+			log.Error("assets remap failed, error: %v", err)
+			closeConn([]byte(fmt.Sprintf("assets remap failed, invalid assets data, cannot remap: %v\n", err)))
+			return
+		}
 
-			// fill in default values
-			runtime.Config.FillInDefaultValues()
+		// fill in default values
+		runtime.Config.FillInDefaultValues()
 
-			// mark assets transferred
-			runtime.assetsTransferred = true
+		// mark assets transferred
+		runtime.assetsTransferred = true
 
-			runtime.checksum = runtime.calculateChecksum()
-			runtime.InitState()
-			runtime.SetActiveAt(time.Now())
+		runtime.checksum = runtime.calculateChecksum()
 
-			// trigger registration event
-			if err := runtime.Register(); err != nil {
-				closeConn([]byte(fmt.Sprintf("register failed, cannot register: %v\n", err)))
-				return
-			}
+		// taking the slots waits for the cluster, it must not block the event loop
+		runtime.launched = make(chan struct{})
+		routine.Submit(map[string]string{
+			"module":   "debugging_runtime",
+			"function": "launch",
+		}, func() {
+			s.launch(runtime)
+		})
+	} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_MANIFEST_DECLARATION {
+		if runtime.registrationTransferred {
+			return
+		}
 
-			// send started event
-			runtime.waitChanLock.Lock()
-			for _, c := range runtime.waitStartedChan {
-				select {
-				case c <- true:
-				default:
-				}
-			}
-			runtime.waitChanLock.Unlock()
+		// process handle shake if not completed
+		declaration, err := parser.UnmarshalJsonBytes[plugin_entities.PluginDeclaration](registerPayload.Data)
+		if err != nil {
+			// close connection if handshake failed
+			closeConn([]byte(fmt.Sprintf("handshake failed, invalid plugin declaration: %v\n", err)))
+			return
+		}
 
-			// notify launched
-			runtime.waitLaunchedChanOnce.Do(func() {
-				close(runtime.waitLaunchedChan)
-			})
+		runtime.Config = declaration
 
-			// mark initialized
-			runtime.initialized = true
+		// registration transferred
+		runtime.registrationTransferred = true
+	} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_TOOL_DECLARATION {
+		if runtime.toolsRegistrationTransferred {
+			return
+		}
 
-			// publish runtime to watcher
-			s.response.Write(runtime)
-		} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_MANIFEST_DECLARATION {
-			if runtime.registrationTransferred {
-				return
-			}
+		tools, err := parser.UnmarshalJsonBytes2Slice[plugin_entities.ToolProviderDeclaration](registerPayload.Data)
+		if err != nil {
+			closeConn([]byte(fmt.Sprintf("tools register failed, invalid tools declaration: %v\n", err)))
+			return
+		}
 
-			// process handle shake if not completed
-			declaration, err := parser.UnmarshalJsonBytes[plugin_entities.PluginDeclaration](registerPayload.Data)
-			if err != nil {
-				// close connection if handshake failed
-				closeConn([]byte(fmt.Sprintf("handshake failed, invalid plugin declaration: %v\n", err)))
-				return
-			}
+		runtime.toolsRegistrationTransferred = true
 
+		if len(tools) > 0 {
+			declaration := runtime.Config
+			declaration.Tool = &tools[0]
 			runtime.Config = declaration
+		}
+	} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_MODEL_DECLARATION {
+		if runtime.modelsRegistrationTransferred {
+			return
+		}
 
-			// registration transferred
-			runtime.registrationTransferred = true
-		} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_TOOL_DECLARATION {
-			if runtime.toolsRegistrationTransferred {
-				return
-			}
+		models, err := parser.UnmarshalJsonBytes2Slice[plugin_entities.ModelProviderDeclaration](registerPayload.Data)
+		if err != nil {
+			closeConn([]byte(fmt.Sprintf("models register failed, invalid models declaration: %v\n", err)))
+			return
+		}
 
-			tools, err := parser.UnmarshalJsonBytes2Slice[plugin_entities.ToolProviderDeclaration](registerPayload.Data)
-			if err != nil {
-				closeConn([]byte(fmt.Sprintf("tools register failed, invalid tools declaration: %v\n", err)))
-				return
-			}
+		runtime.modelsRegistrationTransferred = true
 
-			runtime.toolsRegistrationTransferred = true
+		if len(models) > 0 {
+			declaration := runtime.Config
+			declaration.Model = &models[0]
+			runtime.Config = declaration
+		}
+	} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_ENDPOINT_DECLARATION {
+		if runtime.endpointsRegistrationTransferred {
+			return
+		}
 
-			if len(tools) > 0 {
-				declaration := runtime.Config
-				declaration.Tool = &tools[0]
-				runtime.Config = declaration
-			}
-		} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_MODEL_DECLARATION {
-			if runtime.modelsRegistrationTransferred {
-				return
-			}
+		endpoints, err := parser.UnmarshalJsonBytes2Slice[plugin_entities.EndpointProviderDeclaration](registerPayload.Data)
+		if err != nil {
+			closeConn([]byte(fmt.Sprintf("endpoints register failed, invalid endpoints declaration: %v\n", err)))
+			return
+		}
 
-			models, err := parser.UnmarshalJsonBytes2Slice[plugin_entities.ModelProviderDeclaration](registerPayload.Data)
-			if err != nil {
-				closeConn([]byte(fmt.Sprintf("models register failed, invalid models declaration: %v\n", err)))
-				return
-			}
+		runtime.endpointsRegistrationTransferred = true
 
-			runtime.modelsRegistrationTransferred = true
+		if len(endpoints) > 0 {
+			declaration := runtime.Config
+			declaration.Endpoint = &endpoints[0]
+			runtime.Config = declaration
+		}
+	} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_AGENT_STRATEGY_DECLARATION {
+		if runtime.agentStrategyRegistrationTransferred {
+			return
+		}
 
-			if len(models) > 0 {
-				declaration := runtime.Config
-				declaration.Model = &models[0]
-				runtime.Config = declaration
-			}
-		} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_ENDPOINT_DECLARATION {
-			if runtime.endpointsRegistrationTransferred {
-				return
-			}
+		agents, err := parser.UnmarshalJsonBytes2Slice[plugin_entities.AgentStrategyProviderDeclaration](registerPayload.Data)
+		if err != nil {
+			closeConn([]byte(fmt.Sprintf("agent strategies register failed, invalid agent strategies declaration: %v\n", err)))
+			return
+		}
 
-			endpoints, err := parser.UnmarshalJsonBytes2Slice[plugin_entities.EndpointProviderDeclaration](registerPayload.Data)
-			if err != nil {
-				closeConn([]byte(fmt.Sprintf("endpoints register failed, invalid endpoints declaration: %v\n", err)))
-				return
-			}
+		runtime.agentStrategyRegistrationTransferred = true
 
-			runtime.endpointsRegistrationTransferred = true
+		if len(agents) > 0 {
+			declaration := runtime.Config
+			declaration.AgentStrategy = &agents[0]
+			runtime.Config = declaration
+		}
+	}
+}
 
-			if len(endpoints) > 0 {
-				declaration := runtime.Config
-				declaration.Endpoint = &endpoints[0]
-				runtime.Config = declaration
-			}
-		} else if registerPayload.Type == plugin_entities.REGISTER_EVENT_TYPE_AGENT_STRATEGY_DECLARATION {
-			if runtime.agentStrategyRegistrationTransferred {
-				return
-			}
+// launch takes the connection slots and registers the runtime, it's published once it's ready
+func (s *DifyServer) launch(runtime *RemotePluginRuntime) {
+	defer close(runtime.launched)
 
-			agents, err := parser.UnmarshalJsonBytes2Slice[plugin_entities.AgentStrategyProviderDeclaration](registerPayload.Data)
-			if err != nil {
-				closeConn([]byte(fmt.Sprintf("agent strategies register failed, invalid agent strategies declaration: %v\n", err)))
-				return
-			}
+	// take a slot of the server and of the tenant
+	if err := s.acquireConnection(runtime); err != nil {
+		runtime.abortLaunch([]byte(err.Error() + "\n"))
+		return
+	}
+	runtime.InitState()
+	runtime.SetActiveAt(time.Now())
 
-			runtime.agentStrategyRegistrationTransferred = true
+	// trigger registration event
+	if err := runtime.Register(); err != nil {
+		runtime.abortLaunch([]byte(fmt.Sprintf("register failed, cannot register: %v\n", err)))
+		return
+	}
 
-			if len(agents) > 0 {
-				declaration := runtime.Config
-				declaration.AgentStrategy = &agents[0]
-				runtime.Config = declaration
-			}
+	// send started event
+	runtime.waitChanLock.Lock()
+	for _, c := range runtime.waitStartedChan {
+		select {
+		case c <- true:
+		default:
 		}
-	} else {
-		// continue handle messages if handshake completed
+	}
+	runtime.waitChanLock.Unlock()
+
+	// notify launched
+	runtime.waitLaunchedChanOnce.Do(func() {
+		close(runtime.waitLaunchedChan)
+	})
+
+	// mark initialized, messages received meanwhile are handled first
+	runtime.launchLock.Lock()
+	for _, message := range runtime.pendingMessages {
 		runtime.response.WriteBlocking(message)
 	}
+	runtime.pendingMessages = nil
+	runtime.pendingBytes = 0
+	runtime.initialized.Store(true)
+	runtime.launchLock.Unlock()
+
+	// publish runtime to watcher
+	s.response.Write(runtime)
+}
+
+// messages kept while launching, plugins sending more are disconnected
+const MAX_PENDING_MESSAGES_BYTES = 4 * 1024 * 1024
+
+// deferMessage keeps the message until the runtime is launched, returns false if it's launched already
+func (r *RemotePluginRuntime) deferMessage(message []byte) bool {
+	r.launchLock.Lock()
+
+	if r.initialized.Load() {
+		r.launchLock.Unlock()
+		return false
+	}
+	// the connection is being closed, messages are dropped
+	if r.launchFailed {
+		r.launchLock.Unlock()
+		return true
+	}
+
+	if r.pendingBytes+len(message) > MAX_PENDING_MESSAGES_BYTES {
+		r.launchLock.Unlock()
+		r.abortLaunch([]byte("too many messages sent before the plugin is launched\n"))
+		return true
+	}
+
+	r.pendingMessages = append(r.pendingMessages, message)
+	r.pendingBytes += len(message)
+	r.launchLock.Unlock()
+	return true
+}
+
+func (r *RemotePluginRuntime) abortLaunch(message []byte) {
+	r.launchLock.Lock()
+	r.launchFailed = true
+	r.pendingMessages = nil
+	r.pendingBytes = 0
+	r.launchLock.Unlock()
+
+	r.closeWithMessage(message)
 }
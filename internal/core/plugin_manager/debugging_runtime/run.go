@@ -79,11 +79,14 @@ func (r *RemotePluginRuntime) StartPlugin() error {
 			func() {
 				r.lastActiveAt = time.Now()
 			},
+			func(protocol plugin_entities.PluginProtocolEvent) {
+				r.SetProtocolVersion(protocol.Version)
+			},
 			func(err string) {
 				log.Error("plugin %s: %s", r.Configuration().Identity(), err)
 			},
-			func(message string) {
-				log.Info("plugin %s: %s", r.Configuration().Identity(), message)
+			func(sessionId string, logEvent plugin_entities.PluginLogEvent) {
+				log.Info("plugin %s: %s", r.Configuration().Identity(), logEvent.Message)
 			},
 		)
 	})
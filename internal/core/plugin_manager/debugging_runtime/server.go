@@ -2,26 +2,45 @@ package debugging_runtime
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/media_transport"
 	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/network"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
 	"github.com/panjf2000/gnet/v2"
+	"golang.org/x/net/websocket"
 
 	gnet_errors "github.com/panjf2000/gnet/v2/pkg/errors"
 )
 
 type RemotePluginServer struct {
 	server *DifyServer
+
+	// tls settings, nil if plain tcp is served
+	tls *remotePluginServerTLS
+	// terminates tls in front of the gnet server, which listens on loopback then
+	tlsListener net.Listener
+}
+
+type remotePluginServerTLS struct {
+	// the public address, e.g. 0.0.0.0:5003
+	addr     string
+	certFile string
+	keyFile  string
 }
 
 type RemotePluginServerInterface interface {
@@ -30,6 +49,7 @@ type RemotePluginServerInterface interface {
 	Wrap(f func(plugin_entities.PluginFullDuplexLifetime))
 	Stop() error
 	Launch() error
+	ServeWebSocket(ws *websocket.Conn, remoteAddress string)
 }
 
 // continue accepting new connections
@@ -55,12 +75,20 @@ func (r *RemotePluginServer) Wrap(f func(plugin_entities.PluginFullDuplexLifetim
 	r.server.response.Async(f)
 }
 
+// ServeWebSocket serves a plugin connected over a websocket, e.g. through a http ingress
+func (r *RemotePluginServer) ServeWebSocket(ws *websocket.Conn, remoteAddress string) {
+	r.server.ServeWebSocket(ws, remoteAddress)
+}
+
 // Stop stops the server
 func (r *RemotePluginServer) Stop() error {
 	if r.server.response == nil {
 		return errors.New("plugin server not started")
 	}
 	r.server.response.Close()
+	if r.tlsListener != nil {
+		r.tlsListener.Close()
+	}
 	err := r.server.engine.Stop(context.Background())
 
 	if err == gnet_errors.ErrEmptyEngine || err == gnet_errors.ErrEngineInShutdown {
@@ -77,6 +105,17 @@ func (r *RemotePluginServer) Launch() error {
 
 	time.Sleep(time.Millisecond * 100)
 
+	if r.tls != nil {
+		if err := r.launchTLS(); err != nil {
+			return err
+		}
+	}
+
+	if _mode != _PLUGIN_RUNTIME_MODE_CI {
+		go r.watchRevokedConnectionKeys()
+		go r.watchDebuggingSessions()
+	}
+
 	err := gnet.Run(
 		r.server, r.server.addr, gnet.WithMulticore(r.server.multicore),
 		gnet.WithNumEventLoop(r.server.numLoops),
@@ -91,6 +130,107 @@ func (r *RemotePluginServer) Launch() error {
 	return err
 }
 
+// launchTLS terminates tls on the public address and forwards the connections to the gnet server,
+// which is moved to a loopback address, the certificate is reloaded once its files changed
+func (r *RemotePluginServer) launchTLS() error {
+	reloader, err := network.NewCertReloader(r.tls.certFile, r.tls.keyFile)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to load the tls certificate of the plugin server"))
+	}
+
+	listener, err := tls.Listen("tcp", r.tls.addr, &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	})
+	if err != nil {
+		return err
+	}
+	r.tlsListener = listener
+
+	// the port is picked by the kernel, it's read back once gnet is listening
+	r.server.addr = "tcp://127.0.0.1:0"
+	r.server.onBoot = func(engine gnet.Engine) error {
+		backend, err := listeningAddr(engine)
+		if err != nil {
+			return err
+		}
+
+		// connections reach gnet from loopback, the addresses of the plugins are known to the proxy
+		proxy := network.NewTLSProxy(backend)
+		r.server.clientAddr = proxy.ClientAddr
+
+		go func() {
+			if err := proxy.Serve(listener); err != nil {
+				log.Error("plugin server tls listener stopped: %s", err.Error())
+			}
+		}()
+		return nil
+	}
+
+	return nil
+}
+
+// listeningAddr returns the address the listener of the engine is bound to
+func listeningAddr(engine gnet.Engine) (string, error) {
+	fd, err := engine.Dup()
+	if err != nil {
+		return "", err
+	}
+
+	// the duplicate is closed afterwards, the listener of the engine is not affected
+	file := os.NewFile(uintptr(fd), "plugin-server-listener")
+	defer file.Close()
+
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+
+	return listener.Addr().String(), nil
+}
+
+// watchRevokedConnectionKeys closes the connections of keys revoked or rotated on any node
+func (r *RemotePluginServer) watchRevokedConnectionKeys() {
+	keys, cancel := cache.Subscribe[Key](CONNECTION_KEY_REVOKED_CHANNEL)
+	defer cancel()
+
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				return
+			}
+			r.server.closeConnectionsByKey(key.Key)
+		case <-r.server.shutdownChan:
+			return
+		}
+	}
+}
+
+// watchDebuggingSessions refreshes the sessions of this node and closes the sessions disconnected on any node
+func (r *RemotePluginServer) watchDebuggingSessions() {
+	events, cancel := cache.Subscribe[disconnectDebuggingSessionEvent](DEBUGGING_SESSION_DISCONNECT_CHANNEL)
+	defer cancel()
+
+	ticker := time.NewTicker(DEBUGGING_SESSION_REFRESH_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			r.server.closeDebuggingSession(event.TenantID, event.SessionID)
+		case <-ticker.C:
+			r.server.refreshDebuggingSessions()
+		case <-r.server.shutdownChan:
+			return
+		}
+	}
+}
+
 func (s *RemotePluginServer) collectShutdownSignal() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
@@ -127,12 +267,24 @@ func NewRemotePluginServer(config *app.Config, media_transport *media_transport.
 
 		shutdownChan: make(chan bool),
 
-		maxConn: int32(config.PluginRemoteInstallingMaxConn),
+		maxConn:             int32(config.PluginRemoteInstallingMaxConn),
+		maxSingleTenantConn: config.PluginRemoteInstallingMaxSingleTenantConn,
 	}
 
 	manager := &RemotePluginServer{
 		server: s,
 	}
 
+	if config.PluginRemoteInstallingTLSEnabled {
+		manager.tls = &remotePluginServerTLS{
+			addr: net.JoinHostPort(
+				config.PluginRemoteInstallingHost,
+				strconv.Itoa(int(config.PluginRemoteInstallingPort)),
+			),
+			certFile: config.PluginRemoteInstallingTLSCertFile,
+			keyFile:  config.PluginRemoteInstallingTLSKeyFile,
+		}
+	}
+
 	return manager
 }
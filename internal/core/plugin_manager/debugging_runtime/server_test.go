@@ -15,11 +15,13 @@ import (
 	"github.com/langgenius/dify-plugin-daemon/internal/db"
 	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache/redis"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/network"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/manifest_entities"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/panjf2000/gnet/v2"
 )
 
 var defaultConfig = &app.Config{
@@ -120,7 +122,7 @@ func TestLaunchAndClosePluginServer(t *testing.T) {
 
 // TestAcceptConnection tests the acceptance of the connection
 func TestAcceptConnection(t *testing.T) {
-	if cache.InitRedisClient("0.0.0.0:6379", "", "difyai123456", false, 0) != nil {
+	if redis.InitRedisClient("0.0.0.0:6379", "", "difyai123456", false, 0) != nil {
 		t.Errorf("failed to init redis client")
 		return
 	}
@@ -130,7 +132,7 @@ func TestAcceptConnection(t *testing.T) {
 	defer cache.Close()
 	key, err := GetConnectionKey(ConnectionInfo{
 		TenantId: tenantId,
-	})
+	}, time.Minute)
 	if err != nil {
 		t.Errorf("failed to get connection key: %s", err.Error())
 		return
@@ -356,7 +358,7 @@ func TestNoHandleShakeIn10Seconds(t *testing.T) {
 }
 
 func TestIncorrectHandshake(t *testing.T) {
-	if cache.InitRedisClient("0.0.0.0:6379", "", "difyai123456", false, 0) != nil {
+	if redis.InitRedisClient("0.0.0.0:6379", "", "difyai123456", false, 0) != nil {
 		t.Errorf("failed to init redis client")
 		return
 	}
@@ -429,3 +431,127 @@ func TestIncorrectHandshake(t *testing.T) {
 		return
 	}
 }
+
+func TestExpiredConnectionKeyRejected(t *testing.T) {
+	if redis.InitRedisClient("0.0.0.0:6379", "", "difyai123456", false, 0) != nil {
+		t.Errorf("failed to init redis client")
+		return
+	}
+
+	defer cache.Close()
+
+	tenantId := uuid.New().String()
+	key, err := GetConnectionKey(ConnectionInfo{
+		TenantId: tenantId,
+	}, time.Second)
+	if err != nil {
+		t.Errorf("failed to get connection key: %s", err.Error())
+		return
+	}
+	defer ClearConnectionKey(tenantId)
+
+	server, port := preparePluginServer(t)
+	if server == nil {
+		return
+	}
+	defer server.Stop()
+	go func() {
+		server.Launch()
+	}()
+
+	go func() {
+		for server.Next() {
+			runtime, err := server.Read()
+			if err != nil {
+				t.Errorf("failed to read plugin runtime: %s", err.Error())
+				return
+			}
+
+			t.Errorf("plugin connected with an expired key")
+			runtime.Stop()
+		}
+	}()
+
+	// wait for the server to start and the key to expire
+	time.Sleep(time.Second * 2)
+
+	if _, err := GetConnectionInfo(key); err != cache.ErrNotFound {
+		t.Errorf("connection key not expired: %v", err)
+		return
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("0.0.0.0:%d", port))
+	if err != nil {
+		t.Errorf("failed to connect to plugin server: %s", err.Error())
+		return
+	}
+
+	conn.Write(parser.MarshalJsonBytes(plugin_entities.RemotePluginRegisterPayload{
+		Type: plugin_entities.REGISTER_EVENT_TYPE_HAND_SHAKE,
+		Data: parser.MarshalJsonBytes(plugin_entities.RemotePluginRegisterHandshake{
+			Key: key,
+		}),
+	}))
+	conn.Write([]byte("\n\n"))
+
+	closedChan := make(chan bool)
+	msg := ""
+
+	go func() {
+		// block here to accept messages until the connection is closed
+		buffer := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buffer)
+			if err != nil {
+				break
+			}
+			msg += string(buffer[:n])
+		}
+		close(closedChan)
+	}()
+
+	select {
+	case <-time.After(time.Second * 10):
+		t.Errorf("connection not closed normally")
+		return
+	case <-closedChan:
+		if !strings.Contains(msg, "handshake failed, invalid key") {
+			t.Errorf("expired key not rejected: %s", msg)
+		}
+		return
+	}
+}
+
+type bootEngine struct {
+	gnet.BuiltinEventEngine
+
+	addr chan string
+}
+
+func (e *bootEngine) OnBoot(engine gnet.Engine) gnet.Action {
+	addr, err := listeningAddr(engine)
+	if err != nil {
+		addr = err.Error()
+	}
+	e.addr <- addr
+	return gnet.Shutdown
+}
+
+func TestListeningAddr(t *testing.T) {
+	engine := &bootEngine{addr: make(chan string, 1)}
+	go gnet.Run(engine, "tcp://127.0.0.1:0")
+
+	select {
+	case addr := <-engine.addr:
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			t.Errorf("invalid listening address %s: %s", addr, err.Error())
+			return
+		}
+		if host != "127.0.0.1" || port == "0" {
+			t.Errorf("unexpected listening address %s", addr)
+		}
+	case <-time.After(time.Second * 5):
+		t.Errorf("engine not booted")
+	}
+}
@@ -0,0 +1,175 @@
+package debugging_runtime
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+)
+
+/*
+ * Debugging sessions of a tenant are shared by all nodes, a hash per tenant maps
+ * $session_id => $session, it's used to enforce the per-tenant connection limit cluster-wide.
+ *
+ * Sessions are refreshed by their node periodically, sessions which are not refreshed
+ * anymore, e.g. their node crashed, are considered gone and removed lazily.
+ * */
+
+const (
+	DEBUGGING_SESSIONS_KEY_PREFIX  = "{remote:sessions}:tenant"
+	DEBUGGING_SESSIONS_LOCK_PREFIX = "{remote:sessions}:lock"
+
+	DEBUGGING_SESSION_REFRESH_INTERVAL = time.Second * 30
+	DEBUGGING_SESSION_EXPIRE_TIME      = DEBUGGING_SESSION_REFRESH_INTERVAL * 3
+
+	// sessions to disconnect are published to the node holding them
+	DEBUGGING_SESSION_DISCONNECT_CHANNEL = "remote:session:disconnect"
+)
+
+var (
+	ErrServerBusy                = errors.New("server is busy now, please try again later")
+	ErrDebuggingSessionNotFound  = errors.New("debugging session not found")
+	ErrTenantConnectionsExceeded = errors.New("too many debugging connections for this workspace")
+)
+
+// DebuggingSession is a plugin connected to the debugging server
+type DebuggingSession struct {
+	ID                     string    `json:"id"`
+	TenantID               string    `json:"tenant_id"`
+	UserID                 string    `json:"user_id,omitempty"`
+	PluginUniqueIdentifier string    `json:"plugin_unique_identifier"`
+	RemoteAddress          string    `json:"remote_address"`
+	ConnectedAt            time.Time `json:"connected_at"`
+	RefreshedAt            time.Time `json:"refreshed_at"`
+}
+
+type disconnectDebuggingSessionEvent struct {
+	TenantID  string `json:"tenant_id"`
+	SessionID string `json:"session_id"`
+}
+
+func debuggingSessionsKey(tenantID string) string {
+	return DEBUGGING_SESSIONS_KEY_PREFIX + ":" + tenantID
+}
+
+func debuggingSessionsLockKey(tenantID string) string {
+	return DEBUGGING_SESSIONS_LOCK_PREFIX + ":" + tenantID
+}
+
+// splitDebuggingSessions returns the sessions still alive, the oldest first, and the ids of the expired ones
+func splitDebuggingSessions(sessions map[string]DebuggingSession, now time.Time) ([]DebuggingSession, []string) {
+	alive := []DebuggingSession{}
+	expired := []string{}
+	for id, session := range sessions {
+		if now.Sub(session.RefreshedAt) > DEBUGGING_SESSION_EXPIRE_TIME {
+			expired = append(expired, id)
+			continue
+		}
+		alive = append(alive, session)
+	}
+
+	sort.Slice(alive, func(i, j int) bool {
+		return alive[i].ConnectedAt.Before(alive[j].ConnectedAt)
+	})
+	return alive, expired
+}
+
+// acquireDebuggingSession registers the session unless the tenant has reached the limit, 0 means unlimited
+func acquireDebuggingSession(session *DebuggingSession, limit int) error {
+	lockKey := debuggingSessionsLockKey(session.TenantID)
+	if err := cache.Lock(lockKey, time.Second*10, time.Second*10); err != nil {
+		return err
+	}
+	defer cache.Unlock(lockKey)
+
+	key := debuggingSessionsKey(session.TenantID)
+	sessions, err := cache.GetMap[DebuggingSession](key)
+	if err != nil && err != cache.ErrNotFound {
+		return err
+	}
+
+	alive, expired := splitDebuggingSessions(sessions, time.Now())
+	for _, id := range expired {
+		cache.DelMapField(key, id)
+	}
+
+	if limit > 0 && len(alive) >= limit {
+		return fmt.Errorf("%w, at most %d", ErrTenantConnectionsExceeded, limit)
+	}
+
+	session.RefreshedAt = time.Now()
+	return cache.SetMapOneField(key, session.ID, session)
+}
+
+func releaseDebuggingSession(session *DebuggingSession) {
+	// serialized with the refreshes, which would register the session again otherwise
+	lockKey := debuggingSessionsLockKey(session.TenantID)
+	if err := cache.Lock(lockKey, time.Second*10, time.Second*10); err != nil {
+		log.Error("failed to lock debugging sessions of tenant %s: %s", session.TenantID, err.Error())
+	} else {
+		defer cache.Unlock(lockKey)
+	}
+
+	if err := cache.DelMapField(debuggingSessionsKey(session.TenantID), session.ID); err != nil {
+		log.Error("failed to release debugging session %s: %s", session.ID, err.Error())
+	}
+}
+
+// refreshDebuggingSession keeps the session alive, released sessions are not registered again
+func refreshDebuggingSession(session DebuggingSession) {
+	lockKey := debuggingSessionsLockKey(session.TenantID)
+	if err := cache.Lock(lockKey, time.Second*10, time.Second*10); err != nil {
+		log.Error("failed to refresh debugging session %s: %s", session.ID, err.Error())
+		return
+	}
+	defer cache.Unlock(lockKey)
+
+	key := debuggingSessionsKey(session.TenantID)
+	if _, err := cache.GetMapField[DebuggingSession](key, session.ID); err != nil {
+		if err != cache.ErrNotFound {
+			log.Error("failed to refresh debugging session %s: %s", session.ID, err.Error())
+		}
+		return
+	}
+
+	session.RefreshedAt = time.Now()
+	if err := cache.SetMapOneField(key, session.ID, session); err != nil {
+		log.Error("failed to refresh debugging session %s: %s", session.ID, err.Error())
+	}
+}
+
+// ListDebuggingSessions lists the plugins of a tenant connected to any node, the oldest first
+func ListDebuggingSessions(tenantID string) ([]DebuggingSession, error) {
+	sessions, err := cache.GetMap[DebuggingSession](debuggingSessionsKey(tenantID))
+	if err == cache.ErrNotFound {
+		return []DebuggingSession{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	alive, _ := splitDebuggingSessions(sessions, time.Now())
+	return alive, nil
+}
+
+// DisconnectDebuggingSession closes the connection of a session, on whichever node it is
+func DisconnectDebuggingSession(tenantID string, sessionID string) error {
+	sessions, err := ListDebuggingSessions(tenantID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID == sessionID {
+			return cache.Publish(DEBUGGING_SESSION_DISCONNECT_CHANNEL, disconnectDebuggingSessionEvent{
+				TenantID:  tenantID,
+				SessionID: sessionID,
+			})
+		}
+	}
+
+	return ErrDebuggingSessionNotFound
+}
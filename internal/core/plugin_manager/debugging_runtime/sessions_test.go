@@ -0,0 +1,313 @@
+package debugging_runtime
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitDebuggingSessions(t *testing.T) {
+	now := time.Now()
+	sessions := map[string]DebuggingSession{
+		"newer": {ID: "newer", ConnectedAt: now.Add(-time.Minute), RefreshedAt: now},
+		"older": {ID: "older", ConnectedAt: now.Add(-time.Hour), RefreshedAt: now.Add(-DEBUGGING_SESSION_REFRESH_INTERVAL)},
+		// the node of the session stopped refreshing it
+		"stale": {ID: "stale", ConnectedAt: now.Add(-time.Hour), RefreshedAt: now.Add(-DEBUGGING_SESSION_EXPIRE_TIME - time.Second)},
+	}
+
+	alive, expired := splitDebuggingSessions(sessions, now)
+	assert.Equal(t, []string{"stale"}, expired)
+	if assert.Len(t, alive, 2) {
+		assert.Equal(t, "older", alive[0].ID)
+		assert.Equal(t, "newer", alive[1].ID)
+	}
+}
+
+func TestAcquireConnection(t *testing.T) {
+	// sessions are not shared with other nodes in ci mode
+	mode := _mode
+	_mode = _PLUGIN_RUNTIME_MODE_CI
+	defer func() { _mode = mode }()
+
+	server := &DifyServer{maxConn: 1}
+
+	first := &RemotePluginRuntime{}
+	assert.NoError(t, server.acquireConnection(first))
+
+	// rejected connections don't take a slot
+	second := &RemotePluginRuntime{}
+	assert.ErrorIs(t, server.acquireConnection(second), ErrServerBusy)
+	assert.ErrorIs(t, server.acquireConnection(second), ErrServerBusy)
+	server.releaseConnection(second)
+	assert.Equal(t, int32(1), server.currentConn)
+
+	// slots are released once
+	server.releaseConnection(first)
+	server.releaseConnection(first)
+	assert.Equal(t, int32(0), server.currentConn)
+
+	assert.NoError(t, server.acquireConnection(second))
+}
+
+// sessionsCache is the cache shared by the nodes of a cluster
+type sessionsCache struct {
+	cache.Client
+
+	lock   sync.Mutex
+	maps   map[string]map[string]string
+	locked map[string]bool
+
+	// Lock waits for the gate if it's set
+	gate chan struct{}
+}
+
+func newSessionsCache() *sessionsCache {
+	return &sessionsCache{maps: map[string]map[string]string{}, locked: map[string]bool{}}
+}
+
+func (c *sessionsCache) GetMap(key string) (map[string]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	result := map[string]string{}
+	for field, value := range c.maps[key] {
+		result[field] = value
+	}
+	return result, nil
+}
+
+func (c *sessionsCache) GetMapField(key string, field string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	value, ok := c.maps[key][field]
+	if !ok {
+		return "", cache.ErrNotFound
+	}
+	return value, nil
+}
+
+func (c *sessionsCache) SetMapField(key string, field string, value string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.maps[key] == nil {
+		c.maps[key] = map[string]string{}
+	}
+	c.maps[key][field] = value
+	return nil
+}
+
+func (c *sessionsCache) DeleteMapField(key string, field string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.maps[key], field)
+	return nil
+}
+
+func (c *sessionsCache) Lock(key string, expire time.Duration, tryLockTimeout time.Duration) error {
+	if c.gate != nil {
+		<-c.gate
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.locked[key] {
+		return errors.New("lock timeout")
+	}
+	c.locked[key] = true
+	return nil
+}
+
+func (c *sessionsCache) Unlock(key string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.locked, key)
+	return nil
+}
+
+type recordingConn struct {
+	closed chan []byte
+}
+
+func (c *recordingConn) AsyncWrite(data []byte) error { return nil }
+func (c *recordingConn) CloseWithMessage(message []byte) {
+	c.closed <- message
+}
+func (c *recordingConn) Close() error          { return nil }
+func (c *recordingConn) RemoteAddress() string { return "127.0.0.1:5003" }
+
+func newSessionRuntime(tenantID string) *RemotePluginRuntime {
+	runtime := &RemotePluginRuntime{
+		conn:     &recordingConn{closed: make(chan []byte, 1)},
+		tenantId: tenantID,
+		checksum: strings.Repeat("a", 64),
+	}
+	runtime.Config.Author = "author"
+	runtime.Config.Name = "plugin"
+	runtime.Config.Version = "0.0.1"
+	return runtime
+}
+
+// sessions are shared with other nodes outside of ci mode
+func setupSessionsCache(t *testing.T) *sessionsCache {
+	mode := _mode
+	_mode = ""
+	c := newSessionsCache()
+	cache.SetClient(c)
+	t.Cleanup(func() {
+		_mode = mode
+		cache.SetClient(nil)
+	})
+	return c
+}
+
+func TestAcquireConnectionClusterLimit(t *testing.T) {
+	setupSessionsCache(t)
+
+	// two nodes sharing the sessions of the tenants
+	node1 := &DifyServer{maxConn: 10, maxSingleTenantConn: 1}
+	node2 := &DifyServer{maxConn: 10, maxSingleTenantConn: 1}
+
+	first := newSessionRuntime("tenant-a")
+	assert.NoError(t, node1.acquireConnection(first))
+
+	// the limit is shared by the nodes, the rejected connection takes no slot
+	second := newSessionRuntime("tenant-a")
+	assert.ErrorIs(t, node2.acquireConnection(second), ErrTenantConnectionsExceeded)
+	assert.Equal(t, int32(0), node2.currentConn)
+
+	// other tenants are not affected
+	assert.NoError(t, node2.acquireConnection(newSessionRuntime("tenant-b")))
+
+	sessions, err := ListDebuggingSessions("tenant-a")
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 1) {
+		assert.Equal(t, first.session.ID, sessions[0].ID)
+		assert.Equal(t, "127.0.0.1:5003", sessions[0].RemoteAddress)
+	}
+
+	// the slot of the tenant is free once the session is released
+	node1.releaseConnection(first)
+	assert.NoError(t, node2.acquireConnection(second))
+}
+
+func TestAcquireDebuggingSessionDropsExpiredSessions(t *testing.T) {
+	setupSessionsCache(t)
+
+	// the node of the session crashed, it's not refreshed anymore
+	stale := &DebuggingSession{ID: "stale", TenantID: "tenant-a", ConnectedAt: time.Now().Add(-time.Hour)}
+	assert.NoError(t, acquireDebuggingSession(stale, 1))
+	stale.RefreshedAt = time.Now().Add(-DEBUGGING_SESSION_EXPIRE_TIME - time.Second)
+	assert.NoError(t, cache.SetMapOneField(debuggingSessionsKey("tenant-a"), stale.ID, stale))
+
+	session := &DebuggingSession{ID: "new", TenantID: "tenant-a", ConnectedAt: time.Now()}
+	assert.NoError(t, acquireDebuggingSession(session, 1))
+
+	sessions, err := ListDebuggingSessions("tenant-a")
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 1) {
+		assert.Equal(t, "new", sessions[0].ID)
+	}
+}
+
+func TestRefreshDoesNotRegisterReleasedSession(t *testing.T) {
+	setupSessionsCache(t)
+
+	session := &DebuggingSession{ID: "released", TenantID: "tenant-a", ConnectedAt: time.Now()}
+	assert.NoError(t, acquireDebuggingSession(session, 1))
+
+	// the refresh snapshotted the session before it was released
+	snapshot := *session
+	releaseDebuggingSession(session)
+	refreshDebuggingSession(snapshot)
+
+	sessions, err := ListDebuggingSessions("tenant-a")
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	// the released session doesn't count against the limit
+	assert.NoError(t, acquireDebuggingSession(&DebuggingSession{ID: "new", TenantID: "tenant-a", ConnectedAt: time.Now()}, 1))
+}
+
+func TestDeferMessageLimitsPendingMessages(t *testing.T) {
+	runtime := newSessionRuntime("tenant-a")
+
+	message := make([]byte, MAX_PENDING_MESSAGES_BYTES/2)
+	assert.True(t, runtime.deferMessage(message))
+	assert.True(t, runtime.deferMessage(message))
+	assert.Len(t, runtime.pendingMessages, 2)
+
+	// the plugin is disconnected instead of buffering without limit
+	assert.True(t, runtime.deferMessage([]byte("{}")))
+	select {
+	case message := <-runtime.conn.(*recordingConn).closed:
+		assert.Contains(t, string(message), "too many messages")
+	case <-time.After(time.Second):
+		t.Fatal("the connection was not closed")
+	}
+	assert.Nil(t, runtime.pendingMessages)
+
+	// messages are dropped once the launch failed
+	assert.True(t, runtime.deferMessage([]byte("{}")))
+	assert.Nil(t, runtime.pendingMessages)
+}
+
+func TestLaunchDoesNotBlockMessages(t *testing.T) {
+	routine.InitPool(1024)
+	c := setupSessionsCache(t)
+
+	// the tenant has reached its limit on another node
+	assert.NoError(t, acquireDebuggingSession(&DebuggingSession{
+		ID: "other", TenantID: "tenant-a", ConnectedAt: time.Now(), RefreshedAt: time.Now(),
+	}, 0))
+	// the lock of the cluster is held until the gate is opened
+	c.gate = make(chan struct{})
+
+	server := &DifyServer{maxConn: 10, maxSingleTenantConn: 1}
+	runtime := newSessionRuntime("tenant-a")
+	runtime.handshake = true
+	runtime.registrationTransferred = true
+	runtime.toolsRegistrationTransferred = true
+	runtime.assets = map[string]*bytes.Buffer{}
+	runtime.shutdownChan = make(chan bool)
+	runtime.waitLaunchedChan = make(chan error)
+
+	end := parser.MarshalJsonBytes(plugin_entities.RemotePluginRegisterPayload{
+		Type: plugin_entities.REGISTER_EVENT_TYPE_END,
+		Data: []byte("{}"),
+	})
+
+	// the event loop goes on while the launch waits for the lock of the cluster
+	handled := make(chan struct{})
+	go func() {
+		server.onMessage(runtime, end)
+		server.onMessage(runtime, []byte(`{"event":"heartbeat"}`))
+		close(handled)
+	}()
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("onMessage blocked by the launch")
+	}
+
+	// the result is written back to the connection
+	close(c.gate)
+	select {
+	case message := <-runtime.conn.(*recordingConn).closed:
+		assert.Contains(t, string(message), ErrTenantConnectionsExceeded.Error())
+	case <-time.After(time.Second):
+		t.Fatal("the rejected connection was not closed")
+	}
+
+	<-runtime.launched
+	assert.False(t, runtime.initialized.Load())
+	assert.Nil(t, runtime.pendingMessages)
+	assert.Equal(t, int32(0), server.currentConn)
+}
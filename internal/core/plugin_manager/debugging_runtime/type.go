@@ -9,7 +9,6 @@ import (
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/basic_runtime"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
-	"github.com/panjf2000/gnet/v2"
 )
 
 type pluginRuntimeMode string
@@ -21,7 +20,7 @@ type RemotePluginRuntime struct {
 	plugin_entities.PluginRuntime
 
 	// connection
-	conn   gnet.Conn
+	conn   pluginConn
 	closed int32
 
 	// response entity to accept new events
@@ -48,8 +47,16 @@ type RemotePluginRuntime struct {
 	handshake       bool
 	handshakeFailed bool
 
-	// initialized, wether registration transferred
-	initialized bool
+	// initialized, wether registration transferred, set by the launch outside of the event loop
+	initialized atomic.Bool
+
+	// closed once the launch finished, nil until the registration is transferred
+	launched chan struct{}
+	// guards the messages received while launching
+	launchLock      sync.Mutex
+	pendingMessages [][]byte
+	pendingBytes    int
+	launchFailed    bool
 
 	// registration transferred
 	registrationTransferred bool
@@ -63,6 +70,18 @@ type RemotePluginRuntime struct {
 	// tenant id
 	tenantId string
 
+	// user id, empty if the key is shared by the tenant
+	userId string
+
+	// the key used in the handshake, connections are closed once it's revoked
+	connectionKey string
+
+	// whether the runtime holds a connection slot, released once it disconnects
+	connectionAcquired bool
+
+	// the debugging session shared with other nodes, nil in ci mode
+	session *DebuggingSession
+
 	alive bool
 
 	// checksum
@@ -0,0 +1,134 @@
+package debugging_runtime
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"golang.org/x/net/websocket"
+)
+
+var ErrWebSocketTooSlow = errors.New("websocket peer is too slow, the write queue is full")
+
+const (
+	// writes queued for a websocket, peers not keeping up are disconnected once it's full
+	WEBSOCKET_WRITE_QUEUE_SIZE = 512
+
+	WEBSOCKET_READ_BUFFER_SIZE = 64 * 1024
+)
+
+// wsConn adapts a websocket to the transport of a remote plugin, all writes are sent
+// as text frames in order by a single writer
+type wsConn struct {
+	ws            *websocket.Conn
+	remoteAddress string
+
+	writes    chan []byte
+	closed    chan bool
+	closeOnce sync.Once
+}
+
+func newWSConn(ws *websocket.Conn, remoteAddress string) *wsConn {
+	c := &wsConn{
+		ws:            ws,
+		remoteAddress: remoteAddress,
+		writes:        make(chan []byte, WEBSOCKET_WRITE_QUEUE_SIZE),
+		closed:        make(chan bool),
+	}
+	go c.writeLoop()
+	return c
+}
+
+func (c *wsConn) writeLoop() {
+	for {
+		select {
+		case data := <-c.writes:
+			// nil is queued by CloseWithMessage after its message
+			if data == nil {
+				c.Close()
+				return
+			}
+			if err := websocket.Message.Send(c.ws, string(data)); err != nil {
+				c.Close()
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *wsConn) AsyncWrite(data []byte) error {
+	if data == nil {
+		return nil
+	}
+
+	select {
+	case <-c.closed:
+		return net.ErrClosed
+	default:
+	}
+
+	// the caller must not be blocked by a slow peer, e.g. the responses of all sessions
+	select {
+	case c.writes <- data:
+		return nil
+	default:
+		log.Warn("websocket plugin %s is too slow, disconnecting", c.remoteAddress)
+		c.Close()
+		return ErrWebSocketTooSlow
+	}
+}
+
+func (c *wsConn) CloseWithMessage(message []byte) {
+	if c.AsyncWrite(message) != nil {
+		return
+	}
+	select {
+	case c.writes <- nil:
+	default:
+		c.Close()
+	}
+}
+
+func (c *wsConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.ws.Close()
+	})
+	return nil
+}
+
+func (c *wsConn) RemoteAddress() string {
+	return c.remoteAddress
+}
+
+// ServeWebSocket serves a remote plugin connected over a websocket until it disconnects,
+// the plugin speaks the same protocol as over tcp, messages are separated by newlines
+// regardless of how they are split into frames
+func (s *DifyServer) ServeWebSocket(ws *websocket.Conn, remoteAddress string) {
+	id := int(atomic.AddInt64(&s.lastWebSocketID, -1))
+	conn := newWSConn(ws, remoteAddress)
+	runtime := s.onConnected(id, conn)
+	defer s.onDisconnected(id)
+	defer conn.Close()
+
+	codec := &codec{}
+	buf := make([]byte, WEBSOCKET_READ_BUFFER_SIZE)
+	for {
+		n, err := ws.Read(buf)
+		if n > 0 {
+			for _, message := range codec.getLines(buf[:n]) {
+				if len(message) == 0 {
+					continue
+				}
+				s.onMessage(runtime, message)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
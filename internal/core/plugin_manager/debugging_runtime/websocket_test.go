@@ -0,0 +1,86 @@
+package debugging_runtime
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestServeWebSocket(t *testing.T) {
+	server := &DifyServer{
+		plugins:     make(map[int]*RemotePluginRuntime),
+		pluginsLock: &sync.RWMutex{},
+	}
+
+	httpServer := httptest.NewServer(websocket.Server{
+		Handler: func(ws *websocket.Conn) {
+			server.ServeWebSocket(ws, "127.0.0.1")
+		},
+	})
+	defer httpServer.Close()
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	ws, err := websocket.Dial(url, "", httpServer.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ws.Close()
+
+	// messages are split by newlines, not by frames
+	assert.NoError(t, websocket.Message.Send(ws, "not a "))
+	assert.NoError(t, websocket.Message.Send(ws, "handshake\n"))
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message string
+	assert.NoError(t, websocket.Message.Receive(ws, &message))
+	assert.Equal(t, "handshake failed, invalid handshake message\n", message)
+
+	// the connection is closed after the message
+	assert.Error(t, websocket.Message.Receive(ws, &message))
+	assert.Eventually(t, func() bool {
+		server.pluginsLock.RLock()
+		defer server.pluginsLock.RUnlock()
+		return len(server.plugins) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWebSocketDisconnectsSlowPeer(t *testing.T) {
+	conns := make(chan *websocket.Conn, 1)
+	done := make(chan bool)
+	defer close(done)
+
+	httpServer := httptest.NewServer(websocket.Server{
+		Handler: func(ws *websocket.Conn) {
+			conns <- ws
+			<-done
+		},
+	})
+	defer httpServer.Close()
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	ws, err := websocket.Dial(url, "", httpServer.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ws.Close()
+
+	// nothing is sent, the queue is only drained by the write loop
+	conn := &wsConn{
+		ws:     <-conns,
+		writes: make(chan []byte, 1),
+		closed: make(chan bool),
+	}
+
+	assert.NoError(t, conn.AsyncWrite([]byte("first\n")))
+	assert.ErrorIs(t, conn.AsyncWrite([]byte("second\n")), ErrWebSocketTooSlow)
+	assert.ErrorIs(t, conn.AsyncWrite([]byte("third\n")), net.ErrClosed)
+
+	// closing doesn't block on the full queue either
+	conn.CloseWithMessage([]byte("bye\n"))
+}
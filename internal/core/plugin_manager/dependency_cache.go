@@ -0,0 +1,101 @@
+package plugin_manager
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/dependency_cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+)
+
+var ErrDependencyCacheDisabled = errors.New("dependency cache is disabled")
+
+func (p *PluginManager) initDependencyCache(config *app.Config) {
+	if config.PluginDependencyCacheEnabled == nil || !*config.PluginDependencyCacheEnabled {
+		return
+	}
+
+	cache, err := dependency_cache.NewCache(config.PluginDependencyCachePath)
+	if err != nil {
+		// plugins are still installable with the default cache of uv
+		log.Error("init dependency cache failed: %s", err.Error())
+		return
+	}
+	p.dependencyCache = cache
+
+	if len(config.PluginDependencyCachePrewarmSdkVersions) == 0 {
+		return
+	}
+
+	routine.Submit(map[string]string{
+		"module":   "plugin_manager",
+		"function": "prewarmDependencyCache",
+	}, func() {
+		uvPath, err := p.findUvPath()
+		if err != nil {
+			log.Error("prewarm dependency cache failed: %s", err.Error())
+			return
+		}
+
+		python := config.PythonDefaultVersion
+		if interpreter, ok := config.PythonInterpreters[python]; ok && interpreter != "" {
+			python = interpreter
+		}
+
+		env := []string{}
+		if config.HttpProxy != "" {
+			env = append(env, fmt.Sprintf("HTTP_PROXY=%s", config.HttpProxy))
+		}
+		if config.HttpsProxy != "" {
+			env = append(env, fmt.Sprintf("HTTPS_PROXY=%s", config.HttpsProxy))
+		}
+		if config.NoProxy != "" {
+			env = append(env, fmt.Sprintf("NO_PROXY=%s", config.NoProxy))
+		}
+
+		log.Info("prewarming dependency cache with plugin sdk %v", config.PluginDependencyCachePrewarmSdkVersions)
+		if err := cache.Prewarm(config.PluginDependencyCachePrewarmSdkVersions, dependency_cache.PrewarmOptions{
+			UvPath:   uvPath,
+			Python:   python,
+			IndexUrl: config.PipMirrorUrl,
+			Env:      env,
+		}); err != nil {
+			log.Error("prewarm dependency cache failed: %s", err.Error())
+			return
+		}
+		log.Info("dependency cache prewarmed")
+	})
+}
+
+func (p *PluginManager) findUvPath() (string, error) {
+	if p.config.UvPath != "" {
+		return p.config.UvPath, nil
+	}
+
+	cmd := exec.Command(p.config.PythonInterpreterPath, "-c", "from uv._find_uv import find_uv_bin; print(find_uv_bin())")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find uv path: %s", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// DependencyCacheStats returns the size of the shared dependency cache
+func (p *PluginManager) DependencyCacheStats() (*dependency_cache.Stats, error) {
+	if p.dependencyCache == nil {
+		return nil, ErrDependencyCacheDisabled
+	}
+	return p.dependencyCache.Stats()
+}
+
+// PruneDependencyCache removes the cached packages no plugin references
+func (p *PluginManager) PruneDependencyCache() (*dependency_cache.PruneResult, error) {
+	if p.dependencyCache == nil {
+		return nil, ErrDependencyCacheDisabled
+	}
+	return p.dependencyCache.Prune()
+}
@@ -0,0 +1,268 @@
+package dependency_cache
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// packages are hard linked from the cache into the virtual environments, the cache
+	// and the plugin working directories must be on the same filesystem, otherwise
+	// uv falls back to copying
+	LINK_MODE = "hardlink"
+
+	// uv unpacks every wheel into its own directory under archive-v*, these
+	// directories are the entries linked into the virtual environments
+	ARCHIVE_DIR_PREFIX = "archive-v"
+
+	// entries younger than this are never pruned, uv may be about to link them
+	PRUNE_MIN_AGE = 10 * time.Minute
+
+	// prewarmed packages are linked into virtual environments kept in this directory
+	// of the cache, the links keep them referenced until the sdk version is prewarmed again
+	PREWARM_DIR = "prewarmed"
+)
+
+// Cache is a uv cache shared by the virtual environments of all local plugins
+type Cache struct {
+	path string
+}
+
+func NewCache(path string) (*Cache, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(absPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dependency cache directory: %s", err)
+	}
+
+	return &Cache{path: absPath}, nil
+}
+
+func (c *Cache) Path() string {
+	return c.path
+}
+
+// Env returns the environment variables making uv use the cache
+func (c *Cache) Env() []string {
+	return []string{
+		"UV_CACHE_DIR=" + c.path,
+		"UV_LINK_MODE=" + LINK_MODE,
+	}
+}
+
+type Stats struct {
+	Path                string `json:"path"`
+	Size                int64  `json:"size"`
+	Entries             int    `json:"entries"`
+	UnreferencedEntries int    `json:"unreferenced_entries"`
+	UnreferencedSize    int64  `json:"unreferenced_size"`
+}
+
+type PruneResult struct {
+	RemovedEntries int   `json:"removed_entries"`
+	ReclaimedSize  int64 `json:"reclaimed_size"`
+}
+
+type entry struct {
+	path       string
+	size       int64
+	referenced bool
+	modTime    time.Time
+}
+
+// entries lists the unpacked wheels of the cache, an entry is referenced as long as
+// any of its files is hard linked into a virtual environment
+func (c *Cache) entries() ([]entry, error) {
+	dirs, err := os.ReadDir(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []entry{}
+	for _, dir := range dirs {
+		if !dir.IsDir() || !strings.HasPrefix(dir.Name(), ARCHIVE_DIR_PREFIX) {
+			continue
+		}
+
+		archives, err := os.ReadDir(filepath.Join(c.path, dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, archive := range archives {
+			archivePath := filepath.Join(c.path, dir.Name(), archive.Name())
+			info, err := archive.Info()
+			if err != nil {
+				return nil, err
+			}
+			e := entry{path: archivePath, modTime: info.ModTime()}
+
+			err = filepath.Walk(archivePath, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.Mode().IsRegular() {
+					return nil
+				}
+
+				e.size += info.Size()
+				if links, ok := linkCount(info); !ok || links > 1 {
+					// treat entries as referenced if the link count is unknown
+					e.referenced = true
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
+
+// Stats returns the size of the whole cache and the entries no plugin references
+func (c *Cache) Stats() (*Stats, error) {
+	stats := &Stats{Path: c.path}
+
+	err := filepath.Walk(c.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path == filepath.Join(c.path, PREWARM_DIR) {
+			// hard links of the entries, counted once by the entries themselves
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() {
+			stats.Size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := c.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Entries = len(entries)
+	for _, e := range entries {
+		if !e.referenced {
+			stats.UnreferencedEntries++
+			stats.UnreferencedSize += e.size
+		}
+	}
+
+	return stats, nil
+}
+
+// Prune removes the entries no virtual environment references
+// uv treats the pointers to removed entries as cache misses and downloads them again
+func (c *Cache) Prune() (*PruneResult, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PruneResult{}
+	for _, e := range entries {
+		if e.referenced || time.Since(e.modTime) < PRUNE_MIN_AGE {
+			continue
+		}
+
+		if err := os.RemoveAll(e.path); err != nil {
+			return result, fmt.Errorf("failed to remove %s: %s", e.path, err)
+		}
+
+		result.RemovedEntries++
+		result.ReclaimedSize += e.size
+	}
+
+	return result, nil
+}
+
+type PrewarmOptions struct {
+	UvPath string
+	// passed to `uv venv --python`
+	Python   string
+	IndexUrl string
+	// extra environment variables, e.g. proxies
+	Env []string
+}
+
+// Prewarm installs the given versions of the plugin sdk into virtual environments
+// kept in the cache, so their packages stay referenced and survive pruning
+func (c *Cache) Prewarm(sdkVersions []string, options PrewarmOptions) error {
+	for _, sdkVersion := range sdkVersions {
+		sdkVersion = strings.TrimSpace(sdkVersion)
+		if sdkVersion == "" {
+			continue
+		}
+
+		if err := c.prewarm(sdkVersion, options); err != nil {
+			return fmt.Errorf("failed to prewarm dify_plugin==%s: %s", sdkVersion, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Cache) prewarm(sdkVersion string, options PrewarmOptions) error {
+	if strings.ContainsAny(sdkVersion, `/\`) || strings.Contains(sdkVersion, "..") {
+		return fmt.Errorf("invalid sdk version")
+	}
+
+	// the venv lives inside the cache, so the packages are hard linked on the same filesystem
+	venvDir := filepath.Join(c.path, PREWARM_DIR, "dify_plugin-"+sdkVersion)
+	if err := os.RemoveAll(venvDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(venvDir, 0755); err != nil {
+		return err
+	}
+
+	run := func(args ...string) error {
+		cmd := exec.Command(options.UvPath, args...)
+		cmd.Dir = venvDir
+		cmd.Env = append(os.Environ(), c.Env()...)
+		cmd.Env = append(cmd.Env, options.Env...)
+		cmd.Env = append(cmd.Env, "VIRTUAL_ENV="+filepath.Join(venvDir, ".venv"))
+		output := bytes.NewBuffer(nil)
+		cmd.Stdout = output
+		cmd.Stderr = output
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s, output: %s", err, output.String())
+		}
+		return nil
+	}
+
+	if err := run("venv", ".venv", "--python", options.Python); err != nil {
+		os.RemoveAll(venvDir)
+		return err
+	}
+
+	args := []string{"pip", "install"}
+	if options.IndexUrl != "" {
+		args = append(args, "-i", options.IndexUrl)
+	}
+	args = append(args, "dify_plugin=="+sdkVersion)
+
+	if err := run(args...); err != nil {
+		os.RemoveAll(venvDir)
+		return err
+	}
+
+	return nil
+}
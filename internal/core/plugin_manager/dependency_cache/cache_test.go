@@ -0,0 +1,99 @@
+package dependency_cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeEntry(t *testing.T, cache *Cache, name string, content string, modTime time.Time) string {
+	dir := filepath.Join(cache.Path(), "archive-v0", name)
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	file := filepath.Join(dir, "module.py")
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0644))
+	assert.NoError(t, os.Chtimes(dir, modTime, modTime))
+	return file
+}
+
+func TestStatsAndPrune(t *testing.T) {
+	root := t.TempDir()
+	cache, err := NewCache(filepath.Join(root, "cache"))
+	assert.NoError(t, err)
+
+	old := time.Now().Add(-time.Hour)
+
+	// linked into a venv
+	referenced := writeEntry(t, cache, "referenced", "aaaa", old)
+	venv := filepath.Join(root, "plugin", ".venv")
+	assert.NoError(t, os.MkdirAll(venv, 0755))
+	assert.NoError(t, os.Link(referenced, filepath.Join(venv, "module.py")))
+	assert.NoError(t, os.Chtimes(filepath.Dir(referenced), old, old))
+
+	writeEntry(t, cache, "unreferenced", "bbbbbb", old)
+	// just unpacked by uv, not linked yet
+	writeEntry(t, cache, "fresh", "cc", time.Now())
+
+	stats, err := cache.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), stats.Size)
+	assert.Equal(t, 3, stats.Entries)
+	assert.Equal(t, 2, stats.UnreferencedEntries)
+	assert.Equal(t, int64(8), stats.UnreferencedSize)
+
+	result, err := cache.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.RemovedEntries)
+	assert.Equal(t, int64(6), result.ReclaimedSize)
+
+	assert.DirExists(t, filepath.Join(cache.Path(), "archive-v0", "referenced"))
+	assert.DirExists(t, filepath.Join(cache.Path(), "archive-v0", "fresh"))
+	assert.NoDirExists(t, filepath.Join(cache.Path(), "archive-v0", "unreferenced"))
+
+	// once the venv is gone, the entry is no longer referenced
+	assert.NoError(t, os.RemoveAll(venv))
+	result, err = cache.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.RemovedEntries)
+}
+
+func TestEnv(t *testing.T) {
+	cache, err := NewCache(t.TempDir())
+	assert.NoError(t, err)
+	assert.Contains(t, cache.Env(), "UV_LINK_MODE=hardlink")
+	assert.Contains(t, cache.Env(), "UV_CACHE_DIR="+cache.Path())
+}
+
+func TestPruneKeepsPrewarmedEntries(t *testing.T) {
+	cache, err := NewCache(t.TempDir())
+	assert.NoError(t, err)
+
+	old := time.Now().Add(-time.Hour)
+	prewarmed := writeEntry(t, cache, "dify_plugin", "aaaa", old)
+
+	// prewarmed packages are linked into a venv kept in the cache
+	venv := filepath.Join(cache.Path(), PREWARM_DIR, "dify_plugin-0.4.1", ".venv")
+	assert.NoError(t, os.MkdirAll(venv, 0755))
+	assert.NoError(t, os.Link(prewarmed, filepath.Join(venv, "module.py")))
+	assert.NoError(t, os.Chtimes(filepath.Dir(prewarmed), old, old))
+
+	stats, err := cache.Stats()
+	assert.NoError(t, err)
+	// the links are not counted twice
+	assert.Equal(t, int64(4), stats.Size)
+	assert.Equal(t, 0, stats.UnreferencedEntries)
+
+	result, err := cache.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.RemovedEntries)
+	assert.FileExists(t, prewarmed)
+}
+
+func TestPrewarmRejectsInvalidVersion(t *testing.T) {
+	cache, err := NewCache(t.TempDir())
+	assert.NoError(t, err)
+	assert.Error(t, cache.Prewarm([]string{"../../etc"}, PrewarmOptions{UvPath: "uv"}))
+	assert.NoDirExists(t, filepath.Join(cache.Path(), PREWARM_DIR))
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package dependency_cache
+
+import "os"
+
+// link counts are not exposed through os.FileInfo on windows
+func linkCount(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,41 @@
+package plugin_manager
+
+import (
+	"sort"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+// healthProbeInterval returns the interval of health probes of local plugins, 0 if disabled
+func (p *PluginManager) healthProbeInterval() time.Duration {
+	if p.config.PluginHealthProbeEnabled == nil || !*p.config.PluginHealthProbeEnabled {
+		return 0
+	}
+	return time.Duration(p.config.PluginHealthProbeInterval) * time.Second
+}
+
+// RuntimeState is the state of a plugin runtime running on this node
+type RuntimeState struct {
+	Identity string                             `json:"identity"`
+	Type     plugin_entities.PluginRuntimeType  `json:"type"`
+	State    plugin_entities.PluginRuntimeState `json:"state"`
+}
+
+// ListRuntimeStates lists the states of all runtimes on this node, including the results of health probes
+func (p *PluginManager) ListRuntimeStates() []RuntimeState {
+	states := []RuntimeState{}
+	p.m.Range(func(key string, lifetime plugin_entities.PluginLifetime) bool {
+		states = append(states, RuntimeState{
+			Identity: key,
+			Type:     lifetime.Type(),
+			State:    lifetime.RuntimeState(),
+		})
+		return true
+	})
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Identity < states[j].Identity
+	})
+	return states
+}
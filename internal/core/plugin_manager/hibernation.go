@@ -0,0 +1,41 @@
+package plugin_manager
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+// isOnDemandPlugin returns true if the local plugin should be launched on demand,
+// plugins listed in PluginLocalAlwaysOnPlugins are pinned to stay always-on
+func (p *PluginManager) isOnDemandPlugin(identity plugin_entities.PluginUniqueIdentifier) bool {
+	if !p.config.PluginLocalOnDemandEnabled {
+		return false
+	}
+
+	pluginId := identity.PluginID()
+	for _, alwaysOn := range p.config.PluginLocalAlwaysOnPlugins {
+		if strings.TrimSpace(alwaysOn) == pluginId {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WakeUp makes sure the runtime is ready to serve a dispatch
+// hibernating plugins are started and the caller waits until they are up
+func (p *PluginManager) WakeUp(runtime plugin_entities.PluginLifetime) error {
+	hibernatable, ok := runtime.(plugin_entities.PluginHibernatableLifetime)
+	if !ok {
+		return nil
+	}
+
+	if err := hibernatable.WakeUp(time.Duration(p.config.PluginLocalWakeUpTimeout) * time.Second); err != nil {
+		return errors.Join(err, errors.New("failed to wake up plugin"))
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package plugin_manager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/kubernetes_platform"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/serverless_runtime/dockerfile"
+	"github.com/langgenius/dify-plugin-daemon/internal/db"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/models"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/decoder"
+)
+
+var ErrKubernetesPlatformDisabled = errors.New("kubernetes platform is not enabled")
+
+// InstallToKubernetesFromPkg launches a plugin as a deployment in the kubernetes namespace,
+// it's invoked like a serverless plugin through its service once launched
+func (p *PluginManager) InstallToKubernetesFromPkg(
+	decoder decoder.PluginDecoder,
+	source string,
+	meta map[string]any,
+) (
+	*stream.Stream[PluginInstallResponse], error,
+) {
+	if p.kubernetes == nil {
+		return nil, ErrKubernetesPlatformDisabled
+	}
+
+	checksum, err := decoder.Checksum()
+	if err != nil {
+		return nil, err
+	}
+	declaration, err := decoder.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	uniqueIdentity, err := decoder.UniqueIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := p.kubernetes.LaunchPlugin(
+		uniqueIdentity,
+		&declaration,
+		dockerfile.DetectPackageFeatures(decoder),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	newResponse := stream.NewStream[PluginInstallResponse](128)
+	routine.Submit(map[string]string{
+		"module":          "plugin_manager",
+		"function":        "InstallToKubernetesFromPkg",
+		"checksum":        checksum,
+		"unique_identity": uniqueIdentity.String(),
+		"source":          source,
+	}, func() {
+		defer newResponse.Close()
+
+		response.Async(func(r kubernetes_platform.LaunchResponse) {
+			switch r.Event {
+			case kubernetes_platform.Info:
+				newResponse.Write(PluginInstallResponse{
+					Event: PluginInstallEventInfo,
+					Data:  r.Message,
+				})
+			case kubernetes_platform.Error:
+				newResponse.Write(PluginInstallResponse{
+					Event: PluginInstallEventError,
+					Data:  r.Message,
+				})
+			case kubernetes_platform.Done:
+				if err := p.saveKubernetesRuntime(uniqueIdentity, checksum, r.Message); err != nil {
+					newResponse.Write(PluginInstallResponse{
+						Event: PluginInstallEventError,
+						Data:  "Failed to create serverless runtime",
+					})
+					return
+				}
+
+				newResponse.Write(PluginInstallResponse{
+					Event: PluginInstallEventDone,
+					Data:  "Installed",
+				})
+			default:
+				newResponse.WriteError(fmt.Errorf("unknown event: %s, with message: %s", r.Event, r.Message))
+			}
+		})
+	})
+
+	return newResponse, nil
+}
+
+// saveKubernetesRuntime records the service of a plugin, it's looked up like a serverless function
+func (p *PluginManager) saveKubernetesRuntime(
+	identity plugin_entities.PluginUniqueIdentifier,
+	checksum string,
+	endpoint string,
+) error {
+	runtime, err := db.GetOne[models.ServerlessRuntime](
+		db.Equal("plugin_unique_identifier", identity.String()),
+	)
+	if err == db.ErrDatabaseNotFound {
+		return db.Create(&models.ServerlessRuntime{
+			Checksum:               checksum,
+			Type:                   models.SERVERLESS_RUNTIME_TYPE_KUBERNETES,
+			FunctionURL:            endpoint,
+			FunctionName:           kubernetes_platform.ResourceName(identity),
+			PluginUniqueIdentifier: identity.String(),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	runtime.FunctionURL = endpoint
+	runtime.FunctionName = kubernetes_platform.ResourceName(identity)
+	runtime.Type = models.SERVERLESS_RUNTIME_TYPE_KUBERNETES
+	if err := db.Update(&runtime); err != nil {
+		return err
+	}
+	return p.clearServerlessRuntimeCache(identity)
+}
+
+// UninstallFromKubernetes removes the deployment and service of a plugin
+func (p *PluginManager) UninstallFromKubernetes(identity plugin_entities.PluginUniqueIdentifier) error {
+	if p.kubernetes == nil {
+		return ErrKubernetesPlatformDisabled
+	}
+
+	if err := p.kubernetes.Delete(identity); err != nil {
+		return err
+	}
+
+	if err := db.DeleteByCondition(models.ServerlessRuntime{
+		PluginUniqueIdentifier: identity.String(),
+	}); err != nil {
+		return err
+	}
+
+	return p.clearServerlessRuntimeCache(identity)
+}
+
+// KubernetesEnabled returns whether plugins run on kubernetes, serverless runtimes are kubernetes deployments then
+func (p *PluginManager) KubernetesEnabled() bool {
+	return p.kubernetes != nil
+}
+
+// ScaleKubernetesPlugin sets the number of replicas of a plugin
+func (p *PluginManager) ScaleKubernetesPlugin(identity plugin_entities.PluginUniqueIdentifier, replicas int32) error {
+	if p.kubernetes == nil {
+		return ErrKubernetesPlatformDisabled
+	}
+
+	return p.kubernetes.Scale(identity, replicas)
+}
@@ -0,0 +1,280 @@
+package kubernetes_platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/serverless_runtime/dockerfile"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+type LaunchEvent string
+
+const (
+	Error LaunchEvent = "error"
+	Info  LaunchEvent = "info"
+	// the message of done is the endpoint of the plugin
+	Done LaunchEvent = "done"
+)
+
+type LaunchResponse struct {
+	Event   LaunchEvent `json:"event"`
+	Message string      `json:"message"`
+}
+
+var (
+	ErrBuildFailed = errors.New("failed to build plugin image")
+)
+
+// LaunchPlugin builds the image of the plugin if builds are enabled, then creates or updates its
+// deployment and service, it's done once at least one replica is available
+func (p *Platform) LaunchPlugin(
+	identity plugin_entities.PluginUniqueIdentifier,
+	declaration *plugin_entities.PluginDeclaration,
+	features dockerfile.PackageFeatures,
+) (*stream.Stream[LaunchResponse], error) {
+	var dockerfileContent string
+	if p.config.KubernetesImageBuildEnabled {
+		extraBuildSteps, err := dockerfile.ReadExtraBuildSteps(p.config.ServerlessImageExtraBuildStepsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		dockerfileContent, err = dockerfile.GenerateDockerfile(declaration, dockerfile.Options{
+			RegistryMirror:  p.config.ServerlessImageRegistryMirror,
+			ExtraBuildSteps: extraBuildSteps,
+			PackageFeatures: features,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	response := stream.NewStream[LaunchResponse](16)
+	routine.Submit(map[string]string{
+		"module":          "kubernetes_platform",
+		"function":        "LaunchPlugin",
+		"unique_identity": identity.String(),
+	}, func() {
+		defer response.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.launchTimeout)
+		defer cancel()
+
+		if err := p.launch(ctx, identity, dockerfileContent, response); err != nil {
+			response.Write(LaunchResponse{Event: Error, Message: err.Error()})
+			return
+		}
+
+		response.Write(LaunchResponse{Event: Done, Message: Endpoint(p.namespace, identity)})
+	})
+
+	return response, nil
+}
+
+func (p *Platform) launch(
+	ctx context.Context,
+	identity plugin_entities.PluginUniqueIdentifier,
+	dockerfileContent string,
+	response *stream.Stream[LaunchResponse],
+) error {
+	if p.config.KubernetesImageBuildEnabled {
+		response.Write(LaunchResponse{Event: Info, Message: "Building plugin..."})
+		if err := p.buildImage(ctx, identity, dockerfileContent); err != nil {
+			return err
+		}
+	}
+
+	response.Write(LaunchResponse{Event: Info, Message: "Launching plugin..."})
+	if err := p.applyService(ctx, identity); err != nil {
+		return fmt.Errorf("failed to apply service: %s", err)
+	}
+	if err := p.applyDeployment(ctx, identity); err != nil {
+		return fmt.Errorf("failed to apply deployment: %s", err)
+	}
+
+	return p.waitForDeployment(ctx, identity)
+}
+
+// buildImage runs the build job of the plugin until it's done, succeeded builds are reused
+func (p *Platform) buildImage(
+	ctx context.Context,
+	identity plugin_entities.PluginUniqueIdentifier,
+	dockerfileContent string,
+) error {
+	jobs := p.client.BatchV1().Jobs(p.namespace)
+	name := ResourceName(identity)
+
+	job, err := jobs.Get(ctx, name, metav1.GetOptions{})
+	if err == nil && jobFailed(job) {
+		// retry failed builds from scratch
+		if err := p.deleteJob(ctx, name); err != nil {
+			return err
+		}
+		err = apierrors.NewNotFound(batchv1.Resource("jobs"), name)
+	}
+	if apierrors.IsNotFound(err) {
+		job, err = jobs.Create(ctx, p.buildJob(identity, dockerfileContent), metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create build job: %s", err)
+	}
+
+	for !jobSucceeded(job) {
+		if jobFailed(job) {
+			return ErrBuildFailed
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for build job %s", name)
+		case <-time.After(p.pollInterval):
+		}
+
+		job, err = jobs.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get build job: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func jobSucceeded(job *batchv1.Job) bool {
+	return job.Status.Succeeded > 0
+}
+
+func jobFailed(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Platform) applyService(ctx context.Context, identity plugin_entities.PluginUniqueIdentifier) error {
+	services := p.client.CoreV1().Services(p.namespace)
+	service := p.service(identity)
+
+	current, err := services.Get(ctx, service.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = services.Create(ctx, service, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// the cluster ip is immutable, only the rest of the spec is replaced
+	current.Labels = service.Labels
+	current.Annotations = service.Annotations
+	current.Spec.Selector = service.Spec.Selector
+	current.Spec.Ports = service.Spec.Ports
+	_, err = services.Update(ctx, current, metav1.UpdateOptions{})
+	return err
+}
+
+func (p *Platform) applyDeployment(ctx context.Context, identity plugin_entities.PluginUniqueIdentifier) error {
+	deployments := p.client.AppsV1().Deployments(p.namespace)
+
+	current, err := deployments.Get(ctx, ResourceName(identity), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = deployments.Create(ctx, p.deployment(identity, p.config.KubernetesPluginReplicas), metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// replicas scaled by administrators are kept
+	replicas := p.config.KubernetesPluginReplicas
+	if current.Spec.Replicas != nil {
+		replicas = *current.Spec.Replicas
+	}
+	deployment := p.deployment(identity, replicas)
+	current.Labels = deployment.Labels
+	current.Annotations = deployment.Annotations
+	current.Spec = deployment.Spec
+	_, err = deployments.Update(ctx, current, metav1.UpdateOptions{})
+	return err
+}
+
+func (p *Platform) waitForDeployment(ctx context.Context, identity plugin_entities.PluginUniqueIdentifier) error {
+	deployments := p.client.AppsV1().Deployments(p.namespace)
+	name := ResourceName(identity)
+
+	for {
+		deployment, err := deployments.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get deployment: %s", err)
+		}
+		if deployment.Status.AvailableReplicas > 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for deployment %s to be available", name)
+		case <-time.After(p.pollInterval):
+		}
+	}
+}
+
+// Scale sets the number of replicas of a plugin
+func (p *Platform) Scale(identity plugin_entities.PluginUniqueIdentifier, replicas int32) error {
+	ctx := context.Background()
+	deployments := p.client.AppsV1().Deployments(p.namespace)
+
+	// the deployment may be updated meanwhile, e.g. by an autoscaler, it's read again on conflicts
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := deployments.Get(ctx, ResourceName(identity), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		deployment.Spec.Replicas = &replicas
+		_, err = deployments.Update(ctx, deployment, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// Delete removes the deployment, service and build job of a plugin, missing resources are ignored
+func (p *Platform) Delete(identity plugin_entities.PluginUniqueIdentifier) error {
+	ctx := context.Background()
+	name := ResourceName(identity)
+
+	errs := []error{}
+	if err := p.client.AppsV1().Deployments(p.namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		errs = append(errs, err)
+	}
+	if err := p.client.CoreV1().Services(p.namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		errs = append(errs, err)
+	}
+	if err := p.deleteJob(ctx, name); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *Platform) deleteJob(ctx context.Context, name string) error {
+	// pods of the job are deleted with it
+	propagation := metav1.DeletePropagationBackground
+	err := p.client.BatchV1().Jobs(p.namespace).Delete(ctx, name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package kubernetes_platform
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/serverless_runtime/dockerfile"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testIdentity = plugin_entities.PluginUniqueIdentifier(
+	"langgenius/Open_AI:0.0.1@0123456789abcdef0123456789abcdef",
+)
+
+func newTestPlatform(buildEnabled bool) (*Platform, *fake.Clientset) {
+	routine.InitPool(1024)
+
+	client := fake.NewSimpleClientset()
+	platform := NewPlatform(client, &app.Config{
+		ServerKey:                     "server-key",
+		KubernetesNamespace:           "plugins",
+		KubernetesPluginImage:         "registry.local/plugins/{author}-{name}:{version}-{checksum}",
+		KubernetesPluginReplicas:      2,
+		KubernetesPluginLaunchTimeout: 5,
+		KubernetesImageBuildEnabled:   buildEnabled,
+		KubernetesImageBuilder:        "kaniko",
+		KubernetesImageBuildFetcher:   "mirror.local/busybox:1.36",
+		KubernetesDaemonURL:           "http://daemon:5002/",
+	})
+	platform.pollInterval = 10 * time.Millisecond
+	return platform, client
+}
+
+func testDeclaration() *plugin_entities.PluginDeclaration {
+	return &plugin_entities.PluginDeclaration{
+		PluginDeclarationWithoutAdvancedFields: plugin_entities.PluginDeclarationWithoutAdvancedFields{
+			Meta: plugin_entities.PluginMeta{
+				Arch: []constants.Arch{constants.AMD64},
+				Runner: plugin_entities.PluginRunner{
+					Language:   constants.Python,
+					Version:    "3.12",
+					Entrypoint: "main",
+				},
+			},
+		},
+	}
+}
+
+func readLaunchResponses(t *testing.T, platform *Platform) []LaunchResponse {
+	response, err := platform.LaunchPlugin(testIdentity, testDeclaration(), dockerfile.PackageFeatures{})
+	assert.NoError(t, err)
+
+	responses := []LaunchResponse{}
+	for response.Next() {
+		r, err := response.Read()
+		assert.NoError(t, err)
+		responses = append(responses, r)
+	}
+	return responses
+}
+
+func TestResourceName(t *testing.T) {
+	assert.Equal(t, "plugin-open-ai-0123456789ab", ResourceName(testIdentity))
+	assert.Equal(
+		t,
+		"registry.local/langgenius-open_ai:0.0.1-0123456789abcdef0123456789abcdef",
+		Image("registry.local/{author}-{name}:{version}-{checksum}", testIdentity),
+	)
+	assert.Equal(t, "http://plugin-open-ai-0123456789ab.plugins.svc", Endpoint("plugins", testIdentity))
+
+}
+
+func TestPackageToken(t *testing.T) {
+	now := time.Now()
+	token := PackageToken("server-key", testIdentity, now.Add(time.Minute))
+	assert.True(t, VerifyPackageToken("server-key", testIdentity, token, now))
+	assert.False(t, VerifyPackageToken("other-key", testIdentity, token, now))
+
+	// tokens are only valid for the package of their build job
+	other := plugin_entities.PluginUniqueIdentifier("langgenius/other:0.0.1@0123456789abcdef0123456789abcdef")
+	assert.False(t, VerifyPackageToken("server-key", other, token, now))
+
+	// expired tokens are rejected
+	assert.False(t, VerifyPackageToken("server-key", testIdentity, token, now.Add(2*time.Minute)))
+
+	// the expiry is signed
+	_, signature, _ := strings.Cut(token, ".")
+	forged := fmt.Sprintf("%d.%s", now.Add(time.Hour).Unix(), signature)
+	assert.False(t, VerifyPackageToken("server-key", testIdentity, forged, now.Add(2*time.Minute)))
+
+	assert.False(t, VerifyPackageToken("server-key", testIdentity, "", now))
+	assert.False(t, VerifyPackageToken("server-key", testIdentity, signature, now))
+}
+
+func TestLaunchPlugin(t *testing.T) {
+	platform, client := newTestPlatform(false)
+	name := ResourceName(testIdentity)
+
+	// the deployment becomes available after a while
+	go func() {
+		deployments := client.AppsV1().Deployments("plugins")
+		assert.Eventually(t, func() bool {
+			_, err := deployments.Get(context.Background(), name, metav1.GetOptions{})
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+
+		deployment, _ := deployments.Get(context.Background(), name, metav1.GetOptions{})
+		deployment.Status.AvailableReplicas = 1
+		deployments.UpdateStatus(context.Background(), deployment, metav1.UpdateOptions{})
+	}()
+
+	responses := readLaunchResponses(t, platform)
+	if assert.NotEmpty(t, responses) {
+		last := responses[len(responses)-1]
+		assert.Equal(t, Done, last.Event, last.Message)
+		assert.Equal(t, Endpoint("plugins", testIdentity), last.Message)
+	}
+
+	deployment, err := client.AppsV1().Deployments("plugins").Get(context.Background(), name, metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(2), *deployment.Spec.Replicas)
+		assert.Equal(t, testIdentity.String(), deployment.Annotations[ANNOTATION_PLUGIN_UNIQUE_IDENTIFIER])
+		assert.Equal(
+			t,
+			"registry.local/plugins/langgenius-open_ai:0.0.1-0123456789abcdef0123456789abcdef",
+			deployment.Spec.Template.Spec.Containers[0].Image,
+		)
+	}
+	_, err = client.CoreV1().Services("plugins").Get(context.Background(), name, metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	// no image is built unless enabled
+	_, err = client.BatchV1().Jobs("plugins").Get(context.Background(), name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// scaled replicas are kept by relaunches
+	assert.NoError(t, platform.Scale(testIdentity, 5))
+	responses = readLaunchResponses(t, platform)
+	assert.Equal(t, Done, responses[len(responses)-1].Event)
+	deployment, _ = client.AppsV1().Deployments("plugins").Get(context.Background(), name, metav1.GetOptions{})
+	assert.Equal(t, int32(5), *deployment.Spec.Replicas)
+
+	// everything is removed on uninstall
+	assert.NoError(t, platform.Delete(testIdentity))
+	assert.NoError(t, platform.Delete(testIdentity))
+	_, err = client.AppsV1().Deployments("plugins").Get(context.Background(), name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = client.CoreV1().Services("plugins").Get(context.Background(), name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestLaunchPluginBuildFailed(t *testing.T) {
+	platform, client := newTestPlatform(true)
+	name := ResourceName(testIdentity)
+
+	go func() {
+		jobs := client.BatchV1().Jobs("plugins")
+		assert.Eventually(t, func() bool {
+			_, err := jobs.Get(context.Background(), name, metav1.GetOptions{})
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+
+		job, _ := jobs.Get(context.Background(), name, metav1.GetOptions{})
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+			Type:   batchv1.JobFailed,
+			Status: corev1.ConditionTrue,
+		})
+		jobs.UpdateStatus(context.Background(), job, metav1.UpdateOptions{})
+	}()
+
+	responses := readLaunchResponses(t, platform)
+	if assert.NotEmpty(t, responses) {
+		last := responses[len(responses)-1]
+		assert.Equal(t, Error, last.Event)
+		assert.Equal(t, ErrBuildFailed.Error(), last.Message)
+	}
+
+	job, err := client.BatchV1().Jobs("plugins").Get(context.Background(), name, metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		fetch := job.Spec.Template.Spec.InitContainers[0]
+		assert.Equal(t, "mirror.local/busybox:1.36", fetch.Image)
+		assert.Equal(
+			t,
+			"http://daemon:5002/kubernetes/packages/langgenius%2FOpen_AI:0.0.1@0123456789abcdef0123456789abcdef",
+			fetch.Env[0].Value,
+		)
+		// the token is sent in a header and expires with the launch
+		assert.Contains(t, fetch.Command[2], PACKAGE_TOKEN_HEADER+": $PACKAGE_TOKEN")
+		assert.True(t, VerifyPackageToken("server-key", testIdentity, fetch.Env[1].Value, time.Now()))
+		assert.False(t, VerifyPackageToken("server-key", testIdentity, fetch.Env[1].Value, time.Now().Add(time.Minute)))
+		assert.Contains(t, fetch.Env[2].Value, "python")
+		assert.Contains(t, job.Spec.Template.Spec.Containers[0].Args,
+			"--destination=registry.local/plugins/langgenius-open_ai:0.0.1-0123456789abcdef0123456789abcdef")
+	}
+
+	// nothing is deployed without an image
+	_, err = client.AppsV1().Deployments("plugins").Get(context.Background(), name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestScaleRetriesOnConflict(t *testing.T) {
+	platform, client := newTestPlatform(false)
+	name := ResourceName(testIdentity)
+
+	replicas := int32(2)
+	_, err := client.AppsV1().Deployments("plugins").Create(context.Background(), &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "plugins"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	// the deployment is updated by someone else between reading and updating it once
+	conflicts := 0
+	client.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Group: "apps", Resource: "deployments"}, name, fmt.Errorf("modified"))
+	})
+
+	assert.NoError(t, platform.Scale(testIdentity, 5))
+	assert.Equal(t, 1, conflicts)
+
+	deployment, err := client.AppsV1().Deployments("plugins").Get(context.Background(), name, metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(5), *deployment.Spec.Replicas)
+	}
+}
@@ -0,0 +1,56 @@
+package kubernetes_platform
+
+import (
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// the interval to check whether builds and deployments are done
+	DEFAULT_POLL_INTERVAL = 2 * time.Second
+)
+
+// Platform runs plugins in a kubernetes namespace, each plugin version is a deployment
+// with a service in front of it, which speaks the same http invoke contract as serverless plugins
+type Platform struct {
+	client kubernetes.Interface
+	config *app.Config
+
+	namespace     string
+	pollInterval  time.Duration
+	launchTimeout time.Duration
+}
+
+func NewPlatform(client kubernetes.Interface, config *app.Config) *Platform {
+	return &Platform{
+		client:        client,
+		config:        config,
+		namespace:     config.KubernetesNamespace,
+		pollInterval:  DEFAULT_POLL_INTERVAL,
+		launchTimeout: time.Duration(config.KubernetesPluginLaunchTimeout) * time.Second,
+	}
+}
+
+// NewClient creates a client from the kubeconfig file, or from the in-cluster config if it's empty
+func NewClient(kubeconfig string) (kubernetes.Interface, error) {
+	var restConfig *rest.Config
+	var err error
+	if kubeconfig == "" {
+		restConfig, err = rest.InClusterConfig()
+	} else {
+		restConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(restConfig)
+}
+
+func (p *Platform) Namespace() string {
+	return p.namespace
+}
@@ -0,0 +1,260 @@
+package kubernetes_platform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// the port plugins serve the invoke contract on, see SERVERLESS_PORT of the plugin sdk
+	PLUGIN_PORT = 8080
+
+	LABEL_MANAGED_BY                    = "app.kubernetes.io/managed-by"
+	LABEL_MANAGED_BY_VALUE              = "dify-plugin-daemon"
+	LABEL_PLUGIN                        = "dify.ai/plugin"
+	ANNOTATION_PLUGIN_UNIQUE_IDENTIFIER = "dify.ai/plugin-unique-identifier"
+
+	// build jobs send the token of the package download in this header, it's kept out of access logs
+	PACKAGE_TOKEN_HEADER = "X-Package-Token"
+
+	// finished build jobs are kept for a while to inspect their logs
+	BUILD_JOB_TTL_SECONDS = 3600
+)
+
+var nonDNSCharacters = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// pluginName returns the name of a plugin without its author
+func pluginName(identity plugin_entities.PluginUniqueIdentifier) string {
+	pluginID := identity.PluginID()
+	if index := strings.LastIndex(pluginID, "/"); index != -1 {
+		return pluginID[index+1:]
+	}
+	return pluginID
+}
+
+// ResourceName returns the name of the deployment, service and build job of a plugin,
+// it's a valid dns label which is stable for a plugin unique identifier
+func ResourceName(identity plugin_entities.PluginUniqueIdentifier) string {
+	name := nonDNSCharacters.ReplaceAllString(strings.ToLower(pluginName(identity)), "-")
+	if len(name) > 30 {
+		name = name[:30]
+	}
+	name = strings.Trim(name, "-")
+
+	checksum := identity.Checksum()
+	if len(checksum) > 12 {
+		checksum = checksum[:12]
+	}
+
+	return fmt.Sprintf("plugin-%s-%s", name, checksum)
+}
+
+// Image returns the image of a plugin from the template
+func Image(template string, identity plugin_entities.PluginUniqueIdentifier) string {
+	return strings.NewReplacer(
+		"{author}", strings.ToLower(identity.Author()),
+		"{name}", strings.ToLower(pluginName(identity)),
+		"{version}", string(identity.Version()),
+		"{checksum}", identity.Checksum(),
+	).Replace(template)
+}
+
+// Endpoint returns the url of the service of a plugin inside the cluster
+func Endpoint(namespace string, identity plugin_entities.PluginUniqueIdentifier) string {
+	return fmt.Sprintf("http://%s.%s.svc", ResourceName(identity), namespace)
+}
+
+func packageTokenSignature(key string, identity plugin_entities.PluginUniqueIdentifier, expiresAt int64) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	// scoped to the build job of the plugin
+	mac.Write([]byte(strings.Join([]string{
+		ResourceName(identity), identity.String(), strconv.FormatInt(expiresAt, 10),
+	}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// PackageToken signs the download of a plugin package by its build job, it's valid until expiresAt
+func PackageToken(key string, identity plugin_entities.PluginUniqueIdentifier, expiresAt time.Time) string {
+	return fmt.Sprintf("%d.%s", expiresAt.Unix(), packageTokenSignature(key, identity, expiresAt.Unix()))
+}
+
+func VerifyPackageToken(key string, identity plugin_entities.PluginUniqueIdentifier, token string, now time.Time) bool {
+	expires, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(packageTokenSignature(key, identity, expiresAt)), []byte(signature))
+}
+
+func (p *Platform) labels(identity plugin_entities.PluginUniqueIdentifier) map[string]string {
+	return map[string]string{
+		LABEL_MANAGED_BY: LABEL_MANAGED_BY_VALUE,
+		LABEL_PLUGIN:     ResourceName(identity),
+	}
+}
+
+func (p *Platform) objectMeta(identity plugin_entities.PluginUniqueIdentifier) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      ResourceName(identity),
+		Namespace: p.namespace,
+		Labels:    p.labels(identity),
+		Annotations: map[string]string{
+			ANNOTATION_PLUGIN_UNIQUE_IDENTIFIER: identity.String(),
+		},
+	}
+}
+
+func (p *Platform) deployment(identity plugin_entities.PluginUniqueIdentifier, replicas int32) *appsv1.Deployment {
+	podSpec := corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name:  "plugin",
+				Image: Image(p.config.KubernetesPluginImage, identity),
+				Env: []corev1.EnvVar{
+					{Name: "INSTALL_METHOD", Value: "serverless"},
+					{Name: "SERVERLESS_HOST", Value: "0.0.0.0"},
+					{Name: "SERVERLESS_PORT", Value: fmt.Sprintf("%d", PLUGIN_PORT)},
+				},
+				Ports: []corev1.ContainerPort{
+					{Name: "http", ContainerPort: PLUGIN_PORT},
+				},
+				ReadinessProbe: &corev1.Probe{
+					ProbeHandler: corev1.ProbeHandler{
+						TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(PLUGIN_PORT)},
+					},
+					PeriodSeconds: 5,
+				},
+			},
+		},
+	}
+	if p.config.KubernetesPluginImagePullSecret != "" {
+		podSpec.ImagePullSecrets = []corev1.LocalObjectReference{
+			{Name: p.config.KubernetesPluginImagePullSecret},
+		}
+	}
+
+	return &appsv1.Deployment{
+		ObjectMeta: p.objectMeta(identity),
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: p.labels(identity)},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: p.labels(identity)},
+				Spec:       podSpec,
+			},
+		},
+	}
+}
+
+func (p *Platform) service(identity plugin_entities.PluginUniqueIdentifier) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: p.objectMeta(identity),
+		Spec: corev1.ServiceSpec{
+			Selector: p.labels(identity),
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       80,
+					TargetPort: intstr.FromInt32(PLUGIN_PORT),
+				},
+			},
+		},
+	}
+}
+
+// buildJob builds the image of a plugin with kaniko, the package is downloaded from the daemon
+// and unpacked as the build context next to the generated dockerfile
+func (p *Platform) buildJob(identity plugin_entities.PluginUniqueIdentifier, dockerfile string) *batchv1.Job {
+	packageURL := fmt.Sprintf(
+		"%s/kubernetes/packages/%s",
+		strings.TrimRight(p.config.KubernetesDaemonURL, "/"),
+		url.PathEscape(identity.String()),
+	)
+	// the job is useless once the launch timed out
+	packageToken := PackageToken(p.config.ServerKey, identity, time.Now().Add(p.launchTimeout))
+
+	backoffLimit := int32(1)
+	ttl := int32(BUILD_JOB_TTL_SECONDS)
+
+	workspace := corev1.VolumeMount{Name: "workspace", MountPath: "/workspace"}
+	volumes := []corev1.Volume{
+		{Name: "workspace", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	}
+	builderMounts := []corev1.VolumeMount{workspace}
+	if p.config.KubernetesImageBuildPushSecret != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: "docker-config",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: p.config.KubernetesImageBuildPushSecret,
+					Items: []corev1.KeyToPath{
+						{Key: corev1.DockerConfigJsonKey, Path: "config.json"},
+					},
+				},
+			},
+		})
+		builderMounts = append(builderMounts, corev1.VolumeMount{Name: "docker-config", MountPath: "/kaniko/.docker"})
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: p.objectMeta(identity),
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: p.labels(identity)},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					InitContainers: []corev1.Container{
+						{
+							Name:  "fetch",
+							Image: p.config.KubernetesImageBuildFetcher,
+							Command: []string{"sh", "-c", strings.Join([]string{
+								`wget -q --header "` + PACKAGE_TOKEN_HEADER + `: $PACKAGE_TOKEN" -O /workspace/plugin.difypkg "$PACKAGE_URL"`,
+								`unzip -q -o /workspace/plugin.difypkg -d /workspace/context`,
+								`printf '%s' "$DOCKERFILE" > /workspace/context/Dockerfile`,
+							}, " && ")},
+							Env: []corev1.EnvVar{
+								{Name: "PACKAGE_URL", Value: packageURL},
+								{Name: "PACKAGE_TOKEN", Value: packageToken},
+								{Name: "DOCKERFILE", Value: dockerfile},
+							},
+							VolumeMounts: []corev1.VolumeMount{workspace},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "build",
+							Image: p.config.KubernetesImageBuilder,
+							Args: []string{
+								"--context=dir:///workspace/context",
+								"--dockerfile=/workspace/context/Dockerfile",
+								"--destination=" + Image(p.config.KubernetesPluginImage, identity),
+							},
+							VolumeMounts: builderMounts,
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+}
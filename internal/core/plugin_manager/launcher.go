@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/basic_runtime"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/local_runtime"
@@ -131,19 +132,38 @@ func (p *PluginManager) launchLocal(pluginUniqueIdentifier plugin_entities.Plugi
 
 	localPluginRuntime := local_runtime.NewLocalPluginRuntime(local_runtime.LocalPluginRuntimeConfig{
 		PythonInterpreterPath:     p.config.PythonInterpreterPath,
+		PythonInterpreters:        p.config.PythonInterpreters,
+		DefaultPythonVersion:      p.config.PythonDefaultVersion,
 		UvPath:                    p.config.UvPath,
+		DependencyCache:           p.dependencyCache,
+		SdkPatches:                p.sdkPatches,
 		PythonEnvInitTimeout:      p.config.PythonEnvInitTimeout,
 		PythonCompileAllExtraArgs: p.config.PythonCompileAllExtraArgs,
 		HttpProxy:                 p.config.HttpProxy,
 		HttpsProxy:                p.config.HttpsProxy,
 		NoProxy:                   p.config.NoProxy,
+		NodeExecutablePath:        p.config.NodeExecutablePath,
+		NpmPath:                   p.config.NpmPath,
+		PnpmPath:                  p.config.PnpmPath,
+		NpmRegistryUrl:            p.config.NpmRegistryUrl,
+		NodeEnvInitTimeout:        p.config.NodeEnvInitTimeout,
 		PipMirrorUrl:              p.config.PipMirrorUrl,
 		PipPreferBinary:           *p.config.PipPreferBinary,
 		PipExtraArgs:              p.config.PipExtraArgs,
 		StdoutBufferSize:          p.config.PluginStdioBufferSize,
 		StdoutMaxBufferSize:       p.config.PluginStdioMaxBufferSize,
+		StdoutMaxFrameSize:        p.config.PluginStdioMaxFrameSize,
+		StdioFramingEnabled:       p.config.PluginStdioFramingEnabled,
+		Environment:               p.pluginEnvironmentResolver(identity),
+		LogWriter:                 p.pluginLogWriter(identity),
+		HealthProbeInterval:       p.healthProbeInterval(),
+		HealthProbeTimeout:        time.Duration(p.config.PluginHealthProbeTimeout) * time.Second,
+		HealthProbeMaxFailures:    p.config.PluginHealthProbeMaxFailures,
+		OnDemand:                  p.isOnDemandPlugin(identity),
+		IdleTimeout:               time.Duration(p.config.PluginLocalIdleTimeout) * time.Second,
 	})
-	localPluginRuntime.PluginRuntime = plugin.runtime
+	localPluginRuntime.Config = plugin.runtime.Config
+	localPluginRuntime.State = plugin.runtime.State
 	localPluginRuntime.BasicChecksum = basic_runtime.BasicChecksum{
 		MediaTransport: basic_runtime.NewMediaTransport(p.mediaBucket),
 		WorkingPath:    plugin.runtime.State.WorkingPath,
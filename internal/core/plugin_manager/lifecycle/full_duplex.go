@@ -97,6 +97,11 @@ func FullDuplex(
 			<-c
 		}
 
+		// plugin process was stopped due to idleness, it will be started again on demand
+		if h, ok := r.(plugin_entities.PluginHibernatableLifetime); ok && h.Hibernated() {
+			continue
+		}
+
 		// restart plugin in 5s (skip for debugging runtime)
 		if r.Type() != plugin_entities.PLUGIN_RUNTIME_TYPE_REMOTE {
 			time.Sleep(5 * time.Second)
@@ -0,0 +1,37 @@
+package local_runtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelRequiresNegotiatedProtocol(t *testing.T) {
+	stdin := newMockReadWriteCloser()
+	stdout := newMockReadWriteCloser()
+	stderr := newMockReadWriteCloser()
+
+	runtime := NewLocalPluginRuntime(LocalPluginRuntimeConfig{})
+	runtime.stdioHolder = newStdioHolder("test-plugin", stdin, stdout, stderr, &StdioHolderConfig{
+		OnProtocolNegotiated: runtime.SetProtocolVersion,
+	})
+
+	// plugins with older sdks never negotiate, cancel events must not be sent to them
+	runtime.Cancel("test-session", []byte(`{"event":"cancel"}`))
+	assert.Empty(t, stdin.GetWrittenData())
+	assert.Equal(t, plugin_entities.PLUGIN_PROTOCOL_VERSION_BASIC, runtime.ProtocolVersion())
+
+	stdout.WriteToRead([]byte(`{"event":"protocol","data":{"version":2}}` + "\n"))
+	go runtime.stdioHolder.StartStdout(func() {})
+
+	assert.Eventually(t, func() bool {
+		return runtime.ProtocolVersion() == plugin_entities.PLUGIN_PROTOCOL_VERSION_CANCELLATION
+	}, time.Second, 10*time.Millisecond)
+
+	runtime.Cancel("test-session", []byte(`{"event":"cancel"}`))
+	assert.Equal(t, `{"event":"cancel"}`+"\n", string(stdin.GetWrittenData()))
+
+	stdout.Close()
+}
@@ -9,9 +9,14 @@ import (
 
 func (r *LocalPluginRuntime) InitEnvironment() error {
 	var err error
-	if r.Config.Meta.Runner.Language == constants.Python {
+	switch r.Config.Meta.Runner.Language {
+	case constants.Python:
 		err = r.InitPythonEnvironment()
-	} else {
+	case constants.NodeJS:
+		err = r.InitNodeJSEnvironment()
+	case constants.Go:
+		// go plugins carry prebuilt binaries, nothing needs to be installed
+	default:
 		return fmt.Errorf("unsupported language: %s", r.Config.Meta.Runner.Language)
 	}
 
@@ -0,0 +1,58 @@
+package local_runtime
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/consts"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/packager"
+)
+
+// goBinary returns the prebuilt binary of a go plugin for the arch of the daemon,
+// the checksum is verified on every start as the working directory is writable
+func (r *LocalPluginRuntime) goBinary() (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", fmt.Errorf("go plugins are built for linux, got %s", runtime.GOOS)
+	}
+
+	arch := constants.Arch(runtime.GOARCH)
+	if !slices.Contains(r.Config.Meta.Arch, arch) {
+		return "", fmt.Errorf("plugin %s doesn't support %s", r.Config.Identity(), arch)
+	}
+
+	checksumFile, err := os.ReadFile(path.Join(r.State.WorkingPath, consts.BINARIES_CHECKSUM_FILE))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %s", consts.BINARIES_CHECKSUM_FILE, err)
+	}
+
+	checksums, err := packager.ParseBinaryChecksums(checksumFile)
+	if err != nil {
+		return "", err
+	}
+
+	binaryPath, err := filepath.Abs(path.Join(r.State.WorkingPath, packager.GoBinaryPath(r.Config.Meta.Runner.Entrypoint, arch)))
+	if err != nil {
+		return "", err
+	}
+
+	binary, err := os.ReadFile(binaryPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to find the binary for %s: %s", arch, err)
+	}
+
+	if err := packager.CheckBinaryChecksum(checksums, filepath.Base(binaryPath), binary); err != nil {
+		return "", err
+	}
+
+	// files are extracted from the package without the executable bit
+	if err := os.Chmod(binaryPath, 0755); err != nil {
+		return "", err
+	}
+
+	return binaryPath, nil
+}
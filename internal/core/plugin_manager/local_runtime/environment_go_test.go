@@ -0,0 +1,58 @@
+package local_runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoBinary(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("go plugins are built for linux")
+	}
+
+	r := NewLocalPluginRuntime(LocalPluginRuntimeConfig{})
+	r.State.WorkingPath = t.TempDir()
+	r.Config.Meta.Runner.Language = constants.Go
+	r.Config.Meta.Runner.Entrypoint = "main"
+	r.Config.Meta.Arch = []constants.Arch{constants.Arch(runtime.GOARCH)}
+
+	binaryName := "main-linux-" + runtime.GOARCH
+	binary := []byte("#!/bin/sh\n")
+	hash := sha256.Sum256(binary)
+
+	assert.NoError(t, os.MkdirAll(path.Join(r.State.WorkingPath, "bin"), 0755))
+	assert.NoError(t, os.WriteFile(path.Join(r.State.WorkingPath, "bin", binaryName), binary, 0644))
+
+	// the checksum file is required
+	_, err := r.goBinary()
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(
+		path.Join(r.State.WorkingPath, "bin", "SHA256SUMS"),
+		[]byte(hex.EncodeToString(hash[:])+"  "+binaryName+"\n"),
+		0644,
+	))
+
+	binaryPath, err := r.goBinary()
+	assert.NoError(t, err)
+	info, err := os.Stat(binaryPath)
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Mode()&0100)
+
+	// a tampered binary is refused
+	assert.NoError(t, os.WriteFile(binaryPath, []byte("tampered"), 0755))
+	_, err = r.goBinary()
+	assert.Error(t, err)
+
+	// so is a plugin built for other arches only
+	r.Config.Meta.Arch = []constants.Arch{"other"}
+	_, err = r.goBinary()
+	assert.Error(t, err)
+}
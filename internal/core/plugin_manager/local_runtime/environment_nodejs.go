@@ -0,0 +1,234 @@
+package local_runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+)
+
+const (
+	NODE_MODULES_DIR         = "node_modules"
+	NODE_MODULES_MARKER_PATH = "node_modules/.dify/plugin.json"
+
+	NODE_INSTALLER_NPM      = "npm"
+	NODE_INSTALLER_PNPM     = "pnpm"
+	NODE_INSTALLER_VENDORED = "vendored"
+)
+
+// nodeModulesMarker is written into node_modules once the dependencies are installed
+// node_modules without the marker is considered broken and reinstalled
+type nodeModulesMarker struct {
+	Timestamp int64 `json:"timestamp"`
+	// version of node the dependencies were installed with, e.g. v20.11.1
+	NodeVersion string `json:"node_version"`
+	// npm, pnpm or vendored
+	Installer string `json:"installer"`
+}
+
+func (p *LocalPluginRuntime) InitNodeJSEnvironment() error {
+	nodeVersion, err := p.nodeVersion()
+	if err != nil {
+		return fmt.Errorf("failed to find node: %s", err)
+	}
+
+	if !nodeVersionSatisfied(p.Config.Meta.Runner.Version, nodeVersion) {
+		return fmt.Errorf(
+			"node %s required by the plugin is not available, got node %s",
+			p.Config.Meta.Runner.Version, nodeVersion,
+		)
+	}
+
+	nodeModulesPath := path.Join(p.State.WorkingPath, NODE_MODULES_DIR)
+
+	if p.vendoredNodeModules() {
+		// the package carries its dependencies, nothing needs to be installed
+		if marker, err := readNodeModulesMarker(p.State.WorkingPath); err == nil {
+			if nodeMajorVersion(marker.NodeVersion) != nodeMajorVersion(nodeVersion) {
+				log.Warn(
+					"vendored node_modules of %s were used with node %s, got node %s, native addons may not work",
+					p.Config.Identity(), marker.NodeVersion, nodeVersion,
+				)
+			}
+			return nil
+		}
+
+		log.Info("using the vendored node_modules of %s", p.Config.Identity())
+		return writeNodeModulesMarker(p.State.WorkingPath, &nodeModulesMarker{
+			Timestamp:   time.Now().Unix(),
+			NodeVersion: nodeVersion,
+			Installer:   NODE_INSTALLER_VENDORED,
+		})
+	}
+
+	if _, err := os.Stat(nodeModulesPath); err == nil {
+		marker, err := readNodeModulesMarker(p.State.WorkingPath)
+		if err == nil && nodeMajorVersion(marker.NodeVersion) == nodeMajorVersion(nodeVersion) {
+			return nil
+		}
+
+		if err == nil {
+			// native addons are built against the ABI of a major version
+			log.Info(
+				"node version of %s changed from %s to %s, reinstalling dependencies",
+				p.Config.Identity(), marker.NodeVersion, nodeVersion,
+			)
+		}
+		os.RemoveAll(nodeModulesPath)
+	}
+
+	installer, args, err := p.nodeInstallCommand()
+	if err != nil {
+		return err
+	}
+
+	success := false
+	defer func() {
+		if !success {
+			os.RemoveAll(nodeModulesPath)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(p.nodeEnvInitTimeout)*time.Second)
+	defer cancel()
+
+	executable := p.npmPath
+	if installer == NODE_INSTALLER_PNPM {
+		executable = p.pnpmPath
+	}
+
+	cmd := exec.CommandContext(ctx, executable, args...)
+	cmd.Dir = p.State.WorkingPath
+	cmd.Env = p.nodeInstallEnv()
+	output := bytes.NewBuffer(nil)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	log.Info("installing %s - %s %s", p.Config.Identity(), installer, strings.Join(args, " "))
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf(
+				"failed to install dependencies, not finished in %d seconds, output: %s",
+				p.nodeEnvInitTimeout, output.String(),
+			)
+		}
+		return fmt.Errorf("failed to install dependencies: %s, output: %s", err, output.String())
+	}
+
+	if err := writeNodeModulesMarker(p.State.WorkingPath, &nodeModulesMarker{
+		Timestamp:   time.Now().Unix(),
+		NodeVersion: nodeVersion,
+		Installer:   installer,
+	}); err != nil {
+		return fmt.Errorf("failed to write the node_modules marker: %s", err)
+	}
+
+	success = true
+
+	log.Info("installed dependencies of %s", p.Config.Identity())
+
+	return nil
+}
+
+// nodeInstallCommand picks the package manager by the lockfile shipped with the plugin,
+// a lockfile is required to make sure the installed dependencies are the tested ones
+func (p *LocalPluginRuntime) nodeInstallCommand() (string, []string, error) {
+	if _, err := os.Stat(path.Join(p.State.WorkingPath, "pnpm-lock.yaml")); err == nil {
+		return NODE_INSTALLER_PNPM, []string{"install", "--frozen-lockfile", "--prod"}, nil
+	}
+
+	for _, lockfile := range []string{"package-lock.json", "npm-shrinkwrap.json"} {
+		if _, err := os.Stat(path.Join(p.State.WorkingPath, lockfile)); err == nil {
+			return NODE_INSTALLER_NPM, []string{"ci", "--omit=dev", "--no-audit", "--no-fund"}, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("failed to find a lockfile, package-lock.json or pnpm-lock.yaml is required")
+}
+
+func (p *LocalPluginRuntime) nodeInstallEnv() []string {
+	env := []string{"PATH=" + os.Getenv("PATH"), "HOME=" + os.Getenv("HOME")}
+	if p.npmRegistryUrl != "" {
+		// respected by both npm and pnpm
+		env = append(env, fmt.Sprintf("npm_config_registry=%s", p.npmRegistryUrl))
+	}
+	if p.HttpProxy != "" {
+		env = append(env, fmt.Sprintf("HTTP_PROXY=%s", p.HttpProxy))
+	}
+	if p.HttpsProxy != "" {
+		env = append(env, fmt.Sprintf("HTTPS_PROXY=%s", p.HttpsProxy))
+	}
+	if p.NoProxy != "" {
+		env = append(env, fmt.Sprintf("NO_PROXY=%s", p.NoProxy))
+	}
+	return env
+}
+
+// vendoredNodeModules checks whether node_modules is shipped within the plugin package
+func (p *LocalPluginRuntime) vendoredNodeModules() bool {
+	if p.Decoder == nil {
+		return false
+	}
+
+	info, err := p.Decoder.Stat(NODE_MODULES_DIR)
+	return err == nil && info.IsDir()
+}
+
+func (p *LocalPluginRuntime) nodeVersion() (string, error) {
+	cmd := exec.Command(p.nodeExecutablePath, "--version")
+	cmd.Dir = p.State.WorkingPath
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// nodeVersionSatisfied checks whether the node version, e.g. v20.11.1, matches the
+// version declared in the manifest, e.g. 20 or 20.11
+func nodeVersionSatisfied(required string, actual string) bool {
+	required = strings.TrimPrefix(strings.TrimSpace(required), "v")
+	actual = strings.TrimPrefix(actual, "v")
+	return actual == required || strings.HasPrefix(actual, required+".")
+}
+
+func nodeMajorVersion(version string) string {
+	major, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), ".")
+	return major
+}
+
+func readNodeModulesMarker(workingPath string) (*nodeModulesMarker, error) {
+	data, err := os.ReadFile(path.Join(workingPath, NODE_MODULES_MARKER_PATH))
+	if err != nil {
+		return nil, err
+	}
+
+	marker := &nodeModulesMarker{}
+	if err := json.Unmarshal(data, marker); err != nil {
+		return nil, err
+	}
+
+	return marker, nil
+}
+
+func writeNodeModulesMarker(workingPath string, marker *nodeModulesMarker) error {
+	markerPath := path.Join(workingPath, NODE_MODULES_MARKER_PATH)
+	if err := os.MkdirAll(path.Dir(markerPath), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(markerPath, data, 0644)
+}
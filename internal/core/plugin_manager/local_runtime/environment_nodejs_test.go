@@ -0,0 +1,56 @@
+package local_runtime
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeInstallCommand(t *testing.T) {
+	runtime := NewLocalPluginRuntime(LocalPluginRuntimeConfig{})
+	runtime.State.WorkingPath = t.TempDir()
+
+	_, _, err := runtime.nodeInstallCommand()
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(path.Join(runtime.State.WorkingPath, "package-lock.json"), []byte("{}"), 0644))
+	installer, args, err := runtime.nodeInstallCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, NODE_INSTALLER_NPM, installer)
+	assert.Equal(t, "ci", args[0])
+
+	// pnpm is preferred if the plugin ships its lockfile
+	assert.NoError(t, os.WriteFile(path.Join(runtime.State.WorkingPath, "pnpm-lock.yaml"), []byte(""), 0644))
+	installer, args, err = runtime.nodeInstallCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, NODE_INSTALLER_PNPM, installer)
+	assert.Contains(t, args, "--frozen-lockfile")
+}
+
+func TestNodeVersionSatisfied(t *testing.T) {
+	assert.True(t, nodeVersionSatisfied("20", "v20.11.1"))
+	assert.True(t, nodeVersionSatisfied("20.11", "v20.11.1"))
+	assert.True(t, nodeVersionSatisfied("v20", "v20.11.1"))
+	assert.False(t, nodeVersionSatisfied("2", "v20.11.1"))
+	assert.False(t, nodeVersionSatisfied("18", "v20.11.1"))
+	assert.Equal(t, "20", nodeMajorVersion("v20.11.1"))
+}
+
+func TestNodeModulesMarker(t *testing.T) {
+	workingPath := t.TempDir()
+
+	_, err := readNodeModulesMarker(workingPath)
+	assert.Error(t, err)
+
+	assert.NoError(t, writeNodeModulesMarker(workingPath, &nodeModulesMarker{
+		NodeVersion: "v20.11.1",
+		Installer:   NODE_INSTALLER_VENDORED,
+	}))
+
+	marker, err := readNodeModulesMarker(workingPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "v20.11.1", marker.NodeVersion)
+	assert.Equal(t, NODE_INSTALLER_VENDORED, marker.Installer)
+}
@@ -3,14 +3,12 @@ package local_runtime
 import (
 	"bytes"
 	"context"
-	_ "embed"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,24 +16,28 @@ import (
 	version "github.com/hashicorp/go-version"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/consts"
 )
 
-//go:embed patches/0.0.1b70.ai_model.py.patch
-var python001b70aiModelsPatches []byte
-
-//go:embed patches/0.1.1.llm.py.patch
-var python011llmPatches []byte
-
-//go:embed patches/0.1.1.request_reader.py.patch
-var python011requestReaderPatches []byte
-
 func (p *LocalPluginRuntime) InitPythonEnvironment() error {
+	pythonVersion, err := p.requiredPythonVersion()
+	if err != nil {
+		return err
+	}
+
 	// check if virtual environment exists
 	if _, err := os.Stat(path.Join(p.State.WorkingPath, ".venv")); err == nil {
 		// check if venv is valid, try to find .venv/dify/plugin.json
-		if _, err := os.Stat(path.Join(p.State.WorkingPath, ".venv/dify/plugin.json")); err != nil {
+		if marker, err := readVenvMarker(p.State.WorkingPath); err != nil {
 			// remove the venv and rebuild it
 			os.RemoveAll(path.Join(p.State.WorkingPath, ".venv"))
+		} else if !venvMatchesPythonVersion(marker, pythonVersion) {
+			// the required python version changed, rebuild the venv
+			log.Info(
+				"python version of %s changed from %s to %s, rebuilding the virtual environment",
+				p.Config.Identity(), marker.PythonVersion, pythonVersion,
+			)
+			os.RemoveAll(path.Join(p.State.WorkingPath, ".venv"))
 		} else {
 			// setup python interpreter path
 			pythonPath, err := filepath.Abs(path.Join(p.State.WorkingPath, ".venv/bin/python"))
@@ -44,12 +46,18 @@ func (p *LocalPluginRuntime) InitPythonEnvironment() error {
 			}
 			p.pythonInterpreterPath = pythonPath
 			// PATCH:
-			//  plugin sdk version less than 0.0.1b70 contains a memory leak bug
-			//  to reach a better user experience, we will patch it here using a patched file
-			// https://github.com/langgenius/dify-plugin-sdks/commit/161045b65f708d8ef0837da24440ab3872821b3b
-			if err := p.patchPluginSdk(path.Join(p.State.WorkingPath, "requirements.txt")); err != nil {
+			//  legacy plugin sdk versions contain bugs, e.g. the memory leak of versions less than 0.0.1b70
+			//  patches of the registry are applied idempotently, newly added ones are applied to existing venvs as well
+			patches, err := p.patchPluginSdk(path.Join(p.State.WorkingPath, "requirements.txt"))
+			if err != nil {
 				log.Error("failed to patch the plugin sdk: %s", err)
 			}
+			if !sameVenvMarkerPatches(marker.Patches, patches) {
+				marker.Patches = patches
+				if err := writeVenvMarker(p.State.WorkingPath, marker); err != nil {
+					log.Error("failed to write the virtual environment marker: %s", err)
+				}
+			}
 			return nil
 		}
 	}
@@ -71,13 +79,24 @@ func (p *LocalPluginRuntime) InitPythonEnvironment() error {
 		uvPath = strings.TrimSpace(string(output))
 	}
 
-	cmd := exec.Command(uvPath, "venv", ".venv", "--python", "3.12")
+	marker := &venvMarker{PythonVersion: pythonVersion}
+
+	venvArgs, err := p.uvVenvArgs(pythonVersion)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(uvPath, venvArgs...)
 	cmd.Dir = p.State.WorkingPath
 	b := bytes.NewBuffer(nil)
 	cmd.Stdout = b
 	cmd.Stderr = b
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create virtual environment: %s, output: %s", err, b.String())
+		os.RemoveAll(path.Join(p.State.WorkingPath, ".venv"))
+		return fmt.Errorf(
+			"failed to create virtual environment, python %s required by the plugin is not available: %s, output: %s",
+			pythonVersion, err, b.String(),
+		)
 	}
 	defer func() {
 		// if init failed, remove the .venv directory
@@ -85,9 +104,10 @@ func (p *LocalPluginRuntime) InitPythonEnvironment() error {
 			os.RemoveAll(path.Join(p.State.WorkingPath, ".venv"))
 		} else {
 			// create dify/plugin.json
-			pluginJsonPath := path.Join(p.State.WorkingPath, ".venv/dify/plugin.json")
-			os.MkdirAll(path.Dir(pluginJsonPath), 0755)
-			os.WriteFile(pluginJsonPath, []byte(`{"timestamp":`+strconv.FormatInt(time.Now().Unix(), 10)+`}`), 0644)
+			marker.Timestamp = time.Now().Unix()
+			if err := writeVenvMarker(p.State.WorkingPath, marker); err != nil {
+				log.Error("failed to write the virtual environment marker: %s", err)
+			}
 		}
 	}()
 
@@ -100,6 +120,19 @@ func (p *LocalPluginRuntime) InitPythonEnvironment() error {
 		return fmt.Errorf("failed to find python: %s", err)
 	}
 
+	// make sure the interpreter uv picked is the one the plugin asked for
+	actualVersion, err := interpreterVersion(pythonPath, p.State.WorkingPath)
+	if err != nil {
+		return fmt.Errorf("failed to get the version of python: %s", err)
+	}
+	if !pythonVersionSatisfied(pythonVersion, actualVersion) {
+		return fmt.Errorf(
+			"python %s required by the plugin is not available, got python %s",
+			pythonVersion, actualVersion,
+		)
+	}
+	marker.PythonInterpreter = actualVersion
+
 	p.pythonInterpreterPath = pythonPath
 
 	// try find requirements.txt
@@ -112,27 +145,17 @@ func (p *LocalPluginRuntime) InitPythonEnvironment() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	args := []string{"install"}
-
-	if p.pipMirrorUrl != "" {
-		args = append(args, "-i", p.pipMirrorUrl)
-	}
-
-	args = append(args, "-r", "requirements.txt")
-
-	if p.pipVerbose {
-		args = append(args, "-vvv")
-	}
-
-	if p.pipExtraArgs != "" {
-		args = append(args, strings.Split(p.pipExtraArgs, " ")...)
+	args, err := p.pipInstallArgs()
+	if err != nil {
+		return err
 	}
 
-	args = append([]string{"pip"}, args...)
-
 	virtualEnvPath := path.Join(p.State.WorkingPath, ".venv")
 	cmd = exec.CommandContext(ctx, uvPath, args...)
 	cmd.Env = append(cmd.Env, "VIRTUAL_ENV="+virtualEnvPath, "PATH="+os.Getenv("PATH"))
+	if p.dependencyCache != nil {
+		cmd.Env = append(cmd.Env, p.dependencyCache.Env()...)
+	}
 	if p.HttpProxy != "" {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("HTTP_PROXY=%s", p.HttpProxy))
 	}
@@ -339,93 +362,145 @@ func (p *LocalPluginRuntime) InitPythonEnvironment() error {
 	importCmd.Output()
 
 	// PATCH:
-	//  plugin sdk version less than 0.0.1b70 contains a memory leak bug
-	//  to reach a better user experience, we will patch it here using a patched file
-	// https://github.com/langgenius/dify-plugin-sdks/commit/161045b65f708d8ef0837da24440ab3872821b3b
-	if err := p.patchPluginSdk(requirementsPath); err != nil {
+	//  legacy plugin sdk versions contain bugs, e.g. the memory leak of versions less than 0.0.1b70
+	//  to reach a better user experience, we will patch them here using the patch registry
+	patches, err := p.patchPluginSdk(requirementsPath)
+	if err != nil {
 		log.Error("failed to patch the plugin sdk: %s", err)
 	}
+	marker.Patches = patches
 
 	success = true
 
 	return nil
 }
 
-func (p *LocalPluginRuntime) patchPluginSdk(requirementsPath string) error {
+func (p *LocalPluginRuntime) uvVenvArgs(pythonVersion string) ([]string, error) {
+	args := []string{"venv", ".venv", "--python", p.pythonRequest(pythonVersion)}
+
+	wheelhouse, err := p.wheelhousePath()
+	if err != nil {
+		return nil, err
+	}
+
+	if wheelhouse != "" {
+		// installing offline, the interpreter must not be downloaded either
+		args = append(args, "--no-python-downloads")
+	}
+
+	return args, nil
+}
+
+func (p *LocalPluginRuntime) pipInstallArgs() ([]string, error) {
+	args := []string{"install"}
+
+	wheelhouse, err := p.wheelhousePath()
+	if err != nil {
+		return nil, err
+	}
+
+	if wheelhouse != "" {
+		// the package carries its dependencies, install them without accessing any index
+		log.Info("installing %s from the vendored wheelhouse", p.Config.Identity())
+		args = append(args, "--no-index", "--find-links", wheelhouse)
+	} else if p.pipMirrorUrl != "" {
+		args = append(args, "-i", p.pipMirrorUrl)
+	}
+
+	args = append(args, "-r", "requirements.txt")
+
+	if p.pipVerbose {
+		args = append(args, "-vvv")
+	}
+
+	if p.pipExtraArgs != "" {
+		args = append(args, strings.Split(p.pipExtraArgs, " ")...)
+	}
+
+	return append([]string{"pip"}, args...), nil
+}
+
+// wheelhousePath returns the absolute path of the vendored wheelhouse, empty if the package has none
+func (p *LocalPluginRuntime) wheelhousePath() (string, error) {
+	wheelhouse := path.Join(p.State.WorkingPath, consts.WHEELHOUSE_DIR)
+	entries, err := os.ReadDir(wheelhouse)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read the wheelhouse: %s", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".whl") {
+			return filepath.Abs(wheelhouse)
+		}
+	}
+
+	return "", nil
+}
+
+// patchPluginSdk applies the patches of the registry matching the sdk version
+// declared in requirements.txt, returns all the patches in effect
+func (p *LocalPluginRuntime) patchPluginSdk(requirementsPath string) ([]venvMarkerPatch, error) {
 	// get the version of the plugin sdk
 	requirements, err := os.ReadFile(requirementsPath)
 	if err != nil {
-		return fmt.Errorf("failed to read requirements.txt: %s", err)
+		return nil, fmt.Errorf("failed to read requirements.txt: %s", err)
 	}
 
 	pluginSdkVersion, err := p.getPluginSdkVersion(string(requirements))
 	if err != nil {
 		log.Error("failed to get the version of the plugin sdk: %s", err)
-		return nil
+		return nil, nil
 	}
 
-	pluginSdkVersionObj, err := version.NewVersion(pluginSdkVersion)
+	patches, err := p.sdkPatchRegistry().Match(pluginSdkVersion)
 	if err != nil {
 		log.Error("failed to create the version: %s", err)
-		return nil
+		return nil, nil
 	}
 
-	if pluginSdkVersionObj.LessThan(version.Must(version.NewVersion("0.0.1b70"))) {
-		// get dify-plugin path
-		command := exec.Command(p.pythonInterpreterPath, "-c", "import importlib.util;print(importlib.util.find_spec('dify_plugin').origin)")
-		command.Dir = p.State.WorkingPath
-		output, err := command.Output()
-		if err != nil {
-			return fmt.Errorf("failed to get the path of the plugin sdk: %s", err)
-		}
-
-		pluginSdkPath := path.Dir(strings.TrimSpace(string(output)))
-		patchPath := path.Join(pluginSdkPath, "interfaces/model/ai_model.py")
-
-		// apply the patch
-		if _, err := os.Stat(patchPath); err != nil {
-			return fmt.Errorf("failed to find the patch file: %s", err)
-		}
+	if len(patches) == 0 {
+		return nil, nil
+	}
 
-		if err := os.WriteFile(patchPath, python001b70aiModelsPatches, 0644); err != nil {
-			return fmt.Errorf("failed to write the patch file: %s", err)
-		}
+	// get dify-plugin path
+	command := exec.Command(p.pythonInterpreterPath, "-c", "import importlib.util;print(importlib.util.find_spec('dify_plugin').origin)")
+	command.Dir = p.State.WorkingPath
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the path of the plugin sdk: %s", err)
 	}
+	pluginSdkPath := path.Dir(strings.TrimSpace(string(output)))
 
-	if pluginSdkVersionObj.LessThan(version.Must(version.NewVersion("0.1.1"))) {
-		// get dify-plugin path
-		command := exec.Command(p.pythonInterpreterPath, "-c", "import importlib.util;print(importlib.util.find_spec('dify_plugin').origin)")
-		command.Dir = p.State.WorkingPath
-		output, err := command.Output()
+	applied := []venvMarkerPatch{}
+	for _, patch := range patches {
+		written, err := patch.apply(pluginSdkPath)
 		if err != nil {
-			return fmt.Errorf("failed to get the path of the plugin sdk: %s", err)
+			return applied, err
 		}
-
-		pluginSdkPath := path.Dir(strings.TrimSpace(string(output)))
-		patchPath := path.Join(pluginSdkPath, "entities/model/llm.py")
-
-		// apply the patch
-		if _, err := os.Stat(patchPath); err != nil {
-			return fmt.Errorf("failed to find the patch file: %s", err)
-		}
-
-		if err := os.WriteFile(patchPath, python011llmPatches, 0644); err != nil {
-			return fmt.Errorf("failed to write the patch file: %s", err)
+		if written {
+			log.Info("applied sdk patch %s to %s", patch.Name, p.Config.Identity())
 		}
+		applied = append(applied, venvMarkerPatch{Name: patch.Name, Sha256: patch.Sha256})
+	}
 
-		patchPath = path.Join(pluginSdkPath, "core/server/stdio/request_reader.py")
-		if _, err := os.Stat(patchPath); err != nil {
-			return fmt.Errorf("failed to find the patch file: %s", err)
-		}
+	return applied, nil
+}
 
-		if err := os.WriteFile(patchPath, python011requestReaderPatches, 0644); err != nil {
-			return fmt.Errorf("failed to write the patch file: %s", err)
-		}
+func (p *LocalPluginRuntime) sdkPatchRegistry() *SdkPatchRegistry {
+	if p.sdkPatches != nil {
+		return p.sdkPatches
 	}
-	return nil
+	return DefaultSdkPatchRegistry()
 }
 
 func (p *LocalPluginRuntime) getPluginSdkVersion(requirements string) (string, error) {
+	return pluginSdkVersion(requirements)
+}
+
+func pluginSdkVersion(requirements string) (string, error) {
 	// using regex to find the version of the plugin sdk
 	// First try to match exact version or compatible version
 	re := regexp.MustCompile(`(?:dify[_-]plugin)(?:~=|==)([0-9.a-z]+)`)
@@ -0,0 +1,65 @@
+package local_runtime
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+const (
+	// venvs created before the python version was configurable always used 3.12
+	LEGACY_PYTHON_VERSION = "3.12"
+)
+
+var pythonVersionPattern = regexp.MustCompile(`^3\.\d+(\.\d+)?$`)
+
+// requiredPythonVersion returns the python version declared by the plugin manifest
+func (p *LocalPluginRuntime) requiredPythonVersion() (string, error) {
+	version := strings.TrimSpace(p.Config.Meta.Runner.Version)
+	if version == "" {
+		version = p.defaultPythonVersion
+	}
+	if version == "" {
+		version = LEGACY_PYTHON_VERSION
+	}
+
+	if !pythonVersionPattern.MatchString(version) {
+		return "", fmt.Errorf("invalid python version %q declared in the plugin manifest", version)
+	}
+
+	return version, nil
+}
+
+// pythonRequest returns the value passed to `uv venv --python`
+// interpreters configured by the operator take precedence over uv managed interpreters
+func (p *LocalPluginRuntime) pythonRequest(version string) string {
+	if interpreter, ok := p.pythonInterpreters[version]; ok && interpreter != "" {
+		return interpreter
+	}
+	return version
+}
+
+// pythonVersionSatisfied checks whether the full version of an interpreter, e.g. 3.12.7, satisfies the required one
+func pythonVersionSatisfied(required string, actual string) bool {
+	return actual == required || strings.HasPrefix(actual, required+".")
+}
+
+// venvMatchesPythonVersion checks whether an existing venv was built for the required python version
+func venvMatchesPythonVersion(marker *venvMarker, required string) bool {
+	version := marker.PythonVersion
+	if version == "" {
+		version = LEGACY_PYTHON_VERSION
+	}
+	return version == required
+}
+
+func interpreterVersion(pythonPath string, workingPath string) (string, error) {
+	cmd := exec.Command(pythonPath, "-c", "import platform;print(platform.python_version())")
+	cmd.Dir = workingPath
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
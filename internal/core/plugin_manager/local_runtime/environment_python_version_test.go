@@ -0,0 +1,72 @@
+package local_runtime
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequiredPythonVersion(t *testing.T) {
+	runtime := NewLocalPluginRuntime(LocalPluginRuntimeConfig{
+		DefaultPythonVersion: "3.12",
+		PythonInterpreters: map[string]string{
+			"3.11": "/usr/bin/python3.11",
+		},
+	})
+
+	runtime.Config.Meta.Runner.Version = "3.11"
+	version, err := runtime.requiredPythonVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "3.11", version)
+	assert.Equal(t, "/usr/bin/python3.11", runtime.pythonRequest(version))
+
+	// versions without a configured interpreter are resolved by uv
+	runtime.Config.Meta.Runner.Version = "3.13"
+	version, err = runtime.requiredPythonVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "3.13", runtime.pythonRequest(version))
+
+	runtime.Config.Meta.Runner.Version = ""
+	version, err = runtime.requiredPythonVersion()
+	assert.NoError(t, err)
+	assert.Equal(t, "3.12", version)
+
+	runtime.Config.Meta.Runner.Version = "3.12; rm -rf /"
+	_, err = runtime.requiredPythonVersion()
+	assert.Error(t, err)
+}
+
+func TestPythonVersionSatisfied(t *testing.T) {
+	assert.True(t, pythonVersionSatisfied("3.12", "3.12.7"))
+	assert.True(t, pythonVersionSatisfied("3.12.7", "3.12.7"))
+	assert.False(t, pythonVersionSatisfied("3.1", "3.12.7"))
+	assert.False(t, pythonVersionSatisfied("3.11", "3.12.7"))
+}
+
+func TestVenvMarker(t *testing.T) {
+	workingPath := t.TempDir()
+
+	_, err := readVenvMarker(workingPath)
+	assert.Error(t, err)
+
+	// markers written before the python version was recorded were built with 3.12
+	assert.NoError(t, os.MkdirAll(path.Join(workingPath, ".venv/dify"), 0755))
+	assert.NoError(t, os.WriteFile(path.Join(workingPath, VENV_MARKER_PATH), []byte(`{"timestamp":1}`), 0644))
+	marker, err := readVenvMarker(workingPath)
+	assert.NoError(t, err)
+	assert.True(t, venvMatchesPythonVersion(marker, "3.12"))
+	assert.False(t, venvMatchesPythonVersion(marker, "3.11"))
+
+	assert.NoError(t, writeVenvMarker(workingPath, &venvMarker{
+		Timestamp:         2,
+		PythonVersion:     "3.11",
+		PythonInterpreter: "3.11.9",
+	}))
+	marker, err = readVenvMarker(workingPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "3.11.9", marker.PythonInterpreter)
+	assert.True(t, venvMatchesPythonVersion(marker, "3.11"))
+	assert.False(t, venvMatchesPythonVersion(marker, "3.12"))
+}
@@ -0,0 +1,48 @@
+package local_runtime
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipInstallArgsWithWheelhouse(t *testing.T) {
+	runtime := NewLocalPluginRuntime(LocalPluginRuntimeConfig{
+		PipMirrorUrl: "https://mirror.example.com/simple",
+	})
+	runtime.State.WorkingPath = t.TempDir()
+
+	args, err := runtime.pipInstallArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pip", "install", "-i", "https://mirror.example.com/simple", "-r", "requirements.txt"}, args)
+
+	// an empty wheelhouse is ignored
+	wheelhouse := path.Join(runtime.State.WorkingPath, "wheels")
+	assert.NoError(t, os.MkdirAll(wheelhouse, 0755))
+	args, err = runtime.pipInstallArgs()
+	assert.NoError(t, err)
+	assert.Contains(t, args, "-i")
+
+	assert.NoError(t, os.WriteFile(path.Join(wheelhouse, "requests-2.32.3-py3-none-any.whl"), []byte("wheel"), 0644))
+	args, err = runtime.pipInstallArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pip", "install", "--no-index", "--find-links", wheelhouse, "-r", "requirements.txt"}, args)
+}
+
+func TestUvVenvArgsWithWheelhouse(t *testing.T) {
+	runtime := NewLocalPluginRuntime(LocalPluginRuntimeConfig{})
+	runtime.State.WorkingPath = t.TempDir()
+
+	args, err := runtime.uvVenvArgs("3.12")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"venv", ".venv", "--python", "3.12"}, args)
+
+	wheelhouse := path.Join(runtime.State.WorkingPath, "wheels")
+	assert.NoError(t, os.MkdirAll(wheelhouse, 0755))
+	assert.NoError(t, os.WriteFile(path.Join(wheelhouse, "requests-2.32.3-py3-none-any.whl"), []byte("wheel"), 0644))
+	args, err = runtime.uvVenvArgs("3.12")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"venv", ".venv", "--python", "3.12", "--no-python-downloads"}, args)
+}
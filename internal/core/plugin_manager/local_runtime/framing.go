@@ -0,0 +1,257 @@
+package local_runtime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+// Length-prefixed framing of the stdio protocol
+//
+// newline-delimited JSON caps each message with PLUGIN_STDIO_MAX_BUFFER_SIZE and forces
+// binary outputs to be encoded inside JSON, frames carry their length and may contain raw bytes.
+// the daemon advertises framing with the STDIO_FRAMING_ENV environment variable, runners which
+// support it answer with a protocol event `{"event":"protocol","data":{"framing":"length_prefixed"}}`.
+// frames are distinguished from JSON lines by the magic number, so a reader accepts both at any time.
+//
+// All integers are stored in little endian format
+//
+//	| Field         | Size     | Description                     |
+//	|---------------|----------|---------------------------------|
+//	| Magic Number  | 1 byte   | 0x1f                            |
+//	| Frame Type    | 1 byte   | FRAME_TYPE_JSON or _BINARY      |
+//	| Reserved      | 2 bytes  | Reserved field                  |
+//	| Data Length   | 4 bytes  | Length of the data              |
+//	| Data          | Variable | Actual data content             |
+//
+// the data of a binary frame is a session message whose binary field is sent as raw bytes
+//
+//	| Field              | Size     | Description                                      |
+//	|--------------------|----------|--------------------------------------------------|
+//	| Session ID Length  | 2 bytes  | Length of the session id                         |
+//	| Session ID         | Variable | Session id                                       |
+//	| Meta Length        | 4 bytes  | Length of the meta                               |
+//	| Meta               | Variable | JSON of BinaryFrameMeta                          |
+//	| Raw                | Variable | Raw bytes, placed at BinaryPath of the message   |
+
+type FrameType byte
+
+const (
+	FRAME_MAGIC       byte = 0x1f
+	FRAME_HEADER_SIZE      = 8
+
+	FRAME_TYPE_JSON   FrameType = 0x01
+	FRAME_TYPE_BINARY FrameType = 0x02
+
+	STDIO_FRAMING_LENGTH_PREFIXED = "length_prefixed"
+	STDIO_FRAMING_ENV             = "DIFY_PLUGIN_STDIO_FRAMING"
+)
+
+var (
+	ErrLineTooLong  = errors.New("stdio line is too long")
+	ErrFrameTooLong = errors.New("stdio frame is too long")
+)
+
+// BinaryFrameMeta is the session message of a binary frame without its raw bytes
+type BinaryFrameMeta struct {
+	Type       string          `json:"type"`
+	Data       json.RawMessage `json:"data"`
+	BinaryPath []string        `json:"binary_path"`
+}
+
+func EncodeFrame(frameType FrameType, data []byte) []byte {
+	frame := make([]byte, FRAME_HEADER_SIZE+len(data))
+	frame[0] = FRAME_MAGIC
+	frame[1] = byte(frameType)
+	binary.LittleEndian.PutUint32(frame[4:8], uint32(len(data)))
+	copy(frame[FRAME_HEADER_SIZE:], data)
+	return frame
+}
+
+func EncodeBinaryFrame(sessionID string, meta BinaryFrameMeta, raw []byte) ([]byte, error) {
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, 2+len(sessionID)+4+len(metaBytes)+len(raw))
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(sessionID)))
+	data = append(data, sessionID...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(metaBytes)))
+	data = append(data, metaBytes...)
+	data = append(data, raw...)
+	return EncodeFrame(FRAME_TYPE_BINARY, data), nil
+}
+
+// DecodeBinaryFrame returns the session id and the session message of a binary frame
+// the raw bytes are placed at the binary path, encoded the same way as []byte in JSON
+// as listeners decode session messages from JSON, the rest of the data is passed through untouched
+//
+// TODO: the raw bytes are encoded again here, so frames only lift the size limit of lines,
+// the encoding overhead goes away once listeners accept raw bytes next to the message
+func DecodeBinaryFrame(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", nil, errors.New("binary frame is too short")
+	}
+	sessionIDLength := int(binary.LittleEndian.Uint16(data[:2]))
+	data = data[2:]
+	if len(data) < sessionIDLength+4 {
+		return "", nil, errors.New("binary frame is too short")
+	}
+	sessionID := string(data[:sessionIDLength])
+	data = data[sessionIDLength:]
+
+	metaLength := int(binary.LittleEndian.Uint32(data[:4]))
+	data = data[4:]
+	if len(data) < metaLength {
+		return "", nil, errors.New("binary frame is too short")
+	}
+
+	var meta BinaryFrameMeta
+	if err := json.Unmarshal(data[:metaLength], &meta); err != nil {
+		return "", nil, errors.Join(err, fmt.Errorf("failed to parse binary frame meta"))
+	}
+	raw := data[metaLength:]
+
+	messageData, err := spliceBinary(meta.Data, meta.BinaryPath, raw)
+	if err != nil {
+		return "", nil, errors.Join(err, fmt.Errorf("failed to parse binary frame data"))
+	}
+
+	message, err := json.Marshal(plugin_entities.SessionMessage{
+		Type: plugin_entities.SESSION_MESSAGE_TYPE(meta.Type),
+		Data: messageData,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sessionID, message, nil
+}
+
+// spliceBinary places the raw bytes at the path of the JSON object, only the objects along
+// the path are decoded so other values like large integers are kept verbatim
+func spliceBinary(data json.RawMessage, path []string, raw []byte) (json.RawMessage, error) {
+	if len(path) == 0 {
+		encoded := make([]byte, base64.StdEncoding.EncodedLen(len(raw))+2)
+		encoded[0] = '"'
+		base64.StdEncoding.Encode(encoded[1:], raw)
+		encoded[len(encoded)-1] = '"'
+		return encoded, nil
+	}
+
+	object := map[string]json.RawMessage{}
+	if len(data) > 0 && !bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, err
+		}
+	}
+
+	child, err := spliceBinary(object[path[0]], path[1:], raw)
+	if err != nil {
+		return nil, err
+	}
+	object[path[0]] = child
+
+	return json.Marshal(object)
+}
+
+// ReadStdioMessages reads newline-delimited JSON and frames from the reader until EOF
+// JSON lines and JSON frames are passed to onEvent, binary frames are passed to onBinary
+func ReadStdioMessages(
+	reader io.Reader,
+	bufferSize int,
+	maxLineSize int,
+	maxFrameSize int,
+	onEvent func(data []byte),
+	onBinary func(data []byte),
+) error {
+	r := bufio.NewReaderSize(reader, bufferSize)
+
+	for {
+		head, err := r.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if head[0] != FRAME_MAGIC {
+			line, err := readLine(r, maxLineSize)
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+			if len(line) > 0 {
+				onEvent(line)
+			}
+			continue
+		}
+
+		frameType, data, err := readFrame(r, maxFrameSize)
+		if err != nil {
+			return err
+		}
+
+		switch frameType {
+		case FRAME_TYPE_JSON:
+			onEvent(data)
+		case FRAME_TYPE_BINARY:
+			onBinary(data)
+		default:
+			return fmt.Errorf("unknown stdio frame type: %d", frameType)
+		}
+	}
+}
+
+func readLine(r *bufio.Reader, maxLineSize int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if !isPrefix && line == nil {
+			// the whole line fits into the buffer, the chunk is only valid until the next read
+			return append([]byte(nil), chunk...), nil
+		}
+
+		line = append(line, chunk...)
+		if len(line) > maxLineSize {
+			return nil, ErrLineTooLong
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+func readFrame(r *bufio.Reader, maxFrameSize int) (FrameType, []byte, error) {
+	header := make([]byte, FRAME_HEADER_SIZE)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, errors.Join(err, fmt.Errorf("failed to read frame header"))
+	}
+
+	length := binary.LittleEndian.Uint32(header[4:8])
+	if int64(length) > int64(maxFrameSize) {
+		return 0, nil, ErrFrameTooLong
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, errors.Join(err, fmt.Errorf("failed to read frame data"))
+	}
+
+	return FrameType(header[1]), data, nil
+}
@@ -0,0 +1,131 @@
+package local_runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadStdioMessagesMixed(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString(`{"event":"heartbeat"}` + "\n")
+	buf.Write(EncodeFrame(FRAME_TYPE_JSON, []byte(`{"event":"log"}`)))
+	buf.WriteString("\n" + `{"event":"session"}` + "\n")
+
+	binaryFrame, err := EncodeBinaryFrame("session-id", BinaryFrameMeta{
+		Type:       "stream",
+		Data:       json.RawMessage(`{"type":"blob_chunk","message":{"id":"1"}}`),
+		BinaryPath: []string{"message", "blob"},
+	}, []byte{0x00, 0x1f, 0xff})
+	assert.NoError(t, err)
+	buf.Write(binaryFrame)
+
+	events := []string{}
+	binaries := [][]byte{}
+	err = ReadStdioMessages(buf, 16, 1024, 1024, func(data []byte) {
+		events = append(events, string(data))
+	}, func(data []byte) {
+		binaries = append(binaries, data)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"event":"heartbeat"}`, `{"event":"log"}`, `{"event":"session"}`}, events)
+
+	if assert.Len(t, binaries, 1) {
+		sessionID, message, err := DecodeBinaryFrame(binaries[0])
+		assert.NoError(t, err)
+		assert.Equal(t, "session-id", sessionID)
+
+		var decoded struct {
+			Type string `json:"type"`
+			Data struct {
+				Type    string `json:"type"`
+				Message struct {
+					ID   string `json:"id"`
+					Blob []byte `json:"blob"`
+				} `json:"message"`
+			} `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(message, &decoded))
+		assert.Equal(t, "stream", decoded.Type)
+		assert.Equal(t, "blob_chunk", decoded.Data.Type)
+		assert.Equal(t, "1", decoded.Data.Message.ID)
+		assert.Equal(t, []byte{0x00, 0x1f, 0xff}, decoded.Data.Message.Blob)
+	}
+}
+
+func TestReadStdioMessagesLimits(t *testing.T) {
+	err := ReadStdioMessages(strings.NewReader(strings.Repeat("a", 100)+"\n"), 16, 64, 64, func([]byte) {}, func([]byte) {})
+	assert.ErrorIs(t, err, ErrLineTooLong)
+
+	// frames are limited separately from lines
+	frame := EncodeFrame(FRAME_TYPE_JSON, bytes.Repeat([]byte("a"), 100))
+	err = ReadStdioMessages(bytes.NewReader(frame), 16, 64, 128, func([]byte) {}, func([]byte) {})
+	assert.NoError(t, err)
+	err = ReadStdioMessages(bytes.NewReader(frame), 16, 64, 64, func([]byte) {}, func([]byte) {})
+	assert.ErrorIs(t, err, ErrFrameTooLong)
+}
+
+func TestStdioHolderSwitchesToFraming(t *testing.T) {
+	stdin := newMockReadWriteCloser()
+	stdout := newMockReadWriteCloser()
+	stderr := newMockReadWriteCloser()
+
+	holder := newStdioHolder("test-plugin", stdin, stdout, stderr, &StdioHolderConfig{
+		FramingEnabled: true,
+	})
+
+	assert.NoError(t, holder.writeMessage([]byte(`{}`)))
+	assert.Equal(t, "{}\n", string(stdin.GetWrittenData()))
+
+	stdout.WriteToRead([]byte(`{"event":"protocol","data":{"version":2,"framing":"length_prefixed"}}` + "\n"))
+	go holder.StartStdout(func() {})
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&holder.framed) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, holder.writeMessage([]byte(`{}`)))
+	assert.Equal(t, append([]byte("{}\n"), EncodeFrame(FRAME_TYPE_JSON, []byte(`{}`))...), stdin.GetWrittenData())
+
+	stdout.Close()
+}
+
+func TestDecodeBinaryFrameKeepsData(t *testing.T) {
+	frame, err := EncodeBinaryFrame("session-id", BinaryFrameMeta{
+		Type:       "stream",
+		Data:       json.RawMessage(`{"message":{"size":9007199254740993,"meta":{"ratio":1.50}},"seq":12345678901234567}`),
+		BinaryPath: []string{"message", "blob"},
+	}, []byte("raw"))
+	assert.NoError(t, err)
+
+	_, message, err := DecodeBinaryFrame(frame[FRAME_HEADER_SIZE:])
+	assert.NoError(t, err)
+
+	// integers beyond float64 precision are passed through as they were sent
+	assert.Contains(t, string(message), `"size":9007199254740993`)
+	assert.Contains(t, string(message), `"seq":12345678901234567`)
+	assert.Contains(t, string(message), `"ratio":1.50`)
+	assert.Contains(t, string(message), `"blob":"cmF3"`)
+
+	// the raw bytes are the whole data without a binary path
+	frame, err = EncodeBinaryFrame("session-id", BinaryFrameMeta{Type: "stream"}, []byte("raw"))
+	assert.NoError(t, err)
+	_, message, err = DecodeBinaryFrame(frame[FRAME_HEADER_SIZE:])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"stream","data":"cmF3"}`, string(message))
+
+	// a binary path through a non object is rejected instead of dropping the value
+	frame, err = EncodeBinaryFrame("session-id", BinaryFrameMeta{
+		Type:       "stream",
+		Data:       json.RawMessage(`{"message":"text"}`),
+		BinaryPath: []string{"message", "blob"},
+	}, []byte("raw"))
+	assert.NoError(t, err)
+	_, _, err = DecodeBinaryFrame(frame[FRAME_HEADER_SIZE:])
+	assert.Error(t, err)
+}
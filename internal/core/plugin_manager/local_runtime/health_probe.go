@@ -0,0 +1,156 @@
+package local_runtime
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/plugin_log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+const (
+	PLUGIN_IN_STREAM_EVENT_PING = "ping"
+
+	HEALTH_PROBE_SESSION_PREFIX = "health_probe_"
+)
+
+var ErrHealthProbeTimeout = errors.New("health probe timed out")
+
+// probeHealth pings the plugin every healthProbeInterval until done is closed, heartbeats only
+// prove the plugin process is alive, a pong proves its request handling is not stuck
+// the plugin is restarted after healthProbeMaxFailures consecutive failures
+func (r *LocalPluginRuntime) probeHealth(holder *stdioHolder, done <-chan bool) {
+	ticker := time.NewTicker(r.healthProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		// plugins with older sdks don't understand pings
+		if r.ProtocolVersion() < plugin_entities.PLUGIN_PROTOCOL_VERSION_PING {
+			continue
+		}
+
+		latency, err := ping(holder, r.healthProbeTimeout)
+		failures := r.RecordHealthProbe(latency, err)
+		if err == nil {
+			continue
+		}
+
+		log.Warn("health probe of plugin %s failed (%d/%d): %s", r.Config.Identity(), failures, r.healthProbeMaxFailures, err)
+		if failures < r.healthProbeMaxFailures {
+			continue
+		}
+
+		message := fmt.Sprintf("plugin failed %d health probes in a row, restarting it", failures)
+		log.Error("%s: %s", r.Config.Identity(), message)
+		r.Error(message)
+		r.logWriter.Log(plugin_log.SOURCE_DAEMON, plugin_log.LEVEL_ERROR, "", message)
+		// the lifecycle starts the plugin again once it stopped
+		holder.Stop()
+		return
+	}
+}
+
+// ping sends a ping through the same session io as requests and waits for any answer on the session
+func ping(holder *stdioHolder, timeout time.Duration) (time.Duration, error) {
+	sessionID := HEALTH_PROBE_SESSION_PREFIX + uuid.NewString()
+
+	pong := make(chan bool, 1)
+	holder.setupStdioEventListener(sessionID, func([]byte) {
+		select {
+		case pong <- true:
+		default:
+		}
+	})
+	defer holder.removeStdioHandlerListener(sessionID)
+
+	startedAt := time.Now()
+	if err := holder.writeMessage(parser.MarshalJsonBytes(map[string]any{
+		"session_id": sessionID,
+		"event":      PLUGIN_IN_STREAM_EVENT_PING,
+		"data":       map[string]any{"timestamp": startedAt.UnixMilli()},
+	})); err != nil {
+		return 0, fmt.Errorf("failed to send the health probe: %s", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-pong:
+		return time.Since(startedAt), nil
+	case <-timer.C:
+		return 0, ErrHealthProbeTimeout
+	}
+}
+
+// CheckHealth verifies the plugin is ready to serve requests before traffic is switched to it,
+// the plugin process must have been running for the stabilization period without restarting,
+// plugins which negotiated pings must answer one as well
+func (r *LocalPluginRuntime) CheckHealth(timeout time.Duration, stabilization time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	// on-demand plugins may hibernate right after being launched
+	if err := r.WakeUp(timeout); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	restarts := -1
+	for {
+		if r.Stopped() {
+			return errors.New("plugin has been stopped")
+		}
+
+		if atomic.LoadInt32(&r.hibernation.running) == 1 {
+			if restarts == -1 {
+				restarts = r.State.Restarts
+			} else if r.State.Restarts != restarts {
+				return errors.New("plugin restarted during the health check")
+			}
+
+			startedAt := time.Unix(0, atomic.LoadInt64(&r.hibernation.startedAt))
+			if time.Since(startedAt) >= stabilization {
+				break
+			}
+		} else if restarts != -1 {
+			return errors.New("plugin exited during the health check")
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New("timeout waiting for plugin to become healthy")
+		}
+		<-ticker.C
+	}
+
+	if r.ProtocolVersion() < plugin_entities.PLUGIN_PROTOCOL_VERSION_PING {
+		return nil
+	}
+
+	holder := r.stdioHolder
+	if holder == nil {
+		return errors.New("plugin is not running")
+	}
+
+	// the ping gets whatever is left of the timeout, but at least the timeout of regular probes
+	pingTimeout := time.Until(deadline)
+	if pingTimeout < r.healthProbeTimeout {
+		pingTimeout = r.healthProbeTimeout
+	}
+	if _, err := ping(holder, pingTimeout); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package local_runtime
+
+import (
+	"bufio"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePingPlugin answers pings with an end message on the same session, like a request
+func fakePingPlugin(stdin io.Reader, stdout *mockReadWriteCloser) {
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		event, err := parser.UnmarshalJsonBytes[map[string]any](scanner.Bytes())
+		if err != nil || event["event"] != PLUGIN_IN_STREAM_EVENT_PING {
+			continue
+		}
+
+		stdout.WriteToRead(append(parser.MarshalJsonBytes(map[string]any{
+			"session_id": event["session_id"],
+			"event":      plugin_entities.PLUGIN_EVENT_SESSION,
+			"data":       map[string]any{"type": "end", "data": map[string]any{}},
+		}), '\n'))
+	}
+}
+
+func TestPing(t *testing.T) {
+	stdinReader, stdinWriter := io.Pipe()
+	stdout := newMockReadWriteCloser()
+	stderr := newMockReadWriteCloser()
+	holder := newStdioHolder("test-plugin", stdinWriter, stdout, stderr, nil)
+	defer holder.Stop()
+
+	go holder.StartStdout(func() {})
+	go fakePingPlugin(stdinReader, stdout)
+
+	latency, err := ping(holder, time.Second)
+	assert.NoError(t, err)
+	assert.Less(t, latency, time.Second)
+
+	// the probe session is released once answered
+	holder.l.Lock()
+	assert.Empty(t, holder.listener)
+	holder.l.Unlock()
+}
+
+func TestProbeHealthRestartsStuckPlugin(t *testing.T) {
+	stdinReader, stdinWriter := io.Pipe()
+	stdout := newMockReadWriteCloser()
+	stderr := newMockReadWriteCloser()
+	holder := newStdioHolder("test-plugin", stdinWriter, stdout, stderr, nil)
+
+	// the plugin reads requests but never answers them
+	go io.Copy(io.Discard, stdinReader)
+
+	runtime := &LocalPluginRuntime{
+		healthProbeInterval:    10 * time.Millisecond,
+		healthProbeTimeout:     20 * time.Millisecond,
+		healthProbeMaxFailures: 2,
+	}
+	runtime.SetProtocolVersion(plugin_entities.PLUGIN_PROTOCOL_VERSION_PING)
+
+	done := make(chan bool)
+	finished := make(chan bool)
+	go func() {
+		runtime.probeHealth(holder, done)
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		close(done)
+		t.Fatal("the stuck plugin was not restarted")
+	}
+
+	assert.True(t, stdout.IsClosed())
+	if probe := runtime.HealthProbe(); assert.NotNil(t, probe) {
+		assert.Equal(t, 2, probe.ConsecutiveFailures)
+		assert.Equal(t, ErrHealthProbeTimeout.Error(), probe.LastError)
+		assert.Nil(t, probe.LastSucceededAt)
+	}
+}
+
+func TestProbeHealthSkipsLegacyPlugins(t *testing.T) {
+	stdout := newMockReadWriteCloser()
+	holder := newStdioHolder("test-plugin", newMockReadWriteCloser(), stdout, newMockReadWriteCloser(), nil)
+
+	runtime := &LocalPluginRuntime{
+		healthProbeInterval:    5 * time.Millisecond,
+		healthProbeTimeout:     5 * time.Millisecond,
+		healthProbeMaxFailures: 1,
+	}
+
+	done := make(chan bool)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(done)
+	}()
+	runtime.probeHealth(holder, done)
+
+	// plugins which didn't negotiate pings are never probed
+	assert.Nil(t, runtime.HealthProbe())
+	assert.False(t, stdout.IsClosed())
+}
+
+func TestCheckHealth(t *testing.T) {
+	stdinReader, stdinWriter := io.Pipe()
+	stdout := newMockReadWriteCloser()
+	holder := newStdioHolder("test-plugin", stdinWriter, stdout, newMockReadWriteCloser(), nil)
+	defer holder.Stop()
+
+	go holder.StartStdout(func() {})
+	go fakePingPlugin(stdinReader, stdout)
+
+	runtime := &LocalPluginRuntime{hibernation: newHibernation(), healthProbeTimeout: time.Second}
+	runtime.SetProtocolVersion(plugin_entities.PLUGIN_PROTOCOL_VERSION_PING)
+
+	// the plugin process is not running yet
+	assert.Error(t, runtime.CheckHealth(300*time.Millisecond, 0))
+
+	runtime.stdioHolder = holder
+	atomic.StoreInt64(&runtime.hibernation.startedAt, time.Now().UnixNano())
+	atomic.StoreInt32(&runtime.hibernation.running, 1)
+
+	// the plugin keeps running for the stabilization period and answers the ping
+	startedAt := time.Now()
+	assert.NoError(t, runtime.CheckHealth(5*time.Second, 300*time.Millisecond))
+	assert.GreaterOrEqual(t, time.Since(startedAt), 200*time.Millisecond)
+
+	// a plugin crashing during the stabilization period is unhealthy
+	atomic.StoreInt64(&runtime.hibernation.startedAt, time.Now().UnixNano())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&runtime.hibernation.running, 0)
+	}()
+	assert.Error(t, runtime.CheckHealth(5*time.Second, time.Second))
+}
+
+func TestCheckHealthStuckPlugin(t *testing.T) {
+	stdinReader, stdinWriter := io.Pipe()
+	holder := newStdioHolder("test-plugin", stdinWriter, newMockReadWriteCloser(), newMockReadWriteCloser(), nil)
+	defer holder.Stop()
+
+	// the plugin reads requests but never answers them
+	go io.Copy(io.Discard, stdinReader)
+
+	runtime := &LocalPluginRuntime{hibernation: newHibernation(), healthProbeTimeout: 100 * time.Millisecond}
+	runtime.SetProtocolVersion(plugin_entities.PLUGIN_PROTOCOL_VERSION_PING)
+	runtime.stdioHolder = holder
+	atomic.StoreInt32(&runtime.hibernation.running, 1)
+
+	assert.ErrorIs(t, runtime.CheckHealth(100*time.Millisecond, 0), ErrHealthProbeTimeout)
+}
@@ -0,0 +1,227 @@
+package local_runtime
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+)
+
+const (
+	// the interval to check whether a running on-demand plugin has been idle for too long
+	MAX_IDLE_CHECK_INTERVAL = 10 * time.Second
+)
+
+// hibernation holds the states of an on-demand plugin
+// the runtime keeps registered in the plugin manager and the cluster while hibernating,
+// only the plugin process is stopped, it will be started again on the next dispatch
+type hibernation struct {
+	// demandChan receives a signal when a dispatch is waiting for the plugin process
+	demandChan chan bool
+
+	// stopChan is closed when the runtime is stopped, used to release a hibernating plugin
+	stopChan chan bool
+	stopOnce *sync.Once
+
+	// serializes the idle check of the watcher with the running check of WakeUp,
+	// so a dispatch never lands on a plugin process which is about to be stopped
+	lock *sync.Mutex
+
+	// whether the plugin process is running
+	running int32
+	// whether the last exit of the plugin process was caused by hibernation
+	hibernated int32
+	// the number of sessions which are listening to the plugin
+	activeSessions int32
+	// the last time the plugin process was started, in unix nano
+	startedAt int64
+	// the last time a session was dispatched to or released from the plugin, in unix nano
+	lastDispatchedAt int64
+}
+
+func newHibernation() hibernation {
+	return hibernation{
+		demandChan:       make(chan bool, 1),
+		stopChan:         make(chan bool),
+		stopOnce:         &sync.Once{},
+		lock:             &sync.Mutex{},
+		lastDispatchedAt: time.Now().UnixNano(),
+	}
+}
+
+// touch marks the plugin as recently used to postpone its hibernation
+func (r *LocalPluginRuntime) touch() {
+	atomic.StoreInt64(&r.hibernation.lastDispatchedAt, time.Now().UnixNano())
+}
+
+func (r *LocalPluginRuntime) acquireSession() {
+	atomic.AddInt32(&r.hibernation.activeSessions, 1)
+	r.touch()
+}
+
+func (r *LocalPluginRuntime) releaseSession() {
+	atomic.AddInt32(&r.hibernation.activeSessions, -1)
+	r.touch()
+}
+
+// ActiveSessions returns the number of sessions which are still listening to the plugin
+func (r *LocalPluginRuntime) ActiveSessions() int {
+	return int(atomic.LoadInt32(&r.hibernation.activeSessions))
+}
+
+// shouldHibernate returns true if the plugin has no active sessions and
+// nothing has been dispatched to it within the idle timeout
+func (r *LocalPluginRuntime) shouldHibernate(now time.Time) bool {
+	if !r.onDemand || r.idleTimeout <= 0 {
+		return false
+	}
+
+	if atomic.LoadInt32(&r.hibernation.activeSessions) > 0 {
+		return false
+	}
+
+	lastDispatchedAt := time.Unix(0, atomic.LoadInt64(&r.hibernation.lastDispatchedAt))
+	return now.Sub(lastDispatchedAt) > r.idleTimeout
+}
+
+// waitForDemand blocks until a dispatch wakes the plugin up
+// returns false if the runtime was stopped while hibernating
+func (r *LocalPluginRuntime) waitForDemand() bool {
+	if r.Stopped() {
+		return false
+	}
+
+	r.SetHibernating()
+
+	select {
+	case <-r.hibernation.demandChan:
+		atomic.StoreInt32(&r.hibernation.hibernated, 0)
+		r.touch()
+		return true
+	case <-r.hibernation.stopChan:
+		return false
+	}
+}
+
+// watchIdle stops the plugin process once it has been idle for too long
+// it exits when done is closed, which happens when the plugin process exits
+func (r *LocalPluginRuntime) watchIdle(done <-chan bool) {
+	interval := r.idleTimeout / 4
+	if interval > MAX_IDLE_CHECK_INTERVAL {
+		interval = MAX_IDLE_CHECK_INTERVAL
+	}
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if !r.startHibernating(now) {
+				continue
+			}
+
+			log.Info("plugin %s has been idle for %s, hibernating", r.Config.Identity(), r.idleTimeout)
+			if r.stdioHolder != nil {
+				r.stdioHolder.Stop()
+			}
+			return
+		}
+	}
+}
+
+// startHibernating marks the plugin as hibernating if it has been idle for too long,
+// dispatches from then on wait for the plugin process to be started again
+func (r *LocalPluginRuntime) startHibernating(now time.Time) bool {
+	r.hibernation.lock.Lock()
+	defer r.hibernation.lock.Unlock()
+
+	if !r.shouldHibernate(now) {
+		return false
+	}
+
+	atomic.StoreInt32(&r.hibernation.hibernated, 1)
+	return true
+}
+
+// awake returns true if the plugin process is running and not going to hibernate
+func (r *LocalPluginRuntime) awake() bool {
+	return atomic.LoadInt32(&r.hibernation.running) == 1 &&
+		atomic.LoadInt32(&r.hibernation.hibernated) == 0
+}
+
+// Hibernated returns true if the plugin process was stopped due to idleness
+// instead of crashing, the lifecycle should not consider it as a restart
+func (r *LocalPluginRuntime) Hibernated() bool {
+	return atomic.LoadInt32(&r.hibernation.hibernated) == 1
+}
+
+// WakeUp makes sure the plugin process is running before a session is dispatched to it
+// hibernating plugins are started and the caller waits until the plugin has started
+func (r *LocalPluginRuntime) WakeUp(timeout time.Duration) error {
+	if !r.onDemand {
+		r.touch()
+		return nil
+	}
+
+	// the plugin either stays awake for the idle timeout or is already hibernating
+	r.hibernation.lock.Lock()
+	r.touch()
+	if r.awake() {
+		r.hibernation.lock.Unlock()
+		return nil
+	}
+
+	started := make(chan bool)
+	r.waitChanLock.Lock()
+	r.waitStartedChan = append(r.waitStartedChan, started)
+	r.waitChanLock.Unlock()
+	r.hibernation.lock.Unlock()
+	defer r.removeWaitStartedChan(started)
+
+	select {
+	case r.hibernation.demandChan <- true:
+	default:
+		// a wake up signal is already pending
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// started events are not buffered, check the running flag as a fallback
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-started:
+			return nil
+		case <-ticker.C:
+			if r.awake() {
+				return nil
+			}
+		case <-r.hibernation.stopChan:
+			return errors.New("plugin has been stopped")
+		case <-timer.C:
+			return errors.New("timeout waiting for plugin to start")
+		}
+	}
+}
+
+func (r *LocalPluginRuntime) removeWaitStartedChan(c chan bool) {
+	r.waitChanLock.Lock()
+	defer r.waitChanLock.Unlock()
+	for i, ch := range r.waitStartedChan {
+		if ch == c {
+			r.waitStartedChan = append(r.waitStartedChan[:i], r.waitStartedChan[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package local_runtime
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldHibernate(t *testing.T) {
+	runtime := NewLocalPluginRuntime(LocalPluginRuntimeConfig{
+		OnDemand:    true,
+		IdleTimeout: time.Second,
+	})
+
+	now := time.Now()
+	assert.False(t, runtime.shouldHibernate(now))
+	assert.True(t, runtime.shouldHibernate(now.Add(2*time.Second)))
+
+	// active sessions keep the plugin running
+	runtime.acquireSession()
+	assert.False(t, runtime.shouldHibernate(now.Add(2*time.Second)))
+	runtime.releaseSession()
+	assert.False(t, runtime.shouldHibernate(time.Now()))
+	assert.True(t, runtime.shouldHibernate(time.Now().Add(2*time.Second)))
+}
+
+func TestShouldNotHibernateAlwaysOnPlugin(t *testing.T) {
+	runtime := NewLocalPluginRuntime(LocalPluginRuntimeConfig{
+		OnDemand:    false,
+		IdleTimeout: time.Second,
+	})
+
+	assert.False(t, runtime.shouldHibernate(time.Now().Add(time.Hour)))
+	assert.NoError(t, runtime.WakeUp(time.Millisecond))
+}
+
+func TestWakeUpSignalsDemand(t *testing.T) {
+	runtime := NewLocalPluginRuntime(LocalPluginRuntimeConfig{
+		OnDemand:    true,
+		IdleTimeout: time.Second,
+	})
+
+	woken := make(chan bool, 1)
+	go func() {
+		woken <- runtime.waitForDemand()
+	}()
+
+	// no process is started in this test, so waking up times out after the demand was consumed
+	err := runtime.WakeUp(300 * time.Millisecond)
+	assert.Error(t, err)
+
+	select {
+	case ok := <-woken:
+		assert.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("hibernating plugin was not woken up")
+	}
+
+	runtime.waitChanLock.Lock()
+	assert.Empty(t, runtime.waitStartedChan)
+	runtime.waitChanLock.Unlock()
+}
+
+func TestStopReleasesHibernatingPlugin(t *testing.T) {
+	runtime := NewLocalPluginRuntime(LocalPluginRuntimeConfig{
+		OnDemand:    true,
+		IdleTimeout: time.Second,
+	})
+
+	woken := make(chan bool, 1)
+	go func() {
+		woken <- runtime.waitForDemand()
+	}()
+
+	runtime.Stop()
+
+	select {
+	case ok := <-woken:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("hibernating plugin was not released after stop")
+	}
+}
+
+func TestWakeUpAtIdleDeadline(t *testing.T) {
+	runtime := NewLocalPluginRuntime(LocalPluginRuntimeConfig{
+		OnDemand:    true,
+		IdleTimeout: time.Second,
+	})
+	// the plugin process is running and reaches its idle deadline
+	atomic.StoreInt32(&runtime.hibernation.running, 1)
+	atomic.StoreInt64(&runtime.hibernation.lastDispatchedAt, time.Now().Add(-time.Second).UnixNano())
+
+	// the dispatch comes first, the plugin stays awake for another idle timeout
+	assert.NoError(t, runtime.WakeUp(time.Second))
+	assert.False(t, runtime.startHibernating(time.Now()))
+
+	// the watcher comes first, the dispatch waits for the plugin to be started again
+	assert.True(t, runtime.startHibernating(time.Now().Add(2*time.Second)))
+	woken := make(chan error, 1)
+	go func() {
+		woken <- runtime.WakeUp(5 * time.Second)
+	}()
+
+	select {
+	case <-woken:
+		t.Fatal("session dispatched to a hibernating plugin")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// the plugin process exits and is started again on demand
+	atomic.StoreInt32(&runtime.hibernation.running, 0)
+	assert.True(t, runtime.waitForDemand())
+	atomic.StoreInt32(&runtime.hibernation.running, 1)
+
+	select {
+	case err := <-woken:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("plugin was not woken up after the restart")
+	}
+}
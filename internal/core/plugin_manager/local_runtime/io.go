@@ -1,6 +1,8 @@
 package local_runtime
 
 import (
+	"sync"
+
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_daemon/access_types"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
@@ -10,8 +12,11 @@ import (
 
 func (r *LocalPluginRuntime) Listen(session_id string) *entities.Broadcast[plugin_entities.SessionMessage] {
 	listener := entities.NewBroadcast[plugin_entities.SessionMessage]()
+	r.acquireSession()
+	releaseOnce := sync.Once{}
 	listener.OnClose(func() {
 		r.stdioHolder.removeStdioHandlerListener(session_id)
+		releaseOnce.Do(r.releaseSession)
 	})
 	r.stdioHolder.setupStdioEventListener(session_id, func(b []byte) {
 		// unmarshal the session message
@@ -27,5 +32,15 @@ func (r *LocalPluginRuntime) Listen(session_id string) *entities.Broadcast[plugi
 }
 
 func (r *LocalPluginRuntime) Write(session_id string, action access_types.PluginAccessAction, data []byte) {
-	r.stdioHolder.write(append(data, '\n'))
+	r.touch()
+	r.stdioHolder.writeMessage(data)
+}
+
+// Cancel notifies the plugin that the caller of the session has gone away
+// plugins which did not negotiate the cancellation protocol would not understand it, skip them
+func (r *LocalPluginRuntime) Cancel(session_id string, data []byte) {
+	if r.ProtocolVersion() < plugin_entities.PLUGIN_PROTOCOL_VERSION_CANCELLATION {
+		return
+	}
+	r.stdioHolder.writeMessage(data)
 }
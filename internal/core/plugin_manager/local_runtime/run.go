@@ -6,8 +6,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/plugin_log"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
@@ -29,28 +33,64 @@ func (r *LocalPluginRuntime) Type() plugin_entities.PluginRuntimeType {
 
 // getCmd prepares the exec.Cmd for the plugin based on its language
 func (r *LocalPluginRuntime) getCmd() (*exec.Cmd, error) {
-	if r.Config.Meta.Runner.Language == constants.Python {
-		cmd := exec.Command(r.pythonInterpreterPath, "-m", r.Config.Meta.Runner.Entrypoint)
-		cmd.Dir = r.State.WorkingPath
-		cmd.Env = cmd.Environ()
-		if r.HttpsProxy != "" {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("HTTPS_PROXY=%s", r.HttpsProxy))
-		}
-		if r.HttpProxy != "" {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("HTTP_PROXY=%s", r.HttpProxy))
+	var cmd *exec.Cmd
+	switch r.Config.Meta.Runner.Language {
+	case constants.Python:
+		cmd = exec.Command(r.pythonInterpreterPath, "-m", r.Config.Meta.Runner.Entrypoint)
+	case constants.NodeJS:
+		// node resolves the entrypoint like `require`, e.g. `main` or `dist/main.js`
+		cmd = exec.Command(r.nodeExecutablePath, "./"+strings.TrimPrefix(r.Config.Meta.Runner.Entrypoint, "./"))
+		cmd.Env = append(cmd.Environ(), "NODE_ENV=production")
+	case constants.Go:
+		binary, err := r.goBinary()
+		if err != nil {
+			return nil, err
 		}
-		if r.NoProxy != "" {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("NO_PROXY=%s", r.NoProxy))
+		cmd = exec.Command(binary)
+	default:
+		return nil, fmt.Errorf("unsupported language: %s", r.Config.Meta.Runner.Language)
+	}
+
+	cmd.Dir = r.State.WorkingPath
+	if cmd.Env == nil {
+		cmd.Env = cmd.Environ()
+	}
+	if r.HttpsProxy != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("HTTPS_PROXY=%s", r.HttpsProxy))
+	}
+	if r.HttpProxy != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("HTTP_PROXY=%s", r.HttpProxy))
+	}
+	if r.NoProxy != "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("NO_PROXY=%s", r.NoProxy))
+	}
+	if r.environment != nil {
+		// resolved on every start, so that changed variables take effect after a restart
+		env, err := r.environment()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the environment variables: %s", err)
 		}
-		return cmd, nil
+		cmd.Env = append(cmd.Env, env...)
 	}
+	return cmd, nil
+}
 
-	return nil, fmt.Errorf("unsupported language: %s", r.Config.Meta.Runner.Language)
+// Restart stops the plugin process, the lifecycle starts it again with the latest environment
+func (r *LocalPluginRuntime) Restart() {
+	if r.stdioHolder != nil {
+		r.stdioHolder.Stop()
+	}
 }
 
 // StartPlugin starts the plugin and manages its lifecycle
 func (r *LocalPluginRuntime) StartPlugin() error {
+	// on-demand plugins hibernate until a dispatch wakes them up
+	if r.onDemand && !r.waitForDemand() {
+		return nil
+	}
+
 	defer log.Info("plugin %s stopped", r.Config.Identity())
+	defer r.logWriter.Log(plugin_log.SOURCE_DAEMON, plugin_log.LEVEL_INFO, "", "plugin stopped")
 	defer func() {
 		r.waitChanLock.Lock()
 		for _, c := range r.waitStoppedChan {
@@ -62,7 +102,7 @@ func (r *LocalPluginRuntime) StartPlugin() error {
 		r.waitChanLock.Unlock()
 	}()
 
-	if r.isNotFirstStart {
+	if r.isNotFirstStart && !r.onDemand {
 		r.SetRestarting()
 	} else {
 		r.SetLaunching()
@@ -82,6 +122,10 @@ func (r *LocalPluginRuntime) StartPlugin() error {
 	e.Dir = r.State.WorkingPath
 	// add env INSTALL_METHOD=local
 	e.Env = append(e.Environ(), "INSTALL_METHOD=local", "PATH="+os.Getenv("PATH"))
+	if r.stdioFramingEnabled {
+		// offer length-prefixed framing, runners which don't know it simply ignore it
+		e.Env = append(e.Env, STDIO_FRAMING_ENV+"="+STDIO_FRAMING_LENGTH_PREFIXED)
+	}
 
 	// get writer
 	stdin, err := e.StdinPipe()
@@ -109,16 +153,23 @@ func (r *LocalPluginRuntime) StartPlugin() error {
 	}
 
 	// setup stdio
+	// the new process needs to negotiate its protocol version again
+	r.SetProtocolVersion(plugin_entities.PLUGIN_PROTOCOL_VERSION_BASIC)
 	r.stdioHolder = newStdioHolder(r.Config.Identity(), stdin, stdout, stderr, &StdioHolderConfig{
-		StdoutBufferSize:    r.stdoutBufferSize,
-		StdoutMaxBufferSize: r.stdoutMaxBufferSize,
+		StdoutBufferSize:     r.stdoutBufferSize,
+		StdoutMaxBufferSize:  r.stdoutMaxBufferSize,
+		StdoutMaxFrameSize:   r.stdoutMaxFrameSize,
+		FramingEnabled:       r.stdioFramingEnabled,
+		OnProtocolNegotiated: r.SetProtocolVersion,
+		LogWriter:            r.logWriter,
 	})
 	defer r.stdioHolder.Stop()
 
 	defer func() {
 		// wait for plugin to exit
 		originalErr := e.Wait()
-		if originalErr != nil {
+		// the plugin process is killed on purpose when hibernating
+		if originalErr != nil && !r.Hibernated() {
 			// get stdio
 			var err error
 			if r.stdioHolder != nil {
@@ -133,6 +184,10 @@ func (r *LocalPluginRuntime) StartPlugin() error {
 			}
 			if err != nil {
 				log.Error("plugin %s exited with error: %s", r.Config.Identity(), err.Error())
+				r.logWriter.Log(
+					plugin_log.SOURCE_DAEMON, plugin_log.LEVEL_ERROR, "",
+					fmt.Sprintf("plugin exited with error: %s", err.Error()),
+				)
 			} else {
 				log.Error("plugin %s exited with unknown error", r.Config.Identity())
 			}
@@ -145,6 +200,7 @@ func (r *LocalPluginRuntime) StartPlugin() error {
 	defer e.Process.Kill()
 
 	log.Info("plugin %s started", r.Config.Identity())
+	r.logWriter.Log(plugin_log.SOURCE_DAEMON, plugin_log.LEVEL_INFO, "", "plugin started")
 
 	wg := sync.WaitGroup{}
 	wg.Add(2)
@@ -169,6 +225,38 @@ func (r *LocalPluginRuntime) StartPlugin() error {
 		r.stdioHolder.StartStderr()
 	})
 
+	// stop the plugin process once it has been idle for too long
+	if r.onDemand {
+		idleWatcherDone := make(chan bool)
+		defer close(idleWatcherDone)
+		routine.Submit(map[string]string{
+			"module":   "plugin_manager",
+			"type":     "local",
+			"function": "WatchIdle",
+		}, func() {
+			r.watchIdle(idleWatcherDone)
+		})
+	}
+
+	// probe the plugin actively, a new process starts with a clean record
+	if r.healthProbeInterval > 0 {
+		r.ResetHealthProbe()
+		probeDone := make(chan bool)
+		defer close(probeDone)
+		holder := r.stdioHolder
+		routine.Submit(map[string]string{
+			"module":   "plugin_manager",
+			"type":     "local",
+			"function": "ProbeHealth",
+		}, func() {
+			r.probeHealth(holder, probeDone)
+		})
+	}
+
+	atomic.StoreInt64(&r.hibernation.startedAt, time.Now().UnixNano())
+	atomic.StoreInt32(&r.hibernation.running, 1)
+	defer atomic.StoreInt32(&r.hibernation.running, 0)
+
 	// send started event
 	r.waitChanLock.Lock()
 	for _, c := range r.waitStartedChan {
@@ -221,6 +309,11 @@ func (r *LocalPluginRuntime) Stop() {
 	// inherit from PluginRuntime
 	r.PluginRuntime.Stop()
 
+	// release the plugin if it's hibernating
+	r.hibernation.stopOnce.Do(func() {
+		close(r.hibernation.stopChan)
+	})
+
 	// get stdio
 	if r.stdioHolder != nil {
 		r.stdioHolder.Stop()
@@ -0,0 +1,39 @@
+package local_runtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+// the variables managed by the admin api override the proxy settings of the daemon
+func TestGetCmdPluginEnvironmentOverridesDaemonEnvironment(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://host:1")
+
+	runtime := NewLocalPluginRuntime(LocalPluginRuntimeConfig{
+		PythonInterpreterPath: "python",
+		HttpProxy:             "http://daemon:2",
+		NoProxy:               "localhost",
+		Environment: func() ([]string, error) {
+			return []string{"HTTP_PROXY=http://plugin:3", "API_KEY=secret"}, nil
+		},
+	})
+	runtime.Config.Meta.Runner.Language = constants.Python
+	runtime.Config.Meta.Runner.Entrypoint = "main"
+
+	cmd, err := runtime.getCmd()
+	assert.NoError(t, err)
+
+	env := map[string]string{}
+	for _, kv := range cmd.Environ() {
+		// duplicated names are resolved like exec does, the last one wins
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			env[name] = value
+		}
+	}
+	assert.Equal(t, "http://plugin:3", env["HTTP_PROXY"])
+	assert.Equal(t, "localhost", env["NO_PROXY"])
+	assert.Equal(t, "secret", env["API_KEY"])
+}
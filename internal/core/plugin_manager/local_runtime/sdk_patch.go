@@ -0,0 +1,314 @@
+package local_runtime
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
+)
+
+//go:embed patches
+var embeddedSdkPatches embed.FS
+
+const (
+	SDK_PATCH_REGISTRY_FILE = "registry.yaml"
+)
+
+// SdkPatch replaces a file of the plugin sdk installed in a venv
+type SdkPatch struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+	// versions of the sdk the patch applies to, e.g. `<0.1.1` or `>=0.0.1b60,<0.0.1b70`
+	SdkVersions string `yaml:"sdk_versions" json:"sdk_versions"`
+	// path of the replaced file, relative to the dify_plugin package
+	Target string `yaml:"target" json:"target"`
+	// path of the patch file, relative to the registry file
+	Patch string `yaml:"patch" json:"patch"`
+	// checksum of the patch file
+	Sha256 string `yaml:"sha256" json:"sha256"`
+
+	versions versionRange
+	content  []byte
+}
+
+type sdkPatchRegistryFile struct {
+	Patches []SdkPatch `yaml:"patches"`
+}
+
+// SdkPatchRegistry is the set of patches applied to legacy plugin sdk versions
+type SdkPatchRegistry struct {
+	patches []*SdkPatch
+}
+
+// LoadSdkPatchRegistry loads the embedded patches and the patches of the operator directory
+// every yaml file of the directory is a registry, patches with the same name override embedded ones
+func LoadSdkPatchRegistry(dir string) (*SdkPatchRegistry, error) {
+	embedded, err := fs.Sub(embeddedSdkPatches, "patches")
+	if err != nil {
+		return nil, err
+	}
+
+	patches, err := loadSdkPatches(embedded, SDK_PATCH_REGISTRY_FILE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load embedded sdk patches: %s", err)
+	}
+
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			operatorPatches, err := loadSdkPatches(os.DirFS(dir), filepath.Base(file))
+			if err != nil {
+				return nil, fmt.Errorf("failed to load sdk patches from %s: %s", file, err)
+			}
+
+			for _, patch := range operatorPatches {
+				replaced := false
+				for i, existing := range patches {
+					if existing.Name == patch.Name {
+						patches[i] = patch
+						replaced = true
+						break
+					}
+				}
+				if !replaced {
+					patches = append(patches, patch)
+				}
+			}
+		}
+	}
+
+	return &SdkPatchRegistry{patches: patches}, nil
+}
+
+var (
+	defaultSdkPatchRegistry     *SdkPatchRegistry
+	defaultSdkPatchRegistryOnce sync.Once
+)
+
+// DefaultSdkPatchRegistry returns the registry of embedded patches
+func DefaultSdkPatchRegistry() *SdkPatchRegistry {
+	defaultSdkPatchRegistryOnce.Do(func() {
+		registry, err := LoadSdkPatchRegistry("")
+		if err != nil {
+			// embedded patches are checked by tests, it should never happen
+			log.Panic("failed to load embedded sdk patches: %s", err)
+		}
+		defaultSdkPatchRegistry = registry
+	})
+	return defaultSdkPatchRegistry
+}
+
+func loadSdkPatches(fsys fs.FS, registryFile string) ([]*SdkPatch, error) {
+	data, err := fs.ReadFile(fsys, registryFile)
+	if err != nil {
+		return nil, err
+	}
+
+	registry, err := parser.UnmarshalYamlBytes[sdkPatchRegistryFile](data)
+	if err != nil {
+		return nil, err
+	}
+
+	patches := make([]*SdkPatch, 0, len(registry.Patches))
+	for i := range registry.Patches {
+		patch := registry.Patches[i]
+		if patch.Name == "" {
+			return nil, fmt.Errorf("patch name is empty")
+		}
+		if patch.Target == "" || path.IsAbs(patch.Target) || strings.Contains(patch.Target, "..") {
+			return nil, fmt.Errorf("invalid target of patch %s: %q", patch.Name, patch.Target)
+		}
+
+		patch.versions, err = parseVersionRange(patch.SdkVersions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sdk versions of patch %s: %s", patch.Name, err)
+		}
+
+		patch.content, err = fs.ReadFile(fsys, path.Join(path.Dir(registryFile), patch.Patch))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read patch %s: %s", patch.Name, err)
+		}
+
+		if checksum := sha256Hex(patch.content); !strings.EqualFold(checksum, patch.Sha256) {
+			return nil, fmt.Errorf("checksum mismatch of patch %s, expected %s, got %s", patch.Name, patch.Sha256, checksum)
+		}
+
+		patches = append(patches, &patch)
+	}
+
+	return patches, nil
+}
+
+// Patches returns all the patches of the registry
+func (r *SdkPatchRegistry) Patches() []*SdkPatch {
+	return r.patches
+}
+
+// Match returns the patches applying to the sdk version
+func (r *SdkPatchRegistry) Match(sdkVersion string) ([]*SdkPatch, error) {
+	v, err := version.NewVersion(sdkVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []*SdkPatch{}
+	for _, patch := range r.patches {
+		if patch.versions.check(v) {
+			matched = append(matched, patch)
+		}
+	}
+	return matched, nil
+}
+
+// SdkPatchReport lists the plugins a patch applies to
+type SdkPatchReport struct {
+	Patch   *SdkPatch `json:"patch"`
+	Plugins []string  `json:"plugins"`
+}
+
+// DryRun reports the plugins each patch would be applied to, plugins are given
+// as a map of plugin unique identifier to the content of requirements.txt
+func (r *SdkPatchRegistry) DryRun(requirements map[string]string) []SdkPatchReport {
+	reports := make([]SdkPatchReport, 0, len(r.patches))
+	indexes := map[string]int{}
+	for i, patch := range r.patches {
+		reports = append(reports, SdkPatchReport{Patch: patch, Plugins: []string{}})
+		indexes[patch.Name] = i
+	}
+
+	identities := make([]string, 0, len(requirements))
+	for identity := range requirements {
+		identities = append(identities, identity)
+	}
+	sort.Strings(identities)
+
+	for _, identity := range identities {
+		sdkVersion, err := pluginSdkVersion(requirements[identity])
+		if err != nil {
+			continue
+		}
+
+		patches, err := r.Match(sdkVersion)
+		if err != nil {
+			continue
+		}
+
+		for _, patch := range patches {
+			report := &reports[indexes[patch.Name]]
+			report.Plugins = append(report.Plugins, identity)
+		}
+	}
+
+	return reports
+}
+
+// apply writes the patch into the sdk, returns false if it has been applied already
+func (patch *SdkPatch) apply(sdkPath string) (bool, error) {
+	targetPath := path.Join(sdkPath, patch.Target)
+
+	current, err := os.ReadFile(targetPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to find the target of patch %s: %s", patch.Name, err)
+	}
+
+	if strings.EqualFold(sha256Hex(current), patch.Sha256) {
+		return false, nil
+	}
+
+	// the target may be hard linked to the shared dependency cache, replace the file
+	// instead of writing into it to keep the cache untouched
+	tmpPath := targetPath + ".dify-patch"
+	if err := os.WriteFile(tmpPath, patch.content, 0644); err != nil {
+		return false, fmt.Errorf("failed to write patch %s: %s", patch.Name, err)
+	}
+	if err := os.Rename(tmpPath, targetPath); err != nil {
+		os.Remove(tmpPath)
+		return false, fmt.Errorf("failed to write patch %s: %s", patch.Name, err)
+	}
+
+	return true, nil
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+type versionConstraint struct {
+	operator string
+	version  *version.Version
+}
+
+// versionRange is a comma-separated list of comparisons which all need to be satisfied
+// unlike go-version constraints, pre-releases like 0.0.1b70 are compared as plain versions
+type versionRange []versionConstraint
+
+func parseVersionRange(s string) (versionRange, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("version range is empty")
+	}
+
+	r := versionRange{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		operator := ""
+		for _, op := range []string{"<=", ">=", "==", "<", ">"} {
+			if strings.HasPrefix(part, op) {
+				operator = op
+				break
+			}
+		}
+		if operator == "" {
+			return nil, fmt.Errorf("missing comparison operator in %q", part)
+		}
+
+		v, err := version.NewVersion(strings.TrimSpace(strings.TrimPrefix(part, operator)))
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, versionConstraint{operator: operator, version: v})
+	}
+
+	return r, nil
+}
+
+func (r versionRange) check(v *version.Version) bool {
+	for _, c := range r {
+		cmp := v.Compare(c.version)
+		satisfied := false
+		switch c.operator {
+		case "<":
+			satisfied = cmp < 0
+		case "<=":
+			satisfied = cmp <= 0
+		case ">":
+			satisfied = cmp > 0
+		case ">=":
+			satisfied = cmp >= 0
+		case "==":
+			satisfied = cmp == 0
+		}
+		if !satisfied {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package local_runtime
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func patchNames(patches []*SdkPatch) []string {
+	names := []string{}
+	for _, patch := range patches {
+		names = append(names, patch.Name)
+	}
+	return names
+}
+
+func TestEmbeddedSdkPatches(t *testing.T) {
+	registry, err := LoadSdkPatchRegistry("")
+	assert.NoError(t, err)
+
+	patches, err := registry.Match("0.0.1b60")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ai_model_memory_leak", "llm_entities", "stdio_request_reader"}, patchNames(patches))
+
+	patches, err = registry.Match("0.0.1b70")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"llm_entities", "stdio_request_reader"}, patchNames(patches))
+
+	patches, err = registry.Match("0.1.1")
+	assert.NoError(t, err)
+	assert.Empty(t, patches)
+}
+
+func TestOperatorSdkPatches(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("print('patched')\n")
+	assert.NoError(t, os.WriteFile(path.Join(dir, "tool.py.patch"), content, 0644))
+	assert.NoError(t, os.WriteFile(path.Join(dir, "registry.yaml"), []byte(`
+patches:
+  - name: tool_fix
+    sdk_versions: ">=0.2.0,<0.2.3"
+    target: interfaces/tool/__init__.py
+    patch: tool.py.patch
+    sha256: `+sha256Hex(content)+`
+`), 0644))
+
+	registry, err := LoadSdkPatchRegistry(dir)
+	assert.NoError(t, err)
+	assert.Len(t, registry.Patches(), 4)
+
+	patches, err := registry.Match("0.2.2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tool_fix"}, patchNames(patches))
+
+	reports := registry.DryRun(map[string]string{
+		"langgenius/a:0.0.1@a": "dify_plugin==0.2.1\n",
+		"langgenius/b:0.0.1@b": "dify_plugin==0.1.0\n",
+		"langgenius/c:0.0.1@c": "requests\n",
+	})
+	plugins := map[string][]string{}
+	for _, report := range reports {
+		plugins[report.Patch.Name] = report.Plugins
+	}
+	assert.Equal(t, []string{"langgenius/a:0.0.1@a"}, plugins["tool_fix"])
+	assert.Equal(t, []string{"langgenius/b:0.0.1@b"}, plugins["llm_entities"])
+	assert.Empty(t, plugins["ai_model_memory_leak"])
+
+	// patches not matching their checksum are rejected
+	assert.NoError(t, os.WriteFile(path.Join(dir, "tool.py.patch"), []byte("tampered"), 0644))
+	_, err = LoadSdkPatchRegistry(dir)
+	assert.Error(t, err)
+}
+
+func TestApplySdkPatch(t *testing.T) {
+	sdkPath := t.TempDir()
+	content := []byte("patched\n")
+	patch := &SdkPatch{
+		Name:    "fix",
+		Target:  "core/module.py",
+		Sha256:  sha256Hex(content),
+		content: content,
+	}
+
+	_, err := patch.apply(sdkPath)
+	assert.Error(t, err)
+
+	// the installed file is hard linked to the shared dependency cache
+	cached := path.Join(sdkPath, "cached.py")
+	assert.NoError(t, os.WriteFile(cached, []byte("original\n"), 0644))
+	assert.NoError(t, os.MkdirAll(path.Join(sdkPath, "core"), 0755))
+	assert.NoError(t, os.Link(cached, path.Join(sdkPath, "core/module.py")))
+
+	written, err := patch.apply(sdkPath)
+	assert.NoError(t, err)
+	assert.True(t, written)
+
+	written, err = patch.apply(sdkPath)
+	assert.NoError(t, err)
+	assert.False(t, written)
+
+	patched, err := os.ReadFile(path.Join(sdkPath, "core/module.py"))
+	assert.NoError(t, err)
+	assert.Equal(t, content, patched)
+
+	original, err := os.ReadFile(cached)
+	assert.NoError(t, err)
+	assert.Equal(t, "original\n", string(original))
+}
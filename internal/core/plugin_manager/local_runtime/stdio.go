@@ -1,14 +1,17 @@
 package local_runtime
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/plugin_errors"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/plugin_log"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
 )
@@ -42,11 +45,27 @@ type stdioHolder struct {
 
 	stdoutBufferSize    int
 	stdoutMaxBufferSize int
+	stdoutMaxFrameSize  int
+
+	// whether length-prefixed framing is offered to the plugin
+	framingEnabled bool
+	// set once the plugin switched to length-prefixed framing
+	framed int32
+
+	// called when the plugin negotiates its protocol version
+	onProtocolNegotiated func(version int)
+
+	// persists log events and stderr of the plugin, nil if disabled
+	logWriter *plugin_log.Writer
 }
 
 type StdioHolderConfig struct {
-	StdoutBufferSize    int
-	StdoutMaxBufferSize int
+	StdoutBufferSize     int
+	StdoutMaxBufferSize  int
+	StdoutMaxFrameSize   int
+	FramingEnabled       bool
+	OnProtocolNegotiated func(version int)
+	LogWriter            *plugin_log.Writer
 }
 
 func newStdioHolder(
@@ -64,6 +83,9 @@ func newStdioHolder(
 	if config.StdoutMaxBufferSize <= 0 {
 		config.StdoutMaxBufferSize = 5 * 1024 * 1024
 	}
+	if config.StdoutMaxFrameSize <= 0 {
+		config.StdoutMaxFrameSize = 64 * 1024 * 1024
+	}
 
 	holder := &stdioHolder{
 		pluginUniqueIdentifier: pluginUniqueIdentifier,
@@ -74,6 +96,10 @@ func newStdioHolder(
 
 		stdoutBufferSize:       config.StdoutBufferSize,
 		stdoutMaxBufferSize:    config.StdoutMaxBufferSize,
+		stdoutMaxFrameSize:     config.StdoutMaxFrameSize,
+		framingEnabled:         config.FramingEnabled,
+		onProtocolNegotiated:   config.OnProtocolNegotiated,
+		logWriter:              config.LogWriter,
 		waitControllerChanLock: &sync.Mutex{},
 		waitingControllerChan:  make(chan bool),
 	}
@@ -102,6 +128,24 @@ func (s *stdioHolder) write(data []byte) error {
 	return err
 }
 
+// writeMessage writes a message to the plugin using the negotiated framing
+func (s *stdioHolder) writeMessage(data []byte) error {
+	if atomic.LoadInt32(&s.framed) == 1 {
+		return s.write(EncodeFrame(FRAME_TYPE_JSON, data))
+	}
+	return s.write(append(data, '\n'))
+}
+
+func (s *stdioHolder) dispatch(sessionID string, data []byte) {
+	// FIX: avoid deadlock to plugin invoke
+	s.l.Lock()
+	listener := s.listener[sessionID]
+	s.l.Unlock()
+	if listener != nil {
+		listener(data)
+	}
+}
+
 func (s *stdioHolder) Error() error {
 	if time.Since(s.lastErrMessageUpdatedAt) < 60*time.Second {
 		if s.errMessage != "" {
@@ -135,47 +179,53 @@ func (s *stdioHolder) StartStdout(notify_heartbeat func()) {
 	s.lastActiveAt = time.Now()
 	defer s.Stop()
 
-	scanner := bufio.NewScanner(s.reader)
-
-	// TODO: set a reasonable buffer size or use a reader, this is a temporary solution
-	scanner.Buffer(make([]byte, s.stdoutBufferSize), s.stdoutMaxBufferSize)
-
-	for scanner.Scan() {
-		data := scanner.Bytes()
-
-		if len(data) == 0 {
-			continue
-		}
-
-		// update the last active time on each time the plugin sends data
-		s.lastActiveAt = time.Now()
-
-		plugin_entities.ParsePluginUniversalEvent(
-			data,
-			"",
-			func(session_id string, data []byte) {
-				// FIX: avoid deadlock to plugin invoke
-				s.l.Lock()
-				listener := s.listener[session_id]
-				s.l.Unlock()
-				if listener != nil {
-					listener(data)
-				}
-			},
-			func() {
-				// notify launched
-				notify_heartbeat()
-			},
-			func(err string) {
-				log.Error("plugin %s: %s", s.pluginUniqueIdentifier, err)
-			},
-			func(message string) {
-				log.Info("plugin %s: %s", s.pluginUniqueIdentifier, message)
-			},
-		)
-	}
-
-	if err := scanner.Err(); err != nil {
+	err := ReadStdioMessages(
+		s.reader,
+		s.stdoutBufferSize,
+		s.stdoutMaxBufferSize,
+		s.stdoutMaxFrameSize,
+		func(data []byte) {
+			// update the last active time on each time the plugin sends data
+			s.lastActiveAt = time.Now()
+
+			plugin_entities.ParsePluginUniversalEvent(
+				data,
+				"",
+				s.dispatch,
+				func() {
+					// notify launched
+					notify_heartbeat()
+				},
+				func(protocol plugin_entities.PluginProtocolEvent) {
+					if s.framingEnabled && protocol.Framing == STDIO_FRAMING_LENGTH_PREFIXED {
+						atomic.StoreInt32(&s.framed, 1)
+					}
+					if s.onProtocolNegotiated != nil {
+						s.onProtocolNegotiated(protocol.Version)
+					}
+				},
+				func(err string) {
+					log.Error("plugin %s: %s", s.pluginUniqueIdentifier, err)
+					s.logWriter.Log(plugin_log.SOURCE_STDOUT, plugin_log.LEVEL_ERROR, "", err)
+				},
+				func(sessionId string, logEvent plugin_entities.PluginLogEvent) {
+					log.Info("plugin %s: %s", s.pluginUniqueIdentifier, logEvent.Message)
+					s.logWriter.Log(plugin_log.SOURCE_STDOUT, logEvent.Level, sessionId, logEvent.Message)
+				},
+			)
+		},
+		func(data []byte) {
+			s.lastActiveAt = time.Now()
+
+			sessionID, message, err := DecodeBinaryFrame(data)
+			if err != nil {
+				log.Error("plugin %s sent an invalid binary frame: %s", s.pluginUniqueIdentifier, err)
+				return
+			}
+			s.dispatch(sessionID, message)
+		},
+	)
+	if err != nil {
 		log.Error("plugin %s has an error on stdout: %s", s.pluginUniqueIdentifier, err)
 	}
 }
@@ -203,6 +253,23 @@ func (s *stdioHolder) WriteError(msg string) {
 // StartStderr starts to read the stderr of the plugin
 // it will write the error message to the stdio holder
 func (s *stdioHolder) StartStderr() {
+	// the log file gets a line per entry, partial lines are kept until the rest arrives
+	pending := []byte{}
+	writeLines := func(eof bool) {
+		for {
+			i := bytes.IndexByte(pending, '\n')
+			if i < 0 {
+				if (eof || len(pending) >= MAX_ERR_MSG_LEN) && len(pending) > 0 {
+					s.logWriter.Log(plugin_log.SOURCE_STDERR, plugin_log.LEVEL_ERROR, "", string(pending))
+					pending = pending[:0]
+				}
+				return
+			}
+			s.logWriter.Log(plugin_log.SOURCE_STDERR, plugin_log.LEVEL_ERROR, "", strings.TrimRight(string(pending[:i]), "\r"))
+			pending = pending[i+1:]
+		}
+	}
+
 	for {
 		buf := make([]byte, 1024)
 		n, err := s.errReader.Read(buf)
@@ -210,13 +277,18 @@ func (s *stdioHolder) StartStderr() {
 			break
 		} else if err != nil {
 			s.WriteError(fmt.Sprintf("%s\n", buf[:n]))
+			pending = append(pending, buf[:n]...)
 			break
 		}
 
 		if n > 0 {
 			s.WriteError(fmt.Sprintf("%s\n", buf[:n]))
+			pending = append(pending, buf[:n]...)
+			writeLines(false)
 		}
 	}
+
+	writeLines(true)
 }
 
 // Wait waits for the plugin to exit
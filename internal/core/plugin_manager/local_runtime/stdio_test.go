@@ -10,6 +10,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/plugin_errors"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/plugin_log"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
 	"github.com/stretchr/testify/assert"
@@ -232,6 +233,36 @@ func TestStdioHolderStartStderr(t *testing.T) {
 	assert.Contains(t, holder.errMessage, "stderr message")
 }
 
+// TestStdioHolderStderrLogs tests that stderr is written to the plugin log line by line
+func TestStdioHolderStderrLogs(t *testing.T) {
+	store := plugin_log.NewStore(plugin_log.Config{Root: t.TempDir()})
+	writer, err := store.Writer("test-plugin")
+	assert.NoError(t, err)
+
+	stderr := newMockReadWriteCloser()
+	holder := newStdioHolder("test-plugin", nil, nil, stderr, &StdioHolderConfig{LogWriter: writer})
+
+	stderr.WriteToRead([]byte("Traceback (most recent call last):\n  File \"main.py\"\nValueError"))
+
+	done := make(chan bool)
+	go func() {
+		holder.StartStderr()
+		done <- true
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	stderr.Close()
+	<-done
+
+	entries, err := store.Tail("test-plugin", 10, plugin_log.Filter{})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, "Traceback (most recent call last):", entries[0].Message)
+		assert.Equal(t, "ValueError", entries[2].Message)
+		assert.Equal(t, plugin_log.SOURCE_STDERR, entries[2].Source)
+	}
+}
+
 // TestStdioHolderWait tests the Wait method
 func TestStdioHolderWait(t *testing.T) {
 	stdin := newMockReadWriteCloser()
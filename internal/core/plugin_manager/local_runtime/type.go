@@ -2,8 +2,11 @@ package local_runtime
 
 import (
 	"sync"
+	"time"
 
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/basic_runtime"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/dependency_cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/plugin_log"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
 )
 
@@ -27,11 +30,42 @@ type LocalPluginRuntime struct {
 	defaultPythonInterpreterPath string
 	uvPath                       string
 
+	// python version used when the plugin manifest doesn't declare one
+	defaultPythonVersion string
+	// interpreters provided by the operator, mapping python version to interpreter path
+	// versions not listed here are resolved through uv managed interpreters
+	pythonInterpreters map[string]string
+
+	// patches applied to legacy plugin sdk versions, the embedded ones are used if nil
+	sdkPatches *SdkPatchRegistry
+
+	// shared uv cache, nil if the venvs use the default cache of uv
+	dependencyCache *dependency_cache.Cache
+
+	// node executable and package managers used by nodejs plugins
+	nodeExecutablePath string
+	npmPath            string
+	pnpmPath           string
+	npmRegistryUrl     string
+	// timeout of installing node dependencies in seconds
+	nodeEnvInitTimeout int
+
 	pipMirrorUrl    string
 	pipPreferBinary bool
 	pipVerbose      bool
 	pipExtraArgs    string
 
+	// resolves the variables managed by the admin api, injected on every start
+	environment func() ([]string, error)
+
+	// persists the logs of the plugin, nil if disabled
+	logWriter *plugin_log.Writer
+
+	// ping/pong health probes, disabled if the interval is 0
+	healthProbeInterval    time.Duration
+	healthProbeTimeout     time.Duration
+	healthProbeMaxFailures int
+
 	// proxy settings
 	HttpProxy  string
 	HttpsProxy string
@@ -43,42 +77,89 @@ type LocalPluginRuntime struct {
 
 	stdoutBufferSize    int
 	stdoutMaxBufferSize int
+	stdoutMaxFrameSize  int
+
+	// whether length-prefixed framing of the stdio protocol is offered to the plugin
+	stdioFramingEnabled bool
 
 	isNotFirstStart bool
 
 	stdioHolder *stdioHolder
+
+	// on-demand launching, the plugin process is started on the first dispatch
+	// and stopped again after being idle for idleTimeout
+	onDemand    bool
+	idleTimeout time.Duration
+	hibernation hibernation
 }
 
 type LocalPluginRuntimeConfig struct {
 	PythonInterpreterPath     string
+	PythonInterpreters        map[string]string
+	DefaultPythonVersion      string
 	UvPath                    string
+	DependencyCache           *dependency_cache.Cache
+	SdkPatches                *SdkPatchRegistry
 	PythonEnvInitTimeout      int
 	PythonCompileAllExtraArgs string
 	HttpProxy                 string
 	HttpsProxy                string
 	NoProxy                   string
+	NodeExecutablePath        string
+	NpmPath                   string
+	PnpmPath                  string
+	NpmRegistryUrl            string
+	NodeEnvInitTimeout        int
 	PipMirrorUrl              string
 	PipPreferBinary           bool
 	PipVerbose                bool
 	PipExtraArgs              string
 	StdoutBufferSize          int
 	StdoutMaxBufferSize       int
+	StdoutMaxFrameSize        int
+	StdioFramingEnabled       bool
+	Environment               func() ([]string, error)
+	LogWriter                 *plugin_log.Writer
+	HealthProbeInterval       time.Duration
+	HealthProbeTimeout        time.Duration
+	HealthProbeMaxFailures    int
+	OnDemand                  bool
+	IdleTimeout               time.Duration
 }
 
 func NewLocalPluginRuntime(config LocalPluginRuntimeConfig) *LocalPluginRuntime {
 	return &LocalPluginRuntime{
 		defaultPythonInterpreterPath: config.PythonInterpreterPath,
 		uvPath:                       config.UvPath,
+		dependencyCache:              config.DependencyCache,
+		sdkPatches:                   config.SdkPatches,
+		defaultPythonVersion:         config.DefaultPythonVersion,
+		pythonInterpreters:           config.PythonInterpreters,
 		pythonEnvInitTimeout:         config.PythonEnvInitTimeout,
 		pythonCompileAllExtraArgs:    config.PythonCompileAllExtraArgs,
 		HttpProxy:                    config.HttpProxy,
 		HttpsProxy:                   config.HttpsProxy,
 		NoProxy:                      config.NoProxy,
+		nodeExecutablePath:           config.NodeExecutablePath,
+		npmPath:                      config.NpmPath,
+		pnpmPath:                     config.PnpmPath,
+		npmRegistryUrl:               config.NpmRegistryUrl,
+		nodeEnvInitTimeout:           config.NodeEnvInitTimeout,
 		pipMirrorUrl:                 config.PipMirrorUrl,
 		pipPreferBinary:              config.PipPreferBinary,
 		pipVerbose:                   config.PipVerbose,
 		pipExtraArgs:                 config.PipExtraArgs,
 		stdoutBufferSize:             config.StdoutBufferSize,
 		stdoutMaxBufferSize:          config.StdoutMaxBufferSize,
+		stdoutMaxFrameSize:           config.StdoutMaxFrameSize,
+		stdioFramingEnabled:          config.StdioFramingEnabled,
+		environment:                  config.Environment,
+		logWriter:                    config.LogWriter,
+		healthProbeInterval:          config.HealthProbeInterval,
+		healthProbeTimeout:           config.HealthProbeTimeout,
+		healthProbeMaxFailures:       config.HealthProbeMaxFailures,
+		onDemand:                     config.OnDemand,
+		idleTimeout:                  config.IdleTimeout,
+		hibernation:                  newHibernation(),
 	}
 }
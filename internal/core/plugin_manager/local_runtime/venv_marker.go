@@ -0,0 +1,68 @@
+package local_runtime
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+)
+
+const (
+	VENV_MARKER_PATH = ".venv/dify/plugin.json"
+)
+
+// venvMarker is written into the virtual environment once it's fully initialized
+// a venv without the marker or with an outdated marker is rebuilt
+type venvMarker struct {
+	Timestamp int64 `json:"timestamp"`
+	// python version required by the plugin, e.g. 3.12
+	PythonVersion string `json:"python_version,omitempty"`
+	// the full version of the interpreter the venv was created with, e.g. 3.12.7
+	PythonInterpreter string `json:"python_interpreter,omitempty"`
+	// sdk patches in effect
+	Patches []venvMarkerPatch `json:"patches,omitempty"`
+}
+
+type venvMarkerPatch struct {
+	Name   string `json:"name"`
+	Sha256 string `json:"sha256"`
+}
+
+func sameVenvMarkerPatches(a []venvMarkerPatch, b []venvMarkerPatch) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func readVenvMarker(workingPath string) (*venvMarker, error) {
+	data, err := os.ReadFile(path.Join(workingPath, VENV_MARKER_PATH))
+	if err != nil {
+		return nil, err
+	}
+
+	marker := &venvMarker{}
+	if err := json.Unmarshal(data, marker); err != nil {
+		return nil, err
+	}
+
+	return marker, nil
+}
+
+func writeVenvMarker(workingPath string, marker *venvMarker) error {
+	markerPath := path.Join(workingPath, VENV_MARKER_PATH)
+	if err := os.MkdirAll(path.Dir(markerPath), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(markerPath, data, 0644)
+}
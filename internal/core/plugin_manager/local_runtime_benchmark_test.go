@@ -1,6 +1,8 @@
 package plugin_manager_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -18,6 +20,7 @@ import (
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/local_runtime"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/test_utils"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/model_entities"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
@@ -199,3 +202,95 @@ func BenchmarkLocalOpenAILLMInvocation(b *testing.B) {
 
 	wg.Wait()
 }
+
+const _blobChunkSize = 1024 * 1024
+
+func blobChunkMessage(blob []byte) map[string]any {
+	return map[string]any{
+		"type": "blob_chunk",
+		"message": map[string]any{
+			"id":           "blob",
+			"sequence":     0,
+			"total_length": len(blob),
+			"blob":         blob,
+			"end":          false,
+		},
+	}
+}
+
+// BenchmarkStdioNewlineJSONBlob decodes blob chunks sent as newline-delimited JSON
+func BenchmarkStdioNewlineJSONBlob(b *testing.B) {
+	blob := bytes.Repeat([]byte{0x1f, 0xff, 0x00, 0x7f}, _blobChunkSize/4)
+	line, _ := json.Marshal(map[string]any{
+		"session_id": "session",
+		"event":      plugin_entities.PLUGIN_EVENT_SESSION,
+		"data": map[string]any{
+			"type": plugin_entities.SESSION_MESSAGE_TYPE_STREAM,
+			"data": blobChunkMessage(blob),
+		},
+	})
+	line = append(line, '\n')
+
+	b.SetBytes(int64(len(blob)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := local_runtime.ReadStdioMessages(
+			bytes.NewReader(line), 1024, 5*_blobChunkSize, 5*_blobChunkSize,
+			func(data []byte) {
+				plugin_entities.ParsePluginUniversalEvent(
+					data, "",
+					func(sessionId string, data []byte) {
+						if _, err := parser.UnmarshalJsonBytes[plugin_entities.SessionMessage](data); err != nil {
+							b.Fatal(err)
+						}
+					},
+					func() {},
+					func(plugin_entities.PluginProtocolEvent) {},
+					func(err string) { b.Fatal(err) },
+					func(string, plugin_entities.PluginLogEvent) {},
+				)
+			},
+			func([]byte) {},
+		)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkStdioFramedBlob decodes the same blob chunks sent as length-prefixed binary frames
+func BenchmarkStdioFramedBlob(b *testing.B) {
+	blob := bytes.Repeat([]byte{0x1f, 0xff, 0x00, 0x7f}, _blobChunkSize/4)
+	message := blobChunkMessage(nil)
+	delete(message["message"].(map[string]any), "blob")
+	meta, _ := json.Marshal(message)
+	frame, err := local_runtime.EncodeBinaryFrame("session", local_runtime.BinaryFrameMeta{
+		Type:       string(plugin_entities.SESSION_MESSAGE_TYPE_STREAM),
+		Data:       meta,
+		BinaryPath: []string{"message", "blob"},
+	}, blob)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(blob)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := local_runtime.ReadStdioMessages(
+			bytes.NewReader(frame), 1024, 5*_blobChunkSize, 5*_blobChunkSize,
+			func(data []byte) {},
+			func(data []byte) {
+				_, message, err := local_runtime.DecodeBinaryFrame(data)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := parser.UnmarshalJsonBytes[plugin_entities.SessionMessage](message); err != nil {
+					b.Fatal(err)
+				}
+			},
+		)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
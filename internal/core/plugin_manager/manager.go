@@ -5,13 +5,22 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/langgenius/dify-cloud-kit/oss"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/dify_invocation"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/dify_invocation/real"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/concurrency_limiter"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/debugging_runtime"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/dependency_cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/kubernetes_platform"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/local_runtime"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/media_transport"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/plugin_log"
 	serverless "github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/serverless_connector"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/serverless_lifecycle"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/working_path_gc"
 	"github.com/langgenius/dify-plugin-daemon/internal/db"
 	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
 	"github.com/langgenius/dify-plugin-daemon/internal/types/models"
@@ -53,6 +62,30 @@ type PluginManager struct {
 
 	// max launching lock to prevent too many plugins launching at the same time
 	maxLaunchingLock chan bool
+
+	// concurrencyLimiter limits concurrent sessions per plugin and per tenant
+	concurrencyLimiter *concurrency_limiter.Limiter
+
+	// dependencyCache is the uv cache shared by local plugins, nil if disabled
+	dependencyCache *dependency_cache.Cache
+
+	// sdkPatches are applied to legacy plugin sdk versions of local plugins
+	sdkPatches *local_runtime.SdkPatchRegistry
+
+	// workingPathGC removes working directories left behind by upgrades and uninstalls
+	workingPathGC *working_path_gc.Collector
+
+	// pluginLogs persists the logs of local plugins running on this node, nil if disabled
+	pluginLogs *plugin_log.Store
+
+	// drainingRuntimes holds the local runtimes waiting for their in-flight sessions before being stopped
+	drainingRuntimes sync.Map
+
+	// kubernetes runs plugins as deployments, nil unless the platform is kubernetes
+	kubernetes *kubernetes_platform.Platform
+
+	// serverlessLifecycle manages functions of the serverless platform, nil unless the platform is serverless
+	serverlessLifecycle *serverless_lifecycle.Manager
 }
 
 var (
@@ -78,6 +111,15 @@ func InitGlobalManager(oss oss.OSS, configuration *app.Config) *PluginManager {
 		// By default, we allow up to configuration.PluginLocalLaunchingConcurrent plugins to be launched concurrently; if not configured, the default is 2.
 		maxLaunchingLock: make(chan bool, configuration.PluginLocalLaunchingConcurrent),
 		config:           configuration,
+		concurrencyLimiter: concurrency_limiter.NewLimiter(
+			concurrency_limiter.Limits{
+				PerPlugin:       configuration.PluginMaxConcurrentSessionsPerPlugin,
+				PerTenant:       configuration.PluginMaxConcurrentSessionsPerTenant,
+				PerTenantPlugin: configuration.PluginMaxConcurrentSessionsPerTenantPlugin,
+			},
+			time.Duration(configuration.PluginConcurrencyWaitTimeout)*time.Second,
+			configuration.PluginConcurrencyLimitFailOpen,
+		),
 	}
 
 	return manager
@@ -170,12 +212,27 @@ func (p *PluginManager) Launch(configuration *app.Config) {
 
 	// start local watcher
 	if configuration.Platform == app.PLATFORM_LOCAL {
+		p.initDependencyCache(configuration)
+		p.initSdkPatches(configuration)
+		p.startWorkingPathGC(configuration)
+		p.startPluginLogs(configuration)
+		p.startPluginEnvironmentWatcher()
 		p.startLocalWatcher(configuration)
 	}
 
 	// launch serverless connector
 	if configuration.Platform == app.PLATFORM_SERVERLESS {
 		serverless.Init(configuration)
+		p.startServerlessLifecycle(configuration)
+	}
+
+	// connect to the kubernetes cluster
+	if configuration.Platform == app.PLATFORM_KUBERNETES {
+		client, err := kubernetes_platform.NewClient(configuration.KubernetesKubeconfig)
+		if err != nil {
+			log.Panic("init kubernetes client failed: %s", err.Error())
+		}
+		p.kubernetes = kubernetes_platform.NewPlatform(client, configuration)
 	}
 
 	// start remote watcher
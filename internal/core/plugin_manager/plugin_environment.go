@@ -0,0 +1,380 @@
+package plugin_manager
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/local_runtime"
+	"github.com/langgenius/dify-plugin-daemon/internal/db"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/models"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/encryption"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"gorm.io/gorm"
+)
+
+const (
+	// notifies all nodes to restart the local plugins whose environment changed
+	PLUGIN_ENVIRONMENT_CHANGED_CHANNEL = "plugin_environment_changed"
+)
+
+var (
+	pluginEnvironmentVariableNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,254}$`)
+
+	// variables set by the daemon itself, overriding them breaks the plugin process
+	reservedPluginEnvironmentVariables = map[string]bool{
+		"INSTALL_METHOD":                true,
+		"PATH":                          true,
+		local_runtime.STDIO_FRAMING_ENV: true,
+	}
+
+	ErrInvalidPluginEnvironmentVariable = errors.New("invalid plugin environment variable")
+	ErrPluginEnvironmentKeyMissing      = errors.New("PLUGIN_ENVIRONMENT_ENCRYPTION_KEY is required to store secrets")
+)
+
+// PluginEnvironmentVariable is a variable to be set for a plugin
+type PluginEnvironmentVariable struct {
+	Name   string `json:"name" validate:"required"`
+	Value  string `json:"value"`
+	Secret bool   `json:"secret"`
+}
+
+// PluginEnvironmentVariableView is a stored variable, values of secrets are never exposed
+type PluginEnvironmentVariableView struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	Secret    bool      `json:"secret"`
+	Value     *string   `json:"value,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type pluginEnvironmentChangedEvent struct {
+	PluginID string `json:"plugin_id"`
+	Version  string `json:"version"`
+}
+
+func validatePluginEnvironmentVariableName(name string) error {
+	if !pluginEnvironmentVariableNameRegex.MatchString(name) {
+		return errors.Join(ErrInvalidPluginEnvironmentVariable, fmt.Errorf("invalid name: %q", name))
+	}
+	if reservedPluginEnvironmentVariables[name] {
+		return errors.Join(ErrInvalidPluginEnvironmentVariable, fmt.Errorf("%s is reserved by the daemon", name))
+	}
+	return nil
+}
+
+func pluginEnvironmentKey(config *app.Config) []byte {
+	key := sha256.Sum256([]byte(config.PluginEnvironmentEncryptionKey))
+	return key[:]
+}
+
+// pluginEnvironmentKeyID identifies the key a secret was encrypted with, without revealing the key
+func pluginEnvironmentKeyID(config *app.Config) string {
+	id := sha256.Sum256(pluginEnvironmentKey(config))
+	return hex.EncodeToString(id[:8])
+}
+
+func encryptPluginEnvironmentValue(config *app.Config, value string) (string, error) {
+	if config.PluginEnvironmentEncryptionKey == "" {
+		return "", ErrPluginEnvironmentKeyMissing
+	}
+	encrypted, err := encryption.AESEncrypt(pluginEnvironmentKey(config), []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// decryptPluginEnvironmentValue fails if the secret was encrypted with another key than the current one
+func decryptPluginEnvironmentValue(config *app.Config, variable *models.PluginEnvironmentVariable) (string, error) {
+	if config.PluginEnvironmentEncryptionKey == "" {
+		return "", ErrPluginEnvironmentKeyMissing
+	}
+	if keyID := pluginEnvironmentKeyID(config); variable.KeyID != "" && variable.KeyID != keyID {
+		return "", fmt.Errorf(
+			"encrypted with key %s but PLUGIN_ENVIRONMENT_ENCRYPTION_KEY is key %s, restore the key or set the secret again",
+			variable.KeyID, keyID,
+		)
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(variable.Value)
+	if err != nil {
+		return "", err
+	}
+	decrypted, err := encryption.AESDecrypt(pluginEnvironmentKey(config), encrypted)
+	if err != nil {
+		return "", err
+	}
+	return string(decrypted), nil
+}
+
+// ListPluginEnvironment lists the variables of all versions of a plugin
+func (p *PluginManager) ListPluginEnvironment(pluginID string) ([]PluginEnvironmentVariableView, error) {
+	variables, err := db.GetAll[models.PluginEnvironmentVariable](
+		db.Equal("plugin_id", pluginID),
+		db.OrderBy("version", false),
+		db.OrderBy("name", false),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pluginEnvironmentViews(variables), nil
+}
+
+// pluginEnvironmentViews hides the values of secrets
+func pluginEnvironmentViews(variables []models.PluginEnvironmentVariable) []PluginEnvironmentVariableView {
+	views := make([]PluginEnvironmentVariableView, 0, len(variables))
+	for _, variable := range variables {
+		view := PluginEnvironmentVariableView{
+			Name:      variable.Name,
+			Version:   variable.Version,
+			Secret:    variable.Secret,
+			UpdatedAt: variable.UpdatedAt,
+		}
+		if !variable.Secret {
+			value := variable.Value
+			view.Value = &value
+		}
+		views = append(views, view)
+	}
+
+	return views
+}
+
+// SetPluginEnvironment creates or updates variables of a plugin, an empty version applies
+// to all versions, running processes of the plugin are restarted if anything changed
+func (p *PluginManager) SetPluginEnvironment(
+	pluginID string,
+	version string,
+	variables []PluginEnvironmentVariable,
+) error {
+	for _, variable := range variables {
+		if err := validatePluginEnvironmentVariableName(variable.Name); err != nil {
+			return err
+		}
+	}
+
+	changed := false
+	err := db.WithTransaction(func(tx *gorm.DB) error {
+		for _, variable := range variables {
+			value := variable.Value
+			keyID := ""
+			if variable.Secret {
+				encrypted, err := encryptPluginEnvironmentValue(p.config, value)
+				if err != nil {
+					return err
+				}
+				value = encrypted
+				keyID = pluginEnvironmentKeyID(p.config)
+			}
+
+			existing, err := db.GetOne[models.PluginEnvironmentVariable](
+				db.WithTransactionContext(tx),
+				db.Equal("plugin_id", pluginID),
+				db.Equal("version", version),
+				db.Equal("name", variable.Name),
+				db.WLock(),
+			)
+			if err == db.ErrDatabaseNotFound {
+				changed = true
+				if err := db.Create(&models.PluginEnvironmentVariable{
+					PluginID: pluginID,
+					Version:  version,
+					Name:     variable.Name,
+					Value:    value,
+					Secret:   variable.Secret,
+					KeyID:    keyID,
+				}, tx); err != nil {
+					return err
+				}
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			if existing.Secret == variable.Secret && p.samePluginEnvironmentValue(&existing, variable.Value) {
+				continue
+			}
+
+			changed = true
+			existing.Value = value
+			existing.Secret = variable.Secret
+			existing.KeyID = keyID
+			if err := db.Update(&existing, tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		p.notifyPluginEnvironmentChanged(pluginID, version)
+	}
+
+	return nil
+}
+
+func (p *PluginManager) samePluginEnvironmentValue(variable *models.PluginEnvironmentVariable, value string) bool {
+	if !variable.Secret {
+		return variable.Value == value
+	}
+	decrypted, err := decryptPluginEnvironmentValue(p.config, variable)
+	return err == nil && decrypted == value
+}
+
+// DeletePluginEnvironment deletes variables of a plugin, running processes of the plugin are restarted
+func (p *PluginManager) DeletePluginEnvironment(pluginID string, version string, names []string) error {
+	deleted := false
+	err := db.WithTransaction(func(tx *gorm.DB) error {
+		for _, name := range names {
+			variable, err := db.GetOne[models.PluginEnvironmentVariable](
+				db.WithTransactionContext(tx),
+				db.Equal("plugin_id", pluginID),
+				db.Equal("version", version),
+				db.Equal("name", name),
+			)
+			if err == db.ErrDatabaseNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			if err := db.Delete(&variable, tx); err != nil {
+				return err
+			}
+			deleted = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		p.notifyPluginEnvironmentChanged(pluginID, version)
+	}
+
+	return nil
+}
+
+// pluginEnvironment resolves the variables injected into the process of a plugin,
+// in the form of `NAME=value`
+func (p *PluginManager) pluginEnvironment(identity plugin_entities.PluginUniqueIdentifier) ([]string, error) {
+	variables, err := db.GetAll[models.PluginEnvironmentVariable](
+		db.Equal("plugin_id", identity.PluginID()),
+		db.InArray("version", []any{"", identity.Version().String()}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolvePluginEnvironment(p.config, variables)
+}
+
+// resolvePluginEnvironment decrypts secrets and picks the variables of the specific version
+// over the ones of all versions, the result is sorted by name
+func resolvePluginEnvironment(config *app.Config, variables []models.PluginEnvironmentVariable) ([]string, error) {
+	values := map[string]string{}
+	versioned := map[string]bool{}
+	for _, variable := range variables {
+		// variables of the specific version take precedence
+		if versioned[variable.Name] {
+			continue
+		}
+
+		value := variable.Value
+		if variable.Secret {
+			decrypted, err := decryptPluginEnvironmentValue(config, &variable)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s: %s", variable.Name, err)
+			}
+			value = decrypted
+		}
+
+		values[variable.Name] = value
+		versioned[variable.Name] = variable.Version != ""
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := make([]string, 0, len(names))
+	for _, name := range names {
+		env = append(env, name+"="+values[name])
+	}
+
+	return env, nil
+}
+
+func (p *PluginManager) pluginEnvironmentResolver(identity plugin_entities.PluginUniqueIdentifier) func() ([]string, error) {
+	return func() ([]string, error) {
+		return p.pluginEnvironment(identity)
+	}
+}
+
+func (p *PluginManager) notifyPluginEnvironmentChanged(pluginID string, version string) {
+	event := pluginEnvironmentChangedEvent{PluginID: pluginID, Version: version}
+	if err := cache.Publish(PLUGIN_ENVIRONMENT_CHANGED_CHANNEL, event); err != nil {
+		// at least the plugins of this node pick up the change
+		log.Error("failed to notify the environment change of %s: %s", pluginID, err)
+		p.restartLocalPlugins(pluginID, version)
+	}
+}
+
+// startPluginEnvironmentWatcher restarts the local plugins of this node once their environment changed
+func (p *PluginManager) startPluginEnvironmentWatcher() {
+	routine.Submit(map[string]string{
+		"module":   "plugin_manager",
+		"function": "startPluginEnvironmentWatcher",
+	}, func() {
+		events, cancel := cache.Subscribe[pluginEnvironmentChangedEvent](PLUGIN_ENVIRONMENT_CHANGED_CHANNEL)
+		defer cancel()
+
+		for event := range events {
+			p.restartLocalPlugins(event.PluginID, event.Version)
+		}
+	})
+}
+
+// restartableRuntime is implemented by runtimes whose process is started by the daemon, e.g. local plugins
+type restartableRuntime interface {
+	plugin_entities.PluginLifetime
+	Restart()
+}
+
+func (p *PluginManager) restartLocalPlugins(pluginID string, version string) {
+	p.m.Range(func(key string, lifetime plugin_entities.PluginLifetime) bool {
+		runtime, ok := lifetime.(restartableRuntime)
+		if !ok {
+			return true
+		}
+
+		identity, err := runtime.Identity()
+		if err != nil || identity.PluginID() != pluginID {
+			return true
+		}
+		if version != "" && identity.Version().String() != version {
+			return true
+		}
+
+		log.Info("environment of %s changed, restarting", identity)
+		runtime.Restart()
+		return true
+	})
+}
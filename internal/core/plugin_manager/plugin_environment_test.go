@@ -0,0 +1,188 @@
+package plugin_manager
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/models"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePluginEnvironmentVariableName(t *testing.T) {
+	for _, name := range []string{"OPENAI_API_KEY", "_private", "a1"} {
+		assert.NoError(t, validatePluginEnvironmentVariableName(name), name)
+	}
+
+	for _, name := range []string{"", "1ABC", "A-B", "A=B", "PATH", "INSTALL_METHOD"} {
+		err := validatePluginEnvironmentVariableName(name)
+		assert.True(t, errors.Is(err, ErrInvalidPluginEnvironmentVariable), name)
+	}
+}
+
+func TestPluginEnvironmentValueEncryption(t *testing.T) {
+	config := &app.Config{PluginEnvironmentEncryptionKey: "key"}
+
+	encrypted, err := encryptPluginEnvironmentValue(config, "secret")
+	assert.NoError(t, err)
+	assert.NotContains(t, encrypted, "secret")
+
+	variable := &models.PluginEnvironmentVariable{Value: encrypted, Secret: true}
+	decrypted, err := decryptPluginEnvironmentValue(config, variable)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", decrypted)
+
+	// values can't be read with another key
+	_, err = decryptPluginEnvironmentValue(&app.Config{PluginEnvironmentEncryptionKey: "another"}, variable)
+	assert.Error(t, err)
+}
+
+func TestPluginEnvironmentRequiresDedicatedKey(t *testing.T) {
+	// SERVER_KEY is not used to encrypt secrets, rotating it must not lose them
+	config := &app.Config{ServerKey: "server-key"}
+	_, err := encryptPluginEnvironmentValue(config, "secret")
+	assert.ErrorIs(t, err, ErrPluginEnvironmentKeyMissing)
+	_, err = decryptPluginEnvironmentValue(config, &models.PluginEnvironmentVariable{Value: "c2VjcmV0", Secret: true})
+	assert.ErrorIs(t, err, ErrPluginEnvironmentKeyMissing)
+}
+
+func TestPluginEnvironmentDetectsRotatedKey(t *testing.T) {
+	config := &app.Config{PluginEnvironmentEncryptionKey: "key"}
+	encrypted, err := encryptPluginEnvironmentValue(config, "secret")
+	assert.NoError(t, err)
+	variable := &models.PluginEnvironmentVariable{Value: encrypted, Secret: true, KeyID: pluginEnvironmentKeyID(config)}
+
+	rotated := &app.Config{PluginEnvironmentEncryptionKey: "rotated"}
+	assert.NotEqual(t, pluginEnvironmentKeyID(config), pluginEnvironmentKeyID(rotated))
+	_, err = decryptPluginEnvironmentValue(rotated, variable)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), variable.KeyID)
+	}
+
+	decrypted, err := decryptPluginEnvironmentValue(config, variable)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", decrypted)
+}
+
+func TestResolvePluginEnvironmentPrecedence(t *testing.T) {
+	config := &app.Config{PluginEnvironmentEncryptionKey: "key"}
+	secret, err := encryptPluginEnvironmentValue(config, "sk-versioned")
+	assert.NoError(t, err)
+
+	variables := []models.PluginEnvironmentVariable{
+		{Name: "API_KEY", Value: "sk-all-versions"},
+		{Name: "API_KEY", Version: "0.0.1", Value: secret, Secret: true, KeyID: pluginEnvironmentKeyID(config)},
+		{Name: "REGION", Version: "0.0.1", Value: "us"},
+		// the variable of the version wins regardless of the order
+		{Name: "REGION", Value: "eu"},
+		{Name: "DEBUG", Value: "true"},
+	}
+
+	env, err := resolvePluginEnvironment(config, variables)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"API_KEY=sk-versioned", "DEBUG=true", "REGION=us"}, env)
+
+	// secrets encrypted with another key are not injected as ciphertext
+	_, err = resolvePluginEnvironment(&app.Config{PluginEnvironmentEncryptionKey: "another"}, variables)
+	assert.Error(t, err)
+}
+
+func TestPluginEnvironmentViewsHideSecrets(t *testing.T) {
+	config := &app.Config{PluginEnvironmentEncryptionKey: "key"}
+	secret, err := encryptPluginEnvironmentValue(config, "sk-secret")
+	assert.NoError(t, err)
+
+	views := pluginEnvironmentViews([]models.PluginEnvironmentVariable{
+		{Name: "API_KEY", Value: secret, Secret: true},
+		{Name: "REGION", Value: "us"},
+	})
+
+	if assert.Len(t, views, 2) {
+		assert.True(t, views[0].Secret)
+		assert.Nil(t, views[0].Value)
+		assert.Equal(t, "us", *views[1].Value)
+	}
+	for _, view := range views {
+		if view.Value != nil {
+			assert.NotContains(t, *view.Value, "sk-secret")
+			assert.NotEqual(t, secret, *view.Value)
+		}
+	}
+}
+
+// pubSubCache delivers published messages to the subscribers of this process
+type pubSubCache struct {
+	cache.Client
+
+	subscribers chan string
+}
+
+func (c *pubSubCache) Publish(channel string, message string) error {
+	if channel == PLUGIN_ENVIRONMENT_CHANGED_CHANNEL {
+		c.subscribers <- message
+	}
+	return nil
+}
+
+func (c *pubSubCache) Subscribe(channel string) (<-chan string, func()) {
+	return c.subscribers, func() {}
+}
+
+type restartableFakeRuntime struct {
+	plugin_entities.PluginLifetime
+
+	identity plugin_entities.PluginUniqueIdentifier
+	restarts int32
+}
+
+func (r *restartableFakeRuntime) Identity() (plugin_entities.PluginUniqueIdentifier, error) {
+	return r.identity, nil
+}
+
+func (r *restartableFakeRuntime) Restart() {
+	atomic.AddInt32(&r.restarts, 1)
+}
+
+func TestPluginEnvironmentChangeRestartsRuntime(t *testing.T) {
+	routine.InitPool(1024)
+	cache.SetClient(&pubSubCache{subscribers: make(chan string, 8)})
+	defer cache.SetClient(nil)
+
+	identity := func(version string) plugin_entities.PluginUniqueIdentifier {
+		return plugin_entities.PluginUniqueIdentifier(
+			"langgenius/openai:" + version + "@" + strings.Repeat("0", 64),
+		)
+	}
+
+	manager := &PluginManager{config: &app.Config{}}
+	affected := &restartableFakeRuntime{identity: identity("0.0.1")}
+	otherVersion := &restartableFakeRuntime{identity: identity("0.0.2")}
+	manager.m.Store(affected.identity.String(), affected)
+	manager.m.Store(otherVersion.identity.String(), otherVersion)
+
+	manager.startPluginEnvironmentWatcher()
+
+	// variables of a specific version only restart the runtime of the version
+	manager.notifyPluginEnvironmentChanged("langgenius/openai", "0.0.1")
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&affected.restarts) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&otherVersion.restarts))
+
+	// variables of all versions restart every version
+	manager.notifyPluginEnvironmentChanged("langgenius/openai", "")
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&affected.restarts) == 2 && atomic.LoadInt32(&otherVersion.restarts) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// other plugins are not touched
+	manager.notifyPluginEnvironmentChanged("langgenius/anthropic", "")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&affected.restarts))
+}
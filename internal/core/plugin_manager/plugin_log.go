@@ -0,0 +1,84 @@
+package plugin_manager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/plugin_log"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+const (
+	PLUGIN_LOG_CLEANUP_INTERVAL = 10 * time.Minute
+)
+
+var ErrPluginLogsDisabled = errors.New("plugin logs are disabled or not available on this platform")
+
+func (p *PluginManager) startPluginLogs(config *app.Config) {
+	if config.PluginLogEnabled == nil || !*config.PluginLogEnabled {
+		return
+	}
+
+	p.pluginLogs = plugin_log.NewStore(plugin_log.Config{
+		Root:           config.PluginLogPath,
+		MaxSize:        config.PluginLogMaxSize,
+		RotateInterval: time.Duration(config.PluginLogRotateInterval) * time.Second,
+		MaxBackups:     config.PluginLogMaxBackups,
+		MaxAge:         time.Duration(config.PluginLogMaxAge) * time.Second,
+	})
+
+	routine.Submit(map[string]string{
+		"module":   "plugin_manager",
+		"function": "startPluginLogs",
+	}, func() {
+		ticker := time.NewTicker(PLUGIN_LOG_CLEANUP_INTERVAL)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := p.pluginLogs.Cleanup(); err != nil {
+				log.Error("failed to clean up plugin logs: %s", err.Error())
+			}
+		}
+	})
+}
+
+// pluginLogWriter returns the log writer of a local plugin, nil if plugin logs are disabled
+func (p *PluginManager) pluginLogWriter(identity plugin_entities.PluginUniqueIdentifier) *plugin_log.Writer {
+	if p.pluginLogs == nil {
+		return nil
+	}
+
+	writer, err := p.pluginLogs.Writer(identity.String())
+	if err != nil {
+		log.Error("failed to create the log writer of %s: %s", identity, err.Error())
+		return nil
+	}
+	return writer
+}
+
+// TailPluginLogs returns the last entries of a plugin written on this node
+func (p *PluginManager) TailPluginLogs(
+	identity plugin_entities.PluginUniqueIdentifier,
+	lines int,
+	filter plugin_log.Filter,
+) ([]plugin_log.Entry, error) {
+	if p.pluginLogs == nil {
+		return nil, ErrPluginLogsDisabled
+	}
+	return p.pluginLogs.Tail(identity.String(), lines, filter)
+}
+
+// SubscribePluginLogs receives the entries of a plugin written on this node from now on
+func (p *PluginManager) SubscribePluginLogs(
+	identity plugin_entities.PluginUniqueIdentifier,
+	filter plugin_log.Filter,
+) (<-chan plugin_log.Entry, func(), error) {
+	if p.pluginLogs == nil {
+		return nil, nil, ErrPluginLogsDisabled
+	}
+	ch, cancel := p.pluginLogs.Subscribe(identity.String(), filter)
+	return ch, cancel, nil
+}
@@ -0,0 +1,72 @@
+package plugin_log
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	LEVEL_DEBUG   = "debug"
+	LEVEL_INFO    = "info"
+	LEVEL_WARNING = "warning"
+	LEVEL_ERROR   = "error"
+)
+
+const (
+	// log events sent by the plugin over stdout
+	SOURCE_STDOUT = "stdout"
+	// anything the plugin wrote to stderr, e.g. tracebacks
+	SOURCE_STDERR = "stderr"
+	// lifecycle events recorded by the daemon, e.g. starts and exits
+	SOURCE_DAEMON = "daemon"
+)
+
+var levelSeverities = map[string]int{
+	LEVEL_DEBUG:   0,
+	LEVEL_INFO:    1,
+	LEVEL_WARNING: 2,
+	LEVEL_ERROR:   3,
+}
+
+// Entry is a single line of a plugin log file
+type Entry struct {
+	// increases with every entry of the plugin, entries sharing a timestamp are told apart by it
+	Seq       uint64    `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+	Source    string    `json:"source"`
+	SessionID string    `json:"session_id,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// NormalizeLevel maps the levels used by plugin sdks, e.g. WARN or CRITICAL, to the levels above
+func NormalizeLevel(level string) string {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug", "trace":
+		return LEVEL_DEBUG
+	case "warn", "warning":
+		return LEVEL_WARNING
+	case "error", "err", "critical", "fatal":
+		return LEVEL_ERROR
+	default:
+		return LEVEL_INFO
+	}
+}
+
+// Filter selects entries, zero values match everything
+type Filter struct {
+	// minimum level of the entries
+	Level string
+	// only entries of the session
+	SessionID string
+}
+
+func (f Filter) Match(entry *Entry) bool {
+	if f.Level != "" && levelSeverities[NormalizeLevel(entry.Level)] < levelSeverities[NormalizeLevel(f.Level)] {
+		return false
+	}
+	if f.SessionID != "" && entry.SessionID != f.SessionID {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,277 @@
+package plugin_log
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// files of writers idle for longer are closed, they are opened again on the next write
+	WRITER_IDLE_TIMEOUT = 10 * time.Minute
+
+	// entries buffered for a subscriber, entries are dropped if it can't keep up
+	SUBSCRIBER_BUFFER_SIZE = 256
+)
+
+var ErrInvalidIdentity = errors.New("invalid plugin unique identifier")
+
+type Config struct {
+	// directory containing a sub directory per plugin unique identifier
+	Root string
+	// the current file is rotated once it exceeds the size in bytes, 0 means unlimited
+	MaxSize int64
+	// the current file is rotated once it has been written for the interval, 0 means never
+	RotateInterval time.Duration
+	// rotated files kept per plugin, 0 means unlimited
+	MaxBackups int
+	// files not modified for longer are removed, 0 means forever
+	MaxAge time.Duration
+}
+
+type subscriber struct {
+	filter Filter
+	ch     chan Entry
+}
+
+// Store manages the log files of all plugins running on this node
+type Store struct {
+	config Config
+
+	lock    sync.Mutex
+	writers map[string]*Writer
+
+	subscribersLock sync.RWMutex
+	subscribers     map[string]map[*subscriber]bool
+}
+
+func NewStore(config Config) *Store {
+	return &Store{
+		config:      config,
+		writers:     map[string]*Writer{},
+		subscribers: map[string]map[*subscriber]bool{},
+	}
+}
+
+// dir returns the directory of a plugin, e.g. `langgenius_openai-0.0.1@<checksum>`
+func (s *Store) dir(identity string) (string, error) {
+	name := strings.NewReplacer("/", "_", ":", "-").Replace(identity)
+	if name == "" || name == "." || strings.Contains(name, "..") {
+		return "", ErrInvalidIdentity
+	}
+	return filepath.Join(s.config.Root, name), nil
+}
+
+// Writer returns the writer of a plugin, writers are shared by all runtimes of the same plugin
+func (s *Store) Writer(identity string) (*Writer, error) {
+	dir, err := s.dir(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if writer, ok := s.writers[identity]; ok {
+		return writer, nil
+	}
+
+	// entries written by later processes follow the ones already in the files
+	writer := &Writer{store: s, identity: identity, dir: dir, seq: uint64(time.Now().UnixNano())}
+	s.writers[identity] = writer
+	return writer, nil
+}
+
+// Tail returns the last entries of a plugin matching the filter, the oldest first
+func (s *Store) Tail(identity string, lines int, filter Filter) ([]Entry, error) {
+	dir, err := s.dir(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	if lines <= 0 {
+		return []Entry{}, nil
+	}
+
+	rotated, err := rotatedLogFiles(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Entry{}, nil
+		}
+		return nil, err
+	}
+
+	// entries are collected from the newest file backwards
+	chunks := [][]Entry{}
+	total := 0
+	for _, name := range append([]string{CURRENT_LOG_FILE}, rotated...) {
+		entries, err := readEntries(filepath.Join(dir, name), filter)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// rotated or removed meanwhile
+				continue
+			}
+			return nil, err
+		}
+
+		if total+len(entries) > lines {
+			entries = entries[total+len(entries)-lines:]
+		}
+		chunks = append(chunks, entries)
+		total += len(entries)
+		if total >= lines {
+			break
+		}
+	}
+
+	result := make([]Entry, 0, total)
+	for i := len(chunks) - 1; i >= 0; i-- {
+		result = append(result, chunks[i]...)
+	}
+	return result, nil
+}
+
+func readEntries(path string, filter Filter) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 2*MAX_MESSAGE_SIZE+4096)
+	for scanner.Scan() {
+		entry := Entry{}
+		// a line being written right now may be incomplete, skip it
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if filter.Match(&entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// Subscribe receives the entries of a plugin written from now on,
+// the returned function must be called to release the subscription
+func (s *Store) Subscribe(identity string, filter Filter) (<-chan Entry, func()) {
+	sub := &subscriber{filter: filter, ch: make(chan Entry, SUBSCRIBER_BUFFER_SIZE)}
+
+	s.subscribersLock.Lock()
+	if s.subscribers[identity] == nil {
+		s.subscribers[identity] = map[*subscriber]bool{}
+	}
+	s.subscribers[identity][sub] = true
+	s.subscribersLock.Unlock()
+
+	once := sync.Once{}
+	return sub.ch, func() {
+		once.Do(func() {
+			s.subscribersLock.Lock()
+			delete(s.subscribers[identity], sub)
+			if len(s.subscribers[identity]) == 0 {
+				delete(s.subscribers, identity)
+			}
+			s.subscribersLock.Unlock()
+			close(sub.ch)
+		})
+	}
+}
+
+func (s *Store) publish(identity string, entry *Entry) {
+	s.subscribersLock.RLock()
+	defer s.subscribersLock.RUnlock()
+
+	for sub := range s.subscribers[identity] {
+		if !sub.filter.Match(entry) {
+			continue
+		}
+		select {
+		case sub.ch <- *entry:
+		default:
+		}
+	}
+}
+
+// prune removes the rotated files of a plugin exceeding the retention
+func (s *Store) prune(dir string) error {
+	files, err := rotatedLogFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range files {
+		path := filepath.Join(dir, name)
+		if s.config.MaxBackups > 0 && i >= s.config.MaxBackups {
+			os.Remove(path)
+			continue
+		}
+		if s.config.MaxAge > 0 {
+			if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > s.config.MaxAge {
+				os.Remove(path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Cleanup closes idle files and applies the retention to all plugins,
+// including plugins uninstalled or upgraded meanwhile
+func (s *Store) Cleanup() error {
+	entries, err := os.ReadDir(s.config.Root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	s.lock.Lock()
+	writers := make(map[string]*Writer, len(s.writers))
+	for _, writer := range s.writers {
+		writers[writer.dir] = writer
+	}
+	s.lock.Unlock()
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.config.Root, entry.Name())
+
+		writer := writers[dir]
+		if writer != nil {
+			writer.lock.Lock()
+			if writer.file != nil && time.Since(writer.writtenAt) > WRITER_IDLE_TIMEOUT {
+				writer.close()
+			}
+		}
+
+		s.prune(dir)
+
+		if s.config.MaxAge > 0 && (writer == nil || writer.file == nil) {
+			current := filepath.Join(dir, CURRENT_LOG_FILE)
+			if info, err := os.Stat(current); err == nil && time.Since(info.ModTime()) > s.config.MaxAge {
+				os.Remove(current)
+			}
+		}
+
+		if writer != nil {
+			writer.lock.Unlock()
+		}
+
+		// fails if anything is left
+		os.Remove(dir)
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package plugin_log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testIdentity = "langgenius/test:0.0.1@0123456789abcdef0123456789abcdef"
+
+func TestTailFilter(t *testing.T) {
+	store := NewStore(Config{Root: t.TempDir()})
+	writer, err := store.Writer(testIdentity)
+	assert.NoError(t, err)
+
+	writer.Log(SOURCE_STDOUT, "DEBUG", "session-1", "debug")
+	writer.Log(SOURCE_STDOUT, "INFO", "session-1", "info")
+	writer.Log(SOURCE_STDOUT, "WARN", "session-2", "warning")
+	writer.Log(SOURCE_STDERR, LEVEL_ERROR, "", "error")
+
+	entries, err := store.Tail(testIdentity, 10, Filter{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+	assert.Equal(t, "debug", entries[0].Message)
+	assert.Equal(t, LEVEL_WARNING, entries[2].Level)
+
+	entries, err = store.Tail(testIdentity, 10, Filter{Level: LEVEL_WARNING})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "warning", entries[0].Message)
+	assert.Equal(t, "error", entries[1].Message)
+
+	entries, err = store.Tail(testIdentity, 10, Filter{SessionID: "session-1"})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	entries, err = store.Tail(testIdentity, 1, Filter{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "error", entries[0].Message)
+
+	// nothing written yet
+	entries, err = store.Tail("langgenius/other:0.0.1@0123456789abcdef0123456789abcdef", 10, Filter{})
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = store.Tail("../../etc", 10, Filter{})
+	assert.ErrorIs(t, err, ErrInvalidIdentity)
+}
+
+func TestRotation(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(Config{Root: root, MaxSize: 512, MaxBackups: 2})
+	writer, err := store.Writer(testIdentity)
+	assert.NoError(t, err)
+
+	for i := 0; i < 50; i++ {
+		writer.Log(SOURCE_STDOUT, LEVEL_INFO, "", fmt.Sprintf("message %d", i))
+		// rotated files are named by time
+		time.Sleep(time.Millisecond)
+	}
+
+	dir := filepath.Join(root, "langgenius_test-0.0.1@0123456789abcdef0123456789abcdef")
+	rotated, err := rotatedLogFiles(dir)
+	assert.NoError(t, err)
+	assert.Len(t, rotated, 2)
+
+	info, err := os.Stat(filepath.Join(dir, CURRENT_LOG_FILE))
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, info.Size(), int64(512))
+
+	// the tail spans the rotated files, the oldest entries are gone
+	entries, err := store.Tail(testIdentity, 1000, Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, "message 49", entries[len(entries)-1].Message)
+	assert.NotEqual(t, "message 0", entries[0].Message)
+	for i := 1; i < len(entries); i++ {
+		assert.False(t, entries[i].Timestamp.Before(entries[i-1].Timestamp))
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(Config{Root: root, MaxAge: time.Hour})
+
+	dir := filepath.Join(root, "langgenius_removed-0.0.1@0123456789abcdef0123456789abcdef")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	for _, name := range []string{CURRENT_LOG_FILE, "plugin-20240101T000000.000000.log"} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte("{}\n"), 0644))
+		old := time.Now().Add(-2 * time.Hour)
+		assert.NoError(t, os.Chtimes(path, old, old))
+	}
+
+	writer, err := store.Writer(testIdentity)
+	assert.NoError(t, err)
+	writer.Log(SOURCE_DAEMON, LEVEL_INFO, "", "plugin started")
+
+	assert.NoError(t, store.Cleanup())
+
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+
+	entries, err := store.Tail(testIdentity, 10, Filter{})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestSubscribe(t *testing.T) {
+	store := NewStore(Config{Root: t.TempDir()})
+	writer, err := store.Writer(testIdentity)
+	assert.NoError(t, err)
+
+	entries, cancel := store.Subscribe(testIdentity, Filter{Level: LEVEL_ERROR})
+
+	writer.Log(SOURCE_STDOUT, LEVEL_INFO, "", "ignored")
+	writer.Log(SOURCE_STDERR, LEVEL_ERROR, "", "Traceback")
+
+	select {
+	case entry := <-entries:
+		assert.Equal(t, "Traceback", entry.Message)
+		assert.Equal(t, SOURCE_STDERR, entry.Source)
+	case <-time.After(time.Second):
+		t.Fatal("entry not received")
+	}
+
+	cancel()
+	_, ok := <-entries
+	assert.False(t, ok)
+
+	// writing after the subscription is gone is fine
+	writer.Log(SOURCE_STDOUT, LEVEL_ERROR, "", "after cancel")
+
+	// a nil writer discards everything
+	var disabled *Writer
+	disabled.Log(SOURCE_STDOUT, LEVEL_INFO, "", "discarded")
+}
+
+func TestSequence(t *testing.T) {
+	root := t.TempDir()
+	store := NewStore(Config{Root: root})
+	writer, err := store.Writer(testIdentity)
+	assert.NoError(t, err)
+
+	// entries written at the same time are still told apart
+	timestamp := time.Now()
+	writer.Write(Entry{Timestamp: timestamp, Level: LEVEL_INFO, Source: SOURCE_STDOUT, Message: "first"})
+	writer.Write(Entry{Timestamp: timestamp, Level: LEVEL_INFO, Source: SOURCE_STDOUT, Message: "second"})
+
+	entries, err := store.Tail(testIdentity, 10, Filter{})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Less(t, entries[0].Seq, entries[1].Seq)
+	}
+
+	// entries of a restarted daemon follow the ones in the file
+	restarted, err := NewStore(Config{Root: root}).Writer(testIdentity)
+	assert.NoError(t, err)
+	restarted.Log(SOURCE_DAEMON, LEVEL_INFO, "", "restarted")
+
+	entries, err = store.Tail(testIdentity, 10, Filter{})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.Less(t, entries[1].Seq, entries[2].Seq)
+	}
+}
@@ -0,0 +1,173 @@
+package plugin_log
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+)
+
+const (
+	CURRENT_LOG_FILE = "plugin.log"
+
+	// rotated files are named `plugin-<timestamp>.log`, the timestamp keeps them sorted by name
+	ROTATED_LOG_FILE_PREFIX    = "plugin-"
+	ROTATED_LOG_FILE_SUFFIX    = ".log"
+	ROTATED_LOG_FILE_TIMESTAMP = "20060102T150405.000000"
+
+	// messages are truncated to keep a single entry from filling up the file
+	MAX_MESSAGE_SIZE = 16 * 1024
+)
+
+// Writer appends the entries of a plugin to its current log file and rotates it
+// by size and time, it's safe to be used by multiple goroutines, a nil Writer discards everything
+type Writer struct {
+	store    *Store
+	identity string
+	dir      string
+
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	// the last time an entry was written, used to close idle files
+	writtenAt time.Time
+	// set after a failed write, avoids flooding the daemon log while the disk is full
+	failing bool
+	// sequence of the last entry
+	seq uint64
+}
+
+// Log writes an entry stamped with the current time
+func (w *Writer) Log(source string, level string, sessionID string, message string) {
+	if w == nil {
+		return
+	}
+
+	w.Write(Entry{
+		Timestamp: time.Now(),
+		Level:     NormalizeLevel(level),
+		Source:    source,
+		SessionID: sessionID,
+		Message:   message,
+	})
+}
+
+func (w *Writer) Write(entry Entry) {
+	if w == nil {
+		return
+	}
+
+	if len(entry.Message) > MAX_MESSAGE_SIZE {
+		entry.Message = entry.Message[:MAX_MESSAGE_SIZE] + "...(truncated)"
+	}
+
+	w.lock.Lock()
+	w.seq++
+	entry.Seq = w.seq
+	data, err := json.Marshal(entry)
+	if err != nil {
+		w.lock.Unlock()
+		return
+	}
+	data = append(data, '\n')
+
+	err = w.write(data)
+	if err != nil && !w.failing {
+		log.Error("failed to write the log of plugin %s: %s", w.identity, err)
+	}
+	w.failing = err != nil
+	w.lock.Unlock()
+
+	w.store.publish(w.identity, &entry)
+}
+
+func (w *Writer) write(data []byte) error {
+	config := w.store.config
+	if w.file != nil {
+		if (config.MaxSize > 0 && w.size+int64(len(data)) > config.MaxSize && w.size > 0) ||
+			(config.RotateInterval > 0 && time.Since(w.openedAt) > config.RotateInterval) {
+			if err := w.rotate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	w.writtenAt = time.Now()
+	return err
+}
+
+func (w *Writer) open() error {
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(w.dir, CURRENT_LOG_FILE), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = info.Size()
+	w.openedAt = time.Now()
+	return nil
+}
+
+func (w *Writer) close() {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+}
+
+func (w *Writer) rotate() error {
+	w.close()
+
+	rotated := ROTATED_LOG_FILE_PREFIX + time.Now().UTC().Format(ROTATED_LOG_FILE_TIMESTAMP) + ROTATED_LOG_FILE_SUFFIX
+	if err := os.Rename(filepath.Join(w.dir, CURRENT_LOG_FILE), filepath.Join(w.dir, rotated)); err != nil {
+		return err
+	}
+
+	return w.store.prune(w.dir)
+}
+
+// rotatedLogFiles lists the rotated files of a plugin, the newest first
+func rotatedLogFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == CURRENT_LOG_FILE {
+			continue
+		}
+		if strings.HasPrefix(name, ROTATED_LOG_FILE_PREFIX) && strings.HasSuffix(name, ROTATED_LOG_FILE_SUFFIX) {
+			files = append(files, name)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	return files, nil
+}
@@ -0,0 +1,20 @@
+package plugin_manager
+
+import (
+	"errors"
+
+	"golang.org/x/net/websocket"
+)
+
+var ErrRemoteDebuggingDisabled = errors.New("remote debugging is disabled")
+
+// ServeRemotePluginWebSocket serves a plugin debugging over a websocket instead of the tcp port,
+// it returns once the plugin disconnected
+func (p *PluginManager) ServeRemotePluginWebSocket(ws *websocket.Conn, remoteAddress string) error {
+	if p.remotePluginServer == nil {
+		return ErrRemoteDebuggingDisabled
+	}
+
+	p.remotePluginServer.ServeWebSocket(ws, remoteAddress)
+	return nil
+}
@@ -0,0 +1,61 @@
+package plugin_manager
+
+import (
+	"errors"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/local_runtime"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/decoder"
+)
+
+func (p *PluginManager) initSdkPatches(config *app.Config) {
+	registry, err := local_runtime.LoadSdkPatchRegistry(config.PythonSdkPatchesPath)
+	if err != nil {
+		// a broken operator registry should not prevent plugins from launching
+		log.Error("load sdk patches from %s failed, only embedded patches are used: %s", config.PythonSdkPatchesPath, err.Error())
+		registry = local_runtime.DefaultSdkPatchRegistry()
+	}
+
+	p.sdkPatches = registry
+}
+
+func (p *PluginManager) sdkPatchRegistry() *local_runtime.SdkPatchRegistry {
+	if p.sdkPatches != nil {
+		return p.sdkPatches
+	}
+	return local_runtime.DefaultSdkPatchRegistry()
+}
+
+// SdkPatchDryRun reports the installed plugins each sdk patch applies to
+func (p *PluginManager) SdkPatchDryRun() ([]local_runtime.SdkPatchReport, error) {
+	identities, err := p.installedBucket.List()
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to list installed plugins"))
+	}
+
+	requirements := map[string]string{}
+	for _, identity := range identities {
+		pkg, err := p.installedBucket.Get(identity)
+		if err != nil {
+			log.Warn("failed to load installed plugin %s: %s", identity.String(), err.Error())
+			continue
+		}
+
+		pluginDecoder, err := decoder.NewZipPluginDecoder(pkg)
+		if err != nil {
+			log.Warn("failed to decode installed plugin %s: %s", identity.String(), err.Error())
+			continue
+		}
+
+		content, err := pluginDecoder.ReadFile("requirements.txt")
+		if err != nil {
+			// not a python plugin
+			continue
+		}
+
+		requirements[identity.String()] = string(content)
+	}
+
+	return p.sdkPatchRegistry().DryRun(requirements), nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/basic_runtime"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/serverless_runtime"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/session_manager"
 	"github.com/langgenius/dify-plugin-daemon/internal/db"
 	"github.com/langgenius/dify-plugin-daemon/internal/types/models"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
@@ -37,24 +38,40 @@ func (p *PluginManager) getServerlessPluginRuntime(
 		return nil, err
 	}
 
-	// init runtime entity
-	runtimeEntity := plugin_entities.PluginRuntime{
-		Config: *declaration,
-	}
-	runtimeEntity.InitState()
-
 	// convert to plugin runtime
 	pluginRuntime := serverless_runtime.ServerlessPluginRuntime{
 		BasicChecksum: basic_runtime.BasicChecksum{
 			MediaTransport: basic_runtime.NewMediaTransport(p.mediaBucket),
 			InnerChecksum:  model.Checksum,
 		},
-		PluginRuntime:             runtimeEntity,
+		PluginRuntime: plugin_entities.PluginRuntime{
+			Config: *declaration,
+		},
 		LambdaURL:                 model.FunctionURL,
 		LambdaName:                model.FunctionName,
 		PluginMaxExecutionTimeout: p.config.PluginMaxExecutionTimeout,
+		CallbackToken:             p.issueCallbackToken,
+		RetryPolicy: serverless_runtime.RetryPolicy{
+			MaxAttempts: p.config.ServerlessInvokeMaxAttempts,
+			Backoff:     time.Duration(p.config.ServerlessInvokeRetryBackoff) * time.Millisecond,
+			MaxBackoff:  time.Duration(p.config.ServerlessInvokeRetryMaxBackoff) * time.Millisecond,
+			RetryTimeouts: p.config.ServerlessInvokeRetryTimeouts != nil &&
+				*p.config.ServerlessInvokeRetryTimeouts,
+		},
+		ColdStartTimeout: time.Duration(p.config.ServerlessColdStartTimeout) * time.Second,
 	}
 
+	if p.config.ServerlessCircuitBreakerEnabled != nil && *p.config.ServerlessCircuitBreakerEnabled {
+		pluginRuntime.CircuitBreaker = serverless_runtime.CircuitBreakerFor(
+			model.FunctionURL,
+			p.config.ServerlessCircuitBreakerThreshold,
+			time.Duration(p.config.ServerlessCircuitBreakerCooldown)*time.Second,
+		)
+	}
+
+	// init runtime entity
+	pluginRuntime.InitState()
+
 	if err := pluginRuntime.InitEnvironment(); err != nil {
 		return nil, err
 	}
@@ -101,3 +118,24 @@ func (p *PluginManager) clearServerlessRuntimeCache(
 	_, err := cache.Del(p.getServerlessRuntimeCacheKey(identity))
 	return err
 }
+
+// issueCallbackToken issues the token authenticating backwards invocations of the session,
+// it expires with the execution timeout and is revoked once the session is closed
+func (p *PluginManager) issueCallbackToken(sessionId string) (string, error) {
+	session := session_manager.GetSession(session_manager.GetSessionPayload{
+		ID: sessionId,
+	})
+	if session == nil {
+		return "", fmt.Errorf("session not found: %s", sessionId)
+	}
+
+	secret := p.config.ServerlessCallbackTokenSecret
+	if secret == "" {
+		secret = p.config.ServerKey
+	}
+
+	return session.IssueCallbackToken(
+		[]byte(secret),
+		time.Duration(p.config.PluginMaxExecutionTimeout)*time.Second,
+	)
+}
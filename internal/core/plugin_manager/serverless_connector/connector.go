@@ -86,6 +86,38 @@ func FetchFunction(manifest plugin_entities.PluginDeclaration, checksum string)
 	}, nil
 }
 
+// Delete the function of the plugin from serverless connector, ErrFunctionNotFound is returned if it doesn't exist
+func DeleteFunction(identity plugin_entities.PluginUniqueIdentifier) error {
+	url, err := url.JoinPath(baseurl.String(), "/v1/runner/instances")
+	if err != nil {
+		return err
+	}
+
+	response, err := http_requests.DeleteAndParse[RunnerInstances](
+		client,
+		url,
+		http_requests.HttpHeader(map[string]string{
+			"Authorization": SERVERLESS_CONNECTOR_API_KEY,
+		}),
+		http_requests.HttpParams(map[string]string{
+			"filename": getFunctionFilenameFromIdentity(identity),
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	if response.Error != "" {
+		return fmt.Errorf("unexpected response from plugin controller: %s", response.Error)
+	}
+
+	if len(response.Items) == 0 {
+		return ErrFunctionNotFound
+	}
+
+	return nil
+}
+
 type LaunchFunctionEvent string
 
 const (
@@ -2,6 +2,7 @@ package serverless
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
 )
@@ -55,3 +56,12 @@ type LaunchFunctionFinalStageMessage struct {
 func getFunctionFilename(manifest plugin_entities.PluginDeclaration, checksum string) string {
 	return fmt.Sprintf("%s@%s@%s@%s.difypkg", manifest.Author, manifest.Name, manifest.Version, checksum)
 }
+
+// getFunctionFilenameFromIdentity is the same filename as getFunctionFilename for the manifest of the plugin
+func getFunctionFilenameFromIdentity(identity plugin_entities.PluginUniqueIdentifier) string {
+	name := identity.PluginID()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return fmt.Sprintf("%s@%s@%s@%s.difypkg", identity.Author(), name, identity.Version(), identity.Checksum())
+}
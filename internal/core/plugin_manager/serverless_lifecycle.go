@@ -0,0 +1,220 @@
+package plugin_manager
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	serverless "github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/serverless_connector"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/serverless_lifecycle"
+	"github.com/langgenius/dify-plugin-daemon/internal/db"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/models"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/decoder"
+)
+
+const (
+	// held by the node running the lifecycle of serverless functions in the cluster
+	SERVERLESS_LIFECYCLE_LOCK_KEY = "serverless_lifecycle:lock"
+)
+
+var ErrServerlessLifecycleDisabled = errors.New("serverless lifecycle is only available on serverless platform")
+
+func (p *PluginManager) startServerlessLifecycle(config *app.Config) {
+	p.serverlessLifecycle = serverless_lifecycle.NewManager(
+		&serverlessRuntimeStore{manager: p},
+		&serverlessPlatform{
+			manager: p,
+			client:  &http.Client{Timeout: time.Duration(config.ServerlessWarmupTimeout) * time.Second},
+		},
+		time.Duration(config.ServerlessFunctionGCGracePeriod)*time.Second,
+	)
+
+	gcEnabled := config.ServerlessFunctionGCEnabled != nil && *config.ServerlessFunctionGCEnabled
+	interval := time.Duration(config.ServerlessLifecycleInterval) * time.Second
+
+	routine.Submit(map[string]string{
+		"module":   "plugin_manager",
+		"function": "startServerlessLifecycle",
+	}, func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			// only one node of the cluster runs the lifecycle in each interval, the lock expires by itself
+			if err := cache.Lock(SERVERLESS_LIFECYCLE_LOCK_KEY, interval, 0); err != nil {
+				continue
+			}
+
+			// a round may outlast the interval if functions are slow, keep the lock until it's done
+			done := make(chan bool)
+			routine.Submit(map[string]string{
+				"module":   "plugin_manager",
+				"function": "renewServerlessLifecycleLock",
+			}, func() {
+				renewServerlessLifecycleLock(interval, done)
+			})
+
+			if gcEnabled {
+				report, err := p.serverlessLifecycle.Collect(false)
+				if err != nil {
+					log.Error("serverless function gc failed: %s", err.Error())
+				} else if report.Deleted > 0 {
+					log.Info("serverless function gc deleted %d functions", report.Deleted)
+				}
+			}
+
+			if _, err := p.serverlessLifecycle.Warmup(); err != nil {
+				log.Error("serverless function warmup failed: %s", err.Error())
+			}
+			close(done)
+		}
+	})
+}
+
+func renewServerlessLifecycleLock(interval time.Duration, done chan bool) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if _, err := cache.Expire(SERVERLESS_LIFECYCLE_LOCK_KEY, interval); err != nil {
+				log.Warn("failed to renew serverless lifecycle lock: %s", err.Error())
+			}
+		}
+	}
+}
+
+// CollectServerlessFunctions deletes functions which have had no installation for the whole grace period
+func (p *PluginManager) CollectServerlessFunctions(dryRun bool) (*serverless_lifecycle.Report, error) {
+	if p.serverlessLifecycle == nil {
+		return nil, ErrServerlessLifecycleDisabled
+	}
+	return p.serverlessLifecycle.Collect(dryRun)
+}
+
+// RedeployServerlessFunctions launches functions again, all installed ones if identities is empty
+func (p *PluginManager) RedeployServerlessFunctions(
+	identities []plugin_entities.PluginUniqueIdentifier,
+) (*stream.Stream[serverless_lifecycle.RedeployResponse], error) {
+	if p.serverlessLifecycle == nil {
+		return nil, ErrServerlessLifecycleDisabled
+	}
+	return p.serverlessLifecycle.Redeploy(identities)
+}
+
+// SetServerlessWarmupInterval sets the seconds between warmup pings of the function, 0 disables warmup
+func (p *PluginManager) SetServerlessWarmupInterval(
+	identity plugin_entities.PluginUniqueIdentifier,
+	interval int,
+) error {
+	if p.serverlessLifecycle == nil {
+		return ErrServerlessLifecycleDisabled
+	}
+
+	runtime, err := db.GetOne[models.ServerlessRuntime](
+		db.Equal("plugin_unique_identifier", identity.String()),
+		db.Equal("type", string(models.SERVERLESS_RUNTIME_TYPE_SERVERLESS)),
+	)
+	if err != nil {
+		return err
+	}
+
+	runtime.WarmupInterval = interval
+	if err := db.Update(&runtime); err != nil {
+		return err
+	}
+
+	return p.clearServerlessRuntimeCache(identity)
+}
+
+type serverlessRuntimeStore struct {
+	manager *PluginManager
+}
+
+func (s *serverlessRuntimeStore) ListRuntimes() ([]models.ServerlessRuntime, error) {
+	return db.GetAll[models.ServerlessRuntime](
+		db.Equal("type", string(models.SERVERLESS_RUNTIME_TYPE_SERVERLESS)),
+	)
+}
+
+func (s *serverlessRuntimeStore) CountInstallations(identity plugin_entities.PluginUniqueIdentifier) (int64, error) {
+	return db.GetCount[models.PluginInstallation](
+		db.Equal("plugin_unique_identifier", identity.String()),
+	)
+}
+
+func (s *serverlessRuntimeStore) UpdateRuntime(runtime *models.ServerlessRuntime) error {
+	return db.Update(runtime)
+}
+
+func (s *serverlessRuntimeStore) DeleteRuntime(runtime *models.ServerlessRuntime) error {
+	if err := db.Delete(runtime); err != nil {
+		return err
+	}
+	return s.manager.clearServerlessRuntimeCache(plugin_entities.PluginUniqueIdentifier(runtime.PluginUniqueIdentifier))
+}
+
+type serverlessPlatform struct {
+	manager *PluginManager
+	client  *http.Client
+}
+
+func (s *serverlessPlatform) DeleteFunction(identity plugin_entities.PluginUniqueIdentifier) error {
+	if err := serverless.DeleteFunction(identity); err != nil && !errors.Is(err, serverless.ErrFunctionNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Warmup starts the function by a health check, any response means the function is up
+func (s *serverlessPlatform) Warmup(functionURL string) error {
+	healthCheckURL, err := url.JoinPath(functionURL, "health", "check")
+	if err != nil {
+		return err
+	}
+
+	response, err := s.client.Get(healthCheckURL)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func (s *serverlessPlatform) Redeploy(identity plugin_entities.PluginUniqueIdentifier) error {
+	pkg, err := s.manager.GetPackage(identity)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to get package"))
+	}
+
+	zipDecoder, err := decoder.NewZipPluginDecoder(pkg)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to create zip decoder"))
+	}
+
+	response, err := s.manager.ReinstallToAWSFromPkg(pkg, zipDecoder)
+	if err != nil {
+		return err
+	}
+
+	var redeployErr error
+	if err := response.Async(func(r PluginInstallResponse) {
+		if r.Event == PluginInstallEventError {
+			redeployErr = fmt.Errorf("%s", r.Data)
+		}
+	}); err != nil {
+		return err
+	}
+
+	return redeployErr
+}
@@ -0,0 +1,285 @@
+package serverless_lifecycle
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/types/models"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+const (
+	// functions pinged at the same time, a round takes about (due functions / concurrency) * warmup timeout
+	WARMUP_CONCURRENCY = 16
+)
+
+// Store keeps the serverless runtimes and their installations, it's backed by the database
+type Store interface {
+	ListRuntimes() ([]models.ServerlessRuntime, error)
+	CountInstallations(identity plugin_entities.PluginUniqueIdentifier) (int64, error)
+	UpdateRuntime(runtime *models.ServerlessRuntime) error
+	DeleteRuntime(runtime *models.ServerlessRuntime) error
+}
+
+// Platform manages the functions on the serverless platform
+type Platform interface {
+	// DeleteFunction deletes the function of the plugin, it's not an error if the function doesn't exist
+	DeleteFunction(identity plugin_entities.PluginUniqueIdentifier) error
+	// Warmup sends a request to the function, so it's started before the next invoke
+	Warmup(functionURL string) error
+	// Redeploy launches the function again from the package of the plugin
+	Redeploy(identity plugin_entities.PluginUniqueIdentifier) error
+}
+
+// Orphan is a function without any installation
+type Orphan struct {
+	PluginUniqueIdentifier string    `json:"plugin_unique_identifier"`
+	FunctionName           string    `json:"function_name"`
+	OrphanedAt             time.Time `json:"orphaned_at"`
+	// whether the grace period has elapsed
+	Reclaimable bool `json:"reclaimable"`
+}
+
+type Report struct {
+	DryRun  bool     `json:"dry_run"`
+	Orphans []Orphan `json:"orphans"`
+	Deleted int      `json:"deleted"`
+}
+
+type RedeployEvent string
+
+const (
+	RedeployEventInfo    RedeployEvent = "info"
+	RedeployEventSuccess RedeployEvent = "success"
+	RedeployEventError   RedeployEvent = "error"
+	RedeployEventDone    RedeployEvent = "done"
+)
+
+type RedeployResponse struct {
+	PluginUniqueIdentifier string        `json:"plugin_unique_identifier,omitempty"`
+	Event                  RedeployEvent `json:"event"`
+	Message                string        `json:"message"`
+}
+
+// Manager deletes functions left behind by uninstalls, redeploys functions and keeps them warm
+// orphans are recorded on the runtimes, so the grace period survives restarts of the daemon
+type Manager struct {
+	store       Store
+	platform    Platform
+	gracePeriod time.Duration
+
+	lock sync.Mutex
+	// the last warmup of each function, tracked in memory
+	warmedAt map[string]time.Time
+
+	now func() time.Time
+}
+
+func NewManager(store Store, platform Platform, gracePeriod time.Duration) *Manager {
+	return &Manager{
+		store:       store,
+		platform:    platform,
+		gracePeriod: gracePeriod,
+		warmedAt:    map[string]time.Time{},
+		now:         time.Now,
+	}
+}
+
+// Collect deletes functions which have had no installation for the whole grace period
+func (m *Manager) Collect(dryRun bool) (*Report, error) {
+	runtimes, err := m.store.ListRuntimes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list serverless runtimes: %s", err)
+	}
+
+	now := m.now()
+	report := &Report{DryRun: dryRun, Orphans: []Orphan{}}
+
+	for i := range runtimes {
+		runtime := &runtimes[i]
+		identity := plugin_entities.PluginUniqueIdentifier(runtime.PluginUniqueIdentifier)
+
+		installations, err := m.store.CountInstallations(identity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count installations of %s: %s", identity, err)
+		}
+
+		if installations > 0 {
+			// installed again during the grace period
+			if runtime.OrphanedAt != nil && !dryRun {
+				runtime.OrphanedAt = nil
+				if err := m.store.UpdateRuntime(runtime); err != nil {
+					log.Error("failed to update serverless runtime %s: %s", identity, err.Error())
+				}
+			}
+			continue
+		}
+
+		orphanedAt := now
+		if runtime.OrphanedAt != nil {
+			orphanedAt = *runtime.OrphanedAt
+		} else if !dryRun {
+			runtime.OrphanedAt = &orphanedAt
+			if err := m.store.UpdateRuntime(runtime); err != nil {
+				log.Error("failed to update serverless runtime %s: %s", identity, err.Error())
+				continue
+			}
+		}
+
+		orphan := Orphan{
+			PluginUniqueIdentifier: runtime.PluginUniqueIdentifier,
+			FunctionName:           runtime.FunctionName,
+			OrphanedAt:             orphanedAt,
+			Reclaimable:            now.Sub(orphanedAt) >= m.gracePeriod,
+		}
+		report.Orphans = append(report.Orphans, orphan)
+
+		if dryRun || !orphan.Reclaimable {
+			continue
+		}
+
+		if err := m.platform.DeleteFunction(identity); err != nil {
+			log.Error("failed to delete serverless function %s: %s", identity, err.Error())
+			continue
+		}
+		if err := m.store.DeleteRuntime(runtime); err != nil {
+			log.Error("failed to delete serverless runtime %s: %s", identity, err.Error())
+			continue
+		}
+
+		log.Info("deleted serverless function %s of %s, orphaned at %s", runtime.FunctionName, identity, orphanedAt)
+		report.Deleted++
+	}
+
+	return report, nil
+}
+
+// Warmup pings the functions whose warmup interval has elapsed, returns the number of pinged functions
+func (m *Manager) Warmup() (int, error) {
+	runtimes, err := m.store.ListRuntimes()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list serverless runtimes: %s", err)
+	}
+
+	now := m.now()
+	due := []models.ServerlessRuntime{}
+
+	m.lock.Lock()
+	warmedAt := map[string]time.Time{}
+	for _, runtime := range runtimes {
+		last, ok := m.warmedAt[runtime.PluginUniqueIdentifier]
+		if ok {
+			warmedAt[runtime.PluginUniqueIdentifier] = last
+		}
+
+		if runtime.WarmupInterval <= 0 || runtime.OrphanedAt != nil {
+			continue
+		}
+		if ok && now.Sub(last) < time.Duration(runtime.WarmupInterval)*time.Second {
+			continue
+		}
+
+		warmedAt[runtime.PluginUniqueIdentifier] = now
+		due = append(due, runtime)
+	}
+	// forget functions which no longer exist
+	m.warmedAt = warmedAt
+	m.lock.Unlock()
+
+	// slow functions don't hold up the others
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, WARMUP_CONCURRENCY)
+	for _, runtime := range due {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(runtime models.ServerlessRuntime) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := m.platform.Warmup(runtime.FunctionURL); err != nil {
+				log.Warn("failed to warm up serverless function %s: %s", runtime.PluginUniqueIdentifier, err.Error())
+			}
+		}(runtime)
+	}
+	wg.Wait()
+
+	return len(due), nil
+}
+
+// Redeploy launches the functions again one by one, e.g. to pick up a new base image,
+// all installed functions are redeployed if identities is empty
+func (m *Manager) Redeploy(
+	identities []plugin_entities.PluginUniqueIdentifier,
+) (*stream.Stream[RedeployResponse], error) {
+	runtimes, err := m.store.ListRuntimes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list serverless runtimes: %s", err)
+	}
+
+	targets := []plugin_entities.PluginUniqueIdentifier{}
+	if len(identities) == 0 {
+		for _, runtime := range runtimes {
+			// orphans are going to be deleted
+			if runtime.OrphanedAt == nil {
+				targets = append(targets, plugin_entities.PluginUniqueIdentifier(runtime.PluginUniqueIdentifier))
+			}
+		}
+	} else {
+		exists := map[string]bool{}
+		for _, runtime := range runtimes {
+			exists[runtime.PluginUniqueIdentifier] = true
+		}
+		for _, identity := range identities {
+			if !exists[identity.String()] {
+				return nil, fmt.Errorf("serverless runtime not found: %s", identity)
+			}
+		}
+		targets = identities
+	}
+
+	response := stream.NewStream[RedeployResponse](128)
+	routine.Submit(map[string]string{
+		"module":   "serverless_lifecycle",
+		"function": "Redeploy",
+	}, func() {
+		defer response.Close()
+
+		failed := 0
+		for _, identity := range targets {
+			response.Write(RedeployResponse{
+				PluginUniqueIdentifier: identity.String(),
+				Event:                  RedeployEventInfo,
+				Message:                "Redeploying...",
+			})
+
+			if err := m.platform.Redeploy(identity); err != nil {
+				failed++
+				log.Error("failed to redeploy serverless function %s: %s", identity, err.Error())
+				response.Write(RedeployResponse{
+					PluginUniqueIdentifier: identity.String(),
+					Event:                  RedeployEventError,
+					Message:                err.Error(),
+				})
+				continue
+			}
+
+			response.Write(RedeployResponse{
+				PluginUniqueIdentifier: identity.String(),
+				Event:                  RedeployEventSuccess,
+				Message:                "Redeployed",
+			})
+		}
+
+		response.Write(RedeployResponse{
+			Event:   RedeployEventDone,
+			Message: fmt.Sprintf("redeployed %d functions, %d failed", len(targets)-failed, failed),
+		})
+	})
+
+	return response, nil
+}
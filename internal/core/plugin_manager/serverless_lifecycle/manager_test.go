@@ -0,0 +1,307 @@
+package serverless_lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/types/models"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	pluginA = "langgenius/a:0.0.1@0000000000000000000000000000000000000000000000000000000000000001"
+	pluginB = "langgenius/b:0.0.1@0000000000000000000000000000000000000000000000000000000000000002"
+)
+
+type fakeStore struct {
+	lock          sync.Mutex
+	runtimes      map[string]*models.ServerlessRuntime
+	installations map[string]int64
+}
+
+func newFakeStore(runtimes ...models.ServerlessRuntime) *fakeStore {
+	s := &fakeStore{
+		runtimes:      map[string]*models.ServerlessRuntime{},
+		installations: map[string]int64{},
+	}
+	for i := range runtimes {
+		s.runtimes[runtimes[i].PluginUniqueIdentifier] = &runtimes[i]
+	}
+	return s
+}
+
+func (s *fakeStore) ListRuntimes() ([]models.ServerlessRuntime, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	runtimes := []models.ServerlessRuntime{}
+	for _, runtime := range s.runtimes {
+		runtimes = append(runtimes, *runtime)
+	}
+	return runtimes, nil
+}
+
+func (s *fakeStore) CountInstallations(identity plugin_entities.PluginUniqueIdentifier) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.installations[identity.String()], nil
+}
+
+func (s *fakeStore) UpdateRuntime(runtime *models.ServerlessRuntime) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	updated := *runtime
+	s.runtimes[runtime.PluginUniqueIdentifier] = &updated
+	return nil
+}
+
+func (s *fakeStore) DeleteRuntime(runtime *models.ServerlessRuntime) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.runtimes, runtime.PluginUniqueIdentifier)
+	return nil
+}
+
+type fakePlatform struct {
+	lock        sync.Mutex
+	deleted     []string
+	warmed      []string
+	redeployed  []string
+	redeployErr map[string]error
+}
+
+func (p *fakePlatform) DeleteFunction(identity plugin_entities.PluginUniqueIdentifier) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.deleted = append(p.deleted, identity.String())
+	return nil
+}
+
+func (p *fakePlatform) Warmup(functionURL string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.warmed = append(p.warmed, functionURL)
+	return nil
+}
+
+func (p *fakePlatform) Redeploy(identity plugin_entities.PluginUniqueIdentifier) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.redeployed = append(p.redeployed, identity.String())
+	return p.redeployErr[identity.String()]
+}
+
+func newTestManager(store Store, platform Platform) (*Manager, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	m := NewManager(store, platform, time.Hour)
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestCollect(t *testing.T) {
+	store := newFakeStore(
+		models.ServerlessRuntime{PluginUniqueIdentifier: pluginA, FunctionName: "a"},
+		models.ServerlessRuntime{PluginUniqueIdentifier: pluginB, FunctionName: "b"},
+	)
+	store.installations[pluginA] = 1
+	platform := &fakePlatform{}
+	manager, now := newTestManager(store, platform)
+
+	// dry runs don't record orphans
+	report, err := manager.Collect(true)
+	assert.NoError(t, err)
+	if assert.Len(t, report.Orphans, 1) {
+		assert.Equal(t, pluginB, report.Orphans[0].PluginUniqueIdentifier)
+		assert.False(t, report.Orphans[0].Reclaimable)
+	}
+	assert.Nil(t, store.runtimes[pluginB].OrphanedAt)
+
+	report, err = manager.Collect(false)
+	assert.NoError(t, err)
+	assert.Len(t, report.Orphans, 1)
+	assert.Equal(t, 0, report.Deleted)
+	assert.NotNil(t, store.runtimes[pluginB].OrphanedAt)
+
+	// still within the grace period
+	*now = now.Add(30 * time.Minute)
+	report, err = manager.Collect(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Deleted)
+	assert.Empty(t, platform.deleted)
+
+	*now = now.Add(time.Hour)
+	report, err = manager.Collect(true)
+	assert.NoError(t, err)
+	if assert.Len(t, report.Orphans, 1) {
+		assert.True(t, report.Orphans[0].Reclaimable)
+	}
+	assert.Empty(t, platform.deleted)
+
+	report, err = manager.Collect(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Deleted)
+	assert.Equal(t, []string{pluginB}, platform.deleted)
+	assert.NotContains(t, store.runtimes, pluginB)
+	assert.Contains(t, store.runtimes, pluginA)
+}
+
+func TestCollectReinstalledDuringGracePeriod(t *testing.T) {
+	store := newFakeStore(models.ServerlessRuntime{PluginUniqueIdentifier: pluginA})
+	platform := &fakePlatform{}
+	manager, now := newTestManager(store, platform)
+
+	_, err := manager.Collect(false)
+	assert.NoError(t, err)
+	assert.NotNil(t, store.runtimes[pluginA].OrphanedAt)
+
+	// installed again, the grace period restarts once it's uninstalled
+	store.installations[pluginA] = 1
+	*now = now.Add(30 * time.Minute)
+	_, err = manager.Collect(false)
+	assert.NoError(t, err)
+	assert.Nil(t, store.runtimes[pluginA].OrphanedAt)
+
+	store.installations[pluginA] = 0
+	*now = now.Add(time.Hour)
+	report, err := manager.Collect(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.Deleted)
+	assert.Empty(t, platform.deleted)
+}
+
+func TestWarmup(t *testing.T) {
+	store := newFakeStore(
+		models.ServerlessRuntime{PluginUniqueIdentifier: pluginA, FunctionURL: "http://a", WarmupInterval: 300},
+		models.ServerlessRuntime{PluginUniqueIdentifier: pluginB, FunctionURL: "http://b"},
+	)
+	platform := &fakePlatform{}
+	manager, now := newTestManager(store, platform)
+
+	warmed, err := manager.Warmup()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, warmed)
+	assert.Equal(t, []string{"http://a"}, platform.warmed)
+
+	*now = now.Add(time.Minute)
+	warmed, err = manager.Warmup()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, warmed)
+
+	*now = now.Add(5 * time.Minute)
+	warmed, err = manager.Warmup()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, warmed)
+
+	// orphans are not kept warm
+	orphanedAt := *now
+	store.runtimes[pluginA].OrphanedAt = &orphanedAt
+	*now = now.Add(time.Hour)
+	warmed, err = manager.Warmup()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, warmed)
+}
+
+// blockingPlatform holds the warmups until released
+type blockingPlatform struct {
+	fakePlatform
+
+	release  chan struct{}
+	inflight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (p *blockingPlatform) Warmup(functionURL string) error {
+	current := p.inflight.Add(1)
+	defer p.inflight.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if current <= peak || p.peak.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+	<-p.release
+	return nil
+}
+
+func TestWarmupConcurrently(t *testing.T) {
+	runtimes := []models.ServerlessRuntime{}
+	for i := 0; i < WARMUP_CONCURRENCY*2; i++ {
+		runtimes = append(runtimes, models.ServerlessRuntime{
+			PluginUniqueIdentifier: fmt.Sprintf("langgenius/p%d:0.0.1@%064d", i, i),
+			FunctionURL:            fmt.Sprintf("http://%d", i),
+			WarmupInterval:         60,
+		})
+	}
+	platform := &blockingPlatform{release: make(chan struct{})}
+	manager, _ := newTestManager(newFakeStore(runtimes...), platform)
+
+	done := make(chan int)
+	go func() {
+		warmed, err := manager.Warmup()
+		assert.NoError(t, err)
+		done <- warmed
+	}()
+
+	// slow functions don't hold up the others, up to the limit
+	assert.Eventually(t, func() bool {
+		return platform.inflight.Load() == WARMUP_CONCURRENCY
+	}, time.Second, 10*time.Millisecond)
+
+	close(platform.release)
+	assert.Equal(t, WARMUP_CONCURRENCY*2, <-done)
+	assert.Equal(t, int32(WARMUP_CONCURRENCY), platform.peak.Load())
+}
+
+func TestRedeploy(t *testing.T) {
+	routine.InitPool(1024)
+
+	orphanedAt := time.Now()
+	store := newFakeStore(
+		models.ServerlessRuntime{PluginUniqueIdentifier: pluginA},
+		models.ServerlessRuntime{PluginUniqueIdentifier: pluginB},
+		models.ServerlessRuntime{
+			PluginUniqueIdentifier: "langgenius/c:0.0.1@0000000000000000000000000000000000000000000000000000000000000003",
+			OrphanedAt:             &orphanedAt,
+		},
+	)
+	platform := &fakePlatform{redeployErr: map[string]error{pluginB: errors.New("build failed")}}
+	manager, _ := newTestManager(store, platform)
+
+	response, err := manager.Redeploy(nil)
+	assert.NoError(t, err)
+
+	results := map[string]RedeployEvent{}
+	var done *RedeployResponse
+	response.Async(func(r RedeployResponse) {
+		switch r.Event {
+		case RedeployEventSuccess, RedeployEventError:
+			results[r.PluginUniqueIdentifier] = r.Event
+		case RedeployEventDone:
+			done = &r
+		}
+	})
+
+	assert.ElementsMatch(t, []string{pluginA, pluginB}, platform.redeployed)
+	assert.Equal(t, map[string]RedeployEvent{
+		pluginA: RedeployEventSuccess,
+		pluginB: RedeployEventError,
+	}, results)
+	if assert.NotNil(t, done) {
+		assert.Equal(t, "redeployed 1 functions, 1 failed", done.Message)
+	}
+
+	// only the given functions
+	platform.redeployed = nil
+	response, err = manager.Redeploy([]plugin_entities.PluginUniqueIdentifier{pluginA})
+	assert.NoError(t, err)
+	response.Async(func(r RedeployResponse) {})
+	assert.Equal(t, []string{pluginA}, platform.redeployed)
+
+	_, err = manager.Redeploy([]plugin_entities.PluginUniqueIdentifier{"langgenius/d:0.0.1@0000000000000000000000000000000000000000000000000000000000000004"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package serverless_runtime
+
+import (
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/mapping"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreaker stops invoking a serverless function after consecutive failures,
+// once the cooldown is over a single probe decides whether the circuit closes again
+type CircuitBreaker struct {
+	lock sync.Mutex
+
+	threshold int
+	cooldown  time.Duration
+
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probedAt time.Time
+
+	now func() time.Time
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// the breakers are shared by all runtimes of a function as runtimes are created for each invocation
+var circuitBreakers mapping.Map[string, *CircuitBreaker]
+
+// CircuitBreakerFor returns the breaker of the function, it's created on first use
+func CircuitBreakerFor(functionURL string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	breaker, _ := circuitBreakers.LoadOrStore(functionURL, NewCircuitBreaker(threshold, cooldown))
+	return breaker
+}
+
+// Allow reports whether a request may be sent, otherwise how long the circuit stays open
+func (b *CircuitBreaker) Allow() (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	switch b.state {
+	case circuitOpen:
+		if remaining := b.openedAt.Add(b.cooldown).Sub(now); remaining > 0 {
+			return false, remaining
+		}
+		b.state = circuitHalfOpen
+		b.probedAt = now
+		return true, 0
+	case circuitHalfOpen:
+		// a probe which never reported back must not keep the circuit half-open forever
+		if now.Sub(b.probedAt) < b.cooldown {
+			return false, b.probedAt.Add(b.cooldown).Sub(now)
+		}
+		b.probedAt = now
+		return true, 0
+	}
+
+	return true, 0
+}
+
+// Success closes the circuit
+func (b *CircuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state = circuitClosed
+	b.failures = 0
+}
+
+// Failure opens the circuit once the threshold is reached or the probe failed
+func (b *CircuitBreaker) Failure() {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = b.now()
+	}
+}
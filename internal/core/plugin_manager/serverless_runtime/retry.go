@@ -0,0 +1,270 @@
+package serverless_runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/http_requests"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+// RetryPolicy of invokes, only failures before the first streamed byte are retried
+// as the plugin may have done something irreversible once it started to respond
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	// timeouts may come after the function started to work, they are only retried if enabled,
+	// both gateway timeouts and cold start timeouts
+	RetryTimeouts bool
+}
+
+func (p RetryPolicy) attempts() int {
+	return max(p.MaxAttempts, 1)
+}
+
+// delay before the next attempt, exponential with jitter and capped by MaxBackoff
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	if p.Backoff <= 0 {
+		return 0
+	}
+
+	delay := time.Duration(float64(p.Backoff) * math.Pow(2, float64(attempt)))
+	if p.MaxBackoff > 0 && (delay > p.MaxBackoff || delay <= 0) {
+		delay = p.MaxBackoff
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter accepts both forms of the header, delay in seconds and http date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+
+	return 0, false
+}
+
+// closes the context of the attempt along with the body
+type attemptBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *attemptBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// send a single request, the function has to respond within the cold start timeout
+func (r *ServerlessPluginRuntime) attempt(
+	ctx context.Context,
+	url string,
+	headers map[string]string,
+	data []byte,
+) (*http.Response, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var timedOut atomic.Bool
+	var timer *time.Timer
+	if r.ColdStartTimeout > 0 {
+		timer = time.AfterFunc(r.ColdStartTimeout, func() {
+			timedOut.Store(true)
+			cancel()
+		})
+	}
+
+	response, err := http_requests.Request(
+		r.client, url, "POST",
+		http_requests.HttpHeader(headers),
+		http_requests.HttpPayloadReader(io.NopCloser(bytes.NewReader(data))),
+		http_requests.HttpReadTimeout(int64(r.PluginMaxExecutionTimeout*1000)),
+		http_requests.HttpContext(ctx),
+	)
+
+	if timer != nil && !timer.Stop() && err == nil {
+		// the timer fired right after the response arrived, its context is gone already
+		response.Body.Close()
+		err = context.DeadlineExceeded
+	}
+
+	if err != nil {
+		cancel()
+		return nil, timedOut.Load(), err
+	}
+
+	response.Body = &attemptBody{ReadCloser: response.Body, cancel: cancel}
+	return response, false, nil
+}
+
+// invoke the function, retrying failures before the first streamed byte
+// a nil response without error means the session was cancelled
+func (r *ServerlessPluginRuntime) invoke(
+	ctx context.Context,
+	url string,
+	headers map[string]string,
+	data []byte,
+) (*http.Response, *plugin_entities.ErrorResponse) {
+	if allowed, remaining := r.CircuitBreaker.Allow(); !allowed {
+		return nil, &plugin_entities.ErrorResponse{
+			ErrorType: exception.PluginUnavailableError,
+			Message:   "plugin is unavailable after consecutive failures, circuit breaker is open",
+			Args: map[string]any{
+				"retry_after": int(math.Ceil(remaining.Seconds())),
+			},
+		}
+	}
+
+	response, errResponse, unhealthy := r.invokeWithRetry(ctx, url, headers, data)
+	if response == nil && errResponse == nil {
+		// cancelled sessions say nothing about the function
+		return nil, nil
+	}
+
+	// the breaker counts invocations, retries of the same invocation are a single failure
+	if unhealthy {
+		r.CircuitBreaker.Failure()
+	} else {
+		r.CircuitBreaker.Success()
+	}
+
+	return response, errResponse
+}
+
+// connectionFailed reports whether the request failed before it reached the function, e.g. refused or unresolved
+func connectionFailed(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryable reports whether the status is worth another attempt,
+// throttling and unavailable functions are retried, other statuses are left to the caller
+func (p RetryPolicy) retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusGatewayTimeout:
+		return p.RetryTimeouts
+	}
+	return false
+}
+
+// invokeWithRetry returns whether the last failure says the function is unhealthy,
+// throttling says nothing about the health of the function
+func (r *ServerlessPluginRuntime) invokeWithRetry(
+	ctx context.Context,
+	url string,
+	headers map[string]string,
+	data []byte,
+) (*http.Response, *plugin_entities.ErrorResponse, bool) {
+	var lastErr *plugin_entities.ErrorResponse
+	var unhealthy bool
+	var delay time.Duration
+
+	for attempt := 0; attempt < r.RetryPolicy.attempts(); attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, nil, false
+			case <-time.After(delay):
+			}
+		}
+
+		delay = r.RetryPolicy.delay(attempt)
+
+		response, coldStart, err := r.attempt(ctx, url, headers, data)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, false
+			}
+
+			unhealthy = true
+			if coldStart {
+				lastErr = &plugin_entities.ErrorResponse{
+					ErrorType: exception.PluginColdStartTimeoutError,
+					Message: fmt.Sprintf(
+						"plugin did not respond within %s, it may be starting up",
+						r.ColdStartTimeout,
+					),
+				}
+				if !r.RetryPolicy.RetryTimeouts {
+					return nil, lastErr, unhealthy
+				}
+			} else {
+				lastErr = &plugin_entities.ErrorResponse{
+					ErrorType: exception.PluginUnavailableError,
+					Message:   fmt.Sprintf("Error sending request to serverless function: %v", err),
+				}
+				// the request may have reached the function unless the connection failed
+				if !connectionFailed(err) {
+					return nil, lastErr, unhealthy
+				}
+			}
+			continue
+		}
+
+		if !r.RetryPolicy.retryable(response.StatusCode) {
+			if response.StatusCode != http.StatusBadGateway && response.StatusCode != http.StatusGatewayTimeout {
+				return response, nil, false
+			}
+			// the gateway gave up on the function, it may have done some work already
+			io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+			response.Body.Close()
+			return nil, &plugin_entities.ErrorResponse{
+				ErrorType: exception.PluginUnavailableError,
+				Message:   fmt.Sprintf("serverless function responded with %s", response.Status),
+			}, true
+		}
+
+		retryAfter, hasRetryAfter := parseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+		io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+		response.Body.Close()
+
+		if response.StatusCode == http.StatusTooManyRequests {
+			unhealthy = false
+			lastErr = &plugin_entities.ErrorResponse{
+				ErrorType: exception.PluginThrottledError,
+				Message:   "plugin is throttled by the serverless platform, too many concurrent invocations",
+			}
+		} else {
+			unhealthy = true
+			lastErr = &plugin_entities.ErrorResponse{
+				ErrorType: exception.PluginUnavailableError,
+				Message:   fmt.Sprintf("serverless function responded with %s", response.Status),
+			}
+		}
+
+		if hasRetryAfter {
+			lastErr.Args = map[string]any{
+				"retry_after": int(math.Ceil(retryAfter.Seconds())),
+			}
+			// waiting longer than the policy allows is left to the caller
+			if r.RetryPolicy.MaxBackoff > 0 && retryAfter > r.RetryPolicy.MaxBackoff {
+				return nil, lastErr, unhealthy
+			}
+			delay = max(delay, retryAfter)
+		}
+	}
+
+	return nil, lastErr, unhealthy
+}
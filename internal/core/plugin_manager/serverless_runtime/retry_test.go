@@ -0,0 +1,298 @@
+package serverless_runtime
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRuntime(t *testing.T, policy RetryPolicy) *ServerlessPluginRuntime {
+	runtime := &ServerlessPluginRuntime{
+		PluginMaxExecutionTimeout: 10,
+		RetryPolicy:               policy,
+	}
+	assert.NoError(t, runtime.InitEnvironment())
+	return runtime
+}
+
+// blocks until the client goes away, the body has to be consumed for the server to notice
+func waitForClient(r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+	select {
+	case <-r.Context().Done():
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func TestInvokeRetriesUnavailableFunction(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "payload", string(body))
+		if hits.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("data: ok\n\n"))
+	}))
+	defer server.Close()
+
+	runtime := newTestRuntime(t, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	response, errResponse := runtime.invoke(context.Background(), server.URL, nil, []byte("payload"))
+	assert.Nil(t, errResponse)
+	assert.NotNil(t, response)
+	response.Body.Close()
+	assert.Equal(t, int32(3), hits.Load())
+}
+
+func TestInvokeDoesNotRetryStartedStream(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	runtime := newTestRuntime(t, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	response, errResponse := runtime.invoke(context.Background(), server.URL, nil, nil)
+	assert.Nil(t, errResponse)
+	assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+	response.Body.Close()
+	assert.Equal(t, int32(1), hits.Load())
+}
+
+func TestInvokeRespectsRetryAfter(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	// the function asks for longer than the policy allows to wait
+	runtime := newTestRuntime(t, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 100 * time.Millisecond})
+	response, errResponse := runtime.invoke(context.Background(), server.URL, nil, nil)
+	assert.Nil(t, response)
+	assert.Equal(t, exception.PluginThrottledError, errResponse.ErrorType)
+	assert.Equal(t, 1, errResponse.Args["retry_after"])
+	assert.Equal(t, int32(1), hits.Load())
+
+	// otherwise the delay is waited before retrying
+	hits.Store(0)
+	runtime.RetryPolicy.MaxBackoff = 5 * time.Second
+	runtime.RetryPolicy.MaxAttempts = 2
+	start := time.Now()
+	_, errResponse = runtime.invoke(context.Background(), server.URL, nil, nil)
+	assert.Equal(t, exception.PluginThrottledError, errResponse.ErrorType)
+	assert.Equal(t, int32(2), hits.Load())
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestInvokeColdStartTimeout(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		waitForClient(r)
+	}))
+	defer server.Close()
+
+	// the function may be working already, the invocation fails without retrying
+	runtime := newTestRuntime(t, RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond})
+	runtime.ColdStartTimeout = 50 * time.Millisecond
+	response, errResponse := runtime.invoke(context.Background(), server.URL, nil, nil)
+	assert.Nil(t, response)
+	assert.Equal(t, exception.PluginColdStartTimeoutError, errResponse.ErrorType)
+	assert.Equal(t, int32(1), hits.Load())
+
+	// timeouts are retried if enabled
+	runtime.RetryPolicy.RetryTimeouts = true
+	hits.Store(0)
+	_, errResponse = runtime.invoke(context.Background(), server.URL, nil, nil)
+	assert.Equal(t, exception.PluginColdStartTimeoutError, errResponse.ErrorType)
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+// counts the requests which are sent, including those failing to connect
+type countingTransport struct {
+	attempts atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.attempts.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestInvokeRetriesFailedConnection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	transport := &countingTransport{}
+	runtime := newTestRuntime(t, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	runtime.client.Transport = transport
+
+	response, errResponse := runtime.invoke(context.Background(), server.URL, nil, nil)
+	assert.Nil(t, response)
+	assert.Equal(t, exception.PluginUnavailableError, errResponse.ErrorType)
+	assert.Equal(t, int32(3), transport.attempts.Load())
+}
+
+func TestInvokeDoesNotRetryDroppedConnection(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		io.Copy(io.Discard, r.Body)
+		// the request reached the function, the connection is lost before the response
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if assert.NoError(t, err) {
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	runtime := newTestRuntime(t, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	response, errResponse := runtime.invoke(context.Background(), server.URL, nil, []byte("payload"))
+	assert.Nil(t, response)
+	assert.Equal(t, exception.PluginUnavailableError, errResponse.ErrorType)
+	assert.Equal(t, int32(1), hits.Load())
+}
+
+func TestInvokeDoesNotRetryGatewayErrors(t *testing.T) {
+	var hits atomic.Int32
+	status := http.StatusBadGateway
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	// the function may have started to work behind the gateway
+	runtime := newTestRuntime(t, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	for _, status = range []int{http.StatusBadGateway, http.StatusGatewayTimeout} {
+		hits.Store(0)
+		response, errResponse := runtime.invoke(context.Background(), server.URL, nil, nil)
+		assert.Nil(t, response)
+		assert.Equal(t, exception.PluginUnavailableError, errResponse.ErrorType)
+		assert.Equal(t, int32(1), hits.Load())
+	}
+
+	// gateway timeouts are retried if enabled
+	runtime.RetryPolicy.RetryTimeouts = true
+	hits.Store(0)
+	_, errResponse := runtime.invoke(context.Background(), server.URL, nil, nil)
+	assert.Equal(t, exception.PluginUnavailableError, errResponse.ErrorType)
+	assert.Equal(t, int32(3), hits.Load())
+}
+
+func TestInvokeCircuitBreaker(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	runtime := newTestRuntime(t, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	runtime.CircuitBreaker = NewCircuitBreaker(2, time.Minute)
+
+	// the retries of an invocation count as a single failure
+	_, errResponse := runtime.invoke(context.Background(), server.URL, nil, nil)
+	assert.Equal(t, exception.PluginUnavailableError, errResponse.ErrorType)
+	assert.Equal(t, int32(3), hits.Load())
+	assert.Nil(t, errResponse.Args)
+
+	_, errResponse = runtime.invoke(context.Background(), server.URL, nil, nil)
+	assert.Equal(t, exception.PluginUnavailableError, errResponse.ErrorType)
+	assert.Equal(t, int32(6), hits.Load())
+
+	// the open circuit rejects invocations without reaching the function
+	_, errResponse = runtime.invoke(context.Background(), server.URL, nil, nil)
+	assert.Equal(t, exception.PluginUnavailableError, errResponse.ErrorType)
+	assert.Equal(t, 60, errResponse.Args["retry_after"])
+	assert.Equal(t, int32(6), hits.Load())
+}
+
+func TestInvokeThrottledKeepsCircuitClosed(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	runtime := newTestRuntime(t, RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond})
+	runtime.CircuitBreaker = NewCircuitBreaker(1, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		_, errResponse := runtime.invoke(context.Background(), server.URL, nil, nil)
+		assert.Equal(t, exception.PluginThrottledError, errResponse.ErrorType)
+	}
+	assert.Equal(t, int32(4), hits.Load())
+}
+
+func TestInvokeCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		waitForClient(r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	runtime := newTestRuntime(t, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	response, errResponse := runtime.invoke(ctx, server.URL, nil, nil)
+	assert.Nil(t, response)
+	assert.Nil(t, errResponse)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	delay, ok := parseRetryAfter("3", now)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+
+	delay, ok = parseRetryAfter(now.Add(5*time.Second).Format(http.TimeFormat), now)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, delay)
+
+	_, ok = parseRetryAfter("soon", now)
+	assert.False(t, ok)
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(1, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Failure()
+	allowed, remaining := breaker.Allow()
+	assert.False(t, allowed)
+	assert.Equal(t, time.Minute, remaining)
+
+	// a single probe is let through after the cooldown
+	now = now.Add(time.Minute)
+	allowed, _ = breaker.Allow()
+	assert.True(t, allowed)
+	allowed, _ = breaker.Allow()
+	assert.False(t, allowed)
+
+	// a failed probe opens the circuit again
+	breaker.Failure()
+	allowed, _ = breaker.Allow()
+	assert.False(t, allowed)
+
+	now = now.Add(time.Minute)
+	allowed, _ = breaker.Allow()
+	assert.True(t, allowed)
+	breaker.Success()
+	allowed, _ = breaker.Allow()
+	assert.True(t, allowed)
+}
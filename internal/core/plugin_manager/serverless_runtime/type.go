@@ -1,7 +1,9 @@
 package serverless_runtime
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/basic_runtime"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/mapping"
@@ -19,8 +21,20 @@ type ServerlessPluginRuntime struct {
 
 	// listeners mapping session id to the listener
 	listeners mapping.Map[string, *entities.Broadcast[plugin_entities.SessionMessage]]
+	// cancels mapping session id to the function which aborts the in-flight request
+	cancels mapping.Map[string, context.CancelFunc]
 
 	client *http.Client
 
 	PluginMaxExecutionTimeout int // in seconds
+
+	// retries of invocations failing before the first streamed byte
+	RetryPolicy RetryPolicy
+	// time allowed for the function to respond, longer cold starts fail the attempt, disabled if 0
+	ColdStartTimeout time.Duration
+	// shared by all runtimes of the function, optional
+	CircuitBreaker *CircuitBreaker
+
+	// issues the token which authenticates backwards invocations of the session, optional
+	CallbackToken func(sessionId string) (string, error)
 }
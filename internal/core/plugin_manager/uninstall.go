@@ -1,11 +1,12 @@
 package plugin_manager
 
 import (
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/local_runtime"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
 )
 
 // UninstallFromLocal uninstalls a plugin from local storage
-// once deleted, local runtime will automatically shutdown and exit after several time
+// once deleted, local runtime will automatically shutdown and exit after its in-flight sessions finished
 func (p *PluginManager) UninstallFromLocal(identity plugin_entities.PluginUniqueIdentifier) error {
 	if err := p.installedBucket.Delete(identity); err != nil {
 		return err
@@ -16,6 +17,10 @@ func (p *PluginManager) UninstallFromLocal(identity plugin_entities.PluginUnique
 		// no runtime to shutdown, already uninstalled
 		return nil
 	}
+	if localRuntime, ok := runtime.(*local_runtime.LocalPluginRuntime); ok {
+		p.drainRuntime(identity.String(), localRuntime)
+		return nil
+	}
 	runtime.Stop()
 	return nil
 }
@@ -0,0 +1,87 @@
+package plugin_manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/local_runtime"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+const (
+	// the interval to check whether a draining runtime still has in-flight sessions
+	DRAIN_CHECK_INTERVAL = time.Second
+)
+
+var ErrPluginUnhealthy = errors.New("plugin is unhealthy")
+
+// drainableRuntime is a runtime which can be stopped once its in-flight sessions finished
+type drainableRuntime interface {
+	ActiveSessions() int
+	Stopped() bool
+	Stop()
+}
+
+// CheckLocalPluginHealth waits for the runtime of a freshly installed local plugin to become healthy,
+// upgrades use it to make sure the new version serves requests before installations are switched to it
+func (p *PluginManager) CheckLocalPluginHealth(identity plugin_entities.PluginUniqueIdentifier) error {
+	lifetime, ok := p.m.Load(identity.String())
+	if !ok {
+		return errors.Join(ErrPluginUnhealthy, fmt.Errorf("runtime of plugin %s not found", identity))
+	}
+
+	runtime, ok := lifetime.(*local_runtime.LocalPluginRuntime)
+	if !ok {
+		return nil
+	}
+
+	if err := runtime.CheckHealth(
+		time.Duration(p.config.PluginUpgradeHealthCheckTimeout)*time.Second,
+		time.Duration(p.config.PluginUpgradeStabilizationPeriod)*time.Second,
+	); err != nil {
+		return errors.Join(ErrPluginUnhealthy, err)
+	}
+
+	return nil
+}
+
+// drainRuntime stops a runtime once its in-flight sessions finished or the drain timeout passed,
+// the runtime keeps serving its sessions meanwhile, runtimes already draining are ignored
+func (p *PluginManager) drainRuntime(identity string, runtime drainableRuntime) {
+	if _, draining := p.drainingRuntimes.LoadOrStore(runtime, true); draining {
+		return
+	}
+
+	routine.Submit(map[string]string{
+		"module":    "plugin_manager",
+		"function":  "drainRuntime",
+		"plugin_id": identity,
+	}, func() {
+		defer p.drainingRuntimes.Delete(runtime)
+
+		timeout := time.Duration(p.config.PluginDrainTimeout) * time.Second
+		if !waitForDrained(runtime, timeout, DRAIN_CHECK_INTERVAL) {
+			log.Warn(
+				"plugin %s still has %d in-flight sessions after %s, stopping it anyway",
+				identity, runtime.ActiveSessions(), timeout,
+			)
+		}
+
+		runtime.Stop()
+	})
+}
+
+// waitForDrained returns true once the runtime has no in-flight sessions, false if the timeout passed
+func waitForDrained(runtime drainableRuntime, timeout time.Duration, interval time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for runtime.ActiveSessions() > 0 && !runtime.Stopped() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(interval)
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package plugin_manager
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDrainableRuntime struct {
+	sessions int32
+	stopped  int32
+	stops    int32
+}
+
+func (r *fakeDrainableRuntime) ActiveSessions() int {
+	return int(atomic.LoadInt32(&r.sessions))
+}
+
+func (r *fakeDrainableRuntime) Stopped() bool {
+	return atomic.LoadInt32(&r.stopped) == 1
+}
+
+func (r *fakeDrainableRuntime) Stop() {
+	atomic.StoreInt32(&r.stopped, 1)
+	atomic.AddInt32(&r.stops, 1)
+}
+
+func TestWaitForDrained(t *testing.T) {
+	runtime := &fakeDrainableRuntime{sessions: 2}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(&runtime.sessions, 0)
+	}()
+	assert.True(t, waitForDrained(runtime, time.Second, 10*time.Millisecond))
+
+	// sessions which never finish are given up on after the timeout
+	atomic.StoreInt32(&runtime.sessions, 1)
+	assert.False(t, waitForDrained(runtime, 50*time.Millisecond, 10*time.Millisecond))
+}
+
+func TestDrainRuntime(t *testing.T) {
+	routine.InitPool(1024)
+
+	manager := &PluginManager{config: &app.Config{PluginDrainTimeout: 10}}
+	runtime := &fakeDrainableRuntime{sessions: 1}
+
+	manager.drainRuntime("langgenius/test:0.0.1", runtime)
+	// draining twice doesn't stop the runtime twice
+	manager.drainRuntime("langgenius/test:0.0.1", runtime)
+
+	// in-flight sessions keep the runtime alive
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, runtime.Stopped())
+
+	atomic.StoreInt32(&runtime.sessions, 0)
+	assert.Eventually(t, runtime.Stopped, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runtime.stops))
+
+	assert.Eventually(t, func() bool {
+		_, draining := manager.drainingRuntimes.Load(runtime)
+		return !draining
+	}, time.Second, 10*time.Millisecond)
+}
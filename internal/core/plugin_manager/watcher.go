@@ -138,7 +138,7 @@ func (p *PluginManager) removeUninstalledLocalPlugins() {
 			return true
 		}
 
-		// check if plugin is deleted, stop it if so
+		// check if plugin is deleted, stop it once its in-flight sessions finished if so
 		exists, err := p.installedBucket.Exists(pluginUniqueIdentifier)
 		if err != nil {
 			log.Error("check if plugin is deleted failed: %s", err.Error())
@@ -146,7 +146,7 @@ func (p *PluginManager) removeUninstalledLocalPlugins() {
 		}
 
 		if !exists {
-			runtime.Stop()
+			p.drainRuntime(pluginUniqueIdentifier.String(), runtime)
 		}
 
 		return true
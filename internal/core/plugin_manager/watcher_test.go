@@ -15,6 +15,7 @@ import (
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/manifest_entities"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"golang.org/x/net/websocket"
 )
 
 type fakePlugin struct {
@@ -109,6 +110,9 @@ func (f *fakeRemotePluginServer) Wrap(fn func(plugin_entities.PluginFullDuplexLi
 	fn(getRandomPluginRuntime())
 }
 
+func (f *fakeRemotePluginServer) ServeWebSocket(ws *websocket.Conn, remoteAddress string) {
+}
+
 func TestRemotePluginWatcherPluginStoredToManager(t *testing.T) {
 	config := &app.Config{}
 	config.SetDefault()
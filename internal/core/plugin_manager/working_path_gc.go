@@ -0,0 +1,91 @@
+package plugin_manager
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/working_path_gc"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+var ErrWorkingPathGCDisabled = errors.New("working path gc is only available on local platform")
+
+func (p *PluginManager) startWorkingPathGC(config *app.Config) {
+	p.workingPathGC = working_path_gc.NewCollector(
+		config.PluginWorkingPath,
+		time.Duration(config.PluginWorkingPathGCGracePeriod)*time.Second,
+	)
+
+	// directories are only removed if enabled, the disk usage is measured anyway
+	dryRun := config.PluginWorkingPathGCEnabled == nil || !*config.PluginWorkingPathGCEnabled
+
+	routine.Submit(map[string]string{
+		"module":   "plugin_manager",
+		"function": "startWorkingPathGC",
+	}, func() {
+		ticker := time.NewTicker(time.Duration(config.PluginWorkingPathGCInterval) * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			report, err := p.CollectWorkingPaths(dryRun)
+			if err != nil {
+				log.Error("working path gc failed: %s", err.Error())
+				continue
+			}
+
+			if report.Removed > 0 {
+				log.Info(
+					"working path gc removed %d directories, reclaimed %d bytes, disk usage %d bytes",
+					report.Removed, report.ReclaimedSize, report.DiskUsage-report.ReclaimedSize,
+				)
+			}
+		}
+	})
+}
+
+// CollectWorkingPaths removes working directories of plugins which are neither installed nor running
+func (p *PluginManager) CollectWorkingPaths(dryRun bool) (*working_path_gc.Report, error) {
+	if p.workingPathGC == nil {
+		return nil, ErrWorkingPathGCDisabled
+	}
+
+	installed, err := p.installedBucket.List()
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to list installed plugins"))
+	}
+
+	inUse := map[string]bool{}
+	for _, identity := range installed {
+		inUse[workingDirName(identity)] = true
+	}
+
+	p.m.Range(func(key string, runtime plugin_entities.PluginLifetime) bool {
+		workingPath := runtime.RuntimeState().WorkingPath
+		if workingPath == "" {
+			return true
+		}
+		if relPath, err := p.workingPathGC.RelativePath(workingPath); err == nil {
+			inUse[relPath] = true
+		}
+		return true
+	})
+
+	return p.workingPathGC.Collect(inUse, dryRun)
+}
+
+// WorkingPathDiskUsage returns the size of the plugin working path of this node, -1 if unknown
+func (p *PluginManager) WorkingPathDiskUsage() int64 {
+	if p.workingPathGC == nil {
+		return -1
+	}
+	return p.workingPathGC.DiskUsage()
+}
+
+// workingDirName returns the working directory of an installed plugin relative to the plugin working path
+func workingDirName(identity plugin_entities.PluginUniqueIdentifier) string {
+	return strings.ReplaceAll(identity.String(), ":", "-")
+}
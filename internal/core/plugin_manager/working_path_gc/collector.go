@@ -0,0 +1,259 @@
+package working_path_gc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// working directories are named `<name>-<version>@<checksum>`, optionally under an author directory
+	workingDirPattern = regexp.MustCompile(`^[a-z0-9_-]{1,255}-[0-9]{1,4}(\.[0-9]{1,4}){1,3}(-\w{1,16})?@[a-f0-9]{32,64}$`)
+	authorDirPattern  = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+)
+
+// the orphans are kept in the plugin working path, so the grace period survives restarts
+const STATE_FILE = ".working_path_gc.json"
+
+// Orphan is a working directory neither installed nor used by a running runtime
+type Orphan struct {
+	// relative to the plugin working path
+	Path string `json:"path"`
+	// apparent size, files hard linked to the dependency cache are included
+	Size       int64     `json:"size"`
+	OrphanedAt time.Time `json:"orphaned_at"`
+	// whether the grace period has elapsed
+	Reclaimable bool `json:"reclaimable"`
+}
+
+type Report struct {
+	DryRun bool `json:"dry_run"`
+	// size of the whole plugin working path
+	DiskUsage       int64    `json:"disk_usage"`
+	Orphans         []Orphan `json:"orphans"`
+	ReclaimableSize int64    `json:"reclaimable_size"`
+	Removed         int      `json:"removed"`
+	ReclaimedSize   int64    `json:"reclaimed_size"`
+}
+
+// Collector removes working directories left behind by upgrades and uninstalls
+// a directory is removed once it has been orphaned for the whole grace period
+type Collector struct {
+	root        string
+	gracePeriod time.Duration
+
+	lock       sync.Mutex
+	orphanedAt map[string]time.Time
+
+	diskUsage atomic.Int64
+}
+
+func NewCollector(root string, gracePeriod time.Duration) *Collector {
+	c := &Collector{
+		root:        root,
+		gracePeriod: gracePeriod,
+		orphanedAt:  map[string]time.Time{},
+	}
+	c.diskUsage.Store(-1)
+
+	// a missing or broken state starts the grace period of all orphans again
+	if data, err := os.ReadFile(filepath.Join(root, STATE_FILE)); err == nil {
+		orphanedAt := map[string]time.Time{}
+		if err := json.Unmarshal(data, &orphanedAt); err == nil {
+			c.orphanedAt = orphanedAt
+		}
+	}
+	return c
+}
+
+// DiskUsage returns the size of the plugin working path measured by the last collection, -1 if unknown
+func (c *Collector) DiskUsage() int64 {
+	return c.diskUsage.Load()
+}
+
+// RelativePath returns the path of a working directory relative to the plugin working path
+func (c *Collector) RelativePath(workingPath string) (string, error) {
+	root, err := filepath.Abs(c.root)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(workingPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(root, abs)
+}
+
+// Collect removes orphaned working directories, inUse contains the relative paths
+// of installed plugins and running runtimes, nothing is removed in dry run mode
+func (c *Collector) Collect(inUse map[string]bool, dryRun bool) (*Report, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	report := &Report{DryRun: dryRun, Orphans: []Orphan{}}
+
+	usage, err := dirSize(c.root)
+	if err != nil {
+		return nil, err
+	}
+	report.DiskUsage = usage
+	c.diskUsage.Store(usage)
+
+	dirs, err := c.workingDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if inUse[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		orphanedAt, ok := c.orphanedAt[dir]
+		if !ok {
+			orphanedAt = now
+			if !dryRun {
+				c.orphanedAt[dir] = now
+			}
+		}
+
+		size, err := dirSize(filepath.Join(c.root, dir))
+		if err != nil {
+			return nil, err
+		}
+
+		orphan := Orphan{
+			Path:        dir,
+			Size:        size,
+			OrphanedAt:  orphanedAt,
+			Reclaimable: now.Sub(orphanedAt) >= c.gracePeriod,
+		}
+		report.Orphans = append(report.Orphans, orphan)
+
+		if !orphan.Reclaimable {
+			continue
+		}
+		report.ReclaimableSize += size
+
+		if dryRun {
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(c.root, dir)); err != nil {
+			return report, fmt.Errorf("failed to remove %s: %s", dir, err)
+		}
+		delete(c.orphanedAt, dir)
+		report.Removed++
+		report.ReclaimedSize += size
+
+		// remove the author directory once it's empty
+		if parent := filepath.Dir(dir); parent != "." {
+			os.Remove(filepath.Join(c.root, parent))
+		}
+	}
+
+	if !dryRun {
+		// directories in use again or removed by others are no longer tracked
+		for dir := range c.orphanedAt {
+			if !seen[dir] {
+				delete(c.orphanedAt, dir)
+			}
+		}
+		c.diskUsage.Store(usage - report.ReclaimedSize)
+
+		if err := c.saveState(); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// saveState writes the orphans to the state file, replaced at once so it's never half written
+func (c *Collector) saveState() error {
+	data, err := json.Marshal(c.orphanedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.root, 0755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(c.root, STATE_FILE)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to save working path gc state: %s", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to save working path gc state: %s", err)
+	}
+	return nil
+}
+
+// workingDirs lists the relative paths of all working directories
+func (c *Collector) workingDirs() ([]string, error) {
+	entries, err := os.ReadDir(c.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	dirs := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		if workingDirPattern.MatchString(entry.Name()) {
+			dirs = append(dirs, entry.Name())
+			continue
+		}
+
+		if !authorDirPattern.MatchString(entry.Name()) {
+			continue
+		}
+
+		children, err := os.ReadDir(filepath.Join(c.root, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if child.IsDir() && workingDirPattern.MatchString(child.Name()) {
+				dirs = append(dirs, filepath.Join(entry.Name(), child.Name()))
+			}
+		}
+	}
+
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+func dirSize(root string) (int64, error) {
+	size := int64(0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// removed while walking, e.g. a runtime cleaning up itself
+				return nil
+			}
+			return err
+		}
+		// the state of the gc itself is not counted
+		if info.Mode().IsRegular() && info.Name() != STATE_FILE {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,110 @@
+package working_path_gc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeWorkingDir(t *testing.T, root string, dir string, size int) {
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, dir, ".venv"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, dir, ".venv", "lib"), []byte(strings.Repeat("a", size)), 0644))
+}
+
+func TestCollect(t *testing.T) {
+	root := t.TempDir()
+	checksum := strings.Repeat("a", 64)
+
+	installed := "langgenius/openai-0.0.1@" + checksum
+	running := "langgenius/openai-0.0.2@" + checksum
+	orphan := "langgenius/anthropic-0.0.1@" + checksum
+	authorless := "neko-0.0.1@" + checksum
+
+	makeWorkingDir(t, root, installed, 10)
+	makeWorkingDir(t, root, running, 20)
+	makeWorkingDir(t, root, orphan, 30)
+	makeWorkingDir(t, root, authorless, 40)
+	// not a working directory, e.g. the shared dependency cache
+	makeWorkingDir(t, root, ".dependency_cache", 50)
+
+	inUse := map[string]bool{installed: true, running: true}
+
+	collector := NewCollector(root, time.Hour)
+	assert.Equal(t, int64(-1), collector.DiskUsage())
+
+	report, err := collector.Collect(inUse, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(150), report.DiskUsage)
+	assert.Equal(t, int64(150), collector.DiskUsage())
+	assert.Len(t, report.Orphans, 2)
+	// still in the grace period
+	assert.Equal(t, 0, report.Removed)
+	assert.DirExists(t, filepath.Join(root, orphan))
+
+	// pretend the orphans were seen long ago
+	for dir := range collector.orphanedAt {
+		collector.orphanedAt[dir] = time.Now().Add(-2 * time.Hour)
+	}
+
+	report, err = collector.Collect(inUse, true)
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, int64(70), report.ReclaimableSize)
+	assert.Equal(t, 0, report.Removed)
+	assert.DirExists(t, filepath.Join(root, orphan))
+
+	report, err = collector.Collect(inUse, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Removed)
+	assert.Equal(t, int64(70), report.ReclaimedSize)
+	assert.Equal(t, int64(80), collector.DiskUsage())
+
+	assert.NoDirExists(t, filepath.Join(root, orphan))
+	assert.NoDirExists(t, filepath.Join(root, authorless))
+	assert.DirExists(t, filepath.Join(root, installed))
+	assert.DirExists(t, filepath.Join(root, running))
+	assert.DirExists(t, filepath.Join(root, ".dependency_cache"))
+}
+
+func TestOrphanInUseAgain(t *testing.T) {
+	root := t.TempDir()
+	dir := "langgenius/openai-0.0.1@" + strings.Repeat("b", 64)
+	makeWorkingDir(t, root, dir, 10)
+
+	collector := NewCollector(root, time.Hour)
+	_, err := collector.Collect(map[string]bool{}, false)
+	assert.NoError(t, err)
+	assert.Contains(t, collector.orphanedAt, dir)
+
+	// reinstalled before the grace period elapsed, the orphan is forgotten
+	_, err = collector.Collect(map[string]bool{dir: true}, false)
+	assert.NoError(t, err)
+	assert.NotContains(t, collector.orphanedAt, dir)
+}
+
+func TestOrphansSurviveRestart(t *testing.T) {
+	root := t.TempDir()
+	dir := "langgenius/openai-0.0.1@" + strings.Repeat("c", 64)
+	makeWorkingDir(t, root, dir, 10)
+
+	collector := NewCollector(root, time.Hour)
+	_, err := collector.Collect(map[string]bool{}, false)
+	assert.NoError(t, err)
+	orphanedAt := collector.orphanedAt[dir]
+
+	// the daemon restarts, the grace period goes on
+	restarted := NewCollector(root, time.Hour)
+	report, err := restarted.Collect(map[string]bool{}, true)
+	assert.NoError(t, err)
+	if assert.Len(t, report.Orphans, 1) {
+		assert.True(t, orphanedAt.Equal(report.Orphans[0].OrphanedAt))
+	}
+
+	// the state file is not taken as a working directory
+	assert.FileExists(t, filepath.Join(root, STATE_FILE))
+	assert.DirExists(t, filepath.Join(root, dir))
+}
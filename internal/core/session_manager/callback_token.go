@@ -0,0 +1,150 @@
+package session_manager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+/*
+ * Callback tokens authenticate the backwards invocations of serverless plugins, a token is
+ * issued for each invoke and bound to its session, plugin and tenant.
+ *
+ * Tokens are signed by the daemon and are only valid while their session is alive, issued
+ * tokens are recorded in the cache and removed once the session is closed, so a token can't
+ * be replayed after its session even if it hasn't expired yet.
+ * */
+
+var (
+	ErrInvalidCallbackToken = errors.New("invalid callback token")
+	ErrCallbackTokenExpired = errors.New("callback token expired")
+	ErrCallbackTokenRevoked = errors.New("callback token revoked")
+)
+
+type CallbackTokenClaims struct {
+	SessionID              string                                 `json:"session_id"`
+	PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"plugin_unique_identifier"`
+	TenantID               string                                 `json:"tenant_id"`
+	ExpiresAt              int64                                  `json:"expires_at"`
+}
+
+func callbackTokenKey(sessionID string) string {
+	return fmt.Sprintf("callback_token:%s", sessionID)
+}
+
+func callbackTokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func signCallbackTokenPayload(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignCallbackToken encodes the claims as $payload.$signature
+func SignCallbackToken(secret []byte, claims CallbackTokenClaims) string {
+	data, _ := json.Marshal(claims)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signCallbackTokenPayload(secret, payload)
+}
+
+// ParseCallbackToken checks the signature and the expiry of the token, revocation is not checked
+func ParseCallbackToken(secret []byte, token string, now time.Time) (*CallbackTokenClaims, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCallbackToken
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(signCallbackTokenPayload(secret, payload))) {
+		return nil, ErrInvalidCallbackToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidCallbackToken
+	}
+
+	claims := CallbackTokenClaims{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, ErrInvalidCallbackToken
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrCallbackTokenExpired
+	}
+
+	return &claims, nil
+}
+
+// IssueCallbackToken issues a token for the session, it's revoked once the session is closed
+func (s *Session) IssueCallbackToken(secret []byte, ttl time.Duration) (string, error) {
+	token := SignCallbackToken(secret, CallbackTokenClaims{
+		SessionID:              s.ID,
+		PluginUniqueIdentifier: s.PluginUniqueIdentifier,
+		TenantID:               s.TenantID,
+		ExpiresAt:              time.Now().Add(ttl).Unix(),
+	})
+
+	if err := cache.Store(callbackTokenKey(s.ID), callbackTokenHash(token), ttl); err != nil {
+		return "", err
+	}
+
+	s.lock.Lock()
+	revokeOnClose := !s.callbackTokenIssued
+	s.callbackTokenIssued = true
+	s.lock.Unlock()
+
+	if revokeOnClose {
+		s.OnClose(func() {
+			RevokeCallbackToken(s.ID)
+		})
+	}
+
+	return token, nil
+}
+
+// VerifyCallbackToken returns the claims of a token issued for the session and not revoked yet
+func VerifyCallbackToken(secret []byte, token string, sessionID string) (*CallbackTokenClaims, error) {
+	claims, err := ParseCallbackToken(secret, token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.SessionID != sessionID {
+		return nil, ErrInvalidCallbackToken
+	}
+
+	issued, err := cache.GetString(callbackTokenKey(sessionID))
+	if err == cache.ErrNotFound {
+		return nil, ErrCallbackTokenRevoked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// only the latest token of a session is accepted
+	if !hmac.Equal([]byte(issued), []byte(callbackTokenHash(token))) {
+		return nil, ErrCallbackTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// RevokeCallbackToken revokes the token of the session
+func RevokeCallbackToken(sessionID string) {
+	if _, err := cache.Del(callbackTokenKey(sessionID)); err != nil && err != cache.ErrNotFound {
+		log.Error("failed to revoke callback token of session %s: %s", sessionID, err.Error())
+	}
+}
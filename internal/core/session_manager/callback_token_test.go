@@ -0,0 +1,119 @@
+package session_manager
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupCallbackTokenTest(t *testing.T) *Session {
+	cache.SetClient(&memoryCache{kv: map[string]string{}})
+	t.Cleanup(func() { cache.SetClient(nil) })
+
+	return NewSession(NewSessionPayload{
+		TenantID:               "tenant",
+		PluginUniqueIdentifier: "langgenius/test:0.0.1@0000000000000000000000000000000000000000000000000000000000000000",
+		IgnoreCache:            true,
+	})
+}
+
+func TestCallbackTokenVerify(t *testing.T) {
+	secret := []byte("secret")
+	session := setupCallbackTokenTest(t)
+
+	token, err := session.IssueCallbackToken(secret, time.Minute)
+	assert.NoError(t, err)
+
+	claims, err := VerifyCallbackToken(secret, token, session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, session.ID, claims.SessionID)
+	assert.Equal(t, session.TenantID, claims.TenantID)
+	assert.Equal(t, session.PluginUniqueIdentifier, claims.PluginUniqueIdentifier)
+
+	// tokens are reusable during the session
+	_, err = VerifyCallbackToken(secret, token, session.ID)
+	assert.NoError(t, err)
+}
+
+func TestCallbackTokenForged(t *testing.T) {
+	secret := []byte("secret")
+	session := setupCallbackTokenTest(t)
+
+	token, err := session.IssueCallbackToken(secret, time.Minute)
+	assert.NoError(t, err)
+
+	// signed with another secret
+	_, err = VerifyCallbackToken([]byte("another"), token, session.ID)
+	assert.ErrorIs(t, err, ErrInvalidCallbackToken)
+
+	// claims replaced without resigning
+	forged := SignCallbackToken([]byte("another"), CallbackTokenClaims{
+		SessionID: session.ID,
+		TenantID:  "another_tenant",
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	})
+	payload, _, _ := strings.Cut(forged, ".")
+	_, signature, _ := strings.Cut(token, ".")
+	_, err = VerifyCallbackToken(secret, payload+"."+signature, session.ID)
+	assert.ErrorIs(t, err, ErrInvalidCallbackToken)
+
+	// malformed
+	_, err = VerifyCallbackToken(secret, "token", session.ID)
+	assert.ErrorIs(t, err, ErrInvalidCallbackToken)
+	_, err = VerifyCallbackToken(secret, "", session.ID)
+	assert.ErrorIs(t, err, ErrInvalidCallbackToken)
+}
+
+func TestCallbackTokenBoundToSession(t *testing.T) {
+	secret := []byte("secret")
+	session := setupCallbackTokenTest(t)
+	another := NewSession(NewSessionPayload{TenantID: "tenant", IgnoreCache: true})
+	defer another.Close(CloseSessionPayload{IgnoreCache: true})
+
+	token, err := session.IssueCallbackToken(secret, time.Minute)
+	assert.NoError(t, err)
+	_, err = another.IssueCallbackToken(secret, time.Minute)
+	assert.NoError(t, err)
+
+	_, err = VerifyCallbackToken(secret, token, another.ID)
+	assert.ErrorIs(t, err, ErrInvalidCallbackToken)
+}
+
+func TestCallbackTokenExpired(t *testing.T) {
+	secret := []byte("secret")
+	session := setupCallbackTokenTest(t)
+
+	token := SignCallbackToken(secret, CallbackTokenClaims{
+		SessionID: session.ID,
+		ExpiresAt: time.Now().Add(-time.Second).Unix(),
+	})
+
+	_, err := VerifyCallbackToken(secret, token, session.ID)
+	assert.ErrorIs(t, err, ErrCallbackTokenExpired)
+}
+
+func TestCallbackTokenReplayed(t *testing.T) {
+	secret := []byte("secret")
+	session := setupCallbackTokenTest(t)
+
+	token, err := session.IssueCallbackToken(secret, time.Minute)
+	assert.NoError(t, err)
+
+	// a validly signed token which was never issued
+	unissued := SignCallbackToken(secret, CallbackTokenClaims{
+		SessionID:              session.ID,
+		PluginUniqueIdentifier: session.PluginUniqueIdentifier,
+		TenantID:               session.TenantID,
+		ExpiresAt:              time.Now().Add(time.Hour).Unix(),
+	})
+	_, err = VerifyCallbackToken(secret, unissued, session.ID)
+	assert.ErrorIs(t, err, ErrCallbackTokenRevoked)
+
+	// replayed after the session is closed
+	session.Close(CloseSessionPayload{IgnoreCache: true})
+	_, err = VerifyCallbackToken(secret, token, session.ID)
+	assert.ErrorIs(t, err, ErrCallbackTokenRevoked)
+}
@@ -0,0 +1,98 @@
+package session_manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+)
+
+const (
+	SESSION_CANCELLED_CHANNEL = "session_cancelled"
+)
+
+type sessionCancelledEvent struct {
+	SessionID string `json:"session_id"`
+	Reason    string `json:"reason"`
+}
+
+var (
+	// sessions loaded from cache which are waiting for their cancellation
+	remoteSessions     = map[string]map[*Session]struct{}{}
+	remoteSessionsLock sync.Mutex
+	remoteSessionsOnce sync.Once
+)
+
+// publishSessionCancelled notifies other nodes serving backwards invocations of the session,
+// the marker covers sessions loaded after the event was published
+func publishSessionCancelled(id string, reason string) {
+	if err := cache.Store(sessionCancelledKey(id), reason, time.Minute*30); err != nil {
+		log.Error("set session cancelled marker failed, %s", err)
+	}
+
+	if err := cache.Publish(SESSION_CANCELLED_CHANNEL, sessionCancelledEvent{
+		SessionID: id,
+		Reason:    reason,
+	}); err != nil {
+		log.Error("publish session cancelled event failed, %s", err)
+	}
+}
+
+func remoteSessionCancelled(id string) bool {
+	exists, err := cache.Exist(sessionCancelledKey(id))
+	if err != nil {
+		log.Error("check session cancelled marker failed, %s", err)
+		return false
+	}
+	return exists > 0
+}
+
+func watchRemoteSession(s *Session) {
+	remoteSessionsOnce.Do(subscribeSessionCancelled)
+
+	remoteSessionsLock.Lock()
+	if remoteSessions[s.ID] == nil {
+		remoteSessions[s.ID] = map[*Session]struct{}{}
+	}
+	remoteSessions[s.ID][s] = struct{}{}
+	remoteSessionsLock.Unlock()
+
+	// the event may have been published before the session was watched
+	if remoteSessionCancelled(s.ID) {
+		s.cancel()
+	}
+}
+
+func unwatchRemoteSession(s *Session) {
+	remoteSessionsLock.Lock()
+	defer remoteSessionsLock.Unlock()
+
+	delete(remoteSessions[s.ID], s)
+	if len(remoteSessions[s.ID]) == 0 {
+		delete(remoteSessions, s.ID)
+	}
+}
+
+func subscribeSessionCancelled() {
+	events, _ := cache.Subscribe[sessionCancelledEvent](SESSION_CANCELLED_CHANNEL)
+
+	routine.Submit(map[string]string{
+		"module":   "session_manager",
+		"function": "subscribeSessionCancelled",
+	}, func() {
+		for event := range events {
+			remoteSessionsLock.Lock()
+			watched := make([]*Session, 0, len(remoteSessions[event.SessionID]))
+			for s := range remoteSessions[event.SessionID] {
+				watched = append(watched, s)
+			}
+			remoteSessionsLock.Unlock()
+
+			for _, s := range watched {
+				s.cancel()
+			}
+		}
+	})
+}
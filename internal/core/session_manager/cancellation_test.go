@@ -0,0 +1,220 @@
+package session_manager
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryCache keeps the keys used by sessions in memory
+type memoryCache struct {
+	cache.Client
+
+	lock sync.Mutex
+	kv   map[string]string
+}
+
+func (m *memoryCache) Set(key string, value any, _ time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	switch v := value.(type) {
+	case string:
+		m.kv[key] = v
+	case []byte:
+		m.kv[key] = string(v)
+	}
+	return nil
+}
+
+func (m *memoryCache) GetString(key string) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	v, ok := m.kv[key]
+	if !ok {
+		return "", cache.ErrNotFound
+	}
+	return v, nil
+}
+
+func (m *memoryCache) GetBytes(key string) ([]byte, error) {
+	v, err := m.GetString(key)
+	return []byte(v), err
+}
+
+func (m *memoryCache) Count(keys ...string) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	count := int64(0)
+	for _, key := range keys {
+		if _, ok := m.kv[key]; ok {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *memoryCache) Delete(key string) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.kv[key]; !ok {
+		return 0, nil
+	}
+	delete(m.kv, key)
+	return 1, nil
+}
+
+// the subscription of remote sessions outlives a single test, so the subscribers are shared
+var (
+	memorySubscribers     = map[string][]chan string{}
+	memorySubscribersLock sync.Mutex
+)
+
+type pubSubCache struct {
+	*memoryCache
+}
+
+func (m *pubSubCache) Publish(channel string, message string) error {
+	memorySubscribersLock.Lock()
+	defer memorySubscribersLock.Unlock()
+	for _, ch := range memorySubscribers[channel] {
+		ch <- message
+	}
+	return nil
+}
+
+func (m *pubSubCache) Subscribe(channel string) (<-chan string, func()) {
+	memorySubscribersLock.Lock()
+	defer memorySubscribersLock.Unlock()
+	ch := make(chan string, 16)
+	memorySubscribers[channel] = append(memorySubscribers[channel], ch)
+	return ch, func() {}
+}
+
+type cancellableRuntime struct {
+	plugin_entities.PluginLifetime
+
+	cancelled []string
+}
+
+func (r *cancellableRuntime) Cancel(sessionID string, _ []byte) {
+	r.cancelled = append(r.cancelled, sessionID)
+}
+
+func setupCancellationTest(t *testing.T) {
+	routine.InitPool(1024)
+	cache.SetClient(&pubSubCache{&memoryCache{kv: map[string]string{}}})
+	t.Cleanup(func() { cache.SetClient(nil) })
+}
+
+func TestSessionCancelRunsHandlers(t *testing.T) {
+	session := NewSession(NewSessionPayload{TenantID: "tenant", IgnoreCache: true})
+	defer session.Close(CloseSessionPayload{IgnoreCache: true})
+
+	runtime := &cancellableRuntime{}
+	session.BindRuntime(runtime)
+
+	var calls atomic.Int32
+	session.OnCancel(func() { calls.Add(1) })
+	session.OnCancel(func() { calls.Add(1) })
+
+	session.Cancel(SESSION_CANCEL_REASON_CLIENT_DISCONNECTED)
+	session.Cancel(SESSION_CANCEL_REASON_TIMEOUT)
+
+	assert.True(t, session.Cancelled())
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, []string{session.ID}, runtime.cancelled)
+
+	// handlers registered after the cancellation run immediately
+	session.OnCancel(func() { calls.Add(1) })
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestSessionOnCancelRelease(t *testing.T) {
+	session := NewSession(NewSessionPayload{TenantID: "tenant", IgnoreCache: true})
+	defer session.Close(CloseSessionPayload{IgnoreCache: true})
+
+	var released, kept atomic.Int32
+	release := session.OnCancel(func() { released.Add(1) })
+	session.OnCancel(func() { kept.Add(1) })
+
+	release()
+	assert.Len(t, session.cancelHandlers, 1)
+
+	session.Cancel(SESSION_CANCEL_REASON_TIMEOUT)
+	assert.Equal(t, int32(0), released.Load())
+	assert.Equal(t, int32(1), kept.Load())
+	// handlers are dropped once they ran
+	assert.Nil(t, session.cancelHandlers)
+}
+
+// drops the session from the local map as if it was created by another node
+func forgetSession(id string) {
+	session_lock.Lock()
+	delete(sessions, id)
+	session_lock.Unlock()
+}
+
+func TestRemoteSessionObservesCancellation(t *testing.T) {
+	setupCancellationTest(t)
+
+	origin := NewSession(NewSessionPayload{TenantID: "tenant"})
+	defer origin.Close(CloseSessionPayload{})
+	forgetSession(origin.ID)
+	defer func() {
+		session_lock.Lock()
+		sessions[origin.ID] = origin
+		session_lock.Unlock()
+	}()
+
+	remote := GetSession(GetSessionPayload{ID: origin.ID})
+	assert.NotNil(t, remote)
+	assert.NotSame(t, origin, remote)
+	assert.False(t, remote.Cancelled())
+
+	aborted := make(chan struct{})
+	remote.OnCancel(func() { close(aborted) })
+
+	origin.Cancel(SESSION_CANCEL_REASON_CLIENT_DISCONNECTED)
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("remote session did not observe the cancellation")
+	}
+	assert.True(t, remote.Cancelled())
+
+	remoteSessionsLock.Lock()
+	assert.NotContains(t, remoteSessions, origin.ID)
+	remoteSessionsLock.Unlock()
+
+	// sessions loaded after the cancellation are cancelled already
+	late := GetSession(GetSessionPayload{ID: origin.ID})
+	assert.True(t, late.Cancelled())
+}
+
+func TestRemoteSessionReleasesWatch(t *testing.T) {
+	setupCancellationTest(t)
+
+	origin := NewSession(NewSessionPayload{TenantID: "tenant"})
+	defer origin.Close(CloseSessionPayload{})
+	forgetSession(origin.ID)
+
+	remote := GetSession(GetSessionPayload{ID: origin.ID})
+	release := remote.OnCancel(func() {})
+
+	remoteSessionsLock.Lock()
+	assert.Contains(t, remoteSessions, origin.ID)
+	remoteSessionsLock.Unlock()
+
+	release()
+
+	remoteSessionsLock.Lock()
+	assert.NotContains(t, remoteSessions, origin.ID)
+	remoteSessionsLock.Unlock()
+}
@@ -33,6 +33,8 @@ type Session struct {
 	InvokeFrom             access_types.PluginAccessType          `json:"invoke_from"`
 	Action                 access_types.PluginAccessAction        `json:"action"`
 	Declaration            *plugin_entities.PluginDeclaration     `json:"declaration"`
+	// permission of the installation, backwards invocations must be allowed by both it and the declaration
+	Permission *plugin_entities.PluginPermissionRequirement `json:"permission"`
 
 	// information about incoming request
 	ConversationID *string        `json:"conversation_id"`
@@ -40,27 +42,47 @@ type Session struct {
 	AppID          *string        `json:"app_id"`
 	EndpointID     *string        `json:"endpoint_id"`
 	Context        map[string]any `json:"context"`
+
+	lock sync.Mutex
+	// cancellation of the session, triggered when the caller has gone away
+	cancelled      bool
+	cancelHandlers map[uint64]func()
+	nextHandlerID  uint64
+	// the session is not stored in cache, its cancellation is not visible to other nodes
+	ignoreCache bool
+	// the session was created by another node and loaded from cache,
+	// it's cancelled by the event published by that node
+	remote bool
+	// called once the session is closed, e.g. release resources held by the session
+	closeHandlers []func()
+	// whether a callback token has been issued, it's revoked when the session is closed
+	callbackTokenIssued bool
 }
 
 func sessionKey(id string) string {
 	return fmt.Sprintf("session_info:%s", id)
 }
 
+func sessionCancelledKey(id string) string {
+	return fmt.Sprintf("session_cancelled:%s", id)
+}
+
 type NewSessionPayload struct {
-	TenantID               string                                 `json:"tenant_id"`
-	UserID                 string                                 `json:"user_id"`
-	PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"plugin_unique_identifier"`
-	ClusterID              string                                 `json:"cluster_id"`
-	InvokeFrom             access_types.PluginAccessType          `json:"invoke_from"`
-	Action                 access_types.PluginAccessAction        `json:"action"`
-	Declaration            *plugin_entities.PluginDeclaration     `json:"declaration"`
-	BackwardsInvocation    dify_invocation.BackwardsInvocation    `json:"backwards_invocation"`
-	IgnoreCache            bool                                   `json:"ignore_cache"`
-	ConversationID         *string                                `json:"conversation_id"`
-	MessageID              *string                                `json:"message_id"`
-	AppID                  *string                                `json:"app_id"`
-	EndpointID             *string                                `json:"endpoint_id"`
-	Context                map[string]any                         `json:"context"`
+	TenantID               string                                       `json:"tenant_id"`
+	UserID                 string                                       `json:"user_id"`
+	PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier       `json:"plugin_unique_identifier"`
+	ClusterID              string                                       `json:"cluster_id"`
+	InvokeFrom             access_types.PluginAccessType                `json:"invoke_from"`
+	Action                 access_types.PluginAccessAction              `json:"action"`
+	Declaration            *plugin_entities.PluginDeclaration           `json:"declaration"`
+	Permission             *plugin_entities.PluginPermissionRequirement `json:"permission"`
+	BackwardsInvocation    dify_invocation.BackwardsInvocation          `json:"backwards_invocation"`
+	IgnoreCache            bool                                         `json:"ignore_cache"`
+	ConversationID         *string                                      `json:"conversation_id"`
+	MessageID              *string                                      `json:"message_id"`
+	AppID                  *string                                      `json:"app_id"`
+	EndpointID             *string                                      `json:"endpoint_id"`
+	Context                map[string]any                               `json:"context"`
 }
 
 func NewSession(payload NewSessionPayload) *Session {
@@ -73,12 +95,14 @@ func NewSession(payload NewSessionPayload) *Session {
 		InvokeFrom:             payload.InvokeFrom,
 		Action:                 payload.Action,
 		Declaration:            payload.Declaration,
+		Permission:             payload.Permission,
 		backwardsInvocation:    payload.BackwardsInvocation,
 		ConversationID:         payload.ConversationID,
 		MessageID:              payload.MessageID,
 		AppID:                  payload.AppID,
 		EndpointID:             payload.EndpointID,
 		Context:                payload.Context,
+		ignoreCache:            payload.IgnoreCache,
 	}
 
 	session_lock.Lock()
@@ -111,6 +135,11 @@ func GetSession(payload GetSessionPayload) *Session {
 			log.Error("get session info from cache failed, %s", err)
 			return nil
 		}
+		session.remote = true
+		// the caller may have gone away before the session was loaded
+		if remoteSessionCancelled(session.ID) {
+			session.cancelled = true
+		}
 		return session
 	}
 
@@ -143,6 +172,22 @@ func (s *Session) Close(payload CloseSessionPayload) {
 		ID:          s.ID,
 		IgnoreCache: payload.IgnoreCache,
 	})
+
+	s.lock.Lock()
+	handlers := s.closeHandlers
+	s.closeHandlers = nil
+	s.lock.Unlock()
+
+	for _, f := range handlers {
+		f()
+	}
+}
+
+// OnClose registers a function to be called when the session is closed
+func (s *Session) OnClose(f func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closeHandlers = append(s.closeHandlers, f)
 }
 
 func (s *Session) BindRuntime(runtime plugin_entities.PluginLifetime) {
@@ -166,6 +211,7 @@ type PLUGIN_IN_STREAM_EVENT string
 const (
 	PLUGIN_IN_STREAM_EVENT_REQUEST  PLUGIN_IN_STREAM_EVENT = "request"
 	PLUGIN_IN_STREAM_EVENT_RESPONSE PLUGIN_IN_STREAM_EVENT = "backwards_response"
+	PLUGIN_IN_STREAM_EVENT_CANCEL   PLUGIN_IN_STREAM_EVENT = "cancel"
 )
 
 func (s *Session) Message(event PLUGIN_IN_STREAM_EVENT, data any) []byte {
@@ -188,3 +234,90 @@ func (s *Session) Write(event PLUGIN_IN_STREAM_EVENT, action access_types.Plugin
 	s.runtime.Write(s.ID, action, s.Message(event, data))
 	return nil
 }
+
+const (
+	SESSION_CANCEL_REASON_CLIENT_DISCONNECTED = "client_disconnected"
+	SESSION_CANCEL_REASON_TIMEOUT             = "timeout"
+)
+
+// OnCancel registers a function to be called when the session is cancelled
+// it's called immediately if the session has already been cancelled,
+// the returned function releases the handler once it's no longer needed
+func (s *Session) OnCancel(f func()) func() {
+	s.lock.Lock()
+	if s.cancelled {
+		s.lock.Unlock()
+		f()
+		return func() {}
+	}
+	if s.cancelHandlers == nil {
+		s.cancelHandlers = map[uint64]func(){}
+	}
+	id := s.nextHandlerID
+	s.nextHandlerID++
+	s.cancelHandlers[id] = f
+	s.lock.Unlock()
+
+	if s.remote {
+		watchRemoteSession(s)
+	}
+
+	return func() {
+		s.lock.Lock()
+		delete(s.cancelHandlers, id)
+		empty := len(s.cancelHandlers) == 0
+		s.lock.Unlock()
+
+		if s.remote && empty {
+			unwatchRemoteSession(s)
+		}
+	}
+}
+
+func (s *Session) Cancelled() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.cancelled
+}
+
+// Cancel aborts the session once the caller has gone away, e.g. client disconnected or timeout
+// in-flight backwards invocations are aborted and the plugin is notified to stop its work
+func (s *Session) Cancel(reason string) {
+	if !s.cancel() {
+		return
+	}
+
+	// backwards invocations of the session may be served by other nodes
+	if !s.ignoreCache {
+		publishSessionCancelled(s.ID, reason)
+	}
+
+	if runtime, ok := s.runtime.(plugin_entities.PluginSessionCancellableInterface); ok {
+		runtime.Cancel(s.ID, s.Message(PLUGIN_IN_STREAM_EVENT_CANCEL, map[string]any{
+			"reason": reason,
+		}))
+	}
+}
+
+// cancel marks the session as cancelled and runs the handlers, returns false if it was cancelled already
+func (s *Session) cancel() bool {
+	s.lock.Lock()
+	if s.cancelled {
+		s.lock.Unlock()
+		return false
+	}
+	s.cancelled = true
+	handlers := s.cancelHandlers
+	s.cancelHandlers = nil
+	s.lock.Unlock()
+
+	if s.remote {
+		unwatchRemoteSession(s)
+	}
+
+	for _, f := range handlers {
+		f()
+	}
+
+	return true
+}
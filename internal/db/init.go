@@ -20,6 +20,7 @@ func autoMigrate() error {
 		models.InstallTask{},
 		models.TenantStorage{},
 		models.AgentStrategyInstallation{},
+		models.PluginEnvironmentVariable{},
 	)
 
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
 	"github.com/langgenius/dify-plugin-daemon/internal/manifest"
 	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
@@ -30,16 +31,23 @@ func CollectActiveDispatchRequests() gin.HandlerFunc {
 	}
 }
 
-func HealthCheck(app *app.Config) gin.HandlerFunc {
+func HealthCheck(config *app.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.JSON(200, gin.H{
+		status := gin.H{
 			"status":                   "ok",
 			"pool_status":              routine.FetchRoutineStatus(),
 			"version":                  manifest.VersionX,
 			"build_time":               manifest.BuildTimeX,
-			"platform":                 app.Platform,
+			"platform":                 config.Platform,
 			"active_requests":          activeRequests,
 			"active_dispatch_requests": activeDispatchRequests,
-		})
+		}
+
+		// disk usage of the plugin working path of this node, measured by the working path gc
+		if manager := plugin_manager.Manager(); manager != nil && config.Platform == app.PLATFORM_LOCAL {
+			status["working_path_disk_usage"] = manager.WorkingPathDiskUsage()
+		}
+
+		c.JSON(200, status)
 	}
 }
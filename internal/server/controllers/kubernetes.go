@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/kubernetes_platform"
+	"github.com/langgenius/dify-plugin-daemon/internal/service"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+func ScaleKubernetesPlugin(c *gin.Context) {
+	BindRequest(c, func(request struct {
+		PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"plugin_unique_identifier" validate:"required,plugin_unique_identifier"`
+		Replicas               int32                                  `json:"replicas" validate:"min=0,max=100"`
+	}) {
+		c.JSON(http.StatusOK, service.ScaleKubernetesPlugin(request.PluginUniqueIdentifier, request.Replicas))
+	})
+}
+
+// GetKubernetesPluginPackage serves plugin packages to the image build jobs,
+// downloads are authorized by the token signed when the job was created, it expires with the launch
+func GetKubernetesPluginPackage(config *app.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, err := plugin_entities.NewPluginUniqueIdentifier(strings.TrimPrefix(c.Param("identifier"), "/"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, exception.UniqueIdentifierError(err).ToResponse())
+			return
+		}
+
+		if !kubernetes_platform.VerifyPackageToken(
+			config.ServerKey, identity, c.GetHeader(kubernetes_platform.PACKAGE_TOKEN_HEADER), time.Now(),
+		) {
+			c.JSON(http.StatusUnauthorized, exception.UnauthorizedError().ToResponse())
+			return
+		}
+
+		pkg, err := plugin_manager.Manager().GetPackage(identity)
+		if err != nil {
+			c.JSON(http.StatusNotFound, exception.NotFoundError(err).ToResponse())
+			return
+		}
+
+		c.Data(http.StatusOK, "application/octet-stream", pkg)
+	}
+}
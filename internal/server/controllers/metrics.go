@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
+)
+
+// Metrics exposes the metrics of this node in the prometheus text format
+func Metrics(config *app.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var builder strings.Builder
+
+		// measured by the working path gc, left out until the first measurement
+		if manager := plugin_manager.Manager(); manager != nil && config.Platform == app.PLATFORM_LOCAL {
+			if usage := manager.WorkingPathDiskUsage(); usage >= 0 {
+				builder.WriteString("# HELP plugin_working_path_disk_usage_bytes Size of the plugin working path of this node.\n")
+				builder.WriteString("# TYPE plugin_working_path_disk_usage_bytes gauge\n")
+				builder.WriteString(fmt.Sprintf("plugin_working_path_disk_usage_bytes %d\n", usage))
+			}
+		}
+
+		c.Data(200, "text/plain; version=0.0.4; charset=utf-8", []byte(builder.String()))
+	}
+}
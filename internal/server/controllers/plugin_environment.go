@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
+	"github.com/langgenius/dify-plugin-daemon/internal/service"
+)
+
+func ListPluginEnvironment(c *gin.Context) {
+	BindRequest(c, func(request struct {
+		PluginID string `form:"plugin_id" validate:"required"`
+	}) {
+		c.JSON(http.StatusOK, service.ListPluginEnvironment(request.PluginID))
+	})
+}
+
+func SetPluginEnvironment(c *gin.Context) {
+	BindRequest(c, func(request struct {
+		PluginID  string                                     `json:"plugin_id" validate:"required"`
+		Version   string                                     `json:"version"`
+		Variables []plugin_manager.PluginEnvironmentVariable `json:"variables" validate:"required,max=256,dive"`
+	}) {
+		c.JSON(http.StatusOK, service.SetPluginEnvironment(request.PluginID, request.Version, request.Variables))
+	})
+}
+
+func DeletePluginEnvironment(c *gin.Context) {
+	BindRequest(c, func(request struct {
+		PluginID string   `json:"plugin_id" validate:"required"`
+		Version  string   `json:"version"`
+		Names    []string `json:"names" validate:"required,max=256"`
+	}) {
+		c.JSON(http.StatusOK, service.DeletePluginEnvironment(request.PluginID, request.Version, request.Names))
+	})
+}
@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/plugin_log"
+	"github.com/langgenius/dify-plugin-daemon/internal/service"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+func StreamPluginLogs(c *gin.Context) {
+	BindRequest(c, func(request struct {
+		PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `form:"plugin_unique_identifier" validate:"required,plugin_unique_identifier"`
+		Level                  string                                 `form:"level" validate:"omitempty,oneof=debug info warning error"`
+		SessionID              string                                 `form:"session_id"`
+		Lines                  int                                    `form:"lines" validate:"omitempty,min=0,max=10000"`
+		Follow                 bool                                   `form:"follow"`
+	}) {
+		lines := request.Lines
+		if lines == 0 {
+			lines = 100
+		}
+
+		service.StreamPluginLogs(
+			c,
+			request.PluginUniqueIdentifier,
+			lines,
+			plugin_log.Filter{Level: request.Level, SessionID: request.SessionID},
+			request.Follow,
+		)
+	})
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/service"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+func GetPluginInstallationPermission(c *gin.Context) {
+	BindRequest(c, func(request struct {
+		TenantID string `uri:"tenant_id" validate:"required"`
+		PluginID string `form:"plugin_id" validate:"required"`
+	}) {
+		c.JSON(http.StatusOK, service.GetPluginInstallationPermission(request.TenantID, request.PluginID))
+	})
+}
+
+func SetPluginInstallationPermission(c *gin.Context) {
+	BindRequest(c, func(request struct {
+		TenantID   string                                       `uri:"tenant_id" validate:"required"`
+		PluginID   string                                       `json:"plugin_id" validate:"required"`
+		Permission *plugin_entities.PluginPermissionRequirement `json:"permission" validate:"omitempty"`
+	}) {
+		c.JSON(http.StatusOK, service.SetPluginInstallationPermission(
+			request.TenantID, request.PluginID, request.Permission,
+		))
+	})
+}
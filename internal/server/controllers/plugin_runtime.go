@@ -0,0 +1,13 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/server/constants"
+	"github.com/langgenius/dify-plugin-daemon/internal/service"
+)
+
+func ListPluginRuntimes(c *gin.Context) {
+	c.JSON(http.StatusOK, service.ListPluginRuntimes(c.GetString(constants.CONTEXT_KEY_CLUSTER_ID)))
+}
@@ -2,14 +2,49 @@ package controllers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
 	"github.com/langgenius/dify-plugin-daemon/internal/service"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/requests"
+	"golang.org/x/net/websocket"
 )
 
-func GetRemoteDebuggingKey(c *gin.Context) {
+func GetRemoteDebuggingKey(config *app.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		BindRequest(
+			c, func(request requests.RequestGetRemoteDebuggingKey) {
+				c.JSON(200, service.GetRemoteDebuggingKey(config, request.TenantID, request.UserID, request.Action))
+			},
+		)
+	}
+}
+
+func ListRemoteDebuggingSessions(c *gin.Context) {
+	BindRequest(
+		c, func(request requests.RequestListRemoteDebuggingSessions) {
+			c.JSON(200, service.ListRemoteDebuggingSessions(request.TenantID))
+		},
+	)
+}
+
+func DisconnectRemoteDebuggingSession(c *gin.Context) {
 	BindRequest(
-		c, func(request requests.RequestGetRemoteDebuggingKey) {
-			c.JSON(200, service.GetRemoteDebuggingKey(request.TenantID))
+		c, func(request requests.RequestDisconnectRemoteDebuggingSession) {
+			c.JSON(200, service.DisconnectRemoteDebuggingSession(request.TenantID, request.SessionID))
 		},
 	)
 }
+
+// RemoteDebuggingWebSocket serves the remote debugging protocol over a websocket,
+// plugins authenticate with their debugging key in the handshake like over tcp
+func RemoteDebuggingWebSocket(c *gin.Context) {
+	server := websocket.Server{
+		Handler: func(ws *websocket.Conn) {
+			// the peer of the connection, forwarded headers can be set by anyone
+			if err := plugin_manager.Manager().ServeRemotePluginWebSocket(ws, c.Request.RemoteAddr); err != nil {
+				websocket.Message.Send(ws, err.Error()+"\n")
+			}
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
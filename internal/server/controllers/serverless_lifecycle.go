@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/service"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+func CollectServerlessFunctions(c *gin.Context) {
+	BindRequest(c, func(request struct {
+		DryRun bool `json:"dry_run"`
+	}) {
+		c.JSON(http.StatusOK, service.CollectServerlessFunctions(request.DryRun))
+	})
+}
+
+func RedeployServerlessFunctions(c *gin.Context) {
+	BindRequest(c, func(request struct {
+		// all installed functions are redeployed if empty
+		PluginUniqueIdentifiers []plugin_entities.PluginUniqueIdentifier `json:"plugin_unique_identifiers" validate:"max=256,dive,plugin_unique_identifier"`
+	}) {
+		service.RedeployServerlessFunctions(c, request.PluginUniqueIdentifiers)
+	})
+}
+
+func SetServerlessWarmupInterval(c *gin.Context) {
+	BindRequest(c, func(request struct {
+		PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"plugin_unique_identifier" validate:"required,plugin_unique_identifier"`
+		// seconds between warmup pings, 0 disables warmup
+		Interval int `json:"interval" validate:"min=0,max=86400"`
+	}) {
+		c.JSON(http.StatusOK, service.SetServerlessWarmupInterval(request.PluginUniqueIdentifier, request.Interval))
+	})
+}
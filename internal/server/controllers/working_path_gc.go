@@ -0,0 +1,12 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/service"
+)
+
+func CollectWorkingPathsDryRun(c *gin.Context) {
+	c.JSON(http.StatusOK, service.CollectWorkingPaths(true))
+}
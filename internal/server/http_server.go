@@ -29,11 +29,19 @@ func (app *App) server(config *app.Config) func() {
 	engine.Use(gin.Recovery())
 	engine.Use(controllers.CollectActiveRequests())
 	engine.GET("/health/check", controllers.HealthCheck(config))
+	engine.GET("/metrics", controllers.Metrics(config))
+
+	if config.PluginRemoteInstallingEnabled != nil && *config.PluginRemoteInstallingEnabled &&
+		config.PluginRemoteInstallingWebSocketEnabled != nil && *config.PluginRemoteInstallingWebSocketEnabled {
+		// remote debugging through http ingresses, the same protocol as the tcp port
+		engine.GET("/remote-debugging/ws", controllers.RemoteDebuggingWebSocket)
+	}
 
 	endpointGroup := engine.Group("/e")
 	awsLambdaTransactionGroup := engine.Group("/backwards-invocation")
 	pluginGroup := engine.Group("/plugin/:tenant_id")
 	pprofGroup := engine.Group("/debug/pprof")
+	kubernetesGroup := engine.Group("/kubernetes")
 
 	if config.AdminApiEnabled {
 		if len(config.AdminApiKey) < 10 {
@@ -64,6 +72,7 @@ func (app *App) server(config *app.Config) func() {
 	app.awsLambdaTransactionGroup(awsLambdaTransactionGroup, config)
 	app.pluginGroup(pluginGroup, config)
 	app.pprofGroup(pprofGroup, config)
+	app.kubernetesGroup(kubernetesGroup, config)
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", config.ServerPort),
@@ -107,7 +116,9 @@ func (app *App) pluginDispatchGroup(group *gin.RouterGroup, config *app.Config)
 
 func (app *App) remoteDebuggingGroup(group *gin.RouterGroup, config *app.Config) {
 	if config.PluginRemoteInstallingEnabled != nil && *config.PluginRemoteInstallingEnabled {
-		group.POST("/key", CheckingKey(config.ServerKey), controllers.GetRemoteDebuggingKey)
+		group.POST("/key", CheckingKey(config.ServerKey), controllers.GetRemoteDebuggingKey(config))
+		group.GET("/sessions", controllers.ListRemoteDebuggingSessions)
+		group.POST("/sessions/disconnect", controllers.DisconnectRemoteDebuggingSession)
 	}
 }
 
@@ -123,9 +134,11 @@ func (app *App) endpointGroup(group *gin.RouterGroup, config *app.Config) {
 }
 
 func (appRef *App) awsLambdaTransactionGroup(group *gin.RouterGroup, config *app.Config) {
-	if config.Platform == app.PLATFORM_SERVERLESS {
+	if config.Platform == app.PLATFORM_SERVERLESS || config.Platform == app.PLATFORM_KUBERNETES {
 		appRef.awsTransactionHandler = transaction.NewAWSTransactionHandler(
-			time.Duration(config.MaxServerlessTransactionTimeout) * time.Second,
+			time.Duration(config.MaxServerlessTransactionTimeout)*time.Second,
+			[]byte(config.ServerlessCallbackTokenSecret),
+			config.ServerlessCallbackTokenEnforced != nil && *config.ServerlessCallbackTokenEnforced,
 		)
 		group.POST(
 			"/transaction",
@@ -134,6 +147,13 @@ func (appRef *App) awsLambdaTransactionGroup(group *gin.RouterGroup, config *app
 	}
 }
 
+func (appRef *App) kubernetesGroup(group *gin.RouterGroup, config *app.Config) {
+	if config.Platform == app.PLATFORM_KUBERNETES && config.KubernetesImageBuildEnabled {
+		// build jobs in the cluster download plugin packages
+		group.GET("/packages/*identifier", controllers.GetKubernetesPluginPackage(config))
+	}
+}
+
 func (app *App) endpointManagementGroup(group *gin.RouterGroup) {
 	group.POST("/setup", controllers.SetupEndpoint)
 	group.POST("/remove", controllers.RemoveEndpoint)
@@ -161,6 +181,8 @@ func (app *App) pluginManagementGroup(group *gin.RouterGroup, config *app.Config
 	group.GET("/list", controllers.ListPlugins)
 	group.POST("/installation/fetch/batch", controllers.BatchFetchPluginInstallationByIDs)
 	group.POST("/installation/missing", controllers.FetchMissingPluginInstallations)
+	group.GET("/installation/permission", controllers.GetPluginInstallationPermission)
+	group.POST("/installation/permission", controllers.SetPluginInstallationPermission)
 	group.GET("/models", controllers.ListModels)
 	group.GET("/tools", controllers.ListTools)
 	group.GET("/tool", controllers.GetTool)
@@ -171,6 +193,19 @@ func (app *App) pluginManagementGroup(group *gin.RouterGroup, config *app.Config
 
 func (app *App) adminGroup(group *gin.RouterGroup, config *app.Config) {
 	group.POST("/plugin/serverless/reinstall", controllers.ReinstallPluginFromIdentifier(config))
+	group.POST("/plugin/serverless/gc", controllers.CollectServerlessFunctions)
+	group.POST("/plugin/serverless/redeploy", controllers.RedeployServerlessFunctions)
+	group.POST("/plugin/serverless/warmup", controllers.SetServerlessWarmupInterval)
+	group.GET("/dependency_cache", controllers.GetDependencyCacheStats)
+	group.POST("/dependency_cache/prune", controllers.PruneDependencyCache)
+	group.GET("/sdk_patches/dry_run", controllers.SdkPatchDryRun)
+	group.GET("/working_path/gc/dry_run", controllers.CollectWorkingPathsDryRun)
+	group.GET("/plugin/environment", controllers.ListPluginEnvironment)
+	group.POST("/plugin/environment", controllers.SetPluginEnvironment)
+	group.POST("/plugin/environment/delete", controllers.DeletePluginEnvironment)
+	group.GET("/plugin/logs", app.RedirectPluginLogs(), controllers.StreamPluginLogs)
+	group.GET("/plugin/runtimes", app.RedirectToNode(), app.InitClusterID(), controllers.ListPluginRuntimes)
+	group.POST("/plugin/kubernetes/scale", controllers.ScaleKubernetesPlugin)
 }
 
 func (app *App) pluginAssetGroup(group *gin.RouterGroup) {
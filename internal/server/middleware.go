@@ -125,7 +125,11 @@ func (app *App) redirectPluginInvokeByPluginIdentifier(
 	}
 
 	// redirect to the correct node
-	nodeId := nodes[0]
+	app.redirectRequestToNode(ctx, nodes[0])
+}
+
+// redirectRequestToNode proxies the request to another node of the cluster, responses are streamed
+func (app *App) redirectRequestToNode(ctx *gin.Context, nodeId string) {
 	statusCode, header, body, err := app.cluster.RedirectRequest(nodeId, ctx.Request)
 	if err != nil {
 		log.Error("redirect request failed: %s", err.Error())
@@ -136,16 +140,18 @@ func (app *App) redirectPluginInvokeByPluginIdentifier(
 		return
 	}
 
-	// set status code
-	ctx.Writer.WriteHeader(statusCode)
+	defer body.Close()
 
-	// set header
+	// set header, headers set after the status code are ignored
 	for key, values := range header {
 		for _, value := range values {
 			ctx.Writer.Header().Set(key, value)
 		}
 	}
 
+	// set status code
+	ctx.Writer.WriteHeader(statusCode)
+
 	for {
 		buf := make([]byte, 1024)
 		n, err := body.Read(buf)
@@ -164,6 +170,49 @@ func (app *App) redirectPluginInvokeByPluginIdentifier(
 	}
 }
 
+// RedirectToNode redirects requests about the state of a node to the node specified by `node_id`,
+// requests without `node_id` are handled by the current node
+func (app *App) RedirectToNode() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if nodeId := ctx.Query("node_id"); nodeId != "" && nodeId != app.cluster.ID() {
+			app.redirectRequestToNode(ctx, nodeId)
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RedirectPluginLogs redirects requests of plugin logs to the node specified by `node_id`,
+// or to a node running the plugin, logs are kept by each node separately
+func (app *App) RedirectPluginLogs() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if nodeId := ctx.Query("node_id"); nodeId != "" {
+			if nodeId != app.cluster.ID() {
+				app.redirectRequestToNode(ctx, nodeId)
+				ctx.Abort()
+				return
+			}
+			ctx.Next()
+			return
+		}
+
+		identity, err := plugin_entities.NewPluginUniqueIdentifier(ctx.Query("plugin_unique_identifier"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(400, exception.UniqueIdentifierError(err).ToResponse())
+			return
+		}
+
+		if ok, originalError := app.cluster.IsPluginOnCurrentNode(identity); !ok {
+			app.redirectPluginInvokeByPluginIdentifier(ctx, identity, originalError)
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
 func (app *App) InitClusterID() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ctx.Set(constants.CONTEXT_KEY_CLUSTER_ID, app.cluster.ID())
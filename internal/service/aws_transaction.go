@@ -9,7 +9,8 @@ func HandleAWSPluginTransaction(handler *transaction.AWSTransactionHandler) gin.
 	return func(c *gin.Context) {
 		// get session id from the context
 		sessionId := c.Request.Header.Get("Dify-Plugin-Session-ID")
+		callbackToken := c.Request.Header.Get("Dify-Plugin-Callback-Token")
 
-		handler.Handle(c, sessionId)
+		handler.Handle(c, sessionId, callbackToken)
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_daemon/access_types"
 	"github.com/langgenius/dify-plugin-daemon/internal/core/session_manager"
 	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/models"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/parser"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
@@ -18,11 +19,12 @@ import (
 
 // baseSSEService is a helper function to handle SSE service
 // it accepts a generator function that returns a stream response to gin context
+// returns the reason if the response was abandoned before it finished, otherwise an empty string
 func baseSSEService[R any](
 	generator func() (*stream.Stream[R], error),
 	ctx *gin.Context,
 	max_timeout_seconds int,
-) {
+) string {
 	writer := ctx.Writer
 	writer.WriteHeader(200)
 	writer.Header().Set("Content-Type", "text/event-stream")
@@ -46,7 +48,7 @@ func baseSSEService[R any](
 	if err != nil {
 		writeData(exception.InternalServerError(err).ToResponse())
 		close(done)
-		return
+		return ""
 	}
 
 	routine.Submit(map[string]string{
@@ -77,15 +79,16 @@ func baseSSEService[R any](
 	select {
 	case <-writer.CloseNotify():
 		pluginDaemonResponse.Close()
-		return
+		return session_manager.SESSION_CANCEL_REASON_CLIENT_DISCONNECTED
 	case <-done:
-		return
+		return ""
 	case <-timer.C:
 		writeData(exception.InternalServerError(errors.New("killed by timeout")).ToResponse())
 		if atomic.CompareAndSwapInt32(doneClosed, 0, 1) {
 			close(done)
 		}
-		return
+		pluginDaemonResponse.Close()
+		return session_manager.SESSION_CANCEL_REASON_TIMEOUT
 	}
 }
 
@@ -97,13 +100,25 @@ func baseSSEWithSession[T any, R any](
 	ctx *gin.Context,
 	max_timeout_seconds int,
 ) {
+	// the permission granted to the installation is fetched along with it by the dispatch middleware
+	var permission *plugin_entities.PluginPermissionRequirement
+	if installation, ok := ctx.Value("plugin_installation").(models.PluginInstallation); ok {
+		permission = installation.Permission
+	}
+
 	session, err := createSession(
 		request,
 		access_type,
 		access_action,
 		ctx.GetString("cluster_id"),
+		permission,
 	)
 	if err != nil {
+		if daemonErr, ok := exception.AsTooManyRequestsError(err); ok {
+			// rejected by the concurrency limits, return the structured error to the caller
+			ctx.JSON(429, daemonErr.ToResponse())
+			return
+		}
 		ctx.JSON(500, exception.InternalServerError(err).ToResponse())
 		return
 	}
@@ -111,11 +126,15 @@ func baseSSEWithSession[T any, R any](
 		IgnoreCache: false,
 	})
 
-	baseSSEService(
+	reason := baseSSEService(
 		func() (*stream.Stream[R], error) {
 			return generator(session)
 		},
 		ctx,
 		max_timeout_seconds,
 	)
+	if reason != "" {
+		// the caller has gone away, stop the plugin from doing useless work
+		session.Cancel(reason)
+	}
 }
@@ -1,25 +1,72 @@
 package service
 
 import (
+	"errors"
+	"time"
+
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/debugging_runtime"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/app"
 	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/requests"
 )
 
-func GetRemoteDebuggingKey(tenant_id string) *entities.Response {
+func GetRemoteDebuggingKey(config *app.Config, tenant_id string, user_id string, action string) *entities.Response {
 	type response struct {
-		Key string `json:"key"`
+		Key       string     `json:"key"`
+		ExpiresAt *time.Time `json:"expires_at"`
 	}
 
-	key, err := debugging_runtime.GetConnectionKey(debugging_runtime.ConnectionInfo{
+	info := debugging_runtime.ConnectionInfo{
 		TenantId: tenant_id,
-	})
+		UserId:   user_id,
+	}
+	expire := time.Duration(config.PluginRemoteInstallingKeyExpireTime) * time.Second
+
+	var key string
+	var err error
+	switch action {
+	case requests.REMOTE_DEBUGGING_KEY_ACTION_REVOKE:
+		if err := debugging_runtime.RevokeConnectionKey(info); err != nil {
+			return exception.InternalServerError(err).ToResponse()
+		}
+		return entities.NewSuccessResponse(response{})
+	case requests.REMOTE_DEBUGGING_KEY_ACTION_ROTATE:
+		key, err = debugging_runtime.RotateConnectionKey(info, expire)
+	default:
+		key, err = debugging_runtime.GetConnectionKey(info, expire)
+	}
 
 	if err != nil {
 		return exception.InternalServerError(err).ToResponse()
 	}
 
+	// keys are extended whenever they are fetched
+	expiresAt := time.Now().Add(expire)
 	return entities.NewSuccessResponse(response{
-		Key: key,
+		Key:       key,
+		ExpiresAt: &expiresAt,
 	})
 }
+
+func ListRemoteDebuggingSessions(tenant_id string) *entities.Response {
+	sessions, err := debugging_runtime.ListDebuggingSessions(tenant_id)
+	if err != nil {
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(sessions)
+}
+
+func DisconnectRemoteDebuggingSession(tenant_id string, session_id string) *entities.Response {
+	err := debugging_runtime.DisconnectDebuggingSession(tenant_id, session_id)
+	if errors.Is(err, debugging_runtime.ErrDebuggingSessionNotFound) {
+		return exception.NotFoundError(err).ToResponse()
+	}
+
+	if err != nil {
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(true)
+}
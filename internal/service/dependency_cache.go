@@ -0,0 +1,33 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities"
+)
+
+func GetDependencyCacheStats() *entities.Response {
+	stats, err := plugin_manager.Manager().DependencyCacheStats()
+	if err != nil {
+		if errors.Is(err, plugin_manager.ErrDependencyCacheDisabled) {
+			return exception.BadRequestError(err).ToResponse()
+		}
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(stats)
+}
+
+func PruneDependencyCache() *entities.Response {
+	result, err := plugin_manager.Manager().PruneDependencyCache()
+	if err != nil {
+		if errors.Is(err, plugin_manager.ErrDependencyCacheDisabled) {
+			return exception.BadRequestError(err).ToResponse()
+		}
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(result)
+}
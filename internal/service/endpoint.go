@@ -143,6 +143,17 @@ func Endpoint(
 		return
 	}
 
+	// wait for a free slot of the concurrency limits
+	release, err := manager.AcquireSessionSlot(endpoint.TenantID, identifier)
+	if err != nil {
+		if daemonErr, ok := exception.AsTooManyRequestsError(err); ok {
+			ctx.JSON(429, daemonErr.ToResponse())
+			return
+		}
+		ctx.JSON(500, exception.InternalServerError(err).ToResponse())
+		return
+	}
+
 	session := session_manager.NewSession(
 		session_manager.NewSessionPayload{
 			TenantID:               endpoint.TenantID,
@@ -152,15 +163,22 @@ func Endpoint(
 			InvokeFrom:             access_types.PLUGIN_ACCESS_TYPE_ENDPOINT,
 			Action:                 access_types.PLUGIN_ACCESS_ACTION_INVOKE_ENDPOINT,
 			Declaration:            runtime.Configuration(),
+			Permission:             pluginInstallation.Permission,
 			BackwardsInvocation:    manager.BackwardsInvocation(),
 			IgnoreCache:            false,
 			EndpointID:             &endpoint.ID,
 		},
 	)
+	session.OnClose(release)
 	defer session.Close(session_manager.CloseSessionPayload{
 		IgnoreCache: false,
 	})
 
+	if err := manager.WakeUp(runtime); err != nil {
+		ctx.JSON(503, exception.InternalServerError(err).ToResponse())
+		return
+	}
+
 	session.BindRuntime(runtime)
 
 	statusCode, headers, response, err := plugin_daemon.InvokeEndpoint(
@@ -211,9 +229,11 @@ func Endpoint(
 
 	select {
 	case <-ctx.Writer.CloseNotify():
+		session.Cancel(session_manager.SESSION_CANCEL_REASON_CLIENT_DISCONNECTED)
 	case <-done:
 	case <-time.After(maxExecutionTime):
 		ctx.JSON(500, exception.InternalServerError(errors.New("killed by timeout")).ToResponse())
+		session.Cancel(session_manager.SESSION_CANCEL_REASON_TIMEOUT)
 	}
 }
 
@@ -45,7 +45,8 @@ func InstallPluginRuntimeToTenant(
 	pluginsWaitForInstallation := []plugin_entities.PluginUniqueIdentifier{}
 
 	runtimeType := plugin_entities.PluginRuntimeType("")
-	if config.Platform == app.PLATFORM_SERVERLESS {
+	if config.Platform == app.PLATFORM_SERVERLESS || config.Platform == app.PLATFORM_KUBERNETES {
+		// kubernetes plugins are invoked like serverless ones
 		runtimeType = plugin_entities.PLUGIN_RUNTIME_TYPE_SERVERLESS
 	} else if config.Platform == app.PLATFORM_LOCAL {
 		runtimeType = plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL
@@ -192,7 +193,7 @@ func InstallPluginRuntimeToTenant(
 			})
 
 			var stream *stream.Stream[plugin_manager.PluginInstallResponse]
-			if config.Platform == app.PLATFORM_SERVERLESS {
+			if config.Platform == app.PLATFORM_SERVERLESS || config.Platform == app.PLATFORM_KUBERNETES {
 				var zipDecoder *decoder.ZipPluginDecoder
 				var pkgFile []byte
 
@@ -215,7 +216,11 @@ func InstallPluginRuntimeToTenant(
 					})
 					return
 				}
-				stream, err = manager.InstallToAWSFromPkg(pkgFile, zipDecoder, source, metas[i])
+				if config.Platform == app.PLATFORM_KUBERNETES {
+					stream, err = manager.InstallToKubernetesFromPkg(zipDecoder, source, metas[i])
+				} else {
+					stream, err = manager.InstallToAWSFromPkg(pkgFile, zipDecoder, source, metas[i])
+				}
 			} else if config.Platform == app.PLATFORM_LOCAL {
 				stream, err = manager.InstallToLocal(pluginUniqueIdentifier, source, metas[i])
 			} else {
@@ -261,7 +266,11 @@ func InstallPluginRuntimeToTenant(
 						updateTaskStatus(func(task *models.InstallTask, plugin *models.InstallTaskPluginStatus) {
 							task.Status = models.InstallTaskStatusFailed
 							plugin.Status = models.InstallTaskStatusFailed
-							plugin.Message = "Failed to create plugin, perhaps it's already installed"
+							if errors.Is(err, plugin_manager.ErrPluginUnhealthy) {
+								plugin.Message = err.Error()
+							} else {
+								plugin.Message = "Failed to create plugin, perhaps it's already installed"
+							}
 						})
 						return
 					}
@@ -308,7 +317,7 @@ func InstallPluginFromIdentifiers(
 			runtimeType := plugin_entities.PluginRuntimeType("")
 
 			switch config.Platform {
-			case app.PLATFORM_SERVERLESS:
+			case app.PLATFORM_SERVERLESS, app.PLATFORM_KUBERNETES:
 				runtimeType = plugin_entities.PLUGIN_RUNTIME_TYPE_SERVERLESS
 			case app.PLATFORM_LOCAL:
 				runtimeType = plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL
@@ -472,7 +481,17 @@ func UpgradePlugin(
 				return err
 			}
 
-			// uninstall the original plugin
+			manager := plugin_manager.Manager()
+
+			// the installation is only switched once the new version is able to serve requests
+			if config.Platform == app.PLATFORM_LOCAL {
+				if err := manager.CheckLocalPluginHealth(new_plugin_unique_identifier); err != nil {
+					rollbackLocalUpgrade(new_plugin_unique_identifier)
+					return errors.Join(err, errors.New("upgrade has been rolled back"))
+				}
+			}
+
+			// switch the installation to the new plugin and uninstall the original one atomically
 			upgradeResponse, err := curd.UpgradePlugin(
 				tenant_id,
 				original_plugin_unique_identifier,
@@ -485,12 +504,14 @@ func UpgradePlugin(
 			)
 
 			if err != nil {
+				if config.Platform == app.PLATFORM_LOCAL {
+					rollbackLocalUpgrade(new_plugin_unique_identifier)
+				}
 				return err
 			}
 
 			if upgradeResponse.IsOriginalPluginDeleted {
-				// delete the plugin if no installation left
-				manager := plugin_manager.Manager()
+				// delete the plugin if no installation left, in-flight sessions are drained before it stops
 				if string(upgradeResponse.DeletedPlugin.InstallType) == string(
 					plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL,
 				) {
@@ -501,6 +522,16 @@ func UpgradePlugin(
 						return err
 					}
 				}
+				if manager.KubernetesEnabled() && string(upgradeResponse.DeletedPlugin.InstallType) == string(
+					plugin_entities.PLUGIN_RUNTIME_TYPE_SERVERLESS,
+				) {
+					err = manager.UninstallFromKubernetes(
+						plugin_entities.PluginUniqueIdentifier(upgradeResponse.DeletedPlugin.PluginUniqueIdentifier),
+					)
+					if err != nil {
+						return err
+					}
+				}
 			}
 
 			return nil
@@ -514,6 +545,26 @@ func UpgradePlugin(
 	return entities.NewSuccessResponse(response)
 }
 
+// rollbackLocalUpgrade removes the runtime of the new version of a failed upgrade,
+// unless other installations are using it already
+func rollbackLocalUpgrade(identity plugin_entities.PluginUniqueIdentifier) {
+	_, err := db.GetOne[models.Plugin](
+		db.Equal("plugin_unique_identifier", identity.String()),
+	)
+	if err == nil {
+		return
+	}
+
+	if err != db.ErrDatabaseNotFound {
+		log.Error("failed to check installations of plugin %s, keeping it: %s", identity, err.Error())
+		return
+	}
+
+	if err := plugin_manager.Manager().UninstallFromLocal(identity); err != nil {
+		log.Error("failed to roll back the upgrade to plugin %s: %s", identity, err.Error())
+	}
+}
+
 func FetchPluginInstallationTasks(
 	tenant_id string,
 	page int,
@@ -697,6 +748,13 @@ func UninstallPlugin(
 			if err != nil {
 				return exception.InternalServerError(fmt.Errorf("failed to uninstall plugin: %s", err.Error())).ToResponse()
 			}
+		} else if deleteResponse.Installation.RuntimeType == string(
+			plugin_entities.PLUGIN_RUNTIME_TYPE_SERVERLESS,
+		) && manager.KubernetesEnabled() {
+			err = manager.UninstallFromKubernetes(pluginUniqueIdentifier)
+			if err != nil {
+				return exception.InternalServerError(fmt.Errorf("failed to uninstall plugin: %s", err.Error())).ToResponse()
+			}
 		}
 	}
 
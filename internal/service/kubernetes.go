@@ -0,0 +1,25 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func ScaleKubernetesPlugin(identity plugin_entities.PluginUniqueIdentifier, replicas int32) *entities.Response {
+	if err := plugin_manager.Manager().ScaleKubernetesPlugin(identity, replicas); err != nil {
+		if errors.Is(err, plugin_manager.ErrKubernetesPlatformDisabled) {
+			return exception.BadRequestError(err).ToResponse()
+		}
+		if apierrors.IsNotFound(err) {
+			return exception.ErrPluginNotFound().ToResponse()
+		}
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(true)
+}
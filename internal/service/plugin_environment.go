@@ -0,0 +1,42 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities"
+)
+
+func ListPluginEnvironment(pluginID string) *entities.Response {
+	variables, err := plugin_manager.Manager().ListPluginEnvironment(pluginID)
+	if err != nil {
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(variables)
+}
+
+func SetPluginEnvironment(
+	pluginID string,
+	version string,
+	variables []plugin_manager.PluginEnvironmentVariable,
+) *entities.Response {
+	if err := plugin_manager.Manager().SetPluginEnvironment(pluginID, version, variables); err != nil {
+		if errors.Is(err, plugin_manager.ErrInvalidPluginEnvironmentVariable) ||
+			errors.Is(err, plugin_manager.ErrPluginEnvironmentKeyMissing) {
+			return exception.BadRequestError(err).ToResponse()
+		}
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(true)
+}
+
+func DeletePluginEnvironment(pluginID string, version string, names []string) *entities.Response {
+	if err := plugin_manager.Manager().DeletePluginEnvironment(pluginID, version, names); err != nil {
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(true)
+}
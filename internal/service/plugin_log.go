@@ -0,0 +1,73 @@
+package service
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/plugin_log"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/routine"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+const (
+	// following a log is closed after an hour, clients are expected to reconnect
+	PLUGIN_LOG_STREAM_TIMEOUT = 3600
+)
+
+// StreamPluginLogs sends the last entries of a plugin written on this node,
+// and keeps sending new entries if follow is set
+func StreamPluginLogs(
+	ctx *gin.Context,
+	pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	lines int,
+	filter plugin_log.Filter,
+	follow bool,
+) {
+	baseSSEService(func() (*stream.Stream[plugin_log.Entry], error) {
+		manager := plugin_manager.Manager()
+
+		// subscribe before tailing, otherwise entries written in between are lost
+		var updates <-chan plugin_log.Entry
+		cancel := func() {}
+		if follow {
+			var err error
+			updates, cancel, err = manager.SubscribePluginLogs(pluginUniqueIdentifier, filter)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		entries, err := manager.TailPluginLogs(pluginUniqueIdentifier, lines, filter)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		response := stream.NewStream[plugin_log.Entry](plugin_log.SUBSCRIBER_BUFFER_SIZE)
+		response.OnClose(cancel)
+
+		routine.Submit(map[string]string{
+			"module":   "service",
+			"function": "StreamPluginLogs",
+		}, func() {
+			for _, entry := range entries {
+				response.WriteBlocking(entry)
+			}
+
+			if !follow {
+				response.Close()
+				return
+			}
+
+			for entry := range updates {
+				// already sent by the tail
+				if len(entries) > 0 && entry.Seq <= entries[len(entries)-1].Seq {
+					continue
+				}
+				response.WriteBlocking(entry)
+			}
+		})
+
+		return response, nil
+	}, ctx, PLUGIN_LOG_STREAM_TIMEOUT)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/db"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/models"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/cache/helper"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"gorm.io/gorm"
+)
+
+func GetPluginInstallationPermission(tenantID string, pluginID string) *entities.Response {
+	installation, err := db.GetOne[models.PluginInstallation](
+		db.Equal("tenant_id", tenantID),
+		db.Equal("plugin_id", pluginID),
+	)
+	if err == db.ErrDatabaseNotFound {
+		return exception.ErrPluginNotFound().ToResponse()
+	}
+	if err != nil {
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	identity, err := plugin_entities.NewPluginUniqueIdentifier(installation.PluginUniqueIdentifier)
+	if err != nil {
+		return exception.UniqueIdentifierError(err).ToResponse()
+	}
+
+	declaration, err := helper.CombinedGetPluginDeclaration(
+		identity, plugin_entities.PluginRuntimeType(installation.RuntimeType),
+	)
+	if err != nil {
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(map[string]any{
+		// what the plugin asks for, backwards invocations must be allowed by both
+		"declared":     declaration.Resource.Permission,
+		"installation": installation.Permission,
+	})
+}
+
+// SetPluginInstallationPermission narrows the permission of the plugin for the tenant,
+// a nil permission restores the declared one
+func SetPluginInstallationPermission(
+	tenantID string,
+	pluginID string,
+	permission *plugin_entities.PluginPermissionRequirement,
+) *entities.Response {
+	installation, err := db.GetOne[models.PluginInstallation](
+		db.Equal("tenant_id", tenantID),
+		db.Equal("plugin_id", pluginID),
+	)
+	if err == db.ErrDatabaseNotFound {
+		return exception.ErrPluginNotFound().ToResponse()
+	}
+	if err != nil {
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	// only the permission is written, counters of the installation are updated concurrently
+	installation.Permission = permission
+	if err := db.Run(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&installation).Select("permission").Updates(&installation)
+	}); err != nil {
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	// endpoints read the installation from cache
+	_, _ = cache.AutoDelete[models.PluginInstallation](strings.Join(
+		[]string{
+			"plugin_id",
+			pluginID,
+			"tenant_id",
+			tenantID,
+		},
+		":",
+	))
+
+	return entities.NewSuccessResponse(true)
+}
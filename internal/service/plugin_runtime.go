@@ -0,0 +1,14 @@
+package service
+
+import (
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities"
+)
+
+// ListPluginRuntimes lists the runtimes of the current node, including latencies of health probes
+func ListPluginRuntimes(nodeID string) *entities.Response {
+	return entities.NewSuccessResponse(map[string]any{
+		"node_id":  nodeID,
+		"runtimes": plugin_manager.Manager().ListRuntimeStates(),
+	})
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager/serverless_lifecycle"
+	"github.com/langgenius/dify-plugin-daemon/internal/db"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/stream"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+)
+
+func CollectServerlessFunctions(dryRun bool) *entities.Response {
+	report, err := plugin_manager.Manager().CollectServerlessFunctions(dryRun)
+	if err != nil {
+		if errors.Is(err, plugin_manager.ErrServerlessLifecycleDisabled) {
+			return exception.BadRequestError(err).ToResponse()
+		}
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(report)
+}
+
+func RedeployServerlessFunctions(
+	ctx *gin.Context,
+	identities []plugin_entities.PluginUniqueIdentifier,
+) {
+	baseSSEService(func() (*stream.Stream[serverless_lifecycle.RedeployResponse], error) {
+		return plugin_manager.Manager().RedeployServerlessFunctions(identities)
+	}, ctx, 3600)
+}
+
+func SetServerlessWarmupInterval(
+	identity plugin_entities.PluginUniqueIdentifier,
+	interval int,
+) *entities.Response {
+	if err := plugin_manager.Manager().SetServerlessWarmupInterval(identity, interval); err != nil {
+		if errors.Is(err, plugin_manager.ErrServerlessLifecycleDisabled) {
+			return exception.BadRequestError(err).ToResponse()
+		}
+		if errors.Is(err, db.ErrDatabaseNotFound) {
+			return exception.ErrPluginNotFound().ToResponse()
+		}
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(true)
+}
@@ -14,6 +14,7 @@ func createSession[T any](
 	access_type access_types.PluginAccessType,
 	access_action access_types.PluginAccessAction,
 	cluster_id string,
+	permission *plugin_entities.PluginPermissionRequirement,
 ) (*session_manager.Session, error) {
 	manager := plugin_manager.Manager()
 	if manager == nil {
@@ -27,6 +28,19 @@ func createSession[T any](
 		return nil, errors.New("failed to get plugin runtime")
 	}
 
+	// wait for a free slot of the concurrency limits
+	release, err := manager.AcquireSessionSlot(r.TenantId, r.UniqueIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	// hibernating plugins need to be started before the session is dispatched,
+	// requests rejected by the limits above don't wake them up
+	if err := manager.WakeUp(runtime); err != nil {
+		release()
+		return nil, err
+	}
+
 	session := session_manager.NewSession(
 		session_manager.NewSessionPayload{
 			TenantID:               r.TenantId,
@@ -36,6 +50,7 @@ func createSession[T any](
 			InvokeFrom:             access_type,
 			Action:                 access_action,
 			Declaration:            runtime.Configuration(),
+			Permission:             permission,
 			BackwardsInvocation:    manager.BackwardsInvocation(),
 			IgnoreCache:            false,
 			ConversationID:         r.ConversationID,
@@ -46,6 +61,7 @@ func createSession[T any](
 		},
 	)
 
+	session.OnClose(release)
 	session.BindRuntime(runtime)
 	return session, nil
 }
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_manager"
+	"github.com/langgenius/dify-plugin-daemon/internal/types/exception"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities"
+)
+
+func CollectWorkingPaths(dryRun bool) *entities.Response {
+	report, err := plugin_manager.Manager().CollectWorkingPaths(dryRun)
+	if err != nil {
+		if errors.Is(err, plugin_manager.ErrWorkingPathGCDisabled) {
+			return exception.BadRequestError(err).ToResponse()
+		}
+		return exception.InternalServerError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(report)
+}
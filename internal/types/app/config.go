@@ -74,6 +74,14 @@ type Config struct {
 	PluginRemoteInstallingMaxConn             int    `envconfig:"PLUGIN_REMOTE_INSTALLING_MAX_CONN"`
 	PluginRemoteInstallingMaxSingleTenantConn int    `envconfig:"PLUGIN_REMOTE_INSTALLING_MAX_SINGLE_TENANT_CONN"`
 	PluginRemoteInstallServerEventLoopNums    int    `envconfig:"PLUGIN_REMOTE_INSTALL_SERVER_EVENT_LOOP_NUMS"`
+	// lifetime of debugging keys in seconds, extended whenever the key is fetched again
+	PluginRemoteInstallingKeyExpireTime int `envconfig:"PLUGIN_REMOTE_INSTALLING_KEY_EXPIRE_TIME"`
+	// tls on the debugging listener, certificates are reloaded once the files changed
+	PluginRemoteInstallingTLSEnabled  bool   `envconfig:"PLUGIN_REMOTE_INSTALLING_TLS_ENABLED"`
+	PluginRemoteInstallingTLSCertFile string `envconfig:"PLUGIN_REMOTE_INSTALLING_TLS_CERT_FILE"`
+	PluginRemoteInstallingTLSKeyFile  string `envconfig:"PLUGIN_REMOTE_INSTALLING_TLS_KEY_FILE"`
+	// remote debugging over websockets on the http server, for ingresses which can't expose the tcp port, disabled by default
+	PluginRemoteInstallingWebSocketEnabled *bool `envconfig:"PLUGIN_REMOTE_INSTALLING_WEBSOCKET_ENABLED"`
 
 	// plugin endpoint
 	PluginEndpointEnabled *bool `envconfig:"PLUGIN_ENDPOINT_ENABLED"`
@@ -91,6 +99,40 @@ type Config struct {
 	// local launching max concurrent
 	PluginLocalLaunchingConcurrent int `envconfig:"PLUGIN_LOCAL_LAUNCHING_CONCURRENT" validate:"required"`
 
+	// on-demand launching of local plugins, plugin processes are started on the first dispatch
+	// and stopped after being idle for PluginLocalIdleTimeout seconds
+	PluginLocalOnDemandEnabled bool `envconfig:"PLUGIN_LOCAL_ON_DEMAND_ENABLED" default:"false"`
+	PluginLocalIdleTimeout     int  `envconfig:"PLUGIN_LOCAL_IDLE_TIMEOUT"`
+	// how long a dispatch waits for a hibernating plugin to start, in seconds
+	PluginLocalWakeUpTimeout int `envconfig:"PLUGIN_LOCAL_WAKE_UP_TIMEOUT"`
+	// a comma-separated list of plugin ids which are always running even if on-demand launching is enabled
+	PluginLocalAlwaysOnPlugins []string `envconfig:"PLUGIN_LOCAL_ALWAYS_ON_PLUGINS" default:""`
+
+	// working directories of plugins neither installed nor running are removed after the grace period, in seconds,
+	// only measured if disabled
+	PluginWorkingPathGCEnabled     *bool `envconfig:"PLUGIN_WORKING_PATH_GC_ENABLED"`
+	PluginWorkingPathGCInterval    int   `envconfig:"PLUGIN_WORKING_PATH_GC_INTERVAL"`
+	PluginWorkingPathGCGracePeriod int   `envconfig:"PLUGIN_WORKING_PATH_GC_GRACE_PERIOD"`
+
+	// logs of local plugins are written to a file per plugin on each node
+	PluginLogEnabled *bool  `envconfig:"PLUGIN_LOG_ENABLED"`
+	PluginLogPath    string `envconfig:"PLUGIN_LOG_PATH"`
+	// the current file is rotated once it exceeds the size in bytes or has been written for the interval in seconds
+	PluginLogMaxSize        int64 `envconfig:"PLUGIN_LOG_MAX_SIZE"`
+	PluginLogRotateInterval int   `envconfig:"PLUGIN_LOG_ROTATE_INTERVAL"`
+	// rotated files kept per plugin, files older than the max age in seconds are removed
+	PluginLogMaxBackups int `envconfig:"PLUGIN_LOG_MAX_BACKUPS"`
+	PluginLogMaxAge     int `envconfig:"PLUGIN_LOG_MAX_AGE"`
+
+	// concurrent sessions limits, shared by the whole cluster, 0 means unlimited
+	PluginMaxConcurrentSessionsPerPlugin       int `envconfig:"PLUGIN_MAX_CONCURRENT_SESSIONS_PER_PLUGIN" default:"0"`
+	PluginMaxConcurrentSessionsPerTenant       int `envconfig:"PLUGIN_MAX_CONCURRENT_SESSIONS_PER_TENANT" default:"0"`
+	PluginMaxConcurrentSessionsPerTenantPlugin int `envconfig:"PLUGIN_MAX_CONCURRENT_SESSIONS_PER_TENANT_PLUGIN" default:"0"`
+	// how long a session waits for a free slot before being rejected, in seconds
+	PluginConcurrencyWaitTimeout int `envconfig:"PLUGIN_CONCURRENCY_WAIT_TIMEOUT"`
+	// whether sessions are let through without limiting when the cache is unavailable
+	PluginConcurrencyLimitFailOpen bool `envconfig:"PLUGIN_CONCURRENCY_LIMIT_FAIL_OPEN" default:"true"`
+
 	// platform like local or aws lambda
 	Platform PlatformType `envconfig:"PLATFORM" validate:"required"`
 
@@ -155,10 +197,53 @@ type Config struct {
 	DifyPluginServerlessConnectorAPIKey        *string `envconfig:"DIFY_PLUGIN_SERVERLESS_CONNECTOR_API_KEY"`
 	DifyPluginServerlessConnectorLaunchTimeout int     `envconfig:"DIFY_PLUGIN_SERVERLESS_CONNECTOR_LAUNCH_TIMEOUT"`
 
+	// functions of the serverless platform are collected, warmed up and redeployed by the lifecycle manager
+	ServerlessLifecycleInterval     int   `envconfig:"SERVERLESS_LIFECYCLE_INTERVAL"`       // in seconds
+	ServerlessFunctionGCEnabled     *bool `envconfig:"SERVERLESS_FUNCTION_GC_ENABLED"`      // deletes functions, disabled by default
+	ServerlessFunctionGCGracePeriod int   `envconfig:"SERVERLESS_FUNCTION_GC_GRACE_PERIOD"` // in seconds
+	ServerlessWarmupTimeout         int   `envconfig:"SERVERLESS_WARMUP_TIMEOUT"`           // in seconds
+
+	// invocations failing before the first streamed byte are retried, 1 attempt disables retries
+	ServerlessInvokeMaxAttempts     int `envconfig:"SERVERLESS_INVOKE_MAX_ATTEMPTS"`
+	ServerlessInvokeRetryBackoff    int `envconfig:"SERVERLESS_INVOKE_RETRY_BACKOFF"`     // in milliseconds
+	ServerlessInvokeRetryMaxBackoff int `envconfig:"SERVERLESS_INVOKE_RETRY_MAX_BACKOFF"` // in milliseconds
+	// the function may have started to work before the request timed out
+	ServerlessInvokeRetryTimeouts *bool `envconfig:"SERVERLESS_INVOKE_RETRY_TIMEOUTS"`
+	ServerlessColdStartTimeout    int   `envconfig:"SERVERLESS_COLD_START_TIMEOUT"` // in seconds, disabled if 0
+	// functions failing consecutively are not invoked until the cooldown is over
+	ServerlessCircuitBreakerEnabled   *bool `envconfig:"SERVERLESS_CIRCUIT_BREAKER_ENABLED"`
+	ServerlessCircuitBreakerThreshold int   `envconfig:"SERVERLESS_CIRCUIT_BREAKER_THRESHOLD"`
+	ServerlessCircuitBreakerCooldown  int   `envconfig:"SERVERLESS_CIRCUIT_BREAKER_COOLDOWN"` // in seconds
+
+	// kubernetes platform, each plugin runs as a deployment with a service in the namespace
+	KubernetesNamespace  string `envconfig:"KUBERNETES_NAMESPACE"`
+	KubernetesKubeconfig string `envconfig:"KUBERNETES_KUBECONFIG"` // in-cluster config is used if empty
+	// image of a plugin, {author}, {name}, {version} and {checksum} are replaced
+	KubernetesPluginImage           string `envconfig:"KUBERNETES_PLUGIN_IMAGE"`
+	KubernetesPluginImagePullSecret string `envconfig:"KUBERNETES_PLUGIN_IMAGE_PULL_SECRET"`
+	KubernetesPluginReplicas        int32  `envconfig:"KUBERNETES_PLUGIN_REPLICAS"`
+	KubernetesPluginLaunchTimeout   int    `envconfig:"KUBERNETES_PLUGIN_LAUNCH_TIMEOUT"` // in seconds
+	KubernetesImageBuildEnabled     bool   `envconfig:"KUBERNETES_IMAGE_BUILD_ENABLED"`
+	KubernetesImageBuilder          string `envconfig:"KUBERNETES_IMAGE_BUILDER"`
+	KubernetesImageBuildFetcher     string `envconfig:"KUBERNETES_IMAGE_BUILD_FETCHER"` // downloads the package, needs sh, wget and unzip
+	KubernetesImageBuildPushSecret  string `envconfig:"KUBERNETES_IMAGE_BUILD_PUSH_SECRET"`
+	KubernetesDaemonURL             string `envconfig:"KUBERNETES_DAEMON_URL"` // the daemon as reached from the cluster
+
+	// images of serverless plugins, the registry of base images is replaced by the mirror if set
+	ServerlessImageRegistryMirror string `envconfig:"SERVERLESS_IMAGE_REGISTRY_MIRROR"`
+	// file of dockerfile instructions appended to the images of serverless plugins
+	ServerlessImageExtraBuildStepsPath string `envconfig:"SERVERLESS_IMAGE_EXTRA_BUILD_STEPS_PATH"`
+
 	MaxPluginPackageSize            int64 `envconfig:"MAX_PLUGIN_PACKAGE_SIZE" validate:"required"`
 	MaxBundlePackageSize            int64 `envconfig:"MAX_BUNDLE_PACKAGE_SIZE" validate:"required"`
 	MaxServerlessTransactionTimeout int   `envconfig:"MAX_SERVERLESS_TRANSACTION_TIMEOUT"`
 
+	// secret signing the callback tokens of serverless invokes, SERVER_KEY is used if empty
+	ServerlessCallbackTokenSecret string `envconfig:"SERVERLESS_CALLBACK_TOKEN_SECRET"`
+	// reject backwards invocations of serverless plugins without a callback token,
+	// disabled by default as plugins built with older sdks don't send the token
+	ServerlessCallbackTokenEnforced *bool `envconfig:"SERVERLESS_CALLBACK_TOKEN_ENFORCED"`
+
 	PythonInterpreterPath     string `envconfig:"PYTHON_INTERPRETER_PATH"`
 	UvPath                    string `envconfig:"UV_PATH"  default:""`
 	PythonEnvInitTimeout      int    `envconfig:"PYTHON_ENV_INIT_TIMEOUT" validate:"required"`
@@ -168,8 +253,52 @@ type Config struct {
 	PipVerbose                *bool  `envconfig:"PIP_VERBOSE"`
 	PipExtraArgs              string `envconfig:"PIP_EXTRA_ARGS"`
 
+	// interpreters available for plugins, format: `3.11:/usr/bin/python3.11,3.12:/usr/bin/python3.12`
+	// versions not listed are resolved through uv managed interpreters
+	PythonInterpreters   map[string]string `envconfig:"PYTHON_INTERPRETERS"`
+	PythonDefaultVersion string            `envconfig:"PYTHON_DEFAULT_VERSION"`
+
+	// node executable and package managers for nodejs plugins, resolved from PATH by default
+	NodeExecutablePath string `envconfig:"NODE_EXECUTABLE_PATH"`
+	NpmPath            string `envconfig:"NPM_PATH"`
+	PnpmPath           string `envconfig:"PNPM_PATH"`
+	NpmRegistryUrl     string `envconfig:"NPM_REGISTRY_URL"`
+	NodeEnvInitTimeout int    `envconfig:"NODE_ENV_INIT_TIMEOUT"`
+
+	// key to encrypt the secret environment variables of plugins, required to set secrets,
+	// it's separate from SERVER_KEY so rotating the server key keeps the secrets readable
+	PluginEnvironmentEncryptionKey string `envconfig:"PLUGIN_ENVIRONMENT_ENCRYPTION_KEY"`
+
+	// directory of operator supplied sdk patch registries, patches are applied on top of the embedded ones
+	PythonSdkPatchesPath string `envconfig:"PYTHON_SDK_PATCHES_PATH"`
+
+	// uv cache shared by the virtual environments of local plugins, packages are hard linked
+	// into the venvs, so the cache should be on the same filesystem as PLUGIN_WORKING_PATH, disabled by default
+	PluginDependencyCacheEnabled *bool  `envconfig:"PLUGIN_DEPENDENCY_CACHE_ENABLED"`
+	PluginDependencyCachePath    string `envconfig:"PLUGIN_DEPENDENCY_CACHE_PATH"`
+	// versions of the plugin sdk installed into the cache at startup, e.g. `0.4.1,0.3.3`
+	PluginDependencyCachePrewarmSdkVersions []string `envconfig:"PLUGIN_DEPENDENCY_CACHE_PREWARM_SDK_VERSIONS"`
+
 	PluginStdioBufferSize    int `envconfig:"PLUGIN_STDIO_BUFFER_SIZE" default:"1024"`
 	PluginStdioMaxBufferSize int `envconfig:"PLUGIN_STDIO_MAX_BUFFER_SIZE" default:"5242880"`
+	// length-prefixed framing of the stdio protocol, negotiated with the plugin runner at startup,
+	// it lifts the line size limit but binary outputs are still encoded for the listeners
+	PluginStdioFramingEnabled bool `envconfig:"PLUGIN_STDIO_FRAMING_ENABLED" default:"false"`
+	PluginStdioMaxFrameSize   int  `envconfig:"PLUGIN_STDIO_MAX_FRAME_SIZE" default:"67108864"`
+
+	// ping/pong health probes of local plugins, interval and timeout in seconds,
+	// plugins are restarted after failing max failures probes in a row
+	PluginHealthProbeEnabled     *bool `envconfig:"PLUGIN_HEALTH_PROBE_ENABLED"`
+	PluginHealthProbeInterval    int   `envconfig:"PLUGIN_HEALTH_PROBE_INTERVAL"`
+	PluginHealthProbeTimeout     int   `envconfig:"PLUGIN_HEALTH_PROBE_TIMEOUT"`
+	PluginHealthProbeMaxFailures int   `envconfig:"PLUGIN_HEALTH_PROBE_MAX_FAILURES"`
+
+	// blue-green upgrades of local plugins, in seconds, the new version must keep running for the
+	// stabilization period within the health check timeout, the old version is stopped once its
+	// in-flight sessions finished or the drain timeout passed
+	PluginUpgradeHealthCheckTimeout  int `envconfig:"PLUGIN_UPGRADE_HEALTH_CHECK_TIMEOUT"`
+	PluginUpgradeStabilizationPeriod int `envconfig:"PLUGIN_UPGRADE_STABILIZATION_PERIOD"`
+	PluginDrainTimeout               int `envconfig:"PLUGIN_DRAIN_TIMEOUT"`
 
 	DisplayClusterLog bool `envconfig:"DISPLAY_CLUSTER_LOG"`
 
@@ -216,6 +345,10 @@ func (c *Config) Validate() error {
 		if c.PluginRemoteInstallServerEventLoopNums == 0 {
 			return fmt.Errorf("plugin remote install server event loop nums is empty")
 		}
+		if c.PluginRemoteInstallingTLSEnabled &&
+			(c.PluginRemoteInstallingTLSCertFile == "" || c.PluginRemoteInstallingTLSKeyFile == "") {
+			return fmt.Errorf("plugin remote installing tls cert file and key file are required when tls is enabled")
+		}
 	}
 
 	if c.Platform == PLATFORM_SERVERLESS {
@@ -234,6 +367,18 @@ func (c *Config) Validate() error {
 		if c.PluginWorkingPath == "" {
 			return fmt.Errorf("plugin working path is empty")
 		}
+	} else if c.Platform == PLATFORM_KUBERNETES {
+		if c.KubernetesPluginImage == "" {
+			return fmt.Errorf("kubernetes plugin image is empty")
+		}
+
+		if c.KubernetesImageBuildEnabled && c.KubernetesDaemonURL == "" {
+			return fmt.Errorf("kubernetes daemon url is required when image build is enabled")
+		}
+
+		if c.MaxServerlessTransactionTimeout == 0 {
+			return fmt.Errorf("max serverless transaction timeout is empty")
+		}
 	} else {
 		return fmt.Errorf("invalid platform")
 	}
@@ -250,4 +395,5 @@ type PlatformType string
 const (
 	PLATFORM_LOCAL      PlatformType = "local"
 	PLATFORM_SERVERLESS PlatformType = "serverless"
+	PLATFORM_KUBERNETES PlatformType = "kubernetes"
 )
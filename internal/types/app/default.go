@@ -1,6 +1,8 @@
 package app
 
 import (
+	"path"
+
 	"github.com/langgenius/dify-cloud-kit/oss"
 	"golang.org/x/exp/constraints"
 )
@@ -17,11 +19,26 @@ func (config *Config) SetDefault() {
 	setDefaultInt(&config.MaxPluginPackageSize, 52428800)
 	setDefaultInt(&config.MaxBundlePackageSize, 52428800*12)
 	setDefaultInt(&config.MaxServerlessTransactionTimeout, 300)
+	setDefaultString(&config.ServerlessCallbackTokenSecret, config.ServerKey)
+	setDefaultBoolPtr(&config.ServerlessCallbackTokenEnforced, false)
 	setDefaultInt(&config.PluginMaxExecutionTimeout, 10*60)
 	setDefaultString(&config.PluginStorageType, oss.OSS_TYPE_LOCAL)
 	setDefaultInt(&config.PluginMediaCacheSize, 1024)
 	setDefaultInt(&config.DifyPluginServerlessConnectorLaunchTimeout, 240)
+	setDefaultInt(&config.ServerlessLifecycleInterval, 60)
+	setDefaultBoolPtr(&config.ServerlessFunctionGCEnabled, false)
+	setDefaultInt(&config.ServerlessFunctionGCGracePeriod, 86400)
+	setDefaultInt(&config.ServerlessWarmupTimeout, 30)
+	setDefaultInt(&config.ServerlessInvokeMaxAttempts, 3)
+	setDefaultInt(&config.ServerlessInvokeRetryBackoff, 500)
+	setDefaultInt(&config.ServerlessInvokeRetryMaxBackoff, 10000)
+	setDefaultBoolPtr(&config.ServerlessInvokeRetryTimeouts, false)
+	setDefaultBoolPtr(&config.ServerlessCircuitBreakerEnabled, true)
+	setDefaultInt(&config.ServerlessCircuitBreakerThreshold, 5)
+	setDefaultInt(&config.ServerlessCircuitBreakerCooldown, 30)
 	setDefaultInt(&config.PluginRemoteInstallingMaxSingleTenantConn, 5)
+	setDefaultInt(&config.PluginRemoteInstallingKeyExpireTime, 7200)
+	setDefaultBoolPtr(&config.PluginRemoteInstallingWebSocketEnabled, false)
 	setDefaultBoolPtr(&config.PluginRemoteInstallingEnabled, true)
 	setDefaultBoolPtr(&config.PluginEndpointEnabled, true)
 	setDefaultString(&config.DBSslMode, "disable")
@@ -30,10 +47,38 @@ func (config *Config) SetDefault() {
 	setDefaultString(&config.PluginMediaCachePath, "assets")
 	setDefaultString(&config.PersistenceStoragePath, "persistence")
 	setDefaultInt(&config.PluginLocalLaunchingConcurrent, 2)
+	setDefaultInt(&config.PluginConcurrencyWaitTimeout, 10)
+	setDefaultInt(&config.PluginLocalIdleTimeout, 600)
+	setDefaultInt(&config.PluginLocalWakeUpTimeout, 60)
+	setDefaultBoolPtr(&config.PluginWorkingPathGCEnabled, false)
+	setDefaultInt(&config.PluginWorkingPathGCInterval, 3600)
+	setDefaultInt(&config.PluginWorkingPathGCGracePeriod, 86400)
+	setDefaultBoolPtr(&config.PluginLogEnabled, true)
+	setDefaultString(&config.PluginLogPath, "plugin_logs")
+	setDefaultInt(&config.PluginLogMaxSize, 10*1024*1024)
+	setDefaultInt(&config.PluginLogRotateInterval, 86400)
+	setDefaultInt(&config.PluginLogMaxBackups, 5)
+	setDefaultInt(&config.PluginLogMaxAge, 7*86400)
 	setDefaultInt(&config.PersistenceStorageMaxSize, 100*1024*1024)
 	setDefaultString(&config.PluginPackageCachePath, "plugin_packages")
 	setDefaultString(&config.PythonInterpreterPath, "/usr/bin/python3")
+	setDefaultString(&config.PythonDefaultVersion, "3.12")
+	setDefaultBoolPtr(&config.PluginDependencyCacheEnabled, false)
+	if config.PluginWorkingPath != "" {
+		setDefaultString(&config.PluginDependencyCachePath, path.Join(config.PluginWorkingPath, ".dependency_cache"))
+	}
 	setDefaultInt(&config.PythonEnvInitTimeout, 120)
+	setDefaultString(&config.NodeExecutablePath, "node")
+	setDefaultString(&config.NpmPath, "npm")
+	setDefaultString(&config.PnpmPath, "pnpm")
+	setDefaultInt(&config.NodeEnvInitTimeout, 600)
+	setDefaultBoolPtr(&config.PluginHealthProbeEnabled, true)
+	setDefaultInt(&config.PluginHealthProbeInterval, 30)
+	setDefaultInt(&config.PluginHealthProbeTimeout, 10)
+	setDefaultInt(&config.PluginHealthProbeMaxFailures, 3)
+	setDefaultInt(&config.PluginUpgradeHealthCheckTimeout, 120)
+	setDefaultInt(&config.PluginUpgradeStabilizationPeriod, 5)
+	setDefaultInt(&config.PluginDrainTimeout, config.PluginMaxExecutionTimeout)
 	setDefaultBoolPtr(&config.ForceVerifyingSignature, true)
 	setDefaultBoolPtr(&config.PipPreferBinary, true)
 	setDefaultBoolPtr(&config.PipVerbose, true)
@@ -45,6 +90,11 @@ func (config *Config) SetDefault() {
 		setDefaultString(&config.DBDefaultDatabase, "mysql")
 	}
 	setDefaultBoolPtr(&config.HealthApiLogEnabled, true)
+	setDefaultString(&config.KubernetesNamespace, "dify-plugins")
+	setDefaultInt(&config.KubernetesPluginReplicas, 1)
+	setDefaultInt(&config.KubernetesPluginLaunchTimeout, 600)
+	setDefaultString(&config.KubernetesImageBuilder, "gcr.io/kaniko-project/executor:v1.23.2")
+	setDefaultString(&config.KubernetesImageBuildFetcher, "busybox:1.36")
 }
 
 func setDefaultInt[T constraints.Integer](value *T, defaultValue T) {
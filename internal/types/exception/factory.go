@@ -1,6 +1,7 @@
 package exception
 
 import (
+	"errors"
 	"runtime/debug"
 
 	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
@@ -19,6 +20,10 @@ const (
 	PluginPermissionDeniedError       = "PluginPermissionDeniedError"
 	PluginInvokeError                 = "PluginInvokeError"
 	PluginConnectionClosedError       = "ConnectionClosedError"
+	PluginDaemonTooManyRequestsError  = "PluginDaemonTooManyRequestsError"
+	PluginThrottledError              = "PluginThrottled"
+	PluginColdStartTimeoutError       = "PluginColdStartTimeout"
+	PluginUnavailableError            = "PluginUnavailable"
 )
 
 func InternalServerError(err error) PluginDaemonError {
@@ -65,3 +70,18 @@ func InvokePluginError(err error) PluginDaemonError {
 func ConnectionClosedError() PluginDaemonError {
 	return ErrorWithTypeAndCode("connection closed", PluginConnectionClosedError, -500)
 }
+
+// TooManyRequestsError is used when a request is rejected by the concurrency limits
+// args carries the details of the exceeded limit
+func TooManyRequestsError(msg string, args map[string]any) PluginDaemonError {
+	return ErrorWithTypeAndArgsAndCode(msg, PluginDaemonTooManyRequestsError, args, -429)
+}
+
+// AsTooManyRequestsError finds the rejection of the concurrency limits in the chain of err
+func AsTooManyRequestsError(err error) (PluginDaemonError, bool) {
+	var e *genericError
+	if errors.As(err, &e) && e.ErrorType == PluginDaemonTooManyRequestsError {
+		return e, true
+	}
+	return nil, false
+}
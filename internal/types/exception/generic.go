@@ -43,3 +43,7 @@ func ErrorWithTypeAndCode(msg string, errorType string, code int) PluginDaemonEr
 func ErrorWithTypeAndArgs(msg string, errorType string, args map[string]any) PluginDaemonError {
 	return &genericError{Message: msg, code: -500, ErrorType: errorType, Args: args}
 }
+
+func ErrorWithTypeAndArgsAndCode(msg string, errorType string, args map[string]any, code int) PluginDaemonError {
+	return &genericError{Message: msg, code: code, ErrorType: errorType, Args: args}
+}
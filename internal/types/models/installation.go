@@ -1,5 +1,7 @@
 package models
 
+import "github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+
 type PluginInstallationStatus string
 
 type PluginInstallation struct {
@@ -12,4 +14,6 @@ type PluginInstallation struct {
 	EndpointsActive        int            `json:"endpoints_active"`
 	Source                 string         `json:"source" gorm:"column:source;size:63"`
 	Meta                   map[string]any `json:"meta" gorm:"column:meta;serializer:json"`
+	// narrows the permission declared by the plugin for this tenant, nil to keep it as declared
+	Permission *plugin_entities.PluginPermissionRequirement `json:"permission" gorm:"column:permission;serializer:json;type:text"`
 }
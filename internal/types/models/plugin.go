@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/manifest_entities"
 	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
 )
@@ -21,6 +23,7 @@ type ServerlessRuntimeType string
 
 const (
 	SERVERLESS_RUNTIME_TYPE_SERVERLESS ServerlessRuntimeType = "serverless"
+	SERVERLESS_RUNTIME_TYPE_KUBERNETES ServerlessRuntimeType = "kubernetes"
 )
 
 type ServerlessRuntime struct {
@@ -30,6 +33,10 @@ type ServerlessRuntime struct {
 	FunctionName           string                `json:"function_name" gorm:"size:127"`
 	Type                   ServerlessRuntimeType `json:"type" gorm:"size:127"`
 	Checksum               string                `json:"checksum" gorm:"size:127;index"`
+	// seconds between warmup pings of the function, disabled if 0
+	WarmupInterval int `json:"warmup_interval" gorm:"default:0"`
+	// when the function was first found without any installation, nil if it's installed
+	OrphanedAt *time.Time `json:"orphaned_at"`
 }
 
 type PluginDeclaration struct {
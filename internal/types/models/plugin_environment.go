@@ -0,0 +1,16 @@
+package models
+
+// PluginEnvironmentVariable is injected into the processes of a local plugin,
+// variables of a specific version override the ones shared by all versions
+type PluginEnvironmentVariable struct {
+	Model
+	PluginID string `json:"plugin_id" gorm:"size:255;column:plugin_id;uniqueIndex:idx_plugin_environment_variable"`
+	// empty for all versions of the plugin
+	Version string `json:"version" gorm:"size:127;column:version;uniqueIndex:idx_plugin_environment_variable"`
+	Name    string `json:"name" gorm:"size:255;column:name;uniqueIndex:idx_plugin_environment_variable"`
+	// encrypted if Secret is true
+	Value  string `json:"-" gorm:"column:value;type:text"`
+	Secret bool   `json:"secret" gorm:"column:secret"`
+	// identifies the key the secret was encrypted with, rotated keys are detected instead of decrypting garbage
+	KeyID string `json:"-" gorm:"size:32;column:key_id"`
+}
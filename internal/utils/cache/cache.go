@@ -43,10 +43,16 @@ type Client interface {
 var (
 	client Client
 
-	ErrNotInit  = errors.New("cache not init")
-	ErrNotFound = errors.New("cache not found")
+	ErrNotInit      = errors.New("cache not init")
+	ErrNotFound     = errors.New("cache not found")
+	ErrNotSupported = errors.New("not supported by the cache")
 )
 
+// ScriptClient is implemented by caches which are able to run lua scripts atomically, e.g. redis
+type ScriptClient interface {
+	Eval(script string, keys []string, args ...any) (any, error)
+}
+
 func SetClient(c Client) {
 	client = c
 }
@@ -416,3 +422,23 @@ func Unlock(key string, context ...Context) error {
 
 	return getCmdable(context...).Unlock(serialKey(key))
 }
+
+// Eval runs the lua script atomically, keys are serialized like the keys of other operations
+// returns ErrNotSupported if the cache can't run scripts
+func Eval(script string, keys []string, args ...any) (any, error) {
+	if client == nil {
+		return nil, ErrNotInit
+	}
+
+	scriptClient, ok := client.(ScriptClient)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	serialKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		serialKeys = append(serialKeys, serialKey(key))
+	}
+
+	return scriptClient.Eval(script, serialKeys, args...)
+}
@@ -264,6 +264,11 @@ func (c *Client) Transaction(fn func(context cache.Context) error) error {
 	})
 }
 
+// Eval runs the lua script atomically on the server
+func (c *Client) Eval(script string, keys []string, args ...any) (any, error) {
+	return c.Cmdable.Eval(ctx, script, keys, args...).Result()
+}
+
 func (c *Client) Publish(channel string, message string) error {
 	return c.Cmdable.Publish(ctx, channel, message).Err()
 }
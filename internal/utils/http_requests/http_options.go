@@ -1,6 +1,9 @@
 package http_requests
 
-import "io"
+import (
+	"context"
+	"io"
+)
 
 type HttpOptions struct {
 	Type  string
@@ -20,6 +23,7 @@ const (
 	HttpOptionTypeDirectReferer                    = "directReferer"
 	HttpOptionTypeRetCode                          = "retCode"
 	HttpOptionTypeUsingLengthPrefixed              = "usingLengthPrefixed"
+	HttpOptionTypeContext                          = "context"
 )
 
 // milliseconds
@@ -83,6 +87,11 @@ func HttpWithDirectReferer() HttpOptions {
 	return HttpOptions{HttpOptionTypeDirectReferer, true}
 }
 
+// the request is aborted once the context is cancelled
+func HttpContext(ctx context.Context) HttpOptions {
+	return HttpOptions{HttpOptionTypeContext, ctx}
+}
+
 func HttpWithRetCode(retCode *int) HttpOptions {
 	return HttpOptions{HttpOptionTypeRetCode, retCode}
 }
@@ -2,6 +2,7 @@ package http_requests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"mime/multipart"
@@ -17,6 +18,8 @@ func buildHttpRequest(method string, url string, options ...HttpOptions) (*http.
 
 	for _, option := range options {
 		switch option.Type {
+		case HttpOptionTypeContext:
+			req = req.WithContext(option.Value.(context.Context))
 		case "header":
 			for k, v := range option.Value.(map[string]string) {
 				req.Header.Set(k, v)
@@ -87,6 +87,10 @@ func RequestAndParseStream[T any](client *http.Client, url string, method string
 	}
 
 	ch := stream.NewStream[T](1024)
+	// abort the request once the consumer has gone away
+	ch.OnClose(func() {
+		resp.Body.Close()
+	})
 
 	// get read timeout
 	readTimeout := int64(60000)
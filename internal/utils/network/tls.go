@@ -0,0 +1,223 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/langgenius/dify-plugin-daemon/internal/utils/log"
+)
+
+const (
+	// the interval to check whether the certificate files changed
+	CERT_RELOAD_CHECK_INTERVAL = 10 * time.Second
+
+	// clients which don't complete the tls handshake in time are disconnected
+	TLS_HANDSHAKE_TIMEOUT = 10 * time.Second
+
+	// local ports tried to connect to the backend, a port may be taken between picking and binding it
+	TLS_PROXY_DIAL_ATTEMPTS = 3
+)
+
+// CertReloader serves a certificate loaded from files and reloads it once the files changed,
+// renewed certificates are picked up by new connections without a restart
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	checkInterval time.Duration
+
+	lock      sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		checkInterval: CERT_RELOAD_CHECK_INTERVAL,
+	}
+
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reload loads the certificate from the files
+func (c *CertReloader) Reload() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.checkedAt = time.Now()
+	c.lock.Unlock()
+
+	return nil
+}
+
+func (c *CertReloader) latestModTime() (time.Time, error) {
+	latest := time.Time{}
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate, the current certificate
+// is kept if the changed files can't be loaded, e.g. while they are being replaced
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.RLock()
+	cert, modTime, checkedAt := c.cert, c.modTime, c.checkedAt
+	c.lock.RUnlock()
+
+	if time.Since(checkedAt) < c.checkInterval {
+		return cert, nil
+	}
+
+	c.lock.Lock()
+	c.checkedAt = time.Now()
+	c.lock.Unlock()
+
+	latest, err := c.latestModTime()
+	if err != nil || !latest.After(modTime) {
+		return cert, nil
+	}
+
+	if err := c.Reload(); err != nil {
+		log.Error("failed to reload certificate %s: %s", c.certFile, err.Error())
+		return cert, nil
+	}
+
+	log.Info("certificate %s reloaded", c.certFile)
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cert, nil
+}
+
+// TLSProxy terminates tls and forwards the plaintext to a backend address,
+// used in front of servers without tls support
+type TLSProxy struct {
+	backend string
+
+	// the local addresses of the connections to the backend => the addresses of their clients
+	clients sync.Map
+}
+
+func NewTLSProxy(backend string) *TLSProxy {
+	return &TLSProxy{backend: backend}
+}
+
+// ClientAddr returns the address of the client behind a proxied connection,
+// addr is the remote address of the connection as seen by the backend
+func (p *TLSProxy) ClientAddr(addr net.Addr) (net.Addr, bool) {
+	client, ok := p.clients.Load(addr.String())
+	if !ok {
+		return nil, false
+	}
+	return client.(net.Addr), true
+}
+
+// Serve accepts tls connections and forwards them to the backend, returns once the listener is closed
+func (p *TLSProxy) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		go p.proxy(conn)
+	}
+}
+
+func (p *TLSProxy) proxy(conn net.Conn) {
+	defer conn.Close()
+
+	// connections failing the handshake never reach the backend
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), TLS_HANDSHAKE_TIMEOUT)
+		err := tlsConn.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			log.Warn("tls handshake with %s failed: %s", conn.RemoteAddr(), err.Error())
+			return
+		}
+	}
+
+	upstream, err := p.dial(conn.RemoteAddr())
+	if err != nil {
+		log.Error("failed to connect to %s: %s", p.backend, err.Error())
+		return
+	}
+	defer upstream.Close()
+	defer p.clients.Delete(upstream.LocalAddr().String())
+
+	// both connections are closed once either side is done
+	done := make(chan bool, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		done <- true
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- true
+	}()
+	<-done
+}
+
+// dial connects to the backend from a local port the client is registered to beforehand,
+// the backend may look the client up as soon as it accepts the connection
+func (p *TLSProxy) dial(client net.Addr) (net.Conn, error) {
+	var err error
+	for i := 0; i < TLS_PROXY_DIAL_ATTEMPTS; i++ {
+		var port uint16
+		port, err = GetRandomPort()
+		if err != nil {
+			return nil, err
+		}
+
+		local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: int(port)}
+		p.clients.Store(local.String(), client)
+
+		dialer := net.Dialer{LocalAddr: local}
+		var upstream net.Conn
+		upstream, err = dialer.Dial("tcp", p.backend)
+		if err == nil {
+			return upstream, nil
+		}
+
+		p.clients.Delete(local.String())
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,163 @@
+package network
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSelfSignedCert writes a certificate for 127.0.0.1 and returns it
+func writeSelfSignedCert(t *testing.T, certFile string, keyFile string, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	writeSelfSignedCert(t, certFile, keyFile, "first")
+	reloader, err := NewCertReloader(certFile, keyFile)
+	assert.NoError(t, err)
+	reloader.checkInterval = 0
+
+	cert, err := reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", cert.Leaf.Subject.CommonName)
+
+	// renewed certificates are picked up
+	writeSelfSignedCert(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(certFile, later, later))
+	cert, err = reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", cert.Leaf.Subject.CommonName)
+
+	// broken files keep the current certificate
+	assert.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	later = later.Add(time.Minute)
+	assert.NoError(t, os.Chtimes(keyFile, later, later))
+	cert, err = reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", cert.Leaf.Subject.CommonName)
+
+	_, err = NewCertReloader(certFile, filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+}
+
+func TestTLSProxy(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	leaf := writeSelfSignedCert(t, certFile, keyFile, "proxy")
+
+	// a plain tcp echo server as backend
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer backend.Close()
+	proxy := NewTLSProxy(backend.Addr().String())
+
+	// the client is resolved as soon as the connection is accepted, before any data arrives
+	resolved := make(chan net.Addr, 1)
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			client, _ := proxy.ClientAddr(conn.RemoteAddr())
+			resolved <- client
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadBytes('\n')
+					if err != nil {
+						return
+					}
+					conn.Write(line)
+				}
+			}()
+		}
+	}()
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	assert.NoError(t, err)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{GetCertificate: reloader.GetCertificate})
+	assert.NoError(t, err)
+
+	served := make(chan error)
+	go func() {
+		served <- proxy.Serve(listener)
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: pool})
+	if assert.NoError(t, err) {
+		_, err = conn.Write([]byte("handshake\n"))
+		assert.NoError(t, err)
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "handshake\n", line)
+
+		// the backend resolves the address of the client
+		client := <-resolved
+		if assert.NotNil(t, client) {
+			assert.Equal(t, conn.LocalAddr().String(), client.String())
+		}
+		conn.Close()
+	}
+
+	// plaintext clients are rejected
+	plain, err := net.Dial("tcp", listener.Addr().String())
+	if assert.NoError(t, err) {
+		plain.Write([]byte("handshake\n"))
+		plain.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 64)
+		n, _ := plain.Read(buf)
+		assert.NotContains(t, string(buf[:n]), "handshake")
+		plain.Close()
+	}
+
+	listener.Close()
+	assert.NoError(t, <-served)
+}
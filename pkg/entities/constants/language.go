@@ -9,13 +9,14 @@ type Language string
 
 const (
 	Python Language = "python"
-	Go     Language = "go" // not supported yet
+	NodeJS Language = "nodejs"
+	Go     Language = "go"
 )
 
 func isAvailableLanguage(fl validator.FieldLevel) bool {
 	value := fl.Field().String()
 	switch value {
-	case string(Python):
+	case string(Python), string(NodeJS), string(Go):
 		return true
 	}
 	return false
@@ -21,8 +21,9 @@ func ParsePluginUniversalEvent(
 	statusText string,
 	sessionHandler func(sessionId string, data []byte),
 	heartbeatHandler func(),
+	protocolHandler func(protocol PluginProtocolEvent),
 	errorHandler func(err string),
-	infoHandler func(message string),
+	logHandler func(sessionId string, logEvent PluginLogEvent),
 ) {
 	// handle event
 	event, err := parser.UnmarshalJsonBytes[PluginUniversalEvent](data)
@@ -48,7 +49,7 @@ func ParsePluginUniversalEvent(
 				return
 			}
 
-			infoHandler(logEvent.Message)
+			logHandler(sessionId, logEvent)
 		}
 	case PLUGIN_EVENT_SESSION:
 		sessionHandler(sessionId, event.Data)
@@ -56,6 +57,14 @@ func ParsePluginUniversalEvent(
 		errorHandler(string(event.Data))
 	case PLUGIN_EVENT_HEARTBEAT:
 		heartbeatHandler()
+	case PLUGIN_EVENT_PROTOCOL:
+		protocolEvent, err := parser.UnmarshalJsonBytes[PluginProtocolEvent](event.Data)
+		if err != nil {
+			log.Error("unmarshal json failed: %s", err.Error())
+			return
+		}
+
+		protocolHandler(protocolEvent)
 	}
 }
 
@@ -66,8 +75,25 @@ const (
 	PLUGIN_EVENT_SESSION   PluginEventType = "session"
 	PLUGIN_EVENT_ERROR     PluginEventType = "error"
 	PLUGIN_EVENT_HEARTBEAT PluginEventType = "heartbeat"
+	// sent by plugins to negotiate the protocol version, plugins with older sdks never send it
+	PLUGIN_EVENT_PROTOCOL PluginEventType = "protocol"
 )
 
+const (
+	// the protocol spoken by all plugins, it's assumed if no negotiation happened
+	PLUGIN_PROTOCOL_VERSION_BASIC = 1
+	// plugins accept `cancel` events to abort sessions abandoned by the caller
+	PLUGIN_PROTOCOL_VERSION_CANCELLATION = 2
+	// plugins answer `ping` events on their session, like a request, used to probe their liveness
+	PLUGIN_PROTOCOL_VERSION_PING = 3
+)
+
+type PluginProtocolEvent struct {
+	Version int `json:"version"`
+	// framing of the stdio protocol chosen by the plugin, empty means newline-delimited JSON
+	Framing string `json:"framing,omitempty"`
+}
+
 type PluginLogEvent struct {
 	Level     string  `json:"level"`
 	Message   string  `json:"message"`
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -29,6 +31,7 @@ type PluginPermissionRequirement struct {
 	Endpoint *PluginPermissionEndpointRequirement `json:"endpoint,omitempty" yaml:"endpoint,omitempty" validate:"omitempty"`
 	App      *PluginPermissionAppRequirement      `json:"app,omitempty" yaml:"app,omitempty" validate:"omitempty"`
 	Storage  *PluginPermissionStorageRequirement  `json:"storage,omitempty" yaml:"storage,omitempty" validate:"omitempty"`
+	File     *PluginPermissionFileRequirement     `json:"file,omitempty" yaml:"file,omitempty" validate:"omitempty"`
 }
 
 func (p *PluginPermissionRequirement) AllowInvokeTool() bool {
@@ -79,8 +82,35 @@ func (p *PluginPermissionRequirement) AllowInvokeStorage() bool {
 	return p != nil && p.Storage != nil && p.Storage.Enabled
 }
 
+// canonicalProvider expands a short name like openai to langgenius/openai/openai,
+// the same way dify resolves providers without an organization
+func canonicalProvider(provider string) string {
+	if provider == "" || strings.Contains(provider, "/") {
+		return provider
+	}
+	return fmt.Sprintf("langgenius/%s/%s", provider, provider)
+}
+
+// matchProvider reports whether the provider is in the allowlist, both sides are compared as full provider ids
+func matchProvider(allowlist []string, provider string) bool {
+	provider = canonicalProvider(provider)
+	for _, allowed := range allowlist {
+		if canonicalProvider(allowed) == provider {
+			return true
+		}
+	}
+
+	return false
+}
+
 type PluginPermissionToolRequirement struct {
 	Enabled bool `json:"enabled" yaml:"enabled"`
+	// tool providers allowed to be invoked, all providers if empty
+	Providers []string `json:"providers,omitempty" yaml:"providers,omitempty" validate:"omitempty,max=256,dive,max=255"`
+}
+
+func (t *PluginPermissionToolRequirement) AllowProvider(provider string) bool {
+	return t == nil || len(t.Providers) == 0 || matchProvider(t.Providers, provider)
 }
 
 type PluginPermissionModelRequirement struct {
@@ -91,6 +121,46 @@ type PluginPermissionModelRequirement struct {
 	TTS           bool `json:"tts" yaml:"tts"`
 	Speech2text   bool `json:"speech2text" yaml:"speech2text"`
 	Moderation    bool `json:"moderation" yaml:"moderation"`
+	// model providers allowed to be invoked, all providers if empty
+	Providers []PluginPermissionModelProvider `json:"providers,omitempty" yaml:"providers,omitempty" validate:"omitempty,max=256,dive"`
+}
+
+type PluginPermissionModelProvider struct {
+	Provider string `json:"provider" yaml:"provider" validate:"required,max=255"`
+	// models of the provider allowed to be invoked, all models if empty
+	Models []string `json:"models,omitempty" yaml:"models,omitempty" validate:"omitempty,max=256,dive,max=255"`
+}
+
+// AllowProvider reports whether any model of the provider may be invoked
+func (m *PluginPermissionModelRequirement) AllowProvider(provider string) bool {
+	if m == nil || len(m.Providers) == 0 {
+		return true
+	}
+
+	for _, allowed := range m.Providers {
+		if matchProvider([]string{allowed.Provider}, provider) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *PluginPermissionModelRequirement) AllowModel(provider string, model string) bool {
+	if m == nil || len(m.Providers) == 0 {
+		return true
+	}
+
+	for _, allowed := range m.Providers {
+		if !matchProvider([]string{allowed.Provider}, provider) {
+			continue
+		}
+		if len(allowed.Models) == 0 || slices.Contains(allowed.Models, model) {
+			return true
+		}
+	}
+
+	return false
 }
 
 type PluginPermissionNodeRequirement struct {
@@ -103,6 +173,12 @@ type PluginPermissionEndpointRequirement struct {
 
 type PluginPermissionAppRequirement struct {
 	Enabled bool `json:"enabled" yaml:"enabled"`
+	// apps allowed to be invoked, all apps of the tenant if empty
+	AppIDs []string `json:"app_ids,omitempty" yaml:"app_ids,omitempty" validate:"omitempty,max=256,dive,max=255"`
+}
+
+func (a *PluginPermissionAppRequirement) AllowApp(appID string) bool {
+	return a == nil || len(a.AppIDs) == 0 || slices.Contains(a.AppIDs, appID)
 }
 
 type PluginPermissionStorageRequirement struct {
@@ -110,6 +186,30 @@ type PluginPermissionStorageRequirement struct {
 	Size    uint64 `json:"size" yaml:"size" validate:"min=1024,max=1073741824"` // min 1024 bytes, max 1G
 }
 
+// PluginPermissionFileRequirement limits the files uploaded by the plugin, uploads are unrestricted without it,
+// files are uploaded to dify directly, so only the mimetype declared by the plugin is checked but not the content or size
+type PluginPermissionFileRequirement struct {
+	// e.g. image/png or image/*, all types if empty
+	MimeTypes []string `json:"mime_types,omitempty" yaml:"mime_types,omitempty" validate:"omitempty,max=256,dive,max=255"`
+}
+
+func (f *PluginPermissionFileRequirement) AllowMimeType(mimeType string) bool {
+	if f == nil || len(f.MimeTypes) == 0 {
+		return true
+	}
+
+	for _, allowed := range f.MimeTypes {
+		if allowed == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
 type PluginResourceRequirement struct {
 	// Memory in bytes
 	Memory int64 `json:"memory" yaml:"memory" validate:"required"`
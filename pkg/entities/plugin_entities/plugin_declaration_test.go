@@ -191,3 +191,27 @@ func TestPluginDeclarationIncorrectName(t *testing.T) {
 		return
 	}
 }
+
+func TestMatchProvider(t *testing.T) {
+	cases := []struct {
+		allowed  string
+		provider string
+		match    bool
+	}{
+		{"langgenius/openai/openai", "langgenius/openai/openai", true},
+		// short names are providers of langgenius, in both directions
+		{"openai", "langgenius/openai/openai", true},
+		{"langgenius/openai/openai", "openai", true},
+		{"openai", "openai", true},
+		// the same name from another organization is another provider
+		{"openai", "anyone/openai/openai", false},
+		{"langgenius/openai/openai", "anyone/openai/openai", false},
+		{"openai", "", false},
+	}
+
+	for _, c := range cases {
+		if matchProvider([]string{c.allowed}, c.provider) != c.match {
+			t.Errorf("matchProvider(%q, %q) should be %v", c.allowed, c.provider, c.match)
+		}
+	}
+}
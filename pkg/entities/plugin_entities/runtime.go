@@ -7,6 +7,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"hash/fnv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/langgenius/dify-plugin-daemon/internal/core/plugin_daemon/access_types"
@@ -18,6 +20,11 @@ type (
 		State     PluginRuntimeState `json:"state"`
 		Config    PluginDeclaration  `json:"config"`
 		onStopped []func()           `json:"-"`
+
+		// negotiated by the goroutine reading the plugin while sessions read it
+		protocolVersion atomic.Int32
+		// guards the health probe states, they are written by the probes while the cluster reads the states
+		healthProbeLock sync.RWMutex
 	}
 
 	PluginLifetime interface {
@@ -57,6 +64,15 @@ type (
 		WaitStopped() <-chan bool
 	}
 
+	// PluginHibernatableLifetime is implemented by runtimes whose process can be stopped while idle
+	// and started again on demand, the runtime itself keeps alive during hibernation
+	PluginHibernatableLifetime interface {
+		// returns true if the last exit of the plugin process was caused by hibernation
+		Hibernated() bool
+		// make sure the plugin process is running, waits until it's started or timeout
+		WakeUp(timeout time.Duration) error
+	}
+
 	PluginServerlessLifetime interface {
 		PluginLifetime
 
@@ -79,6 +95,15 @@ type (
 		Warn(string)
 		// Error adds an error to the plugin runtime state
 		Error(string)
+		// returns the protocol version negotiated with the plugin
+		ProtocolVersion() int
+	}
+
+	// PluginSessionCancellableInterface is implemented by runtimes which are able to abort a session
+	PluginSessionCancellableInterface interface {
+		// Cancel notifies the plugin that the session was abandoned by the caller
+		// data is the encoded cancel event, it's dropped if the plugin doesn't support cancellation
+		Cancel(session_id string, data []byte)
 	}
 
 	PluginClusterLifetime interface {
@@ -133,7 +158,11 @@ func (r *PluginRuntime) HashedIdentity() (string, error) {
 }
 
 func (r *PluginRuntime) RuntimeState() PluginRuntimeState {
-	return r.State
+	r.healthProbeLock.RLock()
+	defer r.healthProbeLock.RUnlock()
+	state := r.State
+	state.ProtocolVersion = r.ProtocolVersion()
+	return state
 }
 
 func (r *PluginRuntime) UpdateScheduledAt(t time.Time) {
@@ -164,6 +193,10 @@ func (r *PluginRuntime) SetRestarting() {
 	r.State.Status = PLUGIN_RUNTIME_STATUS_RESTARTING
 }
 
+func (r *PluginRuntime) SetHibernating() {
+	r.State.Status = PLUGIN_RUNTIME_STATUS_HIBERNATING
+}
+
 func (r *PluginRuntime) SetPending() {
 	r.State.Status = PLUGIN_RUNTIME_STATUS_PENDING
 }
@@ -180,6 +213,58 @@ func (r *PluginRuntime) AddRestarts() {
 	r.State.Restarts++
 }
 
+func (r *PluginRuntime) SetProtocolVersion(version int) {
+	r.protocolVersion.Store(int32(version))
+}
+
+func (r *PluginRuntime) ProtocolVersion() int {
+	version := int(r.protocolVersion.Load())
+	if version < PLUGIN_PROTOCOL_VERSION_BASIC {
+		return PLUGIN_PROTOCOL_VERSION_BASIC
+	}
+	return version
+}
+
+// RecordHealthProbe records the result of a health probe, returns the number of consecutive failures
+func (r *PluginRuntime) RecordHealthProbe(latency time.Duration, err error) int {
+	r.healthProbeLock.Lock()
+	defer r.healthProbeLock.Unlock()
+
+	state := PluginHealthProbeState{}
+	if r.State.HealthProbe != nil {
+		state = *r.State.HealthProbe
+	}
+
+	now := time.Now()
+	state.LastProbedAt = now
+	if err != nil {
+		state.ConsecutiveFailures++
+		state.LastError = err.Error()
+	} else {
+		state.ConsecutiveFailures = 0
+		state.LastError = ""
+		state.LatencyMs = latency.Milliseconds()
+		state.LastSucceededAt = &now
+	}
+
+	r.State.HealthProbe = &state
+	return state.ConsecutiveFailures
+}
+
+// HealthProbe returns the result of the last health probe, nil if the plugin was not probed yet
+func (r *PluginRuntime) HealthProbe() *PluginHealthProbeState {
+	r.healthProbeLock.RLock()
+	defer r.healthProbeLock.RUnlock()
+	return r.State.HealthProbe
+}
+
+// ResetHealthProbe clears the results of the health probes, e.g. when a new process starts
+func (r *PluginRuntime) ResetHealthProbe() {
+	r.healthProbeLock.Lock()
+	defer r.healthProbeLock.Unlock()
+	r.State.HealthProbe = nil
+}
+
 func (r *PluginRuntime) OnStop(f func()) {
 	r.onStopped = append(r.onStopped, f)
 }
@@ -219,6 +304,20 @@ type PluginRuntimeState struct {
 	Verified    bool       `json:"verified"`
 	ScheduledAt *time.Time `json:"scheduled_at"`
 	Logs        []string   `json:"logs"`
+	// protocol version negotiated with the plugin
+	ProtocolVersion int `json:"protocol_version"`
+	// result of the active health probes, nil if the plugin is not probed
+	HealthProbe *PluginHealthProbeState `json:"health_probe"`
+}
+
+// PluginHealthProbeState is the result of the ping/pong health probes of a plugin process
+type PluginHealthProbeState struct {
+	// round trip time of the last successful probe in milliseconds
+	LatencyMs           int64      `json:"latency_ms"`
+	LastProbedAt        time.Time  `json:"last_probed_at"`
+	LastSucceededAt     *time.Time `json:"last_succeeded_at"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
 }
 
 func (s *PluginRuntimeState) Hash() (uint64, error) {
@@ -243,4 +342,6 @@ const (
 	PLUGIN_RUNTIME_STATUS_STOPPED    = "stopped"
 	PLUGIN_RUNTIME_STATUS_RESTARTING = "restarting"
 	PLUGIN_RUNTIME_STATUS_PENDING    = "pending"
+	// the plugin process is stopped due to idleness, it will be started on the next dispatch
+	PLUGIN_RUNTIME_STATUS_HIBERNATING = "hibernating"
 )
@@ -1,6 +1,7 @@
 package plugin_entities
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -48,3 +49,55 @@ func TestRuntimeStateHash(t *testing.T) {
 		return
 	}
 }
+
+// the probes record results while the cluster reads the state, run with -race
+func TestRecordHealthProbeConcurrentRead(t *testing.T) {
+	runtime := &PluginRuntime{}
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			runtime.RecordHealthProbe(time.Millisecond, nil)
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if probe := runtime.RuntimeState().HealthProbe; probe != nil && probe.ConsecutiveFailures != 0 {
+			t.Errorf("unexpected failures: %d", probe.ConsecutiveFailures)
+		}
+	}
+	<-done
+
+	if failures := runtime.RecordHealthProbe(0, errors.New("timeout")); failures != 1 {
+		t.Errorf("expected 1 failure, got %d", failures)
+	}
+	runtime.ResetHealthProbe()
+	if runtime.HealthProbe() != nil {
+		t.Error("expected the health probe to be reset")
+	}
+}
+
+// the protocol is negotiated while sessions read it, run with -race
+func TestProtocolVersionConcurrentRead(t *testing.T) {
+	runtime := &PluginRuntime{}
+	if runtime.ProtocolVersion() != PLUGIN_PROTOCOL_VERSION_BASIC {
+		t.Errorf("expected the basic protocol before negotiation, got %d", runtime.ProtocolVersion())
+	}
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		runtime.SetProtocolVersion(PLUGIN_PROTOCOL_VERSION_CANCELLATION)
+	}()
+
+	for i := 0; i < 100; i++ {
+		runtime.ProtocolVersion()
+		runtime.RuntimeState()
+	}
+	<-done
+
+	if version := runtime.RuntimeState().ProtocolVersion; version != PLUGIN_PROTOCOL_VERSION_CANCELLATION {
+		t.Errorf("expected the negotiated protocol in the state, got %d", version)
+	}
+}
@@ -1,5 +1,24 @@
 package requests
 
+const (
+	REMOTE_DEBUGGING_KEY_ACTION_GET    = "get"
+	REMOTE_DEBUGGING_KEY_ACTION_ROTATE = "rotate"
+	REMOTE_DEBUGGING_KEY_ACTION_REVOKE = "revoke"
+)
+
 type RequestGetRemoteDebuggingKey struct {
 	TenantID string `uri:"tenant_id" validate:"required"`
+	// keys of a user are only valid for the user, the key of the tenant is used if empty
+	UserID string `json:"user_id" form:"user_id" validate:"omitempty,max=255"`
+	// get by default, rotate replaces the key, revoke deletes it, connections of replaced keys are closed
+	Action string `json:"action" form:"action" validate:"omitempty,oneof=get rotate revoke"`
+}
+
+type RequestListRemoteDebuggingSessions struct {
+	TenantID string `uri:"tenant_id" validate:"required"`
+}
+
+type RequestDisconnectRemoteDebuggingSession struct {
+	TenantID  string `uri:"tenant_id" validate:"required"`
+	SessionID string `json:"session_id" validate:"required"`
 }
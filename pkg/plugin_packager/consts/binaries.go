@@ -0,0 +1,8 @@
+package consts
+
+const (
+	// directory of a package holding the prebuilt binaries of go plugins
+	BINARIES_DIR = "bin"
+	// checksums of the prebuilt binaries, in the format of `sha256sum`
+	BINARIES_CHECKSUM_FILE = "bin/SHA256SUMS"
+)
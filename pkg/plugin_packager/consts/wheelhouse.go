@@ -0,0 +1,7 @@
+package consts
+
+const (
+	// directory of a package holding vendored python wheels, packages carrying it
+	// are installed without accessing any package index
+	WHEELHOUSE_DIR = "wheels"
+)
@@ -0,0 +1,171 @@
+package packager
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/consts"
+)
+
+// GoBinaryPath returns the path of the prebuilt binary of a go plugin for the arch,
+// relative to the root of the package, e.g. bin/main-linux-amd64
+func GoBinaryPath(entrypoint string, arch constants.Arch) string {
+	return path.Join(consts.BINARIES_DIR, fmt.Sprintf("%s-linux-%s", path.Base(entrypoint), arch))
+}
+
+// ParseBinaryChecksums parses the checksum file of the prebuilt binaries, each line
+// is `<sha256>  <filename>` where filename is relative to the binaries directory
+func ParseBinaryChecksums(data []byte) (map[string]string, error) {
+	checksums := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid checksum line: %q", line)
+		}
+
+		checksum := strings.ToLower(fields[0])
+		if _, err := hex.DecodeString(checksum); err != nil || len(checksum) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid sha256 checksum: %q", fields[0])
+		}
+
+		// binary mode of sha256sum prefixes the filename with `*`
+		filename := strings.TrimPrefix(fields[1], "*")
+		checksums[filename] = checksum
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return checksums, nil
+}
+
+// CheckBinaryChecksum makes sure the content of the binary matches the checksum file
+func CheckBinaryChecksum(checksums map[string]string, filename string, content []byte) error {
+	expected, ok := checksums[filename]
+	if !ok {
+		return fmt.Errorf("checksum of %s not found", filename)
+	}
+
+	hash := sha256.Sum256(content)
+	if actual := hex.EncodeToString(hash[:]); actual != expected {
+		return fmt.Errorf("checksum mismatch of %s, expected %s, got %s", filename, expected, actual)
+	}
+
+	return nil
+}
+
+// validateGoBinaries makes sure a go plugin carries a binary with a valid checksum for every declared arch
+func (p *Packager) validateGoBinaries(manifest *plugin_entities.PluginDeclaration) error {
+	if manifest.Meta.Runner.Language != constants.Go {
+		return nil
+	}
+
+	checksumFile, err := p.decoder.ReadFile(consts.BINARIES_CHECKSUM_FILE)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("failed to read %s", consts.BINARIES_CHECKSUM_FILE))
+	}
+
+	checksums, err := ParseBinaryChecksums(checksumFile)
+	if err != nil {
+		return err
+	}
+
+	for _, arch := range manifest.Meta.Arch {
+		binaryPath := GoBinaryPath(manifest.Meta.Runner.Entrypoint, arch)
+		binary, err := p.decoder.ReadFile(binaryPath)
+		if err != nil {
+			return errors.Join(err, fmt.Errorf("binary for %s not found, expected %s", arch, binaryPath))
+		}
+
+		if err := CheckBinaryChecksum(checksums, path.Base(binaryPath), binary); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type GoBuildOptions struct {
+	// go toolchain, `go` of PATH is used if empty
+	GoPath string
+	// extra args passed to `go build`
+	ExtraArgs []string
+}
+
+// BuildGoBinaries cross-compiles the go plugin at root for every arch declared in the
+// manifest, binaries and their checksum file are written into the binaries directory
+func BuildGoBinaries(root string, manifest *plugin_entities.PluginDeclaration, options GoBuildOptions) error {
+	if len(manifest.Meta.Arch) == 0 {
+		return errors.New("no arch declared in the manifest")
+	}
+
+	goPath := options.GoPath
+	if goPath == "" {
+		goPath = "go"
+	}
+
+	binariesDir := filepath.Join(root, consts.BINARIES_DIR)
+	if err := os.MkdirAll(binariesDir, 0755); err != nil {
+		return err
+	}
+
+	checksums := map[string]string{}
+	for _, arch := range manifest.Meta.Arch {
+		binaryPath := GoBinaryPath(manifest.Meta.Runner.Entrypoint, arch)
+
+		args := []string{"build", "-trimpath", "-ldflags", "-s -w", "-o", binaryPath}
+		args = append(args, options.ExtraArgs...)
+		args = append(args, ".")
+
+		cmd := exec.Command(goPath, args...)
+		cmd.Dir = root
+		// statically linked binaries run on any linux the daemon runs on
+		cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+string(arch), "CGO_ENABLED=0")
+		output := bytes.NewBuffer(nil)
+		cmd.Stdout = output
+		cmd.Stderr = output
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to build the binary for %s: %s, output: %s", arch, err, output.String())
+		}
+
+		binary, err := os.ReadFile(filepath.Join(root, binaryPath))
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(binary)
+		checksums[path.Base(binaryPath)] = hex.EncodeToString(hash[:])
+	}
+
+	filenames := make([]string, 0, len(checksums))
+	for filename := range checksums {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	checksumFile := strings.Builder{}
+	for _, filename := range filenames {
+		checksumFile.WriteString(fmt.Sprintf("%s  %s\n", checksums[filename], filename))
+	}
+
+	return os.WriteFile(filepath.Join(root, consts.BINARIES_CHECKSUM_FILE), []byte(checksumFile.String()), 0644)
+}
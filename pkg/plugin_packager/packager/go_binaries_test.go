@@ -0,0 +1,33 @@
+package packager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoBinaryPath(t *testing.T) {
+	assert.Equal(t, "bin/main-linux-amd64", GoBinaryPath("main", constants.AMD64))
+	assert.Equal(t, "bin/main-linux-arm64", GoBinaryPath("./main", constants.ARM64))
+}
+
+func TestBinaryChecksums(t *testing.T) {
+	binary := []byte("binary")
+	hash := sha256.Sum256(binary)
+	checksum := hex.EncodeToString(hash[:])
+
+	checksums, err := ParseBinaryChecksums([]byte(checksum + "  main-linux-amd64\n" + checksum + " *main-linux-arm64\n\n"))
+	assert.NoError(t, err)
+	assert.Len(t, checksums, 2)
+
+	assert.NoError(t, CheckBinaryChecksum(checksums, "main-linux-amd64", binary))
+	assert.NoError(t, CheckBinaryChecksum(checksums, "main-linux-arm64", binary))
+	assert.Error(t, CheckBinaryChecksum(checksums, "main-linux-amd64", []byte("tampered")))
+	assert.Error(t, CheckBinaryChecksum(checksums, "other-linux-amd64", binary))
+
+	_, err = ParseBinaryChecksums([]byte("not-a-checksum  main-linux-amd64"))
+	assert.Error(t, err)
+}
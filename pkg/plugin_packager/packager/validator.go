@@ -7,7 +7,7 @@ import (
 
 func (p *Packager) Validate() error {
 	// read manifest
-	_, err := p.fetchManifest()
+	manifest, err := p.fetchManifest()
 	if err != nil {
 		return err
 	}
@@ -18,5 +18,17 @@ func (p *Packager) Validate() error {
 		return errors.Join(err, fmt.Errorf("assets invalid"))
 	}
 
+	// check vendored wheels match the declared arches
+	err = p.validateWheelhouse(manifest)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("wheelhouse invalid"))
+	}
+
+	// check go plugins carry the binaries of the declared arches
+	err = p.validateGoBinaries(manifest)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("binaries invalid"))
+	}
+
 	return nil
 }
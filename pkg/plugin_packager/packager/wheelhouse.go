@@ -0,0 +1,336 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/consts"
+	"github.com/langgenius/dify-plugin-daemon/pkg/plugin_packager/decoder"
+)
+
+const (
+	// python version used to resolve wheels when the manifest doesn't declare one
+	DEFAULT_WHEELHOUSE_PYTHON_VERSION = "3.12"
+)
+
+// platform tags accepted by the glibc based images the plugins are running on
+var archPlatformTags = map[constants.Arch][]string{
+	constants.AMD64: {
+		"manylinux_2_28_x86_64",
+		"manylinux_2_17_x86_64",
+		"manylinux2014_x86_64",
+		"manylinux2010_x86_64",
+		"manylinux1_x86_64",
+	},
+	constants.ARM64: {
+		"manylinux_2_28_aarch64",
+		"manylinux_2_17_aarch64",
+		"manylinux2014_aarch64",
+	},
+}
+
+type WheelhouseOptions struct {
+	// python interpreter used to run `pip download`
+	PythonInterpreter string
+	// package index, PyPI is used if empty
+	IndexUrl string
+	// extra args passed to `pip download`
+	ExtraArgs []string
+}
+
+// BuildWheelhouse downloads the wheels of requirements.txt for every arch declared
+// in the manifest into dest, only binary distributions are accepted as the
+// target machine may not be able to build anything
+func (p *Packager) BuildWheelhouse(dest string, options WheelhouseOptions) error {
+	manifest, err := p.fetchManifest()
+	if err != nil {
+		return err
+	}
+
+	if len(manifest.Meta.Arch) == 0 {
+		return errors.New("no arch declared in the manifest")
+	}
+
+	requirements, err := p.decoder.ReadFile("requirements.txt")
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("failed to read requirements.txt"))
+	}
+
+	tmpDir, err := os.MkdirTemp("", "dify-wheelhouse-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	requirementsPath := filepath.Join(tmpDir, "requirements.txt")
+	if err := os.WriteFile(requirementsPath, requirements, 0644); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	interpreter := options.PythonInterpreter
+	if interpreter == "" {
+		interpreter = "python3"
+	}
+
+	for _, arch := range manifest.Meta.Arch {
+		args, err := wheelhouseDownloadArgs(manifest, arch, requirementsPath, dest, options)
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.Command(interpreter, args...)
+		output := bytes.NewBuffer(nil)
+		cmd.Stdout = output
+		cmd.Stderr = output
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to download wheels for %s: %s, output: %s", arch, err, output.String())
+		}
+	}
+
+	return nil
+}
+
+func wheelhouseDownloadArgs(
+	manifest *plugin_entities.PluginDeclaration,
+	arch constants.Arch,
+	requirementsPath string,
+	dest string,
+	options WheelhouseOptions,
+) ([]string, error) {
+	platforms, ok := archPlatformTags[arch]
+	if !ok {
+		return nil, fmt.Errorf("unsupported arch: %s", arch)
+	}
+
+	pythonVersion := manifest.Meta.Runner.Version
+	if pythonVersion == "" {
+		pythonVersion = DEFAULT_WHEELHOUSE_PYTHON_VERSION
+	}
+
+	args := []string{
+		"-m", "pip", "download",
+		"-r", requirementsPath,
+		"--dest", dest,
+		"--only-binary=:all:",
+		"--implementation", "cp",
+		"--python-version", pythonVersion,
+	}
+	for _, platform := range platforms {
+		args = append(args, "--platform", platform)
+	}
+	if options.IndexUrl != "" {
+		args = append(args, "-i", options.IndexUrl)
+	}
+	args = append(args, options.ExtraArgs...)
+
+	return args, nil
+}
+
+// wheelPlatforms returns the platform tags of a wheel, see PEP 427 for the naming convention
+// {distribution}-{version}(-{build tag})?-{python tag}-{abi tag}-{platform tag}.whl
+func wheelPlatforms(filename string) ([]string, error) {
+	if !strings.HasSuffix(filename, ".whl") {
+		return nil, fmt.Errorf("%s is not a wheel", filename)
+	}
+
+	parts := strings.Split(strings.TrimSuffix(filename, ".whl"), "-")
+	if len(parts) != 5 && len(parts) != 6 {
+		return nil, fmt.Errorf("invalid wheel filename: %s", filename)
+	}
+
+	// compressed tag sets are separated by dots, e.g. manylinux_2_17_x86_64.manylinux2014_x86_64
+	return strings.Split(parts[len(parts)-1], "."), nil
+}
+
+// wheelSupportsArch checks whether a wheel can be installed on linux of the arch
+func wheelSupportsArch(platforms []string, arch constants.Arch) bool {
+	for _, platform := range platforms {
+		if platform == "any" {
+			return true
+		}
+
+		if !strings.HasPrefix(platform, "manylinux") &&
+			!strings.HasPrefix(platform, "musllinux") &&
+			!strings.HasPrefix(platform, "linux") {
+			continue
+		}
+
+		switch arch {
+		case constants.AMD64:
+			if strings.HasSuffix(platform, "_x86_64") {
+				return true
+			}
+		case constants.ARM64:
+			if strings.HasSuffix(platform, "_aarch64") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkWheel makes sure the wheel is usable on at least one of the declared arches
+func checkWheel(filename string, arches []constants.Arch) error {
+	platforms, err := wheelPlatforms(filename)
+	if err != nil {
+		return err
+	}
+
+	for _, arch := range arches {
+		if wheelSupportsArch(platforms, arch) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("wheel %s supports none of the declared arches %v", filename, arches)
+}
+
+func (p *Packager) validateWheelhouse(manifest *plugin_entities.PluginDeclaration) error {
+	return p.decoder.Walk(func(filename, dir string) error {
+		if path.Clean(filepath.ToSlash(dir)) != consts.WHEELHOUSE_DIR {
+			return nil
+		}
+		return checkWheel(filename, manifest.Meta.Arch)
+	})
+}
+
+// ReadWheelhouse reads all wheels of a local wheelhouse directory
+func ReadWheelhouse(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	wheels := map[string][]byte{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".whl") {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		wheels[entry.Name()] = content
+	}
+
+	return wheels, nil
+}
+
+// AddWheels adds wheels to the wheelhouse of a packaged plugin, wheels with the same
+// filename are replaced, the result is unsigned as the content changed and needs
+// to be signed again, the uncompressed size of the result is limited by maxSize like Pack
+func AddWheels(plugin []byte, wheels map[string][]byte, maxSize int64) ([]byte, error) {
+	pluginDecoder, err := decoder.NewZipPluginDecoder(plugin)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := pluginDecoder.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	filenames := make([]string, 0, len(wheels))
+	for filename := range wheels {
+		if filename != path.Base(filename) {
+			return nil, fmt.Errorf("invalid wheel filename: %s", filename)
+		}
+		if err := checkWheel(filename, manifest.Meta.Arch); err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	reader, err := zip.NewReader(bytes.NewReader(plugin), int64(len(plugin)))
+	if err != nil {
+		return nil, err
+	}
+
+	totalSize := int64(0)
+	for _, file := range reader.File {
+		dir, filename := path.Split(file.Name)
+		if _, ok := wheels[filename]; ok && path.Clean(dir) == consts.WHEELHOUSE_DIR {
+			continue
+		}
+		totalSize += int64(file.UncompressedSize64)
+	}
+	for _, filename := range filenames {
+		totalSize += int64(len(wheels[filename]))
+	}
+	if totalSize > maxSize {
+		return nil, fmt.Errorf(
+			"plugin package size is too large with the vendored wheels, %d bytes, please ensure the uncompressed size is less than %d bytes",
+			totalSize, maxSize,
+		)
+	}
+
+	zipBuffer := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(zipBuffer)
+
+	for _, file := range reader.File {
+		if file.Name == consts.VERIFICATION_FILE {
+			// the verification only stands for the original content
+			continue
+		}
+
+		dir, filename := path.Split(file.Name)
+		if path.Clean(dir) == consts.WHEELHOUSE_DIR {
+			if _, ok := wheels[filename]; ok {
+				continue
+			}
+		}
+
+		if err := copyZipFile(zipWriter, file); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, filename := range filenames {
+		fileWriter, err := zipWriter.Create(path.Join(consts.WHEELHOUSE_DIR, filename))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fileWriter.Write(wheels[filename]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return zipBuffer.Bytes(), nil
+}
+
+func copyZipFile(zipWriter *zip.Writer, file *zip.File) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	fileWriter, err := zipWriter.Create(file.Name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fileWriter, reader)
+	return err
+}
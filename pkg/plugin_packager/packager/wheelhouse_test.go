@@ -0,0 +1,48 @@
+package packager
+
+import (
+	"testing"
+
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/constants"
+	"github.com/langgenius/dify-plugin-daemon/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckWheel(t *testing.T) {
+	arches := []constants.Arch{constants.AMD64}
+
+	assert.NoError(t, checkWheel("requests-2.32.3-py3-none-any.whl", arches))
+	assert.NoError(t, checkWheel("pydantic_core-2.27.2-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl", arches))
+	assert.NoError(t, checkWheel("numpy-2.2.1-1-cp312-cp312-musllinux_1_2_x86_64.whl", arches))
+
+	assert.Error(t, checkWheel("pydantic_core-2.27.2-cp312-cp312-manylinux_2_17_aarch64.whl", arches))
+	assert.Error(t, checkWheel("pydantic_core-2.27.2-cp312-cp312-win_amd64.whl", arches))
+	assert.Error(t, checkWheel("pydantic_core-2.27.2-cp312-cp312-macosx_11_0_arm64.whl", []constants.Arch{constants.ARM64}))
+	assert.Error(t, checkWheel("requests-2.32.3.tar.gz", arches))
+	assert.Error(t, checkWheel("requests-py3-none-any.whl", arches))
+}
+
+func TestWheelhouseDownloadArgs(t *testing.T) {
+	manifest := &plugin_entities.PluginDeclaration{}
+	manifest.Meta.Runner.Version = "3.11"
+
+	args, err := wheelhouseDownloadArgs(manifest, constants.ARM64, "requirements.txt", "wheels", WheelhouseOptions{
+		IndexUrl: "https://mirror.example.com/simple",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"-m", "pip", "download",
+		"-r", "requirements.txt",
+		"--dest", "wheels",
+		"--only-binary=:all:",
+		"--implementation", "cp",
+		"--python-version", "3.11",
+		"--platform", "manylinux_2_28_aarch64",
+		"--platform", "manylinux_2_17_aarch64",
+		"--platform", "manylinux2014_aarch64",
+		"-i", "https://mirror.example.com/simple",
+	}, args)
+
+	_, err = wheelhouseDownloadArgs(manifest, constants.Arch("riscv64"), "requirements.txt", "wheels", WheelhouseOptions{})
+	assert.Error(t, err)
+}
@@ -537,3 +537,70 @@ func TestVerifyPluginWithThirdPartyKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestAddWheelsAndResign(t *testing.T) {
+	privateKey := loadPrivateKeyFile(t, "test_key_pair_1.private.pem")
+	publicKey := loadPublicKeyFile(t, "test_key_pair_1.public.pem")
+
+	zip := createMinimalPlugin(t)
+	if zip == nil {
+		return
+	}
+
+	signed, err := withkey.SignPluginWithPrivateKey(zip, &decoder.Verification{
+		AuthorizedCategory: decoder.AUTHORIZED_CATEGORY_LANGGENIUS,
+	}, privateKey)
+	if err != nil {
+		t.Fatalf("failed to sign: %s", err.Error())
+	}
+
+	wheel := "requests-2.32.3-py3-none-any.whl"
+	withWheels, err := packager.AddWheels(signed, map[string][]byte{wheel: []byte("wheel")}, 52428800)
+	if err != nil {
+		t.Fatalf("failed to add wheels: %s", err.Error())
+	}
+
+	wheelsDecoder, err := decoder.NewZipPluginDecoder(withWheels)
+	if err != nil {
+		t.Fatalf("failed to create zip decoder: %s", err.Error())
+	}
+
+	// the content changed, the original signature must be gone
+	if err := decoder.VerifyPluginWithPublicKeys(wheelsDecoder, []*rsa.PublicKey{publicKey}); err == nil {
+		t.Fatalf("package with added wheels should not be verified")
+	}
+
+	content, err := wheelsDecoder.ReadFile("wheels/" + wheel)
+	if err != nil || string(content) != "wheel" {
+		t.Fatalf("wheel not found in the package: %v", err)
+	}
+
+	// wheels not installable on any declared arch are rejected
+	if _, err := packager.AddWheels(signed, map[string][]byte{
+		"pydantic_core-2.27.2-cp312-cp312-win_amd64.whl": []byte("wheel"),
+	}, 52428800); err == nil {
+		t.Fatalf("should reject wheels of unsupported platforms")
+	}
+
+	// the vendored wheels count towards the size limit of the package
+	if _, err := packager.AddWheels(signed, map[string][]byte{
+		wheel: make([]byte, 2048),
+	}, 1024); err == nil {
+		t.Fatalf("should reject wheels exceeding the package size limit")
+	}
+
+	resigned, err := withkey.SignPluginWithPrivateKey(withWheels, &decoder.Verification{
+		AuthorizedCategory: decoder.AUTHORIZED_CATEGORY_LANGGENIUS,
+	}, privateKey)
+	if err != nil {
+		t.Fatalf("failed to sign again: %s", err.Error())
+	}
+
+	resignedDecoder, err := decoder.NewZipPluginDecoder(resigned)
+	if err != nil {
+		t.Fatalf("failed to create zip decoder: %s", err.Error())
+	}
+	if err := decoder.VerifyPluginWithPublicKeys(resignedDecoder, []*rsa.PublicKey{publicKey}); err != nil {
+		t.Fatalf("failed to verify the signed package: %s", err.Error())
+	}
+}